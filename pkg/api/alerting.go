@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/grafana/grafana/pkg/api/dtos"
 	"github.com/grafana/grafana/pkg/api/response"
@@ -163,11 +164,79 @@ func (hs *HTTPServer) AlertTest(c *models.ReqContext, dto dtos.AlertTestCommand)
 		dtoRes.EvalMatches = append(dtoRes.EvalMatches, &dtos.EvalMatch{Metric: match.Metric, Value: match.Value})
 	}
 
+	dtoRes.Queries = toAlertQueryTraces(res.QueryTraces)
+
 	dtoRes.TimeMs = fmt.Sprintf("%1.3fms", res.GetDurationMs())
 
 	return response.JSON(200, dtoRes)
 }
 
+// GET /api/alerts/:alertId/last-evaluation
+func (hs *HTTPServer) GetAlertLastEvaluation(c *models.ReqContext) response.Response {
+	id := c.ParamsInt64(":alertId")
+
+	res, ok := hs.AlertEngine.LastEvaluation(c.OrgId, id)
+	if !ok {
+		return response.Error(404, "Alert has not been evaluated by this instance", nil)
+	}
+
+	dtoRes := &dtos.AlertLastEvaluation{
+		AlertId:        res.RuleID,
+		Firing:         res.Firing,
+		State:          res.State,
+		ConditionEvals: res.ConditionEvals,
+		EvalDate:       res.EndTime,
+		TimeMs:         fmt.Sprintf("%1.3fms", float64(res.EndTime.Sub(res.StartTime))/float64(time.Millisecond)),
+		Queries:        toAlertQueryTraces(res.QueryTraces),
+	}
+
+	if res.Error != nil {
+		dtoRes.Error = res.Error.Error()
+	}
+
+	for _, match := range res.EvalMatches {
+		dtoRes.EvalMatches = append(dtoRes.EvalMatches, &dtos.EvalMatch{Metric: match.Metric, Value: match.Value})
+	}
+
+	return response.JSON(200, dtoRes)
+}
+
+// GET /api/alerts/lagging
+func (hs *HTTPServer) GetLaggingAlerts(c *models.ReqContext) response.Response {
+	result := make([]*dtos.LaggingAlert, 0)
+	for _, rule := range hs.AlertEngine.LaggingRules() {
+		if rule.OrgID != c.OrgId {
+			continue
+		}
+		result = append(result, &dtos.LaggingAlert{
+			AlertId:           rule.RuleID,
+			Name:              rule.Name,
+			FrequencySeconds:  rule.Frequency.Seconds(),
+			AverageDurationMs: float64(rule.AverageDuration) / float64(time.Millisecond),
+		})
+	}
+
+	return response.JSON(200, result)
+}
+
+func toAlertQueryTraces(traces []*alerting.QueryTrace) []*dtos.AlertQueryTrace {
+	var result []*dtos.AlertQueryTrace
+	for _, trace := range traces {
+		dtoTrace := &dtos.AlertQueryTrace{
+			ConditionIndex:  trace.ConditionIndex,
+			DatasourceID:    trace.DatasourceID,
+			Query:           trace.Query,
+			Series:          make([]*dtos.AlertSeriesTrace, 0, len(trace.Series)),
+			TruncatedSeries: trace.TruncatedSeries,
+		}
+		for _, series := range trace.Series {
+			dtoTrace.Series = append(dtoTrace.Series, &dtos.AlertSeriesTrace{Metric: series.Metric, Value: series.Value, Matched: series.Matched})
+		}
+		result = append(result, dtoTrace)
+	}
+	return result
+}
+
 // GET /api/alerts/:id
 func GetAlert(c *models.ReqContext) response.Response {
 	id := c.ParamsInt64(":alertId")
@@ -503,6 +572,41 @@ func PauseAlert(c *models.ReqContext, dto dtos.PauseAlertCommand) response.Respo
 	return response.JSON(200, result)
 }
 
+// POST /api/alerts/:alertId/reset-state
+func (hs *HTTPServer) ResetAlertState(c *models.ReqContext, dto dtos.ResetAlertStateCommand) response.Response {
+	alertID := c.ParamsInt64("alertId")
+
+	query := models.GetAlertByIdQuery{Id: alertID}
+	if err := bus.Dispatch(&query); err != nil {
+		return response.Error(500, "Get Alert failed", err)
+	}
+	if query.Result.OrgId != c.OrgId {
+		return response.Error(404, "Alert not found", nil)
+	}
+
+	guardian := guardian.New(query.Result.DashboardId, c.OrgId, c.SignedInUser)
+	if canEdit, err := guardian.CanEdit(); err != nil || !canEdit {
+		if err != nil {
+			return response.Error(500, "Error while checking permissions for Alert", err)
+		}
+
+		return response.Error(403, "Access denied to this dashboard and alert", nil)
+	}
+
+	if err := hs.AlertEngine.ResetRuleState(c.OrgId, alertID, dto.State); err != nil {
+		if errors.Is(err, alerting.ErrInvalidResetState) || errors.Is(err, models.ErrCannotChangeStateOnPausedAlert) {
+			return response.Error(400, err.Error(), nil)
+		}
+		return response.Error(500, "Failed to reset alert state", err)
+	}
+
+	return response.JSON(200, util.DynMap{
+		"alertId": alertID,
+		"state":   dto.State,
+		"message": "Alert state reset",
+	})
+}
+
 // POST /api/admin/pause-all-alerts
 func PauseAllAlerts(c *models.ReqContext, dto dtos.PauseAllAlertsCommand) response.Response {
 	updateCmd := models.PauseAllAlertCommand{
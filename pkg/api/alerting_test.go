@@ -20,7 +20,7 @@ type setUpConf struct {
 }
 
 func TestAlertingAPIEndpoint(t *testing.T) {
-	singleAlert := &models.Alert{Id: 1, DashboardId: 1, Name: "singlealert"}
+	singleAlert := &models.Alert{Id: 1, OrgId: testOrgID, DashboardId: 1, Name: "singlealert"}
 	viewerRole := models.ROLE_VIEWER
 	editorRole := models.ROLE_EDITOR
 
@@ -80,6 +80,46 @@ func TestAlertingAPIEndpoint(t *testing.T) {
 			})
 	})
 
+	t.Run("When user is editor and not in the ACL resetting the alert state is denied", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		hs := &HTTPServer{}
+		sc := setupScenarioContext(t, "/api/alerts/1/reset-state")
+		sc.defaultHandler = routing.Wrap(func(c *models.ReqContext) response.Response {
+			sc.context = c
+			sc.context.UserId = testUserID
+			sc.context.OrgId = testOrgID
+			sc.context.OrgRole = models.ROLE_EDITOR
+
+			return hs.ResetAlertState(c, dtos.ResetAlertStateCommand{State: models.AlertStateOK})
+		})
+		sc.m.Post("/api/alerts/:alertId/reset-state", sc.defaultHandler)
+		setUp()
+
+		sc.fakeReqWithParams("POST", sc.url, map[string]string{}).exec()
+		assert.Equal(t, 403, sc.resp.Code)
+	})
+
+	t.Run("When user is admin of another org resetting the alert state is not found", func(t *testing.T) {
+		defer bus.ClearBusHandlers()
+
+		hs := &HTTPServer{}
+		sc := setupScenarioContext(t, "/api/alerts/1/reset-state")
+		sc.defaultHandler = routing.Wrap(func(c *models.ReqContext) response.Response {
+			sc.context = c
+			sc.context.UserId = testUserID
+			sc.context.OrgId = testOrgID + 1
+			sc.context.OrgRole = models.ROLE_ADMIN
+
+			return hs.ResetAlertState(c, dtos.ResetAlertStateCommand{State: models.AlertStateOK})
+		})
+		sc.m.Post("/api/alerts/:alertId/reset-state", sc.defaultHandler)
+		setUp()
+
+		sc.fakeReqWithParams("POST", sc.url, map[string]string{}).exec()
+		assert.Equal(t, 404, sc.resp.Code)
+	})
+
 	loggedInUserScenarioWithRole(t, "When calling GET on", "GET", "/api/alerts?dashboardId=1", "/api/alerts",
 		models.ROLE_EDITOR, func(sc *scenarioContext) {
 			setUp()
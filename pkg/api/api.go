@@ -374,9 +374,12 @@ func (hs *HTTPServer) registerRoutes() {
 		apiRoute.Group("/alerts", func(alertsRoute routing.RouteRegister) {
 			alertsRoute.Post("/test", bind(dtos.AlertTestCommand{}), routing.Wrap(hs.AlertTest))
 			alertsRoute.Post("/:alertId/pause", reqEditorRole, bind(dtos.PauseAlertCommand{}), routing.Wrap(PauseAlert))
+			alertsRoute.Post("/:alertId/reset-state", reqEditorRole, bind(dtos.ResetAlertStateCommand{}), routing.Wrap(hs.ResetAlertState))
 			alertsRoute.Get("/:alertId", ValidateOrgAlert, routing.Wrap(GetAlert))
+			alertsRoute.Get("/:alertId/last-evaluation", ValidateOrgAlert, routing.Wrap(hs.GetAlertLastEvaluation))
 			alertsRoute.Get("/", routing.Wrap(GetAlerts))
 			alertsRoute.Get("/states-for-dashboard", routing.Wrap(GetAlertStatesForDashboard))
+			alertsRoute.Get("/lagging", routing.Wrap(hs.GetLaggingAlerts))
 		})
 
 		apiRoute.Get("/alert-notifiers", reqEditorRole, routing.Wrap(
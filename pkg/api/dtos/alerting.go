@@ -102,9 +102,43 @@ type AlertTestResult struct {
 	TimeMs         string                `json:"timeMs"`
 	Error          string                `json:"error,omitempty"`
 	EvalMatches    []*EvalMatch          `json:"matches,omitempty"`
+	Queries        []*AlertQueryTrace    `json:"queries,omitempty"`
 	Logs           []*AlertTestResultLog `json:"logs,omitempty"`
 }
 
+type LaggingAlert struct {
+	AlertId           int64   `json:"alertId"`
+	Name              string  `json:"name"`
+	FrequencySeconds  float64 `json:"frequencySeconds"`
+	AverageDurationMs float64 `json:"averageDurationMs"`
+}
+
+type AlertQueryTrace struct {
+	ConditionIndex  int                 `json:"conditionIndex"`
+	DatasourceID    int64               `json:"datasourceId"`
+	Query           string              `json:"query"`
+	Series          []*AlertSeriesTrace `json:"series"`
+	TruncatedSeries int                 `json:"truncatedSeries,omitempty"`
+}
+
+type AlertSeriesTrace struct {
+	Metric  string     `json:"metric"`
+	Value   null.Float `json:"value"`
+	Matched bool       `json:"matched"`
+}
+
+type AlertLastEvaluation struct {
+	AlertId        int64                 `json:"alertId"`
+	Firing         bool                  `json:"firing"`
+	State          models.AlertStateType `json:"state"`
+	ConditionEvals string                `json:"conditionEvals"`
+	EvalDate       time.Time             `json:"evalDate"`
+	TimeMs         string                `json:"timeMs"`
+	Error          string                `json:"error,omitempty"`
+	EvalMatches    []*EvalMatch          `json:"matches,omitempty"`
+	Queries        []*AlertQueryTrace    `json:"queries,omitempty"`
+}
+
 type AlertTestResultLog struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
@@ -132,6 +166,10 @@ type PauseAlertCommand struct {
 	Paused  bool  `json:"paused"`
 }
 
+type ResetAlertStateCommand struct {
+	State models.AlertStateType `json:"state"`
+}
+
 type PauseAllAlertsCommand struct {
 	Paused bool `json:"paused"`
 }
@@ -85,6 +85,12 @@ var (
 	// MAlertingNotificationSent is a metric counter for how many alert notifications that failed
 	MAlertingNotificationFailed *prometheus.CounterVec
 
+	// MAlertingNotificationDuration is a metric summary of the delivery duration of alert notifications by notifier type
+	MAlertingNotificationDuration *prometheus.SummaryVec
+
+	// MAlertingClusteringSkippedTicks is a metric counter for how many scheduler ticks were skipped by a standby instance
+	MAlertingClusteringSkippedTicks prometheus.Counter
+
 	// MAwsCloudWatchGetMetricStatistics is a metric counter for getting metric statistics from aws
 	MAwsCloudWatchGetMetricStatistics prometheus.Counter
 
@@ -133,6 +139,63 @@ var (
 	// MAlertingActiveAlerts is a metric amount of active alerts
 	MAlertingActiveAlerts prometheus.Gauge
 
+	// MAlertingFlappingAlerts is a metric amount of alerts currently detected as flapping
+	MAlertingFlappingAlerts prometheus.Gauge
+
+	// MAlertingResultQueueDepth is a metric amount of alert results waiting to be handled
+	MAlertingResultQueueDepth prometheus.Gauge
+
+	// MAlertingLaggingRules is a metric amount of alert rules whose evaluation lags behind their frequency
+	MAlertingLaggingRules prometheus.Gauge
+
+	// MAlertingStaleRules is a metric amount of alert rules not evaluated for several times their frequency
+	MAlertingStaleRules prometheus.Gauge
+
+	// MAlertingActiveInstance is a metric set to 1 on the active cluster alerting instance and 0 on standbys
+	MAlertingActiveInstance *prometheus.GaugeVec
+
+	// MAlertingClusteringDegraded is a metric set to 1 while the active cluster alerting instance cannot be retrieved
+	MAlertingClusteringDegraded prometheus.Gauge
+
+	// MAlertingEvaluationsPerSecond is a metric rate of alert evaluations over the last minute
+	MAlertingEvaluationsPerSecond prometheus.Gauge
+
+	// MAlertingExecQueueWait is a metric average time alert jobs waited on the exec queue over the last minute
+	MAlertingExecQueueWait prometheus.Gauge
+
+	// MAlertingExecQueueDepth is a metric amount of alert jobs waiting to be evaluated
+	MAlertingExecQueueDepth prometheus.Gauge
+
+	// MAlertingWorkerBusyRatio is a metric average share of the in-flight cost budget used over the last minute
+	MAlertingWorkerBusyRatio prometheus.Gauge
+
+	// MAlertingSchedulerBackpressure is a metric counter for alert jobs deferred because the exec queue was full
+	MAlertingSchedulerBackpressure prometheus.Counter
+
+	// MAlertingEvalEventsDropped is a metric counter for evaluation events dropped because the publish buffer was full
+	MAlertingEvalEventsDropped prometheus.Counter
+
+	// MAlertingStatePointsDropped is a metric counter for state points dropped because the write buffer was full
+	MAlertingStatePointsDropped prometheus.Counter
+
+	// MAlertingDegradedEvaluations is a metric counter for alert evaluations exceeding the soft timeout
+	MAlertingDegradedEvaluations prometheus.Counter
+
+	// MAlertingNotificationsRateLimited is a metric counter for notifications dropped by the global notification rate limit
+	MAlertingNotificationsRateLimited prometheus.Counter
+
+	// MAlertingRuleExecutionTime is a metric summary of alert execution duration by rule
+	MAlertingRuleExecutionTime *prometheus.SummaryVec
+
+	// MAlertingRuleEvaluationFailures is a metric counter for failed alert evaluations by rule
+	MAlertingRuleEvaluationFailures *prometheus.CounterVec
+
+	// MAlertingShadowVerdicts is a metric counter for the verdicts of the shadow conditions of the alert rules
+	MAlertingShadowVerdicts *prometheus.CounterVec
+
+	// MAlertingAbandonedEvaluations is a metric counter for alert evaluations abandoned because they were stuck past their timeout
+	MAlertingAbandonedEvaluations prometheus.Counter
+
 	// MStatTotalDashboards is a metric total amount of dashboards
 	MStatTotalDashboards prometheus.Gauge
 
@@ -352,6 +415,19 @@ func init() {
 		Namespace: ExporterName,
 	}, []string{"type"})
 
+	MAlertingNotificationDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name:       "alerting_notification_duration_milliseconds",
+		Help:       "summary of alert notification delivery duration by notifier type, retries included",
+		Objectives: objectiveMap,
+		Namespace:  ExporterName,
+	}, []string{"type"})
+
+	MAlertingClusteringSkippedTicks = newCounterStartingAtZero(prometheus.CounterOpts{
+		Name:      "alerting_clustering_skipped_ticks_total",
+		Help:      "counter for how many scheduler ticks were skipped by a standby cluster alerting instance",
+		Namespace: ExporterName,
+	})
+
 	MAwsCloudWatchGetMetricStatistics = newCounterStartingAtZero(prometheus.CounterOpts{
 		Name:      "aws_cloudwatch_get_metric_statistics_total",
 		Help:      "counter for getting metric statistics from aws",
@@ -428,6 +504,121 @@ func init() {
 		Namespace: ExporterName,
 	})
 
+	MAlertingFlappingAlerts = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "alerting_flapping_alerts",
+		Help:      "amount of alerts currently flapping",
+		Namespace: ExporterName,
+	})
+
+	MAlertingResultQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "alerting_result_queue_depth",
+		Help:      "amount of alert results waiting to be handled",
+		Namespace: ExporterName,
+	})
+
+	MAlertingLaggingRules = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "alerting_lagging_rules",
+		Help:      "amount of alert rules whose evaluation lags behind their frequency",
+		Namespace: ExporterName,
+	})
+
+	MAlertingStaleRules = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "alerting_stale_rules",
+		Help:      "amount of alert rules not evaluated for several times their frequency",
+		Namespace: ExporterName,
+	})
+
+	MAlertingActiveInstance = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "alerting_active_instance",
+		Help:      "set to 1 on the active cluster alerting instance and 0 on standbys",
+		Namespace: ExporterName,
+	}, []string{"instance"})
+
+	MAlertingClusteringDegraded = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "alerting_clustering_degraded",
+		Help:      "set to 1 while the active cluster alerting instance cannot be retrieved from the remote cache",
+		Namespace: ExporterName,
+	})
+
+	MAlertingEvaluationsPerSecond = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "alerting_evaluations_per_second",
+		Help:      "rate of alert evaluations over the last minute",
+		Namespace: ExporterName,
+	})
+
+	MAlertingExecQueueWait = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "alerting_exec_queue_wait_seconds",
+		Help:      "average time alert jobs waited on the exec queue over the last minute",
+		Namespace: ExporterName,
+	})
+
+	MAlertingExecQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "alerting_exec_queue_depth",
+		Help:      "amount of alert jobs waiting to be evaluated",
+		Namespace: ExporterName,
+	})
+
+	MAlertingWorkerBusyRatio = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name:      "alerting_worker_busy_ratio",
+		Help:      "average share of the in-flight cost budget used over the last minute",
+		Namespace: ExporterName,
+	})
+
+	MAlertingSchedulerBackpressure = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:      "alerting_scheduler_backpressure_total",
+		Help:      "counter for alert jobs deferred to the next tick because the exec queue was full",
+		Namespace: ExporterName,
+	})
+
+	MAlertingEvalEventsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:      "alerting_eval_events_dropped_total",
+		Help:      "counter for evaluation events dropped because the publish buffer was full",
+		Namespace: ExporterName,
+	})
+
+	MAlertingStatePointsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:      "alerting_state_points_dropped_total",
+		Help:      "counter for state points dropped because the write buffer was full",
+		Namespace: ExporterName,
+	})
+
+	MAlertingDegradedEvaluations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:      "alerting_degraded_evaluations_total",
+		Help:      "counter for alert evaluations completing after the soft timeout",
+		Namespace: ExporterName,
+	})
+
+	MAlertingNotificationsRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:      "alerting_notifications_rate_limited_total",
+		Help:      "counter for notifications dropped by the global notification rate limit",
+		Namespace: ExporterName,
+	})
+
+	MAlertingRuleExecutionTime = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name:       "alerting_rule_execution_time_milliseconds",
+		Help:       "summary of alert execution duration by rule",
+		Objectives: objectiveMap,
+		Namespace:  ExporterName,
+	}, []string{"rule"})
+
+	MAlertingRuleEvaluationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "alerting_rule_failed_evaluations_total",
+		Help:      "counter for failed alert evaluations by rule",
+		Namespace: ExporterName,
+	}, []string{"rule"})
+
+	MAlertingShadowVerdicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:      "alerting_shadow_verdicts_total",
+		Help:      "counter for the verdicts of the shadow conditions of the alert rules",
+		Namespace: ExporterName,
+	}, []string{"verdict"})
+
+	MAlertingAbandonedEvaluations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name:      "alerting_abandoned_evaluations_total",
+		Help:      "counter for alert evaluations abandoned because they were stuck past their timeout",
+		Namespace: ExporterName,
+	})
+
 	MStatTotalDashboards = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name:      "stat_totals_dashboard",
 		Help:      "total amount of dashboards",
@@ -629,6 +820,8 @@ func initMetricVars() {
 		MAlertingResultState,
 		MAlertingNotificationSent,
 		MAlertingNotificationFailed,
+		MAlertingNotificationDuration,
+		MAlertingClusteringSkippedTicks,
 		MAwsCloudWatchGetMetricStatistics,
 		MAwsCloudWatchListMetrics,
 		MAwsCloudWatchGetMetricData,
@@ -640,6 +833,25 @@ func initMetricVars() {
 		MAccessPermissionsSummary,
 		MAccessEvaluationsSummary,
 		MAlertingActiveAlerts,
+		MAlertingFlappingAlerts,
+		MAlertingResultQueueDepth,
+		MAlertingLaggingRules,
+		MAlertingStaleRules,
+		MAlertingActiveInstance,
+		MAlertingClusteringDegraded,
+		MAlertingEvaluationsPerSecond,
+		MAlertingExecQueueWait,
+		MAlertingExecQueueDepth,
+		MAlertingWorkerBusyRatio,
+		MAlertingSchedulerBackpressure,
+		MAlertingEvalEventsDropped,
+		MAlertingStatePointsDropped,
+		MAlertingDegradedEvaluations,
+		MAlertingNotificationsRateLimited,
+		MAlertingRuleExecutionTime,
+		MAlertingRuleEvaluationFailures,
+		MAlertingShadowVerdicts,
+		MAlertingAbandonedEvaluations,
 		MStatTotalDashboards,
 		MStatTotalFolders,
 		MStatTotalUsers,
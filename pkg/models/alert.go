@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 type AlertStateType string
@@ -18,6 +19,10 @@ const (
 	AlertStateOK       AlertStateType = "ok"
 	AlertStatePending  AlertStateType = "pending"
 	AlertStateUnknown  AlertStateType = "unknown"
+	// AlertStateConfigError is the state of the rules which cannot be
+	// evaluated until their configuration is fixed, e.g. the ones querying
+	// a deleted datasource.
+	AlertStateConfigError AlertStateType = "config_error"
 )
 
 const (
@@ -43,7 +48,8 @@ func (s AlertStateType) IsValid() bool {
 		s == AlertStatePaused ||
 		s == AlertStatePending ||
 		s == AlertStateAlerting ||
-		s == AlertStateUnknown
+		s == AlertStateUnknown ||
+		s == AlertStateConfigError
 }
 
 func (s NoDataOption) IsValid() bool {
@@ -147,6 +153,11 @@ type PauseAllAlertCommand struct {
 	Paused      bool
 }
 
+// ReloadAlertingSettingsCommand applies the alerting settings of Cfg to the running alerting engine.
+type ReloadAlertingSettingsCommand struct {
+	Cfg *setting.Cfg
+}
+
 type SetAlertStateCommand struct {
 	AlertId  int64
 	OrgId    int64
@@ -176,6 +187,8 @@ type GetAllAlertsQuery struct {
 
 type GetAlertByIdQuery struct {
 	Id int64
+	// OrgId restricts the query to the alerts of the org when set.
+	OrgId int64
 
 	Result *Alert
 }
@@ -384,6 +384,14 @@ type GetDashboardQuery struct {
 	Result *Dashboard
 }
 
+// GetProvisionedDashboardDataQuery returns the provisioning metadata of a
+// dashboard, nil when the dashboard is not provisioned.
+type GetProvisionedDashboardDataQuery struct {
+	DashboardId int64
+
+	Result *DashboardProvisioning
+}
+
 type DashboardTagCloudItem struct {
 	Term  string `json:"term"`
 	Count int    `json:"count"`
@@ -1,6 +1,9 @@
 package models
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 var ErrInvalidEmailCode = errors.New("invalid or expired email code")
 var ErrSmtpNotEnabled = errors.New("SMTP not configured, check your grafana.ini config file's [smtp] section")
@@ -47,3 +50,28 @@ type ValidateResetPasswordCodeQuery struct {
 	Code   string
 	Result *User
 }
+
+type notificationRecorderKey struct{}
+
+// NotificationRecorder receives the notifications dispatched with a context
+// it is set on, instead of them being sent, e.g. to render the payloads of
+// the alert notifiers. The messages are SendWebhookSync and
+// SendEmailCommandSync commands.
+type NotificationRecorder func(msg interface{})
+
+// WithNotificationRecorder returns a context the notifications dispatched
+// with are recorded by the recorder rather than sent.
+func WithNotificationRecorder(ctx context.Context, recorder NotificationRecorder) context.Context {
+	return context.WithValue(ctx, notificationRecorderKey{}, recorder)
+}
+
+// RecordNotification records the notification if the context has a
+// recorder, and returns true if it did, in which case it must not be sent.
+func RecordNotification(ctx context.Context, msg interface{}) bool {
+	recorder, ok := ctx.Value(notificationRecorderKey{}).(NotificationRecorder)
+	if !ok || recorder == nil {
+		return false
+	}
+	recorder(msg)
+	return true
+}
@@ -0,0 +1,37 @@
+package alerting
+
+import "fmt"
+
+// AggregationMode is how the verdicts of the series of a condition are
+// aggregated into the verdict of the condition.
+type AggregationMode string
+
+const (
+	// AggregationAny fires the condition when any of its series breaches.
+	AggregationAny AggregationMode = "any"
+	// AggregationAll fires the condition when all of its series breach.
+	AggregationAll AggregationMode = "all"
+)
+
+// ParseAggregationMode returns the aggregation mode, AggregationAny when it
+// is empty.
+func ParseAggregationMode(mode string) (AggregationMode, error) {
+	switch AggregationMode(mode) {
+	case "", AggregationAny:
+		return AggregationAny, nil
+	case AggregationAll:
+		return AggregationAll, nil
+	default:
+		return "", fmt.Errorf("unknown aggregation mode %q, must be %q or %q", mode, AggregationAny, AggregationAll)
+	}
+}
+
+// aggregatedFiring returns the verdict of the condition across its series
+// according to its aggregation mode. The conditions without series keep
+// their own verdict, e.g. the one on no value.
+func (cr *ConditionResult) aggregatedFiring() bool {
+	if cr.AggregationMode != AggregationAll || cr.SeriesCount == 0 {
+		return cr.Firing
+	}
+	return len(cr.EvalMatches) == cr.SeriesCount
+}
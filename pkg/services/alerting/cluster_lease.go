@@ -0,0 +1,135 @@
+package alerting
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+)
+
+const clusterLeaseKey = "cluster_alerting_instance"
+
+// ClusterLease elects the active cluster alerting instance.
+type ClusterLease interface {
+	// Acquire acquires or renews the lease for the instance and returns
+	// the instance holding the lease. It returns an error when the holder
+	// of the lease cannot be determined.
+	Acquire(instance string) (string, error)
+}
+
+// cacheLease is a ClusterLease stored in the remote cache.
+//
+// The holder renews the lease by bumping a renewal counter, and the other
+// instances take the lease over once they observed no renewal for the
+// timeout, measured with their own clock. As no timestamps written by
+// another instance are ever compared with the local clock, the leadership
+// does not depend on the clocks of the instances being synchronized.
+type cacheLease struct {
+	mtx     sync.Mutex
+	cache   remotecache.CacheStorage
+	timeout time.Duration
+	clock   clock.Clock
+	log     log.Logger
+
+	// observed is the last record of another holder seen by this instance
+	// and observedAt the local time it was first seen.
+	observed   *ClusterAlertingInstance
+	observedAt time.Time
+
+	// backoff is the time waited between the checks of the lease while
+	// another instance holds it, plus a random jitter so that the other
+	// instances don't all check at the same time.
+	backoff   time.Duration
+	jitter    func(max time.Duration) time.Duration
+	nextCheck time.Time
+}
+
+func newCacheLease(cache remotecache.CacheStorage, timeout time.Duration, clock clock.Clock) *cacheLease {
+	return &cacheLease{
+		cache:   cache,
+		timeout: timeout,
+		clock:   clock,
+		log:     log.New("alerting.clusterLease"),
+		jitter: func(max time.Duration) time.Duration {
+			return time.Duration(rand.Int63n(int64(max)/2 + 1))
+		},
+	}
+}
+
+func (l *cacheLease) Acquire(instance string) (string, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.observed != nil && l.clock.Now().Before(l.nextCheck) {
+		return l.observed.Instance, nil
+	}
+
+	record, err := l.cache.Get(clusterLeaseKey)
+	if err != nil && !errors.Is(err, remotecache.ErrCacheItemNotFound) {
+		return "", err
+	}
+
+	current, ok := record.(*ClusterAlertingInstance)
+	renewals := int64(0)
+	if ok && current.Instance == instance {
+		renewals = current.Renewals + 1
+	} else if ok {
+		now := l.clock.Now()
+		if l.observed == nil || *l.observed != *current {
+			// the holder renewed the lease since we last looked
+			observed := *current
+			l.observed = &observed
+			l.observedAt = now
+			l.scheduleCheck(now)
+			return current.Instance, nil
+		}
+		if now.Sub(l.observedAt) < l.timeout {
+			l.scheduleCheck(now)
+			return current.Instance, nil
+		}
+		l.log.Info("Alert Clustering: Taking over the lease of an instance which stopped renewing it", "instance", instance, "previous", current.Instance)
+	}
+
+	l.observed = nil
+	// the cache TTL only cleans up the records of stopped clusters, it is
+	// long enough for the expiry to be decided by the renewals instead.
+	err = l.cache.Set(clusterLeaseKey, &ClusterAlertingInstance{Instance: instance, Renewals: renewals}, 2*l.timeout)
+	if err != nil {
+		l.log.Warn("Alert Clustering: Could not set the cluster_alerting_instance in cache", "err", err)
+	}
+	return instance, nil
+}
+
+// scheduleCheck sets the time of the next check of the lease held by another
+// instance, which is no later than the time the lease can be taken over.
+func (l *cacheLease) scheduleCheck(now time.Time) {
+	if l.backoff <= 0 {
+		return
+	}
+	next := now.Add(l.backoff)
+	if expiry := l.observedAt.Add(l.timeout); next.After(expiry) {
+		next = expiry
+	}
+	l.nextCheck = next.Add(l.jitter(l.backoff))
+}
+
+// setBackoff changes the time waited between the checks of the lease
+// while another instance holds it.
+func (l *cacheLease) setBackoff(backoff time.Duration) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.backoff = backoff
+	l.nextCheck = time.Time{}
+}
+
+// setTimeout changes the time a holder needs to stop renewing the lease
+// for before it is taken over.
+func (l *cacheLease) setTimeout(timeout time.Duration) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.timeout = timeout
+}
@@ -0,0 +1,145 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheLease(t *testing.T) {
+	const timeout = time.Minute
+
+	t.Run("leadership is stable with skewed clocks", func(t *testing.T) {
+		cache := newFakeClusterCache()
+		cacheClock := cache.clock.(*clock.Mock)
+
+		// instance b is 5 minutes ahead of the cache and its clock runs twice as fast
+		clockA, clockB := clock.NewMock(), clock.NewMock()
+		clockB.Add(5 * time.Minute)
+		leaseA := newCacheLease(cache, timeout, clockA)
+		leaseB := newCacheLease(cache, timeout, clockB)
+
+		holder, err := leaseA.Acquire("instance-a")
+		require.NoError(t, err)
+		require.Equal(t, "instance-a", holder)
+
+		for i := 0; i < 150; i++ {
+			cacheClock.Add(time.Second)
+			clockA.Add(time.Second)
+			clockB.Add(2 * time.Second)
+
+			holder, err := leaseA.Acquire("instance-a")
+			require.NoError(t, err)
+			require.Equal(t, "instance-a", holder)
+
+			holder, err = leaseB.Acquire("instance-b")
+			require.NoError(t, err)
+			require.Equal(t, "instance-a", holder, "instance b took over an active lease after %d ticks", i)
+		}
+	})
+
+	t.Run("lease is taken over once the holder stops renewing it", func(t *testing.T) {
+		cache := newFakeClusterCache()
+		clockA, clockB := clock.NewMock(), clock.NewMock()
+		leaseA := newCacheLease(cache, timeout, clockA)
+		leaseB := newCacheLease(cache, timeout, clockB)
+
+		_, err := leaseA.Acquire("instance-a")
+		require.NoError(t, err)
+
+		holder, err := leaseB.Acquire("instance-b")
+		require.NoError(t, err)
+		require.Equal(t, "instance-a", holder)
+
+		// instance a stopped, the timeout is measured by instance b alone
+		clockB.Add(timeout - time.Second)
+		holder, err = leaseB.Acquire("instance-b")
+		require.NoError(t, err)
+		require.Equal(t, "instance-a", holder)
+
+		clockB.Add(time.Second)
+		holder, err = leaseB.Acquire("instance-b")
+		require.NoError(t, err)
+		require.Equal(t, "instance-b", holder)
+
+		// instance a is back and sees the new holder
+		holder, err = leaseA.Acquire("instance-a")
+		require.NoError(t, err)
+		require.Equal(t, "instance-b", holder)
+	})
+
+	t.Run("lease is acquired when there is no holder", func(t *testing.T) {
+		cache := newFakeClusterCache()
+		lease := newCacheLease(cache, timeout, clock.NewMock())
+
+		holder, err := lease.Acquire("instance-a")
+		require.NoError(t, err)
+		require.Equal(t, "instance-a", holder)
+
+		record, err := cache.Get(clusterLeaseKey)
+		require.NoError(t, err)
+		require.Equal(t, &ClusterAlertingInstance{Instance: "instance-a"}, record)
+
+		_, err = lease.Acquire("instance-a")
+		require.NoError(t, err)
+		record, err = cache.Get(clusterLeaseKey)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), record.(*ClusterAlertingInstance).Renewals)
+	})
+	t.Run("standby instances back off their checks of the lease", func(t *testing.T) {
+		cache := newFakeClusterCache()
+		clockA, clockB := clock.NewMock(), clock.NewMock()
+		leaseA := newCacheLease(cache, timeout, clockA)
+		leaseB := newCacheLease(cache, timeout, clockB)
+		leaseB.setBackoff(10 * time.Second)
+		leaseB.jitter = func(max time.Duration) time.Duration { return max / 2 }
+
+		_, err := leaseA.Acquire("instance-a")
+		require.NoError(t, err)
+
+		// 60 ticks of one second, a check on every tick without the backoff
+		cache.gets = 0
+		for i := 0; i < 60; i++ {
+			clockA.Add(time.Second)
+			clockB.Add(time.Second)
+			_, err := leaseA.Acquire("instance-a")
+			require.NoError(t, err)
+			holder, err := leaseB.Acquire("instance-b")
+			require.NoError(t, err)
+			require.Equal(t, "instance-a", holder)
+		}
+		standbyGets := cache.gets - 60
+		require.LessOrEqual(t, standbyGets, 5, "one check every 15s at most")
+		require.Greater(t, standbyGets, 0)
+	})
+
+	t.Run("standby instances still take over the lease with a backoff", func(t *testing.T) {
+		cache := newFakeClusterCache()
+		clockA, clockB := clock.NewMock(), clock.NewMock()
+		leaseA := newCacheLease(cache, timeout, clockA)
+		leaseB := newCacheLease(cache, timeout, clockB)
+		leaseB.setBackoff(25 * time.Second)
+		leaseB.jitter = func(max time.Duration) time.Duration { return time.Second }
+
+		_, err := leaseA.Acquire("instance-a")
+		require.NoError(t, err)
+		holder, err := leaseB.Acquire("instance-b")
+		require.NoError(t, err)
+		require.Equal(t, "instance-a", holder)
+
+		// instance a stopped, the check is scheduled at the end of the timeout plus the jitter
+		var tookOverAfter time.Duration
+		for elapsed := time.Second; elapsed <= 2*timeout; elapsed += time.Second {
+			clockB.Add(time.Second)
+			holder, err := leaseB.Acquire("instance-b")
+			require.NoError(t, err)
+			if holder == "instance-b" {
+				tookOverAfter = elapsed
+				break
+			}
+		}
+		require.Equal(t, timeout+time.Second, tookOverAfter)
+	})
+}
@@ -0,0 +1,62 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// cacheOutage tracks the consecutive failures to retrieve the active
+// cluster alerting instance from the remote cache. Clustering is degraded
+// once they reach the threshold, and until the active instance can be
+// retrieved again.
+type cacheOutage struct {
+	mtx      sync.Mutex
+	failures int
+	degraded bool
+	since    time.Time
+}
+
+// failed records a failure and returns true if clustering is degraded.
+// A threshold below 2 degrades clustering on the first failure.
+func (o *cacheOutage) failed(now time.Time, threshold int) bool {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	if o.failures == 0 {
+		o.since = now
+	}
+	o.failures++
+	if !o.degraded && o.failures >= threshold {
+		o.degraded = true
+		metrics.MAlertingClusteringDegraded.Set(1)
+	}
+	return o.degraded
+}
+
+// recovered records a success and returns how long clustering was
+// degraded for, zero if it wasn't.
+func (o *cacheOutage) recovered(now time.Time) time.Duration {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+
+	var outage time.Duration
+	if o.degraded {
+		outage = now.Sub(o.since)
+		metrics.MAlertingClusteringDegraded.Set(0)
+	}
+	o.failures = 0
+	o.degraded = false
+	return outage
+}
+
+// ClusteringDegraded returns true if the active cluster alerting instance
+// could not be retrieved from the remote cache for clustering_fail_threshold
+// consecutive ticks, the instance then following clustering_fail_mode until
+// the remote cache is available again.
+func (e *AlertEngine) ClusteringDegraded() bool {
+	e.cacheOutage.mtx.Lock()
+	defer e.cacheOutage.mtx.Unlock()
+	return e.cacheOutage.degraded
+}
@@ -0,0 +1,231 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ruleSelector matches the alert rules whose org, dashboard or rule id
+// falls within an inclusive range.
+type ruleSelector struct {
+	field string
+	min   int64
+	max   int64
+}
+
+func (s ruleSelector) matches(rule *Rule) bool {
+	var value int64
+	switch s.field {
+	case "org":
+		value = rule.OrgID
+	case "dashboard":
+		value = rule.DashboardID
+	case "rule":
+		value = rule.ID
+	}
+	return value >= s.min && value <= s.max
+}
+
+// parseRuleSelectors parses a comma separated list of selectors
+// such as `org=1-10, dashboard=42`.
+func parseRuleSelectors(raw string) ([]ruleSelector, error) {
+	var selectors []ruleSelector
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid rule selector %q", part)
+		}
+
+		field := strings.TrimSpace(kv[0])
+		if field != "org" && field != "dashboard" && field != "rule" {
+			return nil, fmt.Errorf("invalid rule selector %q: unknown field %q", part, field)
+		}
+
+		bounds := strings.SplitN(strings.TrimSpace(kv[1]), "-", 2)
+		min, err := strconv.ParseInt(strings.TrimSpace(bounds[0]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule selector %q: %w", part, err)
+		}
+		max := min
+		if len(bounds) == 2 {
+			if max, err = strconv.ParseInt(strings.TrimSpace(bounds[1]), 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid rule selector %q: %w", part, err)
+			}
+		}
+		if max < min {
+			return nil, fmt.Errorf("invalid rule selector %q: empty range", part)
+		}
+
+		selectors = append(selectors, ruleSelector{field: field, min: min, max: max})
+	}
+	return selectors, nil
+}
+
+// workPartition assigns each alert rule to the cluster alerting instance
+// responsible for evaluating it.
+type workPartition struct {
+	instances []string
+	selectors map[string][]ruleSelector
+	fallback  string
+
+	// mtx guards the weights, which are changed when the settings are reloaded.
+	mtx sync.RWMutex
+	// weights are the capacity weights of the instances sharing the rules
+	// not explicitly assigned, weighted holds their names in order.
+	weights  map[string]float64
+	weighted []string
+}
+
+func newWorkPartition(assignments map[string]string, weights map[string]float64, fallback string) (*workPartition, error) {
+	p := &workPartition{
+		selectors: make(map[string][]ruleSelector, len(assignments)),
+		fallback:  fallback,
+	}
+	if err := p.setWeights(weights); err != nil {
+		return nil, err
+	}
+
+	for instance, raw := range assignments {
+		selectors, err := parseRuleSelectors(raw)
+		if err != nil {
+			return nil, fmt.Errorf("alert clustering assignment of instance %q: %w", instance, err)
+		}
+		p.instances = append(p.instances, instance)
+		p.selectors[instance] = selectors
+	}
+	if len(assignments) > 0 && len(weights) == 0 && fallback == "" {
+		// the rules not matched by any instance would not be evaluated
+		return nil, errors.New("alert clustering assignments require a fallback instance for the rules they don't match")
+	}
+
+	// overlapping selectors are resolved in favor of the first instance in alphabetical order
+	sort.Strings(p.instances)
+	return p, nil
+}
+
+// setWeights changes the capacity weights of the instances sharing the
+// rules not explicitly assigned. Only the rules of the instances removed
+// or whose weight changed move to other instances.
+func (p *workPartition) setWeights(weights map[string]float64) error {
+	weighted := make([]string, 0, len(weights))
+	for instance, weight := range weights {
+		if weight <= 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+			return fmt.Errorf("alert clustering weight of instance %q must be a positive number", instance)
+		}
+		weighted = append(weighted, instance)
+	}
+	sort.Strings(weighted)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.weights = weights
+	p.weighted = weighted
+	return nil
+}
+
+// ownerOf returns the instance evaluating the rule, the instance the rule
+// is pinned to if any. Rules not matched by any instance are shared by the
+// weighted instances, or evaluated by the fallback instance when there are
+// none.
+func (p *workPartition) ownerOf(rule *Rule) string {
+	if rule.PinnedInstance != "" {
+		return rule.PinnedInstance
+	}
+	for _, instance := range p.instances {
+		for _, selector := range p.selectors[instance] {
+			if selector.matches(rule) {
+				return instance
+			}
+		}
+	}
+
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+	if len(p.weighted) == 0 {
+		return p.fallback
+	}
+
+	// weighted rendezvous hashing: every instance draws a score for the rule
+	// scaled by its weight and the highest one wins, so the instances own a
+	// share of the rules proportional to their weight.
+	owner, best := "", math.Inf(-1)
+	for _, instance := range p.weighted {
+		if score := p.weights[instance] / -math.Log(rendezvousHash(instance, rule.ID)); score > best {
+			owner, best = instance, score
+		}
+	}
+	return owner
+}
+
+// rendezvousHash returns the hash of the instance and rule as a number
+// uniformly distributed in the open range (0, 1).
+func rendezvousHash(instance string, ruleID int64) float64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(instance))
+	_, _ = h.Write([]byte("/" + strconv.FormatInt(ruleID, 10)))
+	// mix the bits for the close keys of the rules to spread evenly
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return (float64(x>>11) + 0.5) / (1 << 53)
+}
+
+// assign returns the ids of the rules evaluated by every instance.
+func (p *workPartition) assign(rules []*Rule) map[string][]int64 {
+	assignment := make(map[string][]int64)
+	for _, rule := range rules {
+		owner := p.ownerOf(rule)
+		assignment[owner] = append(assignment[owner], rule.ID)
+	}
+	return assignment
+}
+
+// partitionRules returns the rules assigned to this instance and
+// records the effective assignment of all the rules.
+func (e *AlertEngine) partitionRules(rules []*Rule, instance string) []*Rule {
+	assignment := e.partition.assign(rules)
+
+	e.assignmentLock.Lock()
+	e.assignment = assignment
+	e.assignmentLock.Unlock()
+
+	owned := make([]*Rule, 0, len(assignment[instance]))
+	for _, rule := range rules {
+		if e.partition.ownerOf(rule) == instance {
+			owned = append(owned, rule)
+		}
+	}
+	return owned
+}
+
+// ClusterAssignment returns the ids of the alert rules evaluated by each
+// cluster alerting instance, as of the last time the rules were loaded.
+// It returns nil when the rules are not explicitly assigned to instances.
+func (e *AlertEngine) ClusterAssignment() map[string][]int64 {
+	e.assignmentLock.RLock()
+	defer e.assignmentLock.RUnlock()
+
+	if e.assignment == nil {
+		return nil
+	}
+
+	assignment := make(map[string][]int64, len(e.assignment))
+	for instance, ids := range e.assignment {
+		assignment[instance] = append([]int64(nil), ids...)
+	}
+	return assignment
+}
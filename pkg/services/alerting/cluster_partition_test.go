@@ -0,0 +1,180 @@
+package alerting
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRuleSelectors(t *testing.T) {
+	selectors, err := parseRuleSelectors("org=1-10, dashboard=42")
+	require.NoError(t, err)
+	require.Equal(t, []ruleSelector{
+		{field: "org", min: 1, max: 10},
+		{field: "dashboard", min: 42, max: 42},
+	}, selectors)
+
+	for _, raw := range []string{"org", "folder=1", "org=a", "org=10-1", "rule=1-b"} {
+		_, err := parseRuleSelectors(raw)
+		require.Error(t, err, raw)
+	}
+}
+
+func TestWorkPartition(t *testing.T) {
+	rules := []*Rule{
+		{ID: 1, OrgID: 1},
+		{ID: 2, OrgID: 5},
+		{ID: 3, OrgID: 11},
+		{ID: 4, OrgID: 12, DashboardID: 42},
+	}
+
+	t.Run("overlapping selectors are assigned to a single instance", func(t *testing.T) {
+		p, err := newWorkPartition(map[string]string{
+			"instance-b": "org=1-10",
+			"instance-a": "org=5-20",
+		}, nil, "instance-c")
+		require.NoError(t, err)
+
+		require.Equal(t, map[string][]int64{
+			"instance-a": {2, 3, 4},
+			"instance-b": {1},
+		}, p.assign(rules))
+	})
+
+	t.Run("the assignments require a fallback instance for the unmatched rules", func(t *testing.T) {
+		_, err := newWorkPartition(map[string]string{"instance-a": "org=1-10"}, nil, "")
+		require.Error(t, err)
+
+		p, err := newWorkPartition(map[string]string{"instance-a": "org=1-10"}, map[string]float64{"instance-b": 1}, "")
+		require.NoError(t, err)
+		require.Equal(t, map[string][]int64{
+			"instance-a": {1, 2},
+			"instance-b": {3, 4},
+		}, p.assign(rules), "the unmatched rules are shared by the weighted instances")
+	})
+
+	t.Run("unmatched rules are covered by the fallback instance", func(t *testing.T) {
+		p, err := newWorkPartition(map[string]string{
+			"instance-a": "org=1-10",
+			"instance-b": "dashboard=42",
+		}, nil, "instance-c")
+		require.NoError(t, err)
+
+		require.Equal(t, map[string][]int64{
+			"instance-a": {1, 2},
+			"instance-b": {4},
+			"instance-c": {3},
+		}, p.assign(rules))
+	})
+
+	t.Run("engine only schedules its own rules and exposes the assignment", func(t *testing.T) {
+		origEnabled, origAssignments, origFallback := setting.AlertingClusteringEnabled, setting.AlertingClusteringAssignments, setting.AlertingClusteringFallbackInstance
+		t.Cleanup(func() {
+			setting.AlertingClusteringEnabled = origEnabled
+			setting.AlertingClusteringAssignments = origAssignments
+			setting.AlertingClusteringFallbackInstance = origFallback
+		})
+		setting.AlertingClusteringEnabled = true
+		setting.AlertingClusteringAssignments = map[string]string{"instance-a": "org=1-10"}
+		setting.AlertingClusteringFallbackInstance = "instance-b"
+
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		require.Nil(t, engine.ClusterAssignment())
+
+		owned := engine.partitionRules(rules, "instance-b")
+		require.Equal(t, []*Rule{rules[2], rules[3]}, owned)
+		require.Equal(t, map[string][]int64{
+			"instance-a": {1, 2},
+			"instance-b": {3, 4},
+		}, engine.ClusterAssignment())
+	})
+
+	t.Run("invalid assignments fail the engine initialization", func(t *testing.T) {
+		origEnabled, origAssignments := setting.AlertingClusteringEnabled, setting.AlertingClusteringAssignments
+		t.Cleanup(func() {
+			setting.AlertingClusteringEnabled = origEnabled
+			setting.AlertingClusteringAssignments = origAssignments
+		})
+		setting.AlertingClusteringEnabled = true
+		setting.AlertingClusteringAssignments = map[string]string{"instance-a": "org=abc"}
+
+		engine := &AlertEngine{}
+		require.Error(t, engine.Init())
+	})
+
+	t.Run("assignments without a fallback instance fail the engine initialization", func(t *testing.T) {
+		origEnabled, origAssignments, origFallback := setting.AlertingClusteringEnabled, setting.AlertingClusteringAssignments, setting.AlertingClusteringFallbackInstance
+		t.Cleanup(func() {
+			setting.AlertingClusteringEnabled = origEnabled
+			setting.AlertingClusteringAssignments = origAssignments
+			setting.AlertingClusteringFallbackInstance = origFallback
+		})
+		setting.AlertingClusteringEnabled = true
+		setting.AlertingClusteringAssignments = map[string]string{"instance-a": "org=1-10"}
+		setting.AlertingClusteringFallbackInstance = ""
+
+		engine := &AlertEngine{}
+		require.Error(t, engine.Init())
+	})
+}
+
+func TestWeightedWorkPartition(t *testing.T) {
+	rules := make([]*Rule, 0, 10000)
+	for id := int64(1); id <= 10000; id++ {
+		rules = append(rules, &Rule{ID: id, OrgID: 1})
+	}
+	owners := func(p *workPartition) map[int64]string {
+		owners := make(map[int64]string, len(rules))
+		for _, rule := range rules {
+			owners[rule.ID] = p.ownerOf(rule)
+		}
+		return owners
+	}
+
+	p, err := newWorkPartition(nil, map[string]float64{"big": 2, "small-a": 1, "small-b": 1}, "")
+	require.NoError(t, err)
+	before := owners(p)
+
+	t.Run("the rules are shared in proportion to the weights", func(t *testing.T) {
+		assignment := p.assign(rules)
+		require.Len(t, assignment, 3)
+		require.InDelta(t, 5000, len(assignment["big"]), 250)
+		require.InDelta(t, 2500, len(assignment["small-a"]), 250)
+		require.InDelta(t, 2500, len(assignment["small-b"]), 250)
+	})
+
+	t.Run("only the rules of a leaving instance move", func(t *testing.T) {
+		require.NoError(t, p.setWeights(map[string]float64{"big": 2, "small-a": 1}))
+		after := owners(p)
+
+		moved := map[string]int{}
+		for id, owner := range before {
+			if owner != "small-b" {
+				require.Equal(t, owner, after[id], "rule %d moved from a remaining instance", id)
+				continue
+			}
+			moved[after[id]]++
+		}
+		// the rules of the leaving instance are shared by weight as well
+		require.InDelta(t, 2*moved["small-a"], moved["big"], 250)
+
+		assignment := p.assign(rules)
+		require.Len(t, assignment, 2)
+		require.InDelta(t, 6667, len(assignment["big"]), 250)
+	})
+
+	t.Run("explicit assignments take precedence over the weights", func(t *testing.T) {
+		p, err := newWorkPartition(map[string]string{"small-a": "rule=1-100"}, map[string]float64{"big": 1}, "")
+		require.NoError(t, err)
+		assignment := p.assign(rules)
+		require.Len(t, assignment["small-a"], 100)
+		require.Len(t, assignment["big"], 9900)
+	})
+
+	t.Run("weights must be positive", func(t *testing.T) {
+		_, err := newWorkPartition(nil, map[string]float64{"big": 0}, "")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,242 @@
+package alerting
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClusterCache struct {
+	mtx     sync.Mutex
+	items   map[string]interface{}
+	expires map[string]time.Time
+	getErr  error
+	setErr  error
+	// gets counts the calls to Get
+	gets int
+	// clock is the clock of the cache server, used for the TTL of the items
+	clock clock.Clock
+}
+
+func newFakeClusterCache() *fakeClusterCache {
+	return &fakeClusterCache{items: make(map[string]interface{}), expires: make(map[string]time.Time), clock: clock.NewMock()}
+}
+
+func (c *fakeClusterCache) Get(key string) (interface{}, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.gets++
+	if c.getErr != nil {
+		return nil, c.getErr
+	}
+	item, ok := c.items[key]
+	if !ok {
+		return nil, remotecache.ErrCacheItemNotFound
+	}
+	if expires, ok := c.expires[key]; ok && !c.clock.Now().Before(expires) {
+		delete(c.items, key)
+		return nil, remotecache.ErrCacheItemNotFound
+	}
+	return item, nil
+}
+
+func (c *fakeClusterCache) Set(key string, value interface{}, expire time.Duration) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.setErr != nil {
+		return c.setErr
+	}
+	c.items[key] = value
+	if expire > 0 {
+		c.expires[key] = c.clock.Now().Add(expire)
+	} else {
+		delete(c.expires, key)
+	}
+	return nil
+}
+
+func (c *fakeClusterCache) Delete(key string) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.items, key)
+	return nil
+}
+
+func TestEngineClusterActiveInstance(t *testing.T) {
+	cache := newFakeClusterCache()
+
+	newEngine := func() *AlertEngine {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.Lease = newCacheLease(cache, time.Minute, clock.NewMock())
+		return engine
+	}
+	engineA, engineB := newEngine(), newEngine()
+
+	active, current := engineA.checkActiveInstance("instance-a")
+	require.True(t, active)
+	require.Equal(t, "instance-a", current)
+
+	active, current = engineB.checkActiveInstance("instance-b")
+	require.False(t, active)
+	require.Equal(t, "instance-a", current)
+
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.MAlertingActiveInstance.WithLabelValues("instance-a")))
+	require.Equal(t, float64(0), testutil.ToFloat64(metrics.MAlertingActiveInstance.WithLabelValues("instance-b")))
+
+	// instance-a stops renewing its record and instance-b takes over
+	require.NoError(t, cache.Delete("cluster_alerting_instance"))
+	active, _ = engineB.checkActiveInstance("instance-b")
+	require.True(t, active)
+	active, _ = engineA.checkActiveInstance("instance-a")
+	require.False(t, active)
+
+	require.Equal(t, float64(0), testutil.ToFloat64(metrics.MAlertingActiveInstance.WithLabelValues("instance-a")))
+	require.Equal(t, float64(1), testutil.ToFloat64(metrics.MAlertingActiveInstance.WithLabelValues("instance-b")))
+}
+
+func TestEngineClusterFailMode(t *testing.T) {
+	origFailMode := setting.AlertingClusteringFailMode
+	t.Cleanup(func() { setting.AlertingClusteringFailMode = origFailMode })
+
+	newEngine := func(cache *fakeClusterCache) *AlertEngine {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.Lease = newCacheLease(cache, time.Minute, clock.NewMock())
+		return engine
+	}
+
+	t.Run("fail-open keeps scheduling when the cache is unavailable", func(t *testing.T) {
+		setting.AlertingClusteringFailMode = setting.ClusteringFailOpen
+		cache := newFakeClusterCache()
+		cache.getErr = errors.New("connection refused")
+
+		active, current := newEngine(cache).checkActiveInstance("instance-a")
+		require.True(t, active)
+		require.Equal(t, "instance-a", current)
+	})
+
+	t.Run("fail-closed stops scheduling when the cache is unavailable", func(t *testing.T) {
+		setting.AlertingClusteringFailMode = setting.ClusteringFailClosed
+		cache := newFakeClusterCache()
+		engine := newEngine(cache)
+
+		active, _ := engine.checkActiveInstance("instance-a")
+		require.True(t, active)
+
+		cache.getErr = errors.New("connection refused")
+		active, current := engine.checkActiveInstance("instance-a")
+		require.False(t, active)
+		require.Empty(t, current)
+		require.Equal(t, float64(0), testutil.ToFloat64(metrics.MAlertingActiveInstance.WithLabelValues("instance-a")))
+
+		cache.getErr = nil
+		active, _ = engine.checkActiveInstance("instance-a")
+		require.True(t, active)
+	})
+
+	t.Run("fail-closed still elects an instance when there is no active one", func(t *testing.T) {
+		setting.AlertingClusteringFailMode = setting.ClusteringFailClosed
+
+		active, current := newEngine(newFakeClusterCache()).checkActiveInstance("instance-a")
+		require.True(t, active)
+		require.Equal(t, "instance-a", current)
+	})
+}
+
+func TestEngineClusterCacheOutage(t *testing.T) {
+	origFailMode, origThreshold := setting.AlertingClusteringFailMode, setting.AlertingClusteringFailThreshold
+	t.Cleanup(func() {
+		setting.AlertingClusteringFailMode = origFailMode
+		setting.AlertingClusteringFailThreshold = origThreshold
+	})
+	setting.AlertingClusteringFailThreshold = 3
+
+	newEngine := func(cache *fakeClusterCache) *AlertEngine {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.Lease = newCacheLease(cache, time.Minute, clock.NewMock())
+		return engine
+	}
+	degraded := func() float64 { return testutil.ToFloat64(metrics.MAlertingClusteringDegraded) }
+
+	t.Run("fail-open elects the instance as the sole active one on a prolonged outage", func(t *testing.T) {
+		setting.AlertingClusteringFailMode = setting.ClusteringFailOpen
+		cache := newFakeClusterCache()
+		require.NoError(t, cache.Set("cluster_alerting_instance", &ClusterAlertingInstance{Instance: "instance-b"}, 0))
+		engine := newEngine(cache)
+
+		active, current := engine.checkActiveInstance("instance-a")
+		require.False(t, active)
+		require.Equal(t, "instance-b", current)
+
+		cache.getErr = errors.New("connection refused")
+		for i := 0; i < 2; i++ {
+			active, current = engine.checkActiveInstance("instance-a")
+			require.False(t, active, "the instance stays standby on the first failures")
+			require.Equal(t, "instance-b", current)
+			require.False(t, engine.ClusteringDegraded())
+		}
+
+		active, current = engine.checkActiveInstance("instance-a")
+		require.True(t, active)
+		require.Equal(t, "instance-a", current)
+		require.True(t, engine.ClusteringDegraded())
+		require.Equal(t, float64(1), degraded())
+
+		cache.getErr = nil
+		active, current = engine.checkActiveInstance("instance-a")
+		require.False(t, active, "clustering resumes once the cache recovers")
+		require.Equal(t, "instance-b", current)
+		require.False(t, engine.ClusteringDegraded())
+		require.Equal(t, float64(0), degraded())
+	})
+
+	t.Run("fail-closed halts scheduling on a prolonged outage", func(t *testing.T) {
+		setting.AlertingClusteringFailMode = setting.ClusteringFailClosed
+		cache := newFakeClusterCache()
+		engine := newEngine(cache)
+
+		active, _ := engine.checkActiveInstance("instance-a")
+		require.True(t, active)
+
+		cache.getErr = errors.New("connection refused")
+		for i := 0; i < 2; i++ {
+			active, _ = engine.checkActiveInstance("instance-a")
+			require.True(t, active, "the instance stays active on the first failures")
+		}
+		active, current := engine.checkActiveInstance("instance-a")
+		require.False(t, active)
+		require.Empty(t, current)
+		require.True(t, engine.ClusteringDegraded())
+
+		cache.getErr = nil
+		active, _ = engine.checkActiveInstance("instance-a")
+		require.True(t, active)
+		require.False(t, engine.ClusteringDegraded())
+	})
+
+	t.Run("a success resets the failures", func(t *testing.T) {
+		setting.AlertingClusteringFailMode = setting.ClusteringFailClosed
+		cache := newFakeClusterCache()
+		engine := newEngine(cache)
+
+		for i := 0; i < 3; i++ {
+			cache.getErr = errors.New("connection refused")
+			engine.checkActiveInstance("instance-a")
+			engine.checkActiveInstance("instance-a")
+			cache.getErr = nil
+			active, _ := engine.checkActiveInstance("instance-a")
+			require.True(t, active)
+		}
+		require.False(t, engine.ClusteringDegraded())
+	})
+}
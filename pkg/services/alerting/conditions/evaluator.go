@@ -3,6 +3,8 @@ package conditions
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
 
 	"github.com/grafana/grafana/pkg/components/null"
 	"github.com/grafana/grafana/pkg/components/simplejson"
@@ -21,6 +23,18 @@ type AlertEvaluator interface {
 	Eval(reducedValue null.Float) bool
 }
 
+// previousValueEvaluator is implemented by the evaluators which may compare
+// the reduced value of a timeseries with its value on the previous evaluation
+// of the alert rule, e.g. to alert on the rate or the delta of a series.
+type previousValueEvaluator interface {
+	usesPreviousValue() bool
+	evalWithPrevious(reducedValue, previousValue null.Float) bool
+}
+
+// previousValueParam matches the thresholds relative to the previous value
+// of the series, e.g. `__previous_value * 1.5` or `__previous_value + 10`.
+var previousValueParam = regexp.MustCompile(`^__previous_value\s*(?:([*+-])\s*(\d+(?:\.\d+)?))?$`)
+
 type noValueEvaluator struct{}
 
 func (e *noValueEvaluator) Eval(reducedValue null.Float) bool {
@@ -30,6 +44,12 @@ func (e *noValueEvaluator) Eval(reducedValue null.Float) bool {
 type thresholdEvaluator struct {
 	Type      string
 	Threshold float64
+
+	// Previous is set when the threshold is relative to the previous value
+	// of the series, which is then combined with Operand by Operator.
+	Previous bool
+	Operator string
+	Operand  float64
 }
 
 func newThresholdEvaluator(typ string, model *simplejson.Json) (*thresholdEvaluator, error) {
@@ -38,6 +58,10 @@ func newThresholdEvaluator(typ string, model *simplejson.Json) (*thresholdEvalua
 		return nil, fmt.Errorf("evaluator '%v' is missing the threshold parameter", HumanThresholdType(typ))
 	}
 
+	if expr, ok := params[0].(string); ok {
+		return newPreviousValueEvaluator(typ, expr)
+	}
+
 	firstParam, ok := params[0].(json.Number)
 	if !ok {
 		return nil, fmt.Errorf("evaluator has invalid parameter")
@@ -48,16 +72,64 @@ func newThresholdEvaluator(typ string, model *simplejson.Json) (*thresholdEvalua
 	return defaultEval, nil
 }
 
+func newPreviousValueEvaluator(typ string, expr string) (*thresholdEvaluator, error) {
+	parts := previousValueParam.FindStringSubmatch(expr)
+	if parts == nil {
+		return nil, fmt.Errorf("evaluator has invalid threshold %q, expected a number or __previous_value", expr)
+	}
+
+	eval := &thresholdEvaluator{Type: typ, Previous: true, Operator: parts[1]}
+	if parts[2] != "" {
+		eval.Operand, _ = strconv.ParseFloat(parts[2], 64)
+	}
+	return eval, nil
+}
+
 func (e *thresholdEvaluator) Eval(reducedValue null.Float) bool {
+	if e.Previous {
+		// there is no previous value to compare with
+		return false
+	}
+	return e.evalThreshold(reducedValue, e.Threshold)
+}
+
+func (e *thresholdEvaluator) usesPreviousValue() bool {
+	return e.Previous
+}
+
+// evalWithPrevious compares the reduced value with the threshold computed
+// from the previous value of the series. It never matches when the series
+// had no value, e.g. on the first evaluation of the rule.
+func (e *thresholdEvaluator) evalWithPrevious(reducedValue, previousValue null.Float) bool {
+	if !e.Previous {
+		return e.Eval(reducedValue)
+	}
+	if !previousValue.Valid {
+		return false
+	}
+
+	threshold := previousValue.Float64
+	switch e.Operator {
+	case "*":
+		threshold *= e.Operand
+	case "+":
+		threshold += e.Operand
+	case "-":
+		threshold -= e.Operand
+	}
+	return e.evalThreshold(reducedValue, threshold)
+}
+
+func (e *thresholdEvaluator) evalThreshold(reducedValue null.Float, threshold float64) bool {
 	if !reducedValue.Valid {
 		return false
 	}
 
 	switch e.Type {
 	case "gt":
-		return reducedValue.Float64 > e.Threshold
+		return reducedValue.Float64 > threshold
 	case "lt":
-		return reducedValue.Float64 < e.Threshold
+		return reducedValue.Float64 < threshold
 	}
 
 	return false
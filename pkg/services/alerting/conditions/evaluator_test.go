@@ -59,4 +59,38 @@ func TestEvaluators(t *testing.T) {
 			So(evaluator.Eval(null.FloatFromPtr(nil)), ShouldBeTrue)
 		})
 	})
+
+	Convey("relative to the previous value", t, func() {
+		previousScenario := func(json string, reducedValue float64, previousValue null.Float) bool {
+			jsonModel, err := simplejson.NewJson([]byte(json))
+			So(err, ShouldBeNil)
+
+			evaluator, err := NewAlertEvaluator(jsonModel)
+			So(err, ShouldBeNil)
+
+			previous, ok := evaluator.(previousValueEvaluator)
+			So(ok, ShouldBeTrue)
+			So(previous.usesPreviousValue(), ShouldBeTrue)
+			return previous.evalWithPrevious(null.FloatFrom(reducedValue), previousValue)
+		}
+
+		So(previousScenario(`{"type": "gt", "params": ["__previous_value * 1.5"] }`, 16, null.FloatFrom(10)), ShouldBeTrue)
+		So(previousScenario(`{"type": "gt", "params": ["__previous_value * 1.5"] }`, 14, null.FloatFrom(10)), ShouldBeFalse)
+		So(previousScenario(`{"type": "gt", "params": ["__previous_value + 10"] }`, 21, null.FloatFrom(10)), ShouldBeTrue)
+		So(previousScenario(`{"type": "lt", "params": ["__previous_value - 5"] }`, 4, null.FloatFrom(10)), ShouldBeTrue)
+		So(previousScenario(`{"type": "lt", "params": ["__previous_value"] }`, 9, null.FloatFrom(10)), ShouldBeTrue)
+
+		Convey("should be false without a previous value", func() {
+			So(previousScenario(`{"type": "gt", "params": ["__previous_value"] }`, 10, null.FloatFromPtr(nil)), ShouldBeFalse)
+			So(evaluatorScenario(`{"type": "gt", "params": ["__previous_value"] }`, 10), ShouldBeFalse)
+		})
+
+		Convey("should reject an invalid expression", func() {
+			jsonModel, err := simplejson.NewJson([]byte(`{"type": "gt", "params": ["__previous_value / 2"] }`))
+			So(err, ShouldBeNil)
+
+			_, err = NewAlertEvaluator(jsonModel)
+			So(err, ShouldNotBeNil)
+		})
+	})
 }
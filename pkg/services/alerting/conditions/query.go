@@ -3,6 +3,8 @@ package conditions
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,6 +36,15 @@ type QueryCondition struct {
 	Reducer   *queryReducer
 	Evaluator AlertEvaluator
 	Operator  string
+
+	// AggregationMode is whether the condition fires when any or all of
+	// its series breach.
+	AggregationMode alerting.AggregationMode
+
+	// Timeout bounds the time the query is given, within the evaluation
+	// timeout it is also bounded by, e.g. for a fast query not to wait for
+	// as long as the slow queries of the rule. Zero means no bound of its own.
+	Timeout time.Duration
 }
 
 // AlertQuery contains information about what datasource a query
@@ -45,9 +56,31 @@ type AlertQuery struct {
 	To           string
 }
 
+// GetDatasourceID returns the id of the datasource queried by the condition.
+func (c *QueryCondition) GetDatasourceID() int64 {
+	return c.Query.DatasourceID
+}
+
 // Eval evaluates the `QueryCondition`.
 func (c *QueryCondition) Eval(context *alerting.EvalContext, requestHandler plugins.DataRequestHandler) (*alerting.ConditionResult, error) {
 	timeRange := plugins.NewDataTimeRange(c.Query.From, c.Query.To)
+	if lookback := context.Rule.Lookback; lookback > 0 {
+		timeRange = plugins.NewDataTimeRange(lookback.String(), "now")
+	}
+	if context.Window != nil {
+		timeRange = plugins.NewDataTimeRange(context.Window.Duration.String(), "now")
+	}
+	if offset := context.Rule.EvaluationOffset; offset > 0 {
+		timeRange = shiftTimeRange(timeRange, offset)
+	}
+
+	var query string
+	if c.Query.Model != nil {
+		if encoded, err := c.Query.Model.Encode(); err == nil {
+			query = string(encoded)
+		}
+	}
+	trace := context.TraceQuery(c.Index, c.Query.DatasourceID, query)
 
 	seriesList, err := c.executeQuery(context, timeRange, requestHandler)
 	if err != nil {
@@ -57,16 +90,43 @@ func (c *QueryCondition) Eval(context *alerting.EvalContext, requestHandler plug
 	emptySeriesCount := 0
 	evalMatchCount := 0
 	var matches []*alerting.EvalMatch
+	var allSeries []*alerting.EvalMatch
+	var latestDataPoint time.Time
+	var values map[string]null.Float
+	previous, usesPrevious := c.Evaluator.(previousValueEvaluator)
+	usesPrevious = usesPrevious && previous.usesPreviousValue()
+	if usesPrevious {
+		values = make(map[string]null.Float, len(seriesList))
+	}
 
 	for _, series := range seriesList {
-		reducedValue := c.Reducer.Reduce(series)
-		evalMatch := c.Evaluator.Eval(reducedValue)
+		if ts := latestPointTime(series); ts.After(latestDataPoint) {
+			latestDataPoint = ts
+		}
+
+		reducedValue, err := c.Reducer.reduce(series)
+		if err != nil {
+			return nil, fmt.Errorf("condition %d: %w", c.Index, err)
+		}
+		var evalMatch bool
+		if usesPrevious {
+			key := alerting.SeriesKey(series.Name, series.Tags)
+			previousValue, _ := context.PreviousValue(c.Index, key)
+			evalMatch = previous.evalWithPrevious(reducedValue, previousValue)
+			values[key] = reducedValue
+		} else {
+			evalMatch = c.Evaluator.Eval(reducedValue)
+		}
+		trace.AddSeries(series.Name, reducedValue, evalMatch)
+		if context.Window != nil {
+			allSeries = append(allSeries, &alerting.EvalMatch{Metric: series.Name, Value: reducedValue, Tags: series.Tags})
+		}
 
 		if !reducedValue.Valid {
 			emptySeriesCount++
 		}
 
-		if context.IsTestRun {
+		if context.IsTestRun || context.IsDebug {
 			context.Logs = append(context.Logs, &alerting.ResultLogEntry{
 				Message: fmt.Sprintf("Condition[%d]: Eval: %v, Metric: %s, Value: %s", c.Index, evalMatch, series.Name, reducedValue),
 			})
@@ -84,11 +144,14 @@ func (c *QueryCondition) Eval(context *alerting.EvalContext, requestHandler plug
 	}
 
 	// handle no series special case
+	var zeroFiring bool
 	if len(seriesList) == 0 {
 		// eval condition for null value
 		evalMatch := c.Evaluator.Eval(null.FloatFromPtr(nil))
+		// and for zero, for the rules taking the empty results for zero
+		zeroFiring = c.Evaluator.Eval(null.FloatFrom(0))
 
-		if context.IsTestRun {
+		if context.IsTestRun || context.IsDebug {
 			context.Logs = append(context.Logs, &alerting.ResultLogEntry{
 				Message: fmt.Sprintf("Condition: Eval: %v, Query Returned No Series (reduced to null/no value)", evalMatch),
 			})
@@ -101,13 +164,35 @@ func (c *QueryCondition) Eval(context *alerting.EvalContext, requestHandler plug
 	}
 
 	return &alerting.ConditionResult{
-		Firing:      evalMatchCount > 0,
-		NoDataFound: emptySeriesCount == len(seriesList),
-		Operator:    c.Operator,
-		EvalMatches: matches,
+		Firing:          evalMatchCount > 0,
+		NoDataFound:     emptySeriesCount == len(seriesList),
+		Operator:        c.Operator,
+		EvalMatches:     matches,
+		LatestDataPoint: latestDataPoint,
+		Values:          values,
+		Series:          allSeries,
+		AggregationMode: c.AggregationMode,
+		SeriesCount:     len(seriesList),
+		EmptyResult:     len(seriesList) == 0,
+		ZeroFiring:      zeroFiring,
 	}, nil
 }
 
+// latestPointTime returns the time of the most recent point of the series
+// that has a value, zero if there is none.
+func latestPointTime(series plugins.DataTimeSeries) time.Time {
+	var latest time.Time
+	for _, point := range series.Points {
+		if !point[0].Valid || !point[1].Valid {
+			continue
+		}
+		if ts := time.Unix(0, int64(point[1].Float64)*int64(time.Millisecond)); ts.After(latest) {
+			latest = ts
+		}
+	}
+	return latest
+}
+
 func (c *QueryCondition) executeQuery(context *alerting.EvalContext, timeRange plugins.DataTimeRange,
 	requestHandler plugins.DataRequestHandler) (plugins.DataTimeSeriesSlice, error) {
 	getDsInfo := &models.GetDataSourceQuery{
@@ -119,12 +204,13 @@ func (c *QueryCondition) executeQuery(context *alerting.EvalContext, timeRange p
 		return nil, fmt.Errorf("could not find datasource: %w", err)
 	}
 
-	err := context.RequestValidator.Validate(getDsInfo.Result.Url, nil)
+	err := context.RequestValidator.Validate(getDsInfo.Result.Url, newValidationRequest(context, getDsInfo.Result.Url))
 	if err != nil {
 		return nil, fmt.Errorf("access denied: %w", err)
 	}
 
 	req := c.getRequestForAlertRule(getDsInfo.Result, timeRange, context.IsDebug)
+	req.User = context.User
 	result := make(plugins.DataTimeSeriesSlice, 0)
 
 	if context.IsDebug {
@@ -164,8 +250,18 @@ func (c *QueryCondition) executeQuery(context *alerting.EvalContext, timeRange p
 		})
 	}
 
-	resp, err := requestHandler.HandleRequest(context.Ctx, getDsInfo.Result, req)
+	ctx := context.Ctx
+	if c.Timeout > 0 {
+		var cancel gocontext.CancelFunc
+		ctx, cancel = gocontext.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	resp, err := requestHandler.HandleRequest(ctx, getDsInfo.Result, req)
 	if err != nil {
+		if c.Timeout > 0 && errors.Is(ctx.Err(), gocontext.DeadlineExceeded) && context.Ctx.Err() == nil {
+			return nil, fmt.Errorf("query of condition %d exceeded its timeout of %s", c.Index, c.Timeout)
+		}
 		return nil, toCustomError(err)
 	}
 
@@ -184,6 +280,12 @@ func (c *QueryCondition) executeQuery(context *alerting.EvalContext, timeRange p
 			}
 
 			for _, frame := range frames {
+				// counted before the conversion, which allocates the series
+				if len(frame.Fields) > 1 {
+					if err := context.CountDatapoints(int64(frame.Rows()) * int64(len(frame.Fields)-1)); err != nil {
+						return nil, err
+					}
+				}
 				ss, err := FrameToSeriesSlice(frame)
 				if err != nil {
 					return nil, errutil.Wrapf(err,
@@ -192,12 +294,17 @@ func (c *QueryCondition) executeQuery(context *alerting.EvalContext, timeRange p
 				result = append(result, ss...)
 			}
 		} else {
+			for _, series := range v.Series {
+				if err := context.CountDatapoints(int64(len(series.Points))); err != nil {
+					return nil, err
+				}
+			}
 			result = append(result, v.Series...)
 		}
 
 		queryResultData := map[string]interface{}{}
 
-		if context.IsTestRun {
+		if context.IsTestRun || context.IsDebug {
 			queryResultData["series"] = result
 		}
 
@@ -219,6 +326,18 @@ func (c *QueryCondition) executeQuery(context *alerting.EvalContext, timeRange p
 	return result, nil
 }
 
+// newValidationRequest returns the request the datasource request validator checks,
+// which identifies the org of the alert rule. It returns nil if the datasource URL is invalid.
+func newValidationRequest(context *alerting.EvalContext, dsURL string) *http.Request {
+	req, err := http.NewRequestWithContext(context.Ctx, http.MethodGet, dsURL, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("X-Grafana-Org-Id", strconv.FormatInt(context.Rule.OrgID, 10))
+	req.Header.Set("FromAlert", "true")
+	return req
+}
+
 func (c *QueryCondition) getRequestForAlertRule(datasource *models.DataSource, timeRange plugins.DataTimeRange,
 	debug bool) plugins.DataQuery {
 	queryModel := c.Query.Model
@@ -263,6 +382,10 @@ func newQueryCondition(model *simplejson.Json, index int) (*QueryCondition, erro
 
 	reducerJSON := model.Get("reducer")
 	condition.Reducer = newSimpleReducer(reducerJSON.Get("type").MustString())
+	_, isRegistered := alerting.GetReducer(condition.Reducer.Type)
+	if p, ok := percentileOf(condition.Reducer.Type); ok && !isRegistered && (p < 0 || p > 100) {
+		return nil, fmt.Errorf("error in condition %v: percentile of reducer %s must be between 0 and 100", index, condition.Reducer.Type)
+	}
 
 	evaluatorJSON := model.Get("evaluator")
 	evaluator, err := NewAlertEvaluator(evaluatorJSON)
@@ -275,9 +398,48 @@ func newQueryCondition(model *simplejson.Json, index int) (*QueryCondition, erro
 	operator := operatorJSON.Get("type").MustString("and")
 	condition.Operator = operator
 
+	aggregationMode, err := alerting.ParseAggregationMode(model.Get("aggregation").MustString())
+	if err != nil {
+		return nil, fmt.Errorf("error in condition %v: %v", index, err)
+	}
+	condition.AggregationMode = aggregationMode
+
+	if timeout := model.Get("timeout").MustString(); timeout != "" {
+		condition.Timeout, err = time.ParseDuration(timeout)
+		if err != nil || condition.Timeout <= 0 {
+			return nil, fmt.Errorf("error in condition %v: could not parse timeout %q", index, timeout)
+		}
+	}
+
 	return &condition, nil
 }
 
+// shiftTimeRange shifts the relative time range back by the offset, e.g.
+// `5m` to `now` becomes `5m30s` to `30s` for an offset of 30s. The range
+// is left as is if it isn't relative to now.
+func shiftTimeRange(timeRange plugins.DataTimeRange, offset time.Duration) plugins.DataTimeRange {
+	from, err := durationBeforeNow(timeRange.From)
+	if err != nil {
+		return timeRange
+	}
+	to, err := durationBeforeNow(timeRange.To)
+	if err != nil {
+		return timeRange
+	}
+	timeRange.From = (from + offset).String()
+	timeRange.To = (to + offset).String()
+	return timeRange
+}
+
+// durationBeforeNow returns the duration before now of a relative time,
+// e.g. 5m for `now-5m` or `5m`.
+func durationBeforeNow(relative string) (time.Duration, error) {
+	if relative == "now" {
+		return 0, nil
+	}
+	return time.ParseDuration(strings.TrimPrefix(relative, "now-"))
+}
+
 func validateFromValue(from string) error {
 	fromRaw := strings.Replace(from, "now-", "", 1)
 
@@ -2,7 +2,11 @@ package conditions
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math"
+	"net/http"
+	"sort"
 	"testing"
 	"time"
 
@@ -17,6 +21,7 @@ import (
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/plugins"
 	"github.com/grafana/grafana/pkg/services/alerting"
+	"github.com/grafana/grafana/pkg/setting"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/stretchr/testify/require"
 	"github.com/xorcare/pointer"
@@ -109,6 +114,176 @@ func TestQueryCondition(t *testing.T) {
 				So(cr.Firing, ShouldBeTrue)
 			})
 
+			Convey("Should report the time of the most recent datapoint with a value", func() {
+				ctx.series = plugins.DataTimeSeriesSlice{
+					plugins.DataTimeSeries{Name: "test1", Points: plugins.DataTimeSeriesPoints{
+						plugins.DataTimePoint{null.FloatFrom(120), null.FloatFrom(1000)},
+						plugins.DataTimePoint{null.FloatFrom(120), null.FloatFrom(3000)},
+					}},
+					plugins.DataTimeSeries{Name: "test2", Points: plugins.DataTimeSeriesPoints{
+						plugins.DataTimePoint{null.FloatFrom(120), null.FloatFrom(2000)},
+						plugins.DataTimePoint{null.FloatFromPtr(nil), null.FloatFrom(5000)},
+					}},
+				}
+				cr, err := ctx.exec()
+
+				So(err, ShouldBeNil)
+				So(cr.LatestDataPoint.Equal(time.Unix(3, 0)), ShouldBeTrue)
+			})
+
+			Convey("Should trace the query and the reduced series", func() {
+				ctx.series = plugins.DataTimeSeriesSlice{
+					plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0)},
+					plugins.DataTimeSeries{Name: "test2", Points: newTimeSeriesPointsFromArgs(0, 0)},
+				}
+				_, err := ctx.exec()
+
+				So(err, ShouldBeNil)
+				So(ctx.result.QueryTraces, ShouldHaveLength, 1)
+				trace := ctx.result.QueryTraces[0]
+				So(trace.DatasourceID, ShouldEqual, 1)
+				So(trace.Query, ShouldContainSubstring, "aliasByNode")
+				So(trace.Series, ShouldHaveLength, 2)
+				So(trace.Series[0].Metric, ShouldEqual, "test1")
+				So(trace.Series[0].Value, ShouldResemble, null.FloatFrom(120))
+				So(trace.Series[0].Matched, ShouldBeTrue)
+				So(trace.Series[1].Matched, ShouldBeFalse)
+			})
+
+			Convey("Should query the datasource on behalf of the org of the rule", func() {
+				validator := &recordingRequestValidator{}
+				ctx.result = alerting.NewEvalContext(context.Background(), &alerting.Rule{OrgID: 3}, validator)
+				ctx.series = plugins.DataTimeSeriesSlice{
+					plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0)},
+				}
+				_, err := ctx.exec()
+
+				So(err, ShouldBeNil)
+				So(ctx.request.User, ShouldNotBeNil)
+				So(ctx.request.User.OrgId, ShouldEqual, 3)
+				So(ctx.request.User.Login, ShouldEqual, alerting.AlertingUserLogin)
+				So(validator.requests, ShouldHaveLength, 1)
+				So(validator.requests[0].Header.Get("X-Grafana-Org-Id"), ShouldEqual, "3")
+			})
+
+			Convey("Should query the time range of the condition", func() {
+				ctx.series = plugins.DataTimeSeriesSlice{
+					plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0)},
+				}
+				_, err := ctx.exec()
+
+				So(err, ShouldBeNil)
+				tr := ctx.request.TimeRange
+				So(tr.MustGetTo().Sub(tr.MustGetFrom()), ShouldEqual, 5*time.Minute)
+			})
+
+			Convey("Should query the lookback window of the rule", func() {
+				ranges := make([]time.Duration, 0, 2)
+				for _, lookback := range []time.Duration{time.Hour, 10 * time.Minute} {
+					ctx.result = alerting.NewEvalContext(context.Background(), &alerting.Rule{Lookback: lookback}, &validations.OSSPluginRequestValidator{})
+					ctx.series = plugins.DataTimeSeriesSlice{
+						plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0)},
+					}
+					_, err := ctx.exec()
+					So(err, ShouldBeNil)
+
+					tr := ctx.request.TimeRange
+					So(tr.MustGetTo(), ShouldHappenWithin, time.Minute, time.Now())
+					ranges = append(ranges, tr.MustGetTo().Sub(tr.MustGetFrom()))
+				}
+				So(ranges, ShouldResemble, []time.Duration{time.Hour, 10 * time.Minute})
+			})
+
+			Convey("Should reject the results with more datapoints than an evaluation processes", func() {
+				origMaxDatapoints := setting.AlertingMaxEvalDatapoints
+				defer func() { setting.AlertingMaxEvalDatapoints = origMaxDatapoints }()
+				setting.AlertingMaxEvalDatapoints = 4
+
+				ctx.result = alerting.NewEvalContext(context.Background(), &alerting.Rule{}, &validations.OSSPluginRequestValidator{})
+				ctx.series = plugins.DataTimeSeriesSlice{
+					plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0, 110, 1)},
+					plugins.DataTimeSeries{Name: "test2", Points: newTimeSeriesPointsFromArgs(120, 0, 110, 1)},
+				}
+				_, err := ctx.exec()
+				So(err, ShouldBeNil)
+
+				// the datapoints of all the conditions of the evaluation are counted
+				_, err = ctx.exec()
+				So(errors.Is(err, alerting.ErrResultTooLarge), ShouldBeTrue)
+
+				ctx.result = alerting.NewEvalContext(context.Background(), &alerting.Rule{}, &validations.OSSPluginRequestValidator{})
+				ctx.series = nil
+				ctx.frame = data.NewFrame("",
+					data.NewField("time", nil, []time.Time{time.Now(), time.Now()}),
+					data.NewField("a", nil, []float64{1, 2}),
+					data.NewField("b", nil, []float64{1, 2}),
+					data.NewField("c", nil, []float64{1, 2}),
+				)
+				_, err = ctx.exec()
+				So(errors.Is(err, alerting.ErrResultTooLarge), ShouldBeTrue)
+			})
+
+			Convey("Should shift the queried range back by the evaluation offset of the rule", func() {
+				ctx.result = alerting.NewEvalContext(context.Background(), &alerting.Rule{Lookback: 5 * time.Minute, EvaluationOffset: 30 * time.Second}, &validations.OSSPluginRequestValidator{})
+				ctx.series = plugins.DataTimeSeriesSlice{
+					plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0)},
+				}
+				_, err := ctx.exec()
+				So(err, ShouldBeNil)
+
+				tr := ctx.request.TimeRange
+				So(tr.Now.Sub(tr.MustGetTo()), ShouldEqual, 30*time.Second)
+				So(tr.Now.Sub(tr.MustGetFrom()), ShouldEqual, 5*time.Minute+30*time.Second)
+			})
+
+			Convey("Should query the window the rule is evaluated over and report all its series", func() {
+				ctx.result = alerting.NewEvalContext(context.Background(), &alerting.Rule{Lookback: time.Hour}, &validations.OSSPluginRequestValidator{})
+				ctx.result.Window = &alerting.EvalWindow{Name: "short", Duration: 5 * time.Minute}
+				ctx.series = plugins.DataTimeSeriesSlice{
+					plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0)},
+					plugins.DataTimeSeries{Name: "test2", Points: newTimeSeriesPointsFromArgs(10, 0)},
+				}
+				cr, err := ctx.exec()
+				So(err, ShouldBeNil)
+
+				tr := ctx.request.TimeRange
+				So(tr.MustGetTo().Sub(tr.MustGetFrom()), ShouldEqual, 5*time.Minute)
+				So(cr.EvalMatches, ShouldHaveLength, 1)
+				So(cr.Series, ShouldHaveLength, 2)
+				So(cr.Series[1].Metric, ShouldEqual, "test2")
+				So(cr.Series[1].Value, ShouldResemble, null.FloatFrom(10))
+			})
+
+			Convey("Should report the aggregation mode and the number of series", func() {
+				ctx.series = plugins.DataTimeSeriesSlice{
+					plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0)},
+					plugins.DataTimeSeries{Name: "test2", Points: newTimeSeriesPointsFromArgs(10, 0)},
+				}
+				cr, err := ctx.exec()
+				So(err, ShouldBeNil)
+				So(cr.AggregationMode, ShouldEqual, alerting.AggregationAny)
+				So(cr.SeriesCount, ShouldEqual, 2)
+
+				ctx.aggregation = "all"
+				cr, err = ctx.exec()
+				So(err, ShouldBeNil)
+				So(cr.AggregationMode, ShouldEqual, alerting.AggregationAll)
+				So(cr.EvalMatches, ShouldHaveLength, 1)
+			})
+
+			Convey("Should reject an unknown aggregation mode", func() {
+				jsonModel, err := simplejson.NewJson([]byte(`{
+					"type": "query",
+					"query": {"params": ["A", "5m", "now"], "datasourceId": 1, "model": {}},
+					"reducer": {"type": "avg", "params": []},
+					"evaluator": {"type": "gt", "params": [100]},
+					"aggregation": "most"
+				}`))
+				So(err, ShouldBeNil)
+				_, err = newQueryCondition(jsonModel, 0)
+				So(err, ShouldNotBeNil)
+			})
+
 			Convey("No series", func() {
 				Convey("Should set NoDataFound when condition is gt", func() {
 					ctx.series = plugins.DataTimeSeriesSlice{}
@@ -127,6 +302,18 @@ func TestQueryCondition(t *testing.T) {
 					So(err, ShouldBeNil)
 					So(cr.Firing, ShouldBeTrue)
 				})
+
+				Convey("Should report the verdict for a zero value", func() {
+					ctx.evaluator = `{"type": "lt", "params": [1]}`
+					ctx.series = plugins.DataTimeSeriesSlice{}
+					cr, err := ctx.exec()
+
+					So(err, ShouldBeNil)
+					So(cr.Firing, ShouldBeFalse)
+					So(cr.NoDataFound, ShouldBeTrue)
+					So(cr.EmptyResult, ShouldBeTrue)
+					So(cr.ZeroFiring, ShouldBeTrue)
+				})
 			})
 
 			Convey("Empty series", func() {
@@ -178,18 +365,295 @@ func TestQueryCondition(t *testing.T) {
 	})
 }
 
+func TestQueryConditionCustomReducer(t *testing.T) {
+	t.Cleanup(func() {
+		for _, name := range []string{"p90", "failing", "avg"} {
+			alerting.UnregisterReducer(name)
+		}
+	})
+	alerting.RegisterReducer("p90", func(series []float64) (float64, error) {
+		sorted := append([]float64(nil), series...)
+		sort.Float64s(sorted)
+		return sorted[int(math.Ceil(0.9*float64(len(sorted))))-1], nil
+	})
+	alerting.RegisterReducer("failing", func(series []float64) (float64, error) {
+		return 0, errors.New("not enough datapoints")
+	})
+	alerting.RegisterReducer("avg", func(series []float64) (float64, error) {
+		return 1000, nil
+	})
+
+	Convey("when evaluating query condition with a percentile reducer", t, func() {
+		queryConditionScenario("Given p99() and > 500", func(ctx *queryConditionTestContext) {
+			ctx.reducer = `{"type": "p99"}`
+			ctx.evaluator = `{"type": "gt", "params": [500]}`
+
+			// a hundred latencies of 100ms to 595ms by steps of 5ms, the
+			// p99 of which is 590.05ms
+			latencies := func(spike float64) plugins.DataTimeSeriesPoints {
+				values := make([]float64, 0, 200)
+				for i := 0; i < 100; i++ {
+					values = append(values, 100+float64(i)*5*spike, float64(i))
+				}
+				return newTimeSeriesPointsFromArgs(values...)
+			}
+
+			Convey("should fire when the 99th percentile is above 500", func() {
+				ctx.series = plugins.DataTimeSeriesSlice{plugins.DataTimeSeries{Name: "latency", Points: latencies(1)}}
+				cr, err := ctx.exec()
+
+				So(err, ShouldBeNil)
+				So(cr.Firing, ShouldBeTrue)
+				So(cr.EvalMatches[0].Value.Float64, ShouldAlmostEqual, 590.05)
+			})
+
+			Convey("should not fire when the 99th percentile is below 500 though the max is not", func() {
+				points := latencies(0.5)
+				points[50][0] = null.FloatFrom(2000)
+				ctx.series = plugins.DataTimeSeriesSlice{plugins.DataTimeSeries{Name: "latency", Points: points}}
+				cr, err := ctx.exec()
+
+				So(err, ShouldBeNil)
+				So(cr.Firing, ShouldBeFalse)
+			})
+		})
+
+		Convey("Should reject a percentile above 100", func() {
+			jsonModel, err := simplejson.NewJson([]byte(`{
+				"type": "query",
+				"query": {"params": ["A", "5m", "now"], "datasourceId": 1, "model": {}},
+				"reducer": {"type": "p150", "params": []},
+				"evaluator": {"type": "gt", "params": [100]}
+			}`))
+			So(err, ShouldBeNil)
+			_, err = newQueryCondition(jsonModel, 0)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should accept a registered reducer named like a percentile above 100", func() {
+			alerting.RegisterReducer("p150", func(series []float64) (float64, error) {
+				return series[0], nil
+			})
+			defer alerting.UnregisterReducer("p150")
+			jsonModel, err := simplejson.NewJson([]byte(`{
+				"type": "query",
+				"query": {"params": ["A", "5m", "now"], "datasourceId": 1, "model": {}},
+				"reducer": {"type": "p150", "params": []},
+				"evaluator": {"type": "gt", "params": [100]}
+			}`))
+			So(err, ShouldBeNil)
+			_, err = newQueryCondition(jsonModel, 0)
+			So(err, ShouldBeNil)
+		})
+	})
+
+	Convey("when evaluating query condition with a custom reducer", t, func() {
+		queryConditionScenario("Given p90() and > 80", func(ctx *queryConditionTestContext) {
+			ctx.reducer = `{"type": "p90"}`
+			ctx.evaluator = `{"type": "gt", "params": [80]}`
+
+			Convey("should fire when the 90th percentile is above 80", func() {
+				ctx.series = plugins.DataTimeSeriesSlice{
+					plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(10, 0, 20, 1, 30, 2, 40, 3, 50, 4, 60, 5, 70, 6, 80, 7, 90, 8, 150, 9)},
+				}
+				cr, err := ctx.exec()
+
+				So(err, ShouldBeNil)
+				So(cr.Firing, ShouldBeTrue)
+				So(cr.EvalMatches[0].Value.Float64, ShouldEqual, 90)
+			})
+
+			Convey("should skip the null values", func() {
+				ctx.series = plugins.DataTimeSeriesSlice{
+					plugins.DataTimeSeries{Name: "test1", Points: plugins.DataTimeSeriesPoints{
+						plugins.DataTimePoint{null.FloatFromPtr(nil), null.FloatFrom(0)},
+					}},
+				}
+				cr, err := ctx.exec()
+
+				So(err, ShouldBeNil)
+				So(cr.NoDataFound, ShouldBeTrue)
+			})
+		})
+
+		queryConditionScenario("Given a failing reducer", func(ctx *queryConditionTestContext) {
+			ctx.reducer = `{"type": "failing"}`
+			ctx.evaluator = `{"type": "gt", "params": [100]}`
+			ctx.series = plugins.DataTimeSeriesSlice{plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0)}}
+
+			_, err := ctx.exec()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "not enough datapoints")
+		})
+
+		queryConditionScenario("Given a custom reducer named after a built-in one", func(ctx *queryConditionTestContext) {
+			ctx.reducer = `{"type": "avg"}`
+			ctx.evaluator = `{"type": "gt", "params": [100]}`
+			ctx.series = plugins.DataTimeSeriesSlice{plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(20, 0)}}
+
+			cr, err := ctx.exec()
+			So(err, ShouldBeNil)
+			So(cr.Firing, ShouldBeFalse)
+		})
+	})
+}
+
+func TestQueryConditionPreviousValue(t *testing.T) {
+	Convey("when evaluating a query condition relative to the previous value", t, func() {
+		queryConditionScenario("Given avg() and > __previous_value + 10", func(ctx *queryConditionTestContext) {
+			ctx.reducer = `{"type": "avg"}`
+			ctx.evaluator = `{"type": "gt", "params": ["__previous_value + 10"]}`
+			tags := map[string]string{"host": "a"}
+
+			ctx.series = plugins.DataTimeSeriesSlice{plugins.DataTimeSeries{Name: "test1", Tags: tags, Points: newTimeSeriesPointsFromArgs(100, 0)}}
+			first, err := ctx.exec()
+			So(err, ShouldBeNil)
+
+			Convey("should not fire on the first evaluation", func() {
+				So(first.Firing, ShouldBeFalse)
+				So(first.Values, ShouldResemble, map[string]null.Float{"test1{host=a}": null.FloatFrom(100)})
+			})
+
+			Convey("should fire when the delta with the previous evaluation is above 10", func() {
+				ctx.result.PreviousSeriesValues = alerting.SeriesValues{0: first.Values}
+				ctx.series = plugins.DataTimeSeriesSlice{plugins.DataTimeSeries{Name: "test1", Tags: tags, Points: newTimeSeriesPointsFromArgs(115, 0)}}
+				cr, err := ctx.exec()
+
+				So(err, ShouldBeNil)
+				So(cr.Firing, ShouldBeTrue)
+				So(cr.EvalMatches[0].Value.Float64, ShouldEqual, 115)
+			})
+
+			Convey("should not fire when the delta with the previous evaluation is below 10", func() {
+				ctx.result.PreviousSeriesValues = alerting.SeriesValues{0: first.Values}
+				ctx.series = plugins.DataTimeSeriesSlice{plugins.DataTimeSeries{Name: "test1", Tags: tags, Points: newTimeSeriesPointsFromArgs(105, 0)}}
+				cr, err := ctx.exec()
+
+				So(err, ShouldBeNil)
+				So(cr.Firing, ShouldBeFalse)
+			})
+		})
+
+		queryConditionScenario("Given an absolute threshold", func(ctx *queryConditionTestContext) {
+			ctx.reducer = `{"type": "avg"}`
+			ctx.evaluator = `{"type": "gt", "params": [100]}`
+			ctx.series = plugins.DataTimeSeriesSlice{plugins.DataTimeSeries{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0)}}
+
+			cr, err := ctx.exec()
+			So(err, ShouldBeNil)
+			So(cr.Values, ShouldBeNil)
+		})
+	})
+}
+
+// delayingReqHandler answers the queries of every datasource after its
+// delay, unless their context is done first.
+type delayingReqHandler struct {
+	delays map[int64]time.Duration
+}
+
+// nolint: staticcheck // plugins.DataPlugin deprecated
+func (rh delayingReqHandler) HandleRequest(ctx context.Context, ds *models.DataSource, query plugins.DataQuery) (
+	plugins.DataResponse, error) {
+	select {
+	case <-time.After(rh.delays[ds.Id]):
+	case <-ctx.Done():
+		return plugins.DataResponse{}, ctx.Err()
+	}
+	return plugins.DataResponse{Results: map[string]plugins.DataQueryResult{
+		"A": {Series: plugins.DataTimeSeriesSlice{{Name: "test1", Points: newTimeSeriesPointsFromArgs(120, 0)}}},
+	}}, nil
+}
+
+func TestQueryConditionTimeout(t *testing.T) {
+	Convey("when evaluating query conditions with their own timeout", t, func() {
+		bus.AddHandler("test", func(query *models.GetDataSourceQuery) error {
+			query.Result = &models.DataSource{Id: query.Id, Type: "graphite"}
+			return nil
+		})
+		newCondition := func(datasourceID int64, timeout string) *QueryCondition {
+			jsonModel, err := simplejson.NewJson([]byte(fmt.Sprintf(`{
+				"type": "query",
+				"query": {"params": ["A", "5m", "now"], "datasourceId": %d, "model": {}},
+				"reducer": {"type": "avg", "params": []},
+				"evaluator": {"type": "gt", "params": [100]},
+				"timeout": %q
+			}`, datasourceID, timeout)))
+			So(err, ShouldBeNil)
+			condition, err := newQueryCondition(jsonModel, int(datasourceID))
+			So(err, ShouldBeNil)
+			return condition
+		}
+		newEvalContext := func(timeout time.Duration) (*alerting.EvalContext, context.CancelFunc) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			return &alerting.EvalContext{
+				Ctx:              ctx,
+				Rule:             &alerting.Rule{},
+				RequestValidator: &validations.OSSPluginRequestValidator{},
+			}, cancel
+		}
+		// the queries of datasource 1 are slow, the ones of datasource 2 fast
+		reqHandler := delayingReqHandler{delays: map[int64]time.Duration{1: time.Second, 2: 10 * time.Millisecond}}
+
+		Convey("Should fail the query exceeding its timeout while the others succeed", func() {
+			slow, fast := newCondition(1, "20ms"), newCondition(2, "2s")
+			So(slow.Timeout, ShouldEqual, 20*time.Millisecond)
+			evalContext, cancel := newEvalContext(5 * time.Second)
+			defer cancel()
+
+			_, err := slow.Eval(evalContext, reqHandler)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "query of condition 1 exceeded its timeout of 20ms")
+
+			cr, err := fast.Eval(evalContext, reqHandler)
+			So(err, ShouldBeNil)
+			So(cr.Firing, ShouldBeTrue)
+
+			So(evalContext.Ctx.Err(), ShouldBeNil)
+		})
+
+		Convey("Should be bounded by the evaluation timeout", func() {
+			condition := newCondition(1, "5s")
+			evalContext, cancel := newEvalContext(20 * time.Millisecond)
+			defer cancel()
+
+			_, err := condition.Eval(evalContext, reqHandler)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "alert execution exceeded the timeout")
+		})
+
+		Convey("Should reject an invalid timeout", func() {
+			for _, timeout := range []string{"fast", "-1s", "0s"} {
+				jsonModel, err := simplejson.NewJson([]byte(fmt.Sprintf(`{
+					"type": "query",
+					"query": {"params": ["A", "5m", "now"], "datasourceId": 1, "model": {}},
+					"reducer": {"type": "avg", "params": []},
+					"evaluator": {"type": "gt", "params": [100]},
+					"timeout": %q
+				}`, timeout)))
+				So(err, ShouldBeNil)
+				_, err = newQueryCondition(jsonModel, 0)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
 type queryConditionTestContext struct {
-	reducer   string
-	evaluator string
-	series    plugins.DataTimeSeriesSlice
-	frame     *data.Frame
-	result    *alerting.EvalContext
-	condition *QueryCondition
+	reducer     string
+	evaluator   string
+	aggregation string
+	series      plugins.DataTimeSeriesSlice
+	frame       *data.Frame
+	result      *alerting.EvalContext
+	condition   *QueryCondition
+	//nolint: staticcheck // plugins.DataPlugin deprecated
+	request plugins.DataQuery
 }
 
 type queryConditionScenarioFunc func(c *queryConditionTestContext)
 
-//nolint: staticcheck // plugins.DataPlugin deprecated
+// nolint: staticcheck // plugins.DataPlugin deprecated
 func (ctx *queryConditionTestContext) exec() (*alerting.ConditionResult, error) {
 	jsonModel, err := simplejson.NewJson([]byte(`{
             "type": "query",
@@ -199,7 +663,8 @@ func (ctx *queryConditionTestContext) exec() (*alerting.ConditionResult, error)
               "model": {"target": "aliasByNode(statsd.fakesite.counters.session_start.mobile.count, 4)"}
             },
             "reducer":` + ctx.reducer + `,
-            "evaluator":` + ctx.evaluator + `
+            "evaluator":` + ctx.evaluator + `,
+            "aggregation": "` + ctx.aggregation + `"
           }`))
 	So(err, ShouldBeNil)
 
@@ -223,6 +688,7 @@ func (ctx *queryConditionTestContext) exec() (*alerting.ConditionResult, error)
 				"A": qr,
 			},
 		},
+		request: &ctx.request,
 	}
 
 	return condition.Eval(ctx.result, reqHandler)
@@ -231,14 +697,28 @@ func (ctx *queryConditionTestContext) exec() (*alerting.ConditionResult, error)
 type fakeReqHandler struct {
 	//nolint: staticcheck // plugins.DataPlugin deprecated
 	response plugins.DataResponse
+	//nolint: staticcheck // plugins.DataPlugin deprecated
+	request *plugins.DataQuery
 }
 
-//nolint: staticcheck // plugins.DataPlugin deprecated
-func (rh fakeReqHandler) HandleRequest(context.Context, *models.DataSource, plugins.DataQuery) (
+// nolint: staticcheck // plugins.DataPlugin deprecated
+func (rh fakeReqHandler) HandleRequest(_ context.Context, _ *models.DataSource, query plugins.DataQuery) (
 	plugins.DataResponse, error) {
+	if rh.request != nil {
+		*rh.request = query
+	}
 	return rh.response, nil
 }
 
+type recordingRequestValidator struct {
+	requests []*http.Request
+}
+
+func (v *recordingRequestValidator) Validate(_ string, req *http.Request) error {
+	v.requests = append(v.requests, req)
+	return nil
+}
+
 func queryConditionScenario(desc string, fn queryConditionScenarioFunc) {
 	Convey(desc, func() {
 		bus.AddHandler("test", func(query *models.GetDataSourceQuery) error {
@@ -256,6 +736,24 @@ func queryConditionScenario(desc string, fn queryConditionScenarioFunc) {
 	})
 }
 
+func TestShiftTimeRange(t *testing.T) {
+	tests := []struct {
+		from, to               string
+		shiftedFrom, shiftedTo string
+	}{
+		{from: "5m", to: "now", shiftedFrom: "5m30s", shiftedTo: "30s"},
+		{from: "now-1h", to: "now-10m", shiftedFrom: "1h0m30s", shiftedTo: "10m30s"},
+		{from: "10m", to: "1m", shiftedFrom: "10m30s", shiftedTo: "1m30s"},
+		{from: "now/d", to: "now", shiftedFrom: "now/d", shiftedTo: "now"},
+	}
+
+	for _, tc := range tests {
+		shifted := shiftTimeRange(plugins.NewDataTimeRange(tc.from, tc.to), 30*time.Second)
+		require.Equal(t, tc.shiftedFrom, shifted.From, tc.from)
+		require.Equal(t, tc.shiftedTo, shifted.To, tc.to)
+	}
+}
+
 func TestFrameToSeriesSlice(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -1,27 +1,36 @@
 package conditions
 
 import (
+	"fmt"
 	"math"
-
 	"sort"
+	"strconv"
 
 	"github.com/grafana/grafana/pkg/components/null"
 	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/services/alerting"
 )
 
 // queryReducer reduces a timeseries to a nullable float
 type queryReducer struct {
 
 	// Type is how the timeseries should be reduced.
-	// Ex avg, sum, max, min, count
+	// Ex avg, sum, max, min, count, p99
 	Type string
 }
 
-//nolint: gocyclo
+// Reduce reduces the series, it is reduced to null when a custom reducer fails.
 //nolint: staticcheck // plugins.DataTimeSeries deprecated
 func (s *queryReducer) Reduce(series plugins.DataTimeSeries) null.Float {
+	value, _ := s.reduce(series)
+	return value
+}
+
+//nolint: gocyclo
+//nolint: staticcheck // plugins.DataTimeSeries deprecated
+func (s *queryReducer) reduce(series plugins.DataTimeSeries) (null.Float, error) {
 	if len(series.Points) == 0 {
-		return null.FloatFromPtr(nil)
+		return null.FloatFromPtr(nil), nil
 	}
 
 	value := float64(0)
@@ -114,19 +123,77 @@ func (s *queryReducer) Reduce(series plugins.DataTimeSeries) null.Float {
 		if value > 0 {
 			allNull = false
 		}
+	default:
+		// the registered reducers take precedence over the percentile ones,
+		// so that a custom reducer can be named like a percentile
+		fn, isRegistered := alerting.GetReducer(s.Type)
+		p, isPercentile := percentileOf(s.Type)
+		if !isRegistered && !isPercentile {
+			break
+		}
+
+		var values []float64
+		for _, v := range series.Points {
+			if isValid(v[0]) {
+				values = append(values, v[0].Float64)
+			}
+		}
+		if len(values) == 0 {
+			break
+		}
+
+		if !isRegistered {
+			value = percentile(values, p)
+			allNull = false
+			break
+		}
+		reduced, err := fn(values)
+		if err != nil {
+			return null.FloatFromPtr(nil), fmt.Errorf("reducer %s failed: %w", s.Type, err)
+		}
+		value = reduced
+		allNull = false
 	}
 
 	if allNull {
-		return null.FloatFromPtr(nil)
+		return null.FloatFromPtr(nil), nil
 	}
 
-	return null.FloatFrom(value)
+	return null.FloatFrom(value), nil
 }
 
 func newSimpleReducer(t string) *queryReducer {
 	return &queryReducer{Type: t}
 }
 
+// percentileOf returns the percentile of a percentile reducer type, which is
+// p followed by the percentile, e.g. 99 for p99 or 99.9 for p99.9.
+func percentileOf(t string) (float64, bool) {
+	if len(t) < 2 || t[0] != 'p' {
+		return 0, false
+	}
+	p, err := strconv.ParseFloat(t[1:], 64)
+	if err != nil || math.IsNaN(p) || math.IsInf(p, 0) {
+		return 0, false
+	}
+	return p, true
+}
+
+// percentile returns the p-th percentile of the values, interpolated linearly
+// between the closest ranks like the median is, so p50 is the median.
+func percentile(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	rank := p / 100 * float64(len(values)-1)
+	if rank <= 0 {
+		return values[0]
+	}
+	if rank >= float64(len(values)-1) {
+		return values[len(values)-1]
+	}
+	lower := int(math.Floor(rank))
+	return values[lower] + (values[lower+1]-values[lower])*(rank-float64(lower))
+}
+
 //nolint: staticcheck // plugins.* deprecated
 func calculateDiff(series plugins.DataTimeSeries, allNull bool, value float64, fn func(float64, float64) float64) (bool, float64) {
 	var (
@@ -114,6 +114,59 @@ func TestSimpleReducer(t *testing.T) {
 			})
 		})
 
+		Convey("percentiles", func() {
+			Convey("p50 is the median", func() {
+				So(testReducer("p50", 3000, 1, 4, 2), ShouldEqual, float64(3))
+				So(testReducer("p50", 1, 2, 3000), ShouldEqual, float64(2))
+			})
+
+			Convey("are interpolated linearly between the closest ranks", func() {
+				So(testReducer("p90", 10, 9, 8, 7, 6, 5, 4, 3, 2, 1), ShouldAlmostEqual, 9.1)
+				So(testReducer("p95", 1, 2, 3, 4, 5), ShouldAlmostEqual, 4.8)
+			})
+
+			Convey("p99 of a hundred values", func() {
+				values := make([]float64, 0, 100)
+				for i := 1; i <= 100; i++ {
+					values = append(values, float64(i))
+				}
+				So(testReducer("p99", values...), ShouldAlmostEqual, 99.01)
+				So(testReducer("p99.9", values...), ShouldAlmostEqual, 99.901)
+			})
+
+			Convey("p0 and p100 are the min and max", func() {
+				So(testReducer("p0", 3, 1, 2), ShouldEqual, float64(1))
+				So(testReducer("p100", 3, 1, 2), ShouldEqual, float64(3))
+			})
+
+			Convey("of a single value", func() {
+				So(testReducer("p99", 42), ShouldEqual, float64(42))
+			})
+
+			Convey("should ignore null values", func() {
+				reducer := newSimpleReducer("p90")
+				series := plugins.DataTimeSeries{
+					Name: "test time series",
+				}
+				series.Points = append(series.Points, plugins.DataTimePoint{null.FloatFrom(1), null.FloatFrom(1)})
+				series.Points = append(series.Points, plugins.DataTimePoint{null.FloatFromPtr(nil), null.FloatFrom(2)})
+				series.Points = append(series.Points, plugins.DataTimePoint{null.FloatFrom(math.NaN()), null.FloatFrom(3)})
+				series.Points = append(series.Points, plugins.DataTimePoint{null.FloatFrom(2), null.FloatFrom(4)})
+
+				So(reducer.Reduce(series).Float64, ShouldAlmostEqual, 1.9)
+			})
+
+			Convey("of only null values should be null", func() {
+				reducer := newSimpleReducer("p99")
+				series := plugins.DataTimeSeries{
+					Name: "test time series",
+				}
+				series.Points = append(series.Points, plugins.DataTimePoint{null.FloatFromPtr(nil), null.FloatFrom(1)})
+
+				So(reducer.Reduce(series).Valid, ShouldEqual, false)
+			})
+		})
+
 		Convey("avg of number values and null values should ignore nulls", func() {
 			reducer := newSimpleReducer("avg")
 			series := plugins.DataTimeSeries{
@@ -0,0 +1,107 @@
+package alerting
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// isConfigError returns true if the evaluation error is caused by the
+// configuration of the rule, e.g. a deleted datasource, which retrying or
+// evaluating the rule again won't fix.
+func isConfigError(err error) bool {
+	return errors.Is(err, models.ErrDataSourceNotFound)
+}
+
+// MissingDatasourceRule is an alert rule failing to evaluate because it
+// queries a datasource that doesn't exist anymore.
+type MissingDatasourceRule struct {
+	RuleID int64
+	OrgID  int64
+	Name   string
+	Error  string
+	// Since is the time of the first evaluation of the rule which failed
+	// because of the missing datasource.
+	Since time.Time
+}
+
+// missingDatasources keeps track of the rules querying a missing datasource,
+// until an evaluation of the rule doesn't fail because of it anymore.
+type missingDatasources struct {
+	mtx   sync.Mutex
+	rules map[ruleKey]*MissingDatasourceRule
+}
+
+func newMissingDatasources() *missingDatasources {
+	return &missingDatasources{rules: make(map[ruleKey]*MissingDatasourceRule)}
+}
+
+func (m *missingDatasources) observe(evalContext *EvalContext) {
+	if evalContext.Skipped {
+		// the queries of the rule were not executed
+		return
+	}
+	key := ruleKeyOf(evalContext.Rule)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if !isConfigError(evalContext.Error) {
+		delete(m.rules, key)
+		return
+	}
+	if rule, ok := m.rules[key]; ok {
+		rule.Error = evalContext.Error.Error()
+		return
+	}
+	m.rules[key] = &MissingDatasourceRule{
+		RuleID: evalContext.Rule.ID,
+		OrgID:  evalContext.Rule.OrgID,
+		Name:   evalContext.Rule.Name,
+		Error:  evalContext.Error.Error(),
+		Since:  evalContext.StartTime,
+	}
+}
+
+// prune forgets the rules that are no longer scheduled.
+func (m *missingDatasources) prune(rules []*Rule) {
+	scheduled := make(map[ruleKey]bool, len(rules))
+	for _, rule := range rules {
+		scheduled[ruleKeyOf(rule)] = true
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for key := range m.rules {
+		if !scheduled[key] {
+			delete(m.rules, key)
+		}
+	}
+}
+
+func (m *missingDatasources) list() []MissingDatasourceRule {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	rules := make([]MissingDatasourceRule, 0, len(m.rules))
+	for _, rule := range m.rules {
+		rules = append(rules, *rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].RuleID != rules[j].RuleID {
+			return rules[i].RuleID < rules[j].RuleID
+		}
+		return rules[i].OrgID < rules[j].OrgID
+	})
+	return rules
+}
+
+// MissingDatasourceRules returns the rules evaluated by this instance which
+// query a missing datasource, ordered by rule id. They are in the config
+// error state, and only notified for once, until their datasource is fixed.
+func (e *AlertEngine) MissingDatasourceRules() []MissingDatasourceRule {
+	return e.configErrors.list()
+}
@@ -0,0 +1,108 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+// datasourceCondition looks up its datasource like the query conditions do.
+type datasourceCondition struct {
+	datasourceID int64
+	evaluations  int
+}
+
+func (c *datasourceCondition) Eval(context *EvalContext, reqHandler plugins.DataRequestHandler) (*ConditionResult, error) {
+	c.evaluations++
+	query := &models.GetDataSourceQuery{Id: c.datasourceID, OrgId: context.Rule.OrgID}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, fmt.Errorf("could not find datasource: %w", err)
+	}
+	return &ConditionResult{Firing: false}, nil
+}
+
+func TestEngineMissingDatasource(t *testing.T) {
+	origEvaluationTimeout, origNotificationTimeout, origMaxAttempts := setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts
+	t.Cleanup(func() {
+		setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts = origEvaluationTimeout, origNotificationTimeout, origMaxAttempts
+	})
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 3
+
+	origRepo := annotations.GetRepository()
+	annotations.SetRepository(&fakeAnnotationsRepo{})
+	t.Cleanup(func() { annotations.SetRepository(origRepo) })
+
+	notifier := &capturingNotifier{testNotifier: testNotifier{UID: "config", Type: "config"}}
+	RegisterNotifier(&NotifierPlugin{
+		Type: "config",
+		Name: "Config",
+		Factory: func(model *models.AlertNotification) (Notifier, error) {
+			return notifier, nil
+		},
+	})
+	datasources := map[int64]bool{}
+	bus.AddHandler("test", func(query *models.GetDataSourceQuery) error {
+		if !datasources[query.Id] {
+			return models.ErrDataSourceNotFound
+		}
+		query.Result = &models.DataSource{Id: query.Id, OrgId: query.OrgId}
+		return nil
+	})
+	bus.AddHandler("test", func(cmd *models.SetAlertStateCommand) error {
+		cmd.Result = models.Alert{Id: cmd.AlertId, State: cmd.State, StateChanges: 1}
+		return nil
+	})
+	bus.AddHandler("test", func(query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = []*models.AlertNotification{{Id: 1, Uid: "config", Type: "config", Settings: simplejson.New()}}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetOrCreateNotificationStateQuery) error {
+		query.Result = &models.AlertNotificationState{Id: 1, State: models.AlertNotificationStateUnknown}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		return nil
+	})
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.resultHandler = newResultHandler(nil, &fakeStateStore{states: map[ruleKey]RuleState{}}, newInhibitor(nil), newSilences(clock.NewMock()), nil, clock.New())
+	engine.resultQueue = nil
+	condition := &datasourceCondition{datasourceID: 99}
+	rule := &Rule{ID: 1, OrgID: 1, Name: "deleted datasource", State: models.AlertStateOK, Frequency: 10,
+		Notifications: []string{"config"}, Conditions: []Condition{condition}}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{Rule: rule}))
+	}
+
+	require.Equal(t, 3, condition.evaluations, "the evaluations are not retried")
+	require.Equal(t, models.AlertStateConfigError, rule.State)
+	require.Len(t, notifier.notified, 1, "the configuration error is notified once")
+	missing := engine.MissingDatasourceRules()
+	require.Len(t, missing, 1)
+	require.Equal(t, int64(1), missing[0].RuleID)
+	require.Contains(t, missing[0].Error, "data source not found")
+
+	// the datasource is fixed
+	datasources[99] = true
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{Rule: rule}))
+	require.Equal(t, models.AlertStateOK, rule.State)
+	require.Len(t, notifier.notified, 2, "the rule is notified once fixed")
+	require.Empty(t, engine.MissingDatasourceRules())
+}
@@ -0,0 +1,47 @@
+package alerting
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// configVersions tells the version of the configuration which defined the
+// alert rules of a dashboard, that is the checksum of the provisioning file
+// of the dashboard, for the evaluations to be correlated with the config
+// changes. The versions are cached for the lifetime of the lookup, that is
+// a single load of the rules.
+type configVersions struct {
+	versions map[dashboardKey]string
+}
+
+// dashboardKey identifies a dashboard across the orgs.
+type dashboardKey struct {
+	orgID int64
+	id    int64
+}
+
+func newConfigVersions() *configVersions {
+	return &configVersions{versions: make(map[dashboardKey]string)}
+}
+
+// get returns the config version of the dashboard of the org, empty when the
+// dashboard is not provisioned or its provisioning could not be looked up.
+func (c *configVersions) get(orgID, dashboardID int64) string {
+	if dashboardID == 0 {
+		return ""
+	}
+	key := dashboardKey{orgID: orgID, id: dashboardID}
+	if version, ok := c.versions[key]; ok {
+		return version
+	}
+
+	var version string
+	query := &models.GetProvisionedDashboardDataQuery{DashboardId: dashboardID}
+	if err := bus.Dispatch(query); err != nil {
+		logger.Debug("Could not look up the provisioning of the dashboard", "dashboardId", dashboardID, "error", err)
+	} else if query.Result != nil {
+		version = query.Result.CheckSum
+	}
+	c.versions[key] = version
+	return version
+}
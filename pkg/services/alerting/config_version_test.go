@@ -0,0 +1,61 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleReaderConfigVersion(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	newAlert := func(id, dashboardID int64) *models.Alert {
+		settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}]}`))
+		require.NoError(t, err)
+		return &models.Alert{Id: id, OrgId: 1, DashboardId: dashboardID, Name: "rule", Frequency: 60, Settings: settings}
+	}
+	bus.AddHandler("test", func(query *models.GetAllAlertsQuery) error {
+		query.Result = []*models.Alert{newAlert(1, 1), newAlert(2, 1), newAlert(3, 2), newAlert(4, 3)}
+		return nil
+	})
+
+	lookups := 0
+	bus.AddHandler("test", func(query *models.GetProvisionedDashboardDataQuery) error {
+		lookups++
+		switch query.DashboardId {
+		case 1:
+			query.Result = &models.DashboardProvisioning{DashboardId: 1, Name: "ops", ExternalId: "/etc/dashboards/ops.json", CheckSum: "9f2c1e"}
+		case 3:
+			return errors.New("database is locked")
+		}
+		return nil
+	})
+
+	rules, err := newRuleReader(nil).fetch()
+	require.NoError(t, err)
+	require.Len(t, rules, 4)
+
+	versions := map[int64]string{}
+	for _, rule := range rules {
+		versions[rule.ID] = rule.ConfigVersion
+	}
+	require.Equal(t, map[int64]string{1: "9f2c1e", 2: "9f2c1e", 3: "", 4: ""}, versions,
+		"the rules of the dashboards neither provisioned nor found have no config version")
+	require.Equal(t, 3, lookups, "the dashboards are looked up once per fetch")
+
+	t.Run("propagates to the evaluation and its notifications", func(t *testing.T) {
+		evalContext := NewEvalContext(context.Background(), rules[0], nil)
+		require.Equal(t, "9f2c1e", evalContext.ConfigVersion)
+		require.Equal(t, "9f2c1e", newEvalWebhookPayload(evalContext).ConfigVersion)
+
+		evalContext.EvalMatches = newMatches(3)
+		require.Equal(t, "9f2c1e", evalContext.capMatches(1).ConfigVersion)
+	})
+}
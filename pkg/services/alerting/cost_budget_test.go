@@ -0,0 +1,176 @@
+package alerting
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+// costTrackingEvalHandler blocks every evaluation until its rule is
+// released and records the total cost of the evaluations in flight.
+type costTrackingEvalHandler struct {
+	mtx      sync.Mutex
+	inFlight int64
+	max      int64
+	started  chan int64
+	release  map[int64]chan struct{}
+}
+
+func newCostTrackingEvalHandler(ruleIDs ...int64) *costTrackingEvalHandler {
+	h := &costTrackingEvalHandler{started: make(chan int64, len(ruleIDs)), release: make(map[int64]chan struct{})}
+	for _, id := range ruleIDs {
+		h.release[id] = make(chan struct{})
+	}
+	return h
+}
+
+func (h *costTrackingEvalHandler) Eval(evalContext *EvalContext) {
+	h.mtx.Lock()
+	h.inFlight += evalContext.Rule.Cost
+	if h.inFlight > h.max {
+		h.max = h.inFlight
+	}
+	h.mtx.Unlock()
+
+	h.started <- evalContext.Rule.ID
+	<-h.release[evalContext.Rule.ID]
+
+	h.mtx.Lock()
+	h.inFlight -= evalContext.Rule.Cost
+	h.mtx.Unlock()
+}
+
+func (h *costTrackingEvalHandler) maxInFlight() int64 {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return h.max
+}
+
+func TestEngineCostBudget(t *testing.T) {
+	origMaxCost := setting.AlertingMaxInFlightCost
+	t.Cleanup(func() { setting.AlertingMaxInFlightCost = origMaxCost })
+	setting.AlertingMaxInFlightCost = 3
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	newEngine := func(evalHandler evalHandler) *AlertEngine {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.evalHandler = evalHandler
+		engine.resultHandler = &FakeResultHandler{}
+		return engine
+	}
+
+	waitStarted := func(t *testing.T, h *costTrackingEvalHandler) int64 {
+		t.Helper()
+		select {
+		case id := <-h.started:
+			return id
+		case <-time.After(5 * time.Second):
+			t.Fatal("evaluation did not start")
+			return 0
+		}
+	}
+
+	t.Run("expensive jobs wait for the budget", func(t *testing.T) {
+		h := newCostTrackingEvalHandler(1, 2, 3)
+		engine := newEngine(h)
+
+		var wg sync.WaitGroup
+		run := func(rule *Rule) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				require.NoError(t, engine.processJobWithinBudget(context.Background(), &Job{running: true, Rule: rule}))
+			}()
+		}
+
+		run(&Rule{ID: 1, Cost: 2})
+		run(&Rule{ID: 2, Cost: 1})
+		started := map[int64]bool{waitStarted(t, h): true, waitStarted(t, h): true}
+		require.Equal(t, map[int64]bool{1: true, 2: true}, started)
+
+		// only 2 jobs are in flight, but they already use the whole budget
+		run(&Rule{ID: 3, Cost: 2})
+		select {
+		case id := <-h.started:
+			t.Fatalf("rule %d started over budget", id)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// releasing the cheap job does not leave enough room
+		close(h.release[2])
+		select {
+		case id := <-h.started:
+			t.Fatalf("rule %d started over budget", id)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(h.release[1])
+		require.Equal(t, int64(3), waitStarted(t, h))
+		close(h.release[3])
+
+		wg.Wait()
+		require.Equal(t, int64(3), h.maxInFlight())
+	})
+
+	t.Run("cheap jobs are not limited by their count", func(t *testing.T) {
+		h := newCostTrackingEvalHandler(1, 2, 3)
+		engine := newEngine(h)
+
+		var wg sync.WaitGroup
+		for id := int64(1); id <= 3; id++ {
+			rule := &Rule{ID: id, Cost: 1}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				require.NoError(t, engine.processJobWithinBudget(context.Background(), &Job{running: true, Rule: rule}))
+			}()
+		}
+		for i := 0; i < 3; i++ {
+			waitStarted(t, h)
+		}
+		for _, release := range h.release {
+			close(release)
+		}
+
+		wg.Wait()
+		require.Equal(t, int64(3), h.maxInFlight())
+	})
+
+	t.Run("a job over the whole budget runs on its own", func(t *testing.T) {
+		h := newCostTrackingEvalHandler(1)
+		close(h.release[1])
+		engine := newEngine(h)
+
+		require.NoError(t, engine.processJobWithinBudget(context.Background(), &Job{running: true, Rule: &Rule{ID: 1, Cost: 10}}))
+		require.Equal(t, int64(3), jobCost(&Job{Rule: &Rule{Cost: 10}}, engine.maxCost))
+	})
+
+	t.Run("jobs waiting for the budget are dropped on shutdown", func(t *testing.T) {
+		h := newCostTrackingEvalHandler(1)
+		engine := newEngine(h)
+
+		done := make(chan struct{})
+		defer func() {
+			close(h.release[1])
+			<-done
+		}()
+		go func() {
+			defer close(done)
+			_ = engine.processJobWithinBudget(context.Background(), &Job{running: true, Rule: &Rule{ID: 1, Cost: 3}})
+		}()
+		waitStarted(t, h)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		job := &Job{running: true, Rule: &Rule{ID: 2, Cost: 1}}
+		require.NoError(t, engine.processJobWithinBudget(ctx, job))
+		require.False(t, job.GetRunning())
+	})
+}
@@ -0,0 +1,268 @@
+package alerting
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+)
+
+const (
+	// datasourceHealthSamples is the number of evaluations the health score
+	// of a datasource is computed on.
+	datasourceHealthSamples = 20
+	// datasourceHealthMinSamples is the number of evaluations a datasource
+	// needs before its rules are evaluated less often, so a single failure
+	// doesn't hold them back.
+	datasourceHealthMinSamples = 5
+	// maxAdmissionSlowdown is the most the intervals of the rules of a
+	// degraded datasource are stretched by, for them to still notice its
+	// recovery.
+	maxAdmissionSlowdown = 8
+)
+
+// DatasourceHealthScore is the health of a datasource as of the recent
+// evaluations of the alert rules querying it.
+type DatasourceHealthScore struct {
+	DatasourceID int64
+	// Score goes from 0, every evaluation failing, to 1, every evaluation
+	// succeeding within the latency of datasource_health_latency_seconds.
+	Score float64
+	// Slowdown is the number of times the intervals of the rules of the
+	// datasource are stretched by, 1 while it is healthy.
+	Slowdown int64
+	Samples  int
+}
+
+// datasourceHealth keeps a rolling health score of every datasource queried
+// by the alert rules, from the latency and the error ratio of their recent
+// evaluations. The rules of a datasource whose score drops below the
+// threshold are evaluated less often, for the engine to back off from it
+// before it fails entirely, and at their frequency again once it recovers.
+type datasourceHealth struct {
+	sync.Mutex
+	threshold float64
+	latency   time.Duration
+	sources   map[int64]*datasourceSamples
+	log       log.Logger
+}
+
+type datasourceSamples struct {
+	latencies []time.Duration
+	failures  []bool
+	next      int
+	score     float64
+	slowdown  int64
+}
+
+func newDatasourceHealth(threshold float64, latency time.Duration) *datasourceHealth {
+	return &datasourceHealth{
+		threshold: threshold,
+		latency:   latency,
+		sources:   make(map[int64]*datasourceSamples),
+		log:       log.New("alerting.datasourceHealth"),
+	}
+}
+
+// ruleDatasources returns the datasources queried by the conditions of the rule.
+func ruleDatasources(rule *Rule) []int64 {
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, condition := range rule.Conditions {
+		dc, ok := condition.(DatasourceCondition)
+		if !ok || seen[dc.GetDatasourceID()] {
+			continue
+		}
+		seen[dc.GetDatasourceID()] = true
+		ids = append(ids, dc.GetDatasourceID())
+	}
+	return ids
+}
+
+// observe records the evaluation against the datasources of the rule, and
+// returns the slowdowns of the datasources which changed with it. The
+// evaluations failing on the rule itself, such as a missing datasource,
+// say nothing about the health of the datasources and are left out.
+func (h *datasourceHealth) observe(evalContext *EvalContext) map[int64]int64 {
+	if evalContext.Skipped || (evalContext.Error != nil && !isRetryable(evalContext.Error)) {
+		return nil
+	}
+	ids := ruleDatasources(evalContext.Rule)
+	if len(ids) == 0 {
+		return nil
+	}
+	latency := evalContext.EndTime.Sub(evalContext.StartTime)
+	failed := evalContext.Error != nil
+
+	h.Lock()
+	defer h.Unlock()
+
+	var changed map[int64]int64
+	for _, id := range ids {
+		s, ok := h.sources[id]
+		if !ok {
+			s = &datasourceSamples{score: 1, slowdown: 1}
+			h.sources[id] = s
+		}
+		if len(s.latencies) < datasourceHealthSamples {
+			s.latencies = append(s.latencies, latency)
+			s.failures = append(s.failures, failed)
+		} else {
+			s.latencies[s.next] = latency
+			s.failures[s.next] = failed
+			s.next = (s.next + 1) % datasourceHealthSamples
+		}
+
+		s.score = h.score(s)
+		slowdown := h.slowdown(s)
+		if slowdown == s.slowdown {
+			continue
+		}
+		if slowdown > s.slowdown {
+			h.log.Warn("Datasource health degraded, evaluating its alert rules less often", "datasourceId", id, "score", s.score, "slowdown", slowdown)
+		} else {
+			h.log.Info("Datasource health recovering, evaluating its alert rules more often", "datasourceId", id, "score", s.score, "slowdown", slowdown)
+		}
+		s.slowdown = slowdown
+		if changed == nil {
+			changed = make(map[int64]int64)
+		}
+		changed[id] = slowdown
+	}
+	return changed
+}
+
+// score combines the ratio of successful evaluations with the ratio of the
+// latency to the average latency, when it is higher.
+func (h *datasourceHealth) score(s *datasourceSamples) float64 {
+	var total time.Duration
+	successes := 0
+	for i, latency := range s.latencies {
+		total += latency
+		if !s.failures[i] {
+			successes++
+		}
+	}
+	score := float64(successes) / float64(len(s.latencies))
+	average := total / time.Duration(len(s.latencies))
+	if h.latency > 0 && average > h.latency {
+		score *= float64(h.latency) / float64(average)
+	}
+	return score
+}
+
+// slowdown returns the number of times the intervals of the rules of the
+// datasource are stretched by, growing as its score drops below the threshold.
+func (h *datasourceHealth) slowdown(s *datasourceSamples) int64 {
+	if h.threshold <= 0 || len(s.latencies) < datasourceHealthMinSamples || s.score >= h.threshold {
+		return 1
+	}
+	if s.score <= 0 {
+		return maxAdmissionSlowdown
+	}
+	slowdown := int64(math.Ceil(h.threshold / s.score))
+	if slowdown > maxAdmissionSlowdown {
+		slowdown = maxAdmissionSlowdown
+	}
+	return slowdown
+}
+
+// setSettings changes the threshold and the latency the scores are computed
+// with, which apply as of the next evaluations.
+func (h *datasourceHealth) setSettings(threshold float64, latency time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+	h.threshold = threshold
+	h.latency = latency
+}
+
+// prune forgets the datasources no scheduled rule queries anymore, and
+// returns the ones whose rules were slowed down.
+func (h *datasourceHealth) prune(rules []*Rule) []int64 {
+	queried := make(map[int64]bool)
+	for _, rule := range rules {
+		for _, id := range ruleDatasources(rule) {
+			queried[id] = true
+		}
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	var released []int64
+	for id, s := range h.sources {
+		if queried[id] {
+			continue
+		}
+		if s.slowdown > 1 {
+			released = append(released, id)
+		}
+		delete(h.sources, id)
+	}
+	return released
+}
+
+// scores returns the health of the datasources, ordered by datasource id.
+func (h *datasourceHealth) scores() []DatasourceHealthScore {
+	h.Lock()
+	defer h.Unlock()
+
+	scores := make([]DatasourceHealthScore, 0, len(h.sources))
+	for id, s := range h.sources {
+		scores = append(scores, DatasourceHealthScore{DatasourceID: id, Score: s.score, Slowdown: s.slowdown, Samples: len(s.latencies)})
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].DatasourceID < scores[j].DatasourceID })
+	return scores
+}
+
+// Throttle stretches the intervals of the rules querying the datasource by
+// slowdown, a slowdown of 1 evaluating them at their frequency again.
+func (s *schedulerImpl) Throttle(datasourceID int64, slowdown int64) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if slowdown <= 1 {
+		delete(s.throttles, datasourceID)
+		return
+	}
+	s.throttles[datasourceID] = slowdown
+}
+
+// admit drops the rules of the degraded datasources from the jobs due until
+// their stretched interval elapsed since their last run, the highest
+// slowdown of their datasources applying. The boosted rules and the ones on
+// a wall-clock schedule are left alone. s.mtx must be held.
+func (s *schedulerImpl) admit(due []*Job, tickTime time.Time) []*Job {
+	if len(s.throttles) == 0 {
+		return due
+	}
+
+	admitted := due[:0]
+	for _, job := range due {
+		key := ruleKeyOf(job.Rule)
+		if _, boosted := s.boosts[key]; boosted || job.Rule.Schedule != nil {
+			admitted = append(admitted, job)
+			continue
+		}
+
+		slowdown := int64(1)
+		for _, id := range ruleDatasources(job.Rule) {
+			if s.throttles[id] > slowdown {
+				slowdown = s.throttles[id]
+			}
+		}
+		lastRun, ok := s.lastRuns[key]
+		if slowdown > 1 && ok && tickTime.Sub(lastRun) < time.Duration(job.Rule.Frequency*slowdown)*time.Second {
+			s.log.Debug("Skipping the alert rule, its datasource is degraded", "ruleId", key.id, "slowdown", slowdown, "lastRun", lastRun)
+			continue
+		}
+		admitted = append(admitted, job)
+	}
+	return admitted
+}
+
+// DatasourceHealthScores returns the health of the datasources queried by
+// the alert rules, ordered by datasource id.
+func (e *AlertEngine) DatasourceHealthScores() []DatasourceHealthScore {
+	return e.dsHealth.scores()
+}
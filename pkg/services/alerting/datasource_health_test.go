@@ -0,0 +1,167 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+// latencyEvalHandler evaluates the rules in latency, failing with err.
+type latencyEvalHandler struct {
+	latency time.Duration
+	err     error
+}
+
+func (h *latencyEvalHandler) Eval(evalContext *EvalContext) {
+	evalContext.EndTime = evalContext.StartTime.Add(h.latency)
+	evalContext.Error = h.err
+}
+
+func TestDatasourceHealth(t *testing.T) {
+	rule := &Rule{ID: 1, Conditions: []Condition{&conditionStub{datasourceID: 1}, &conditionStub{datasourceID: 2}}}
+	observe := func(h *datasourceHealth, latency time.Duration, err error) map[int64]int64 {
+		start := time.Now()
+		return h.observe(&EvalContext{Rule: rule, StartTime: start, EndTime: start.Add(latency), Error: err})
+	}
+	failure := errors.New("connection refused")
+
+	t.Run("the rules of a failing datasource are slowed down once it has enough samples", func(t *testing.T) {
+		h := newDatasourceHealth(0.5, 10*time.Second)
+		for i := 0; i < datasourceHealthMinSamples-1; i++ {
+			require.Empty(t, observe(h, time.Second, failure))
+		}
+		require.Equal(t, map[int64]int64{1: maxAdmissionSlowdown, 2: maxAdmissionSlowdown}, observe(h, time.Second, failure))
+
+		scores := h.scores()
+		require.Len(t, scores, 2)
+		require.Equal(t, DatasourceHealthScore{DatasourceID: 1, Score: 0, Slowdown: maxAdmissionSlowdown, Samples: datasourceHealthMinSamples}, scores[0])
+	})
+
+	t.Run("the slowdown grows with the latency", func(t *testing.T) {
+		h := newDatasourceHealth(0.5, 10*time.Second)
+		for i := 0; i < datasourceHealthMinSamples; i++ {
+			observe(h, 10*time.Second, nil)
+		}
+		require.Equal(t, 1.0, h.scores()[0].Score)
+		require.Equal(t, int64(1), h.scores()[0].Slowdown)
+
+		for i := 0; i < datasourceHealthSamples; i++ {
+			observe(h, 40*time.Second, nil)
+		}
+		require.Equal(t, 0.25, h.scores()[0].Score)
+		require.Equal(t, int64(2), h.scores()[0].Slowdown)
+	})
+
+	t.Run("the rules are evaluated at their frequency again as the datasource recovers", func(t *testing.T) {
+		h := newDatasourceHealth(0.5, 10*time.Second)
+		for i := 0; i < datasourceHealthSamples; i++ {
+			observe(h, time.Second, failure)
+		}
+		require.Equal(t, int64(maxAdmissionSlowdown), h.scores()[0].Slowdown)
+
+		var changed map[int64]int64
+		for i := 0; i < datasourceHealthSamples/2; i++ {
+			changed = observe(h, time.Second, nil)
+		}
+		require.Equal(t, map[int64]int64{1: 1, 2: 1}, changed, "half the evaluations succeeding is healthy enough")
+	})
+
+	t.Run("the evaluations failing on the rule are left out", func(t *testing.T) {
+		h := newDatasourceHealth(0.5, 10*time.Second)
+		observe(h, time.Second, models.ErrDataSourceNotFound)
+		require.Empty(t, h.scores())
+	})
+
+	t.Run("the datasources no rule queries are forgotten", func(t *testing.T) {
+		h := newDatasourceHealth(0.5, 10*time.Second)
+		for i := 0; i < datasourceHealthMinSamples; i++ {
+			observe(h, time.Second, failure)
+		}
+		released := h.prune([]*Rule{{ID: 1, Conditions: []Condition{&conditionStub{datasourceID: 2}}}})
+		require.Equal(t, []int64{1}, released)
+		require.Len(t, h.scores(), 1)
+	})
+}
+
+func TestSchedulerAdmission(t *testing.T) {
+	origMinInterval := setting.AlertingMinInterval
+	t.Cleanup(func() { setting.AlertingMinInterval = origMinInterval })
+	setting.AlertingMinInterval = 1
+
+	evaluations := func(sc *schedulerImpl, from time.Time, seconds int) map[int64]int {
+		execQueue := make(chan *Job, 100)
+		counts := make(map[int64]int)
+		for i := 0; i < seconds; i++ {
+			sc.Tick(from.Add(time.Duration(i)*time.Second), execQueue)
+			for len(execQueue) > 0 {
+				counts[(<-execQueue).Rule.ID]++
+			}
+		}
+		return counts
+	}
+
+	sc := newScheduler().(*schedulerImpl)
+	sc.Update([]*Rule{
+		{ID: 1, Frequency: 10, Conditions: []Condition{&conditionStub{datasourceID: 1}}},
+		{ID: 2, Frequency: 10, Conditions: []Condition{&conditionStub{datasourceID: 2}}},
+	})
+	start := time.Unix(1000, 0)
+	counts := evaluations(sc, start, 120)
+	require.Equal(t, 12, counts[1])
+	require.Equal(t, 12, counts[2])
+
+	sc.Throttle(1, 3)
+	counts = evaluations(sc, start.Add(120*time.Second), 120)
+	require.Equal(t, 4, counts[1], "the rules of the degraded datasource are evaluated every 30s")
+	require.Equal(t, 12, counts[2], "the rules of the other datasources are not slowed down")
+
+	sc.Throttle(1, 1)
+	counts = evaluations(sc, start.Add(240*time.Second), 120)
+	require.Equal(t, 12, counts[1])
+}
+
+func TestEngineDatasourceAdmission(t *testing.T) {
+	origEvaluationTimeout, origNotificationTimeout, origMaxAttempts := setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts
+	t.Cleanup(func() {
+		setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts = origEvaluationTimeout, origNotificationTimeout, origMaxAttempts
+	})
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.resultHandler = &FakeResultHandler{}
+	engine.resultQueue = nil
+	engine.dsHealth = newDatasourceHealth(0.5, 10*time.Second)
+	sc := engine.scheduler.(*schedulerImpl)
+
+	rule := &Rule{ID: 1, OrgID: 1, Frequency: 10, State: models.AlertStateOK, Conditions: []Condition{&conditionStub{datasourceID: 1}}}
+	evaluate := func(evalHandler evalHandler, times int) {
+		engine.evalHandler = evalHandler
+		for i := 0; i < times; i++ {
+			require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}))
+		}
+	}
+
+	// the latency of the datasource rises, then its evaluations time out
+	evaluate(&latencyEvalHandler{latency: time.Second}, datasourceHealthMinSamples)
+	require.Empty(t, sc.throttles)
+	evaluate(&latencyEvalHandler{latency: 30 * time.Second}, datasourceHealthSamples)
+	require.Equal(t, int64(2), sc.throttles[1])
+	evaluate(&latencyEvalHandler{latency: 30 * time.Second, err: context.DeadlineExceeded}, datasourceHealthSamples/2)
+	require.Equal(t, int64(3), sc.throttles[1])
+
+	scores := engine.DatasourceHealthScores()
+	require.Len(t, scores, 1)
+	require.Equal(t, int64(3), scores[0].Slowdown)
+
+	evaluate(&latencyEvalHandler{latency: time.Second}, datasourceHealthSamples)
+	require.Empty(t, sc.throttles, "the datasource recovered")
+	require.Equal(t, 1.0, engine.DatasourceHealthScores()[0].Score)
+}
@@ -0,0 +1,143 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDeadLetterNotFound is returned when the failed evaluation is not in
+	// the dead letter store.
+	ErrDeadLetterNotFound = errors.New("failed evaluation not found")
+	// ErrRuleEvaluating is returned when the alert rule is being evaluated.
+	ErrRuleEvaluating = errors.New("alert rule is being evaluated")
+)
+
+// FailedEval is an evaluation of an alert rule which failed all its attempts.
+type FailedEval struct {
+	// ID identifies the failed evaluation in the dead letter store.
+	ID       int64
+	RuleID   int64
+	OrgID    int64
+	RuleName string
+	Error    string
+	Attempts int
+	Time     time.Time
+}
+
+// DeadLetterStore keeps the evaluations which failed all their attempts, for
+// them to be triaged and replayed later.
+type DeadLetterStore interface {
+	// Add records the failed evaluation, the store setting its ID.
+	Add(eval FailedEval) error
+
+	// List returns the failed evaluations, the oldest first.
+	List() ([]FailedEval, error)
+
+	// Remove drops the failed evaluation, e.g. once it was replayed.
+	Remove(id int64) error
+}
+
+// deadLetterLimit is the number of failed evaluations the in-memory dead
+// letter store keeps, the oldest ones being dropped first.
+var deadLetterLimit = 1000
+
+// memoryDeadLetters is the DeadLetterStore used when none is set.
+type memoryDeadLetters struct {
+	mtx    sync.Mutex
+	nextID int64
+	evals  []FailedEval
+}
+
+func (m *memoryDeadLetters) Add(eval FailedEval) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.nextID++
+	eval.ID = m.nextID
+	m.evals = append(m.evals, eval)
+	if len(m.evals) > deadLetterLimit {
+		m.evals = append([]FailedEval(nil), m.evals[len(m.evals)-deadLetterLimit:]...)
+	}
+	return nil
+}
+
+func (m *memoryDeadLetters) List() ([]FailedEval, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return append([]FailedEval(nil), m.evals...), nil
+}
+
+func (m *memoryDeadLetters) Remove(id int64) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for i, eval := range m.evals {
+		if eval.ID == id {
+			m.evals = append(m.evals[:i], m.evals[i+1:]...)
+			return nil
+		}
+	}
+	return ErrDeadLetterNotFound
+}
+
+// recordDeadLetter records the evaluation which failed all its attempts.
+func (e *AlertEngine) recordDeadLetter(evalContext *EvalContext, attempts int) {
+	eval := FailedEval{
+		RuleID:   evalContext.Rule.ID,
+		OrgID:    evalContext.Rule.OrgID,
+		RuleName: evalContext.Rule.Name,
+		Error:    evalContext.Error.Error(),
+		Attempts: attempts,
+		Time:     e.clock.Now(),
+	}
+	if err := e.DeadLetterStore.Add(eval); err != nil {
+		e.log.Error("Failed to record the failed alert rule evaluation", "alertId", eval.RuleID, "error", err)
+	}
+}
+
+// DeadLetters returns the evaluations which failed all their attempts, the
+// oldest first.
+func (e *AlertEngine) DeadLetters() []FailedEval {
+	evals, err := e.DeadLetterStore.List()
+	if err != nil {
+		e.log.Error("Failed to list the failed alert rule evaluations", "error", err)
+		return nil
+	}
+	return evals
+}
+
+// ReplayDeadLetter evaluates the alert rule of the failed evaluation again,
+// right away, and drops the failed evaluation once the rule is evaluated.
+// The rule is evaluated as of now, the failed evaluation being recorded
+// again if it still fails. It returns ErrRuleNotScheduled if the rule is
+// not scheduled anymore and ErrRuleEvaluating if it is being evaluated.
+func (e *AlertEngine) ReplayDeadLetter(ctx context.Context, id int64) error {
+	evals, err := e.DeadLetterStore.List()
+	if err != nil {
+		return err
+	}
+
+	for _, eval := range evals {
+		if eval.ID != id {
+			continue
+		}
+		job, ok := e.scheduler.Job(ruleKey{orgID: eval.OrgID, id: eval.RuleID})
+		if !ok {
+			return ErrRuleNotScheduled
+		}
+		// the job is set as running so the scheduler doesn't enqueue it meanwhile
+		if !job.claim() {
+			return ErrRuleEvaluating
+		}
+
+		e.log.Info("Replaying the failed alert rule evaluation", "alertId", eval.RuleID, "failedAt", eval.Time)
+		if err := e.processJobWithRetry(ctx, job); err != nil {
+			return err
+		}
+		return e.DeadLetterStore.Remove(id)
+	}
+	return ErrDeadLetterNotFound
+}
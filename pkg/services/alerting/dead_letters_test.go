@@ -0,0 +1,120 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+// deadLettersEvalHandler records the number of dead letters while the rule is evaluated.
+type deadLettersEvalHandler struct {
+	*FakeEvalHandler
+	engine      *AlertEngine
+	deadLetters int
+}
+
+func (h *deadLettersEvalHandler) Eval(evalContext *EvalContext) {
+	h.deadLetters = len(h.engine.DeadLetters())
+	h.FakeEvalHandler.Eval(evalContext)
+}
+
+func TestEngineDeadLetters(t *testing.T) {
+	origEvaluationTimeout, origNotificationTimeout, origMaxAttempts := setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts
+	t.Cleanup(func() {
+		setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts = origEvaluationTimeout, origNotificationTimeout, origMaxAttempts
+	})
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 2
+
+	newEngine := func() *AlertEngine {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.resultHandler = &FakeResultHandler{}
+		engine.resultQueue = nil
+		return engine
+	}
+
+	t.Run("the evaluations failing all their attempts are dead letters", func(t *testing.T) {
+		engine := newEngine()
+		engine.evalHandler = NewFakeEvalHandler(0)
+		rule := &Rule{ID: 1, OrgID: 2, Name: "failing", State: models.AlertStateOK}
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}))
+
+		deadLetters := engine.DeadLetters()
+		require.Len(t, deadLetters, 1)
+		require.Equal(t, int64(1), deadLetters[0].RuleID)
+		require.Equal(t, int64(2), deadLetters[0].OrgID)
+		require.Equal(t, "failing", deadLetters[0].RuleName)
+		require.Equal(t, "Fake evaluation failure", deadLetters[0].Error)
+		require.Equal(t, 2, deadLetters[0].Attempts)
+		require.False(t, deadLetters[0].Time.IsZero())
+	})
+
+	t.Run("the evaluations succeeding on a retry are not", func(t *testing.T) {
+		engine := newEngine()
+		engine.evalHandler = NewFakeEvalHandler(2)
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 1, OrgID: 2}}))
+		require.Empty(t, engine.DeadLetters())
+	})
+
+	t.Run("the dead letters are replayed", func(t *testing.T) {
+		engine := newEngine()
+		engine.evalHandler = NewFakeEvalHandler(0)
+		rule := &Rule{ID: 1, OrgID: 2, Frequency: 10, State: models.AlertStateOK}
+		engine.scheduler.Update([]*Rule{rule})
+		job, ok := engine.scheduler.Job(ruleKeyOf(rule))
+		require.True(t, ok)
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		deadLetters := engine.DeadLetters()
+		require.Len(t, deadLetters, 1)
+
+		require.ErrorIs(t, engine.ReplayDeadLetter(context.Background(), deadLetters[0].ID+1), ErrDeadLetterNotFound)
+
+		job.SetRunning(true)
+		require.ErrorIs(t, engine.ReplayDeadLetter(context.Background(), deadLetters[0].ID), ErrRuleEvaluating)
+		require.Len(t, engine.DeadLetters(), 1, "the dead letters of the rules being evaluated are kept")
+		job.SetRunning(false)
+
+		evalHandler := &deadLettersEvalHandler{FakeEvalHandler: NewFakeEvalHandler(1), engine: engine}
+		engine.evalHandler = evalHandler
+		require.NoError(t, engine.ReplayDeadLetter(context.Background(), deadLetters[0].ID))
+		require.Equal(t, 1, evalHandler.CallNb, "the rule is evaluated again")
+		require.Equal(t, 1, evalHandler.deadLetters, "the evaluation is dropped once the rule is evaluated again")
+		require.Empty(t, engine.DeadLetters(), "the replayed evaluation is dropped")
+		require.False(t, job.GetRunning())
+	})
+
+	t.Run("the dead letters of the rules not scheduled anymore are not replayed", func(t *testing.T) {
+		engine := newEngine()
+		engine.evalHandler = NewFakeEvalHandler(0)
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 1, OrgID: 2}}))
+		deadLetters := engine.DeadLetters()
+		require.Len(t, deadLetters, 1)
+		require.ErrorIs(t, engine.ReplayDeadLetter(context.Background(), deadLetters[0].ID), ErrRuleNotScheduled)
+		require.Len(t, engine.DeadLetters(), 1)
+	})
+}
+
+func TestMemoryDeadLettersLimit(t *testing.T) {
+	origLimit := deadLetterLimit
+	t.Cleanup(func() { deadLetterLimit = origLimit })
+	deadLetterLimit = 2
+
+	store := &memoryDeadLetters{}
+	for i := int64(1); i <= 3; i++ {
+		require.NoError(t, store.Add(FailedEval{RuleID: i}))
+	}
+	evals, err := store.List()
+	require.NoError(t, err)
+	require.Len(t, evals, 2, "the oldest failed evaluations are dropped")
+	require.Equal(t, int64(2), evals[0].RuleID)
+	require.Equal(t, int64(3), evals[1].RuleID)
+
+	require.NoError(t, store.Remove(evals[0].ID))
+	require.ErrorIs(t, store.Remove(evals[0].ID), ErrDeadLetterNotFound)
+}
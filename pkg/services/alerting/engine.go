@@ -4,11 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
 	"github.com/grafana/grafana/pkg/infra/remotecache"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/plugins"
@@ -19,6 +25,7 @@ import (
 	"github.com/opentracing/opentracing-go/ext"
 	tlog "github.com/opentracing/opentracing-go/log"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 // AlertEngine is the background process that
@@ -32,22 +39,119 @@ type AlertEngine struct {
 	Cfg                *setting.Cfg                  `inject:""`
 	RemoteCacheService *remotecache.RemoteCache      `inject:""`
 
+	// StateStore persists the alert states across restarts.
+	// The alert table is used when not set.
+	StateStore StateStore
+
+	// Lease elects the active cluster alerting instance.
+	// A lease stored in the remote cache is used when not set.
+	Lease ClusterLease
+
+	// DeadLetterStore keeps the evaluations which failed all their attempts.
+	// They are kept in memory when not set.
+	DeadLetterStore DeadLetterStore
+
+	// StateSeriesStore stores the state series of the alert rules.
+	// They are kept in memory for stateSeriesRetention when not set.
+	StateSeriesStore StateSeriesStore
+
+	// PanicHandler is called with the value and the stack of the panics
+	// recovered by the engine, e.g. to report them to an error tracker.
+	// The panics are logged when not set.
+	PanicHandler func(recovered interface{}, stack []byte)
+
 	execQueue     chan *Job
+	clock         clock.Clock
 	ticker        *Ticker
 	scheduler     scheduler
 	evalHandler   evalHandler
 	ruleReader    ruleReader
 	log           log.Logger
 	resultHandler resultHandler
+	resultQueue   chan *EvalContext
+	evalWebhook   *evalWebhookSender
+	evalEvents    *evalEventPublisher
+	stateSeries   *stateSeriesWriter
+	activity      *engineActivity
+	heartbeat     *heartbeat
+	costBudget    *semaphore.Weighted
+	maxCost       int64
+
+	// unfinishedWorkTimeout is the time given to in-flight jobs
+	// to finish once the grafana server context is canceled.
+	unfinishedWorkTimeout time.Duration
+
+	// settingsLock guards the settings cached by the engine which
+	// are changed when the settings are reloaded.
+	settingsLock sync.RWMutex
+
+	restoredStates *restoredStates
+
+	evalMiddlewares   []EvalMiddleware
+	resultMiddlewares []ResultMiddleware
+
+	lastEvaluations *lastEvaluations
+	previousValues  *previousValues
+	traces          *ruleTraces
+	evalLag         *evalLagDetector
+	dsHealth        *datasourceHealth
+	staleEvals      *staleEvaluations
+	ruleMetrics     *ruleMetrics
+	tombstones      *ruleTombstones
+	throughput      *throughputStats
+	live            *liveStats
+	inflight        *inflightEvals
+	runningJobs     *runningJobs
+	configErrors    *missingDatasources
+	pinned          *pinnedRules
+	instruments     *evalInstruments
+	inhibitor       *inhibitor
+	silences        *silences
+	notifier        *notificationService
+	notifierStats   *notifierStats
+	flapDetector    *flapDetector
+	runtimes        *ruleRuntimes
+	startupHold     *startupHold
+	notifierless    *notifierlessRules
+	stateResets     *stateResets
+	// notifyReset notifies the reset of the state of a rule through the
+	// notification service of the result handler.
+	notifyReset func(evalContext *EvalContext)
+
+	// rulesChanged is set when the engine changes the stored rules, for
+	// them to be reloaded on the next tick. It is only updated atomically.
+	rulesChanged int32
+	// updateRulesLock serializes the updates of the rules of the ticker
+	// with the ones requested with RefreshRules.
+	updateRulesLock sync.Mutex
+
+	wasActiveInstance bool
+	// lastActiveInstance is the active instance last retrieved.
+	lastActiveInstance string
+	cacheOutage        *cacheOutage
+
+	partition      *workPartition
+	assignment     map[string][]int64
+	assignmentLock sync.RWMutex
+
+	stopOnce       sync.Once
+	stopChan       chan struct{}
+	dispatcherDone chan struct{}
+	runDone        chan struct{}
+	runningLock    sync.Mutex
+	running        bool
 }
 
 type ClusterAlertingInstance struct {
 	Instance string
+	// Renewals counts the renewals of the lease by the instance.
+	Renewals int64
 }
 
 func init() {
 	registry.RegisterService(&AlertEngine{})
 	remotecache.Register(&ClusterAlertingInstance{})
+	remotecache.Register(&RuleState{})
 }
 
 // IsDisabled returns true if the alerting service is disable for this instance.
@@ -57,30 +161,195 @@ func (e *AlertEngine) IsDisabled() bool {
 
 // Init initializes the AlertingService.
 func (e *AlertEngine) Init() error {
-	e.ticker = NewTicker(time.Now(), time.Second*0, clock.New(), 1)
+	e.clock = clock.New()
+	e.ticker = NewTicker(time.Now(), time.Second*0, e.clock, 1)
+	e.unfinishedWorkTimeout = setting.AlertingShutdownGracePeriod
 	e.execQueue = make(chan *Job, 1000)
 	e.scheduler = newScheduler()
+	e.activity = newEngineActivity()
+	if s, ok := e.scheduler.(*schedulerImpl); ok {
+		s.activity = e.activity
+	}
 	e.evalHandler = NewEvalHandler(e.DataService)
-	e.ruleReader = newRuleReader()
+	selector, err := parseLabelSelector(setting.AlertingRuleSelector)
+	if err != nil {
+		return err
+	}
+	e.ruleReader = newRuleReader(selector)
 	e.log = log.New("alerting.engine")
-	e.resultHandler = newResultHandler(e.RenderService)
+	e.stopChan = make(chan struct{})
+	e.dispatcherDone = make(chan struct{})
+	e.runDone = make(chan struct{})
+	e.lastEvaluations = newLastEvaluations()
+	e.previousValues = newPreviousValues()
+	e.traces = newRuleTraces()
+	e.evalLag = newEvalLagDetector(setting.AlertingEvalLagThreshold)
+	e.dsHealth = newDatasourceHealth(setting.AlertingDatasourceHealthThreshold, setting.AlertingDatasourceHealthLatency)
+	e.staleEvals = newStaleEvaluations(setting.AlertingStaleEvaluationThreshold)
+	e.ruleMetrics = newRuleMetrics(setting.AlertingMetricsPerRule, setting.AlertingMetricsPerRuleTag, setting.AlertingMetricsPerRuleMaxLabels)
+	e.tombstones = newRuleTombstones(setting.AlertingDeletedRuleGracePeriod)
+	e.notifierless = newNotifierlessRules(setting.AlertingNotifierlessRules)
+	e.stateResets = newStateResets()
+	e.live = &liveStats{}
+	e.inflight = newInflightEvals()
+	e.runningJobs = newRunningJobs()
+	e.configErrors = newMissingDatasources()
+	e.instruments = newGlobalEvalInstruments()
+	e.cacheOutage = &cacheOutage{}
+
+	if setting.AlertingMaxInFlightCost > 0 {
+		e.maxCost = setting.AlertingMaxInFlightCost
+		e.costBudget = semaphore.NewWeighted(e.maxCost)
+	}
+	e.throughput = newThroughputStats(e.clock.Now(), e.maxCost)
+
+	if setting.AlertingEvalWebhookURL != "" {
+		e.evalWebhook = newEvalWebhookSender(setting.AlertingEvalWebhookURL, setting.AlertingEvalWebhookTimeout, setting.AlertingEvalWebhookMaxAttempts)
+	}
+
+	e.evalEvents = newEvalEventPublisher(registeredEvalEventSink())
+
+	if setting.AlertingHeartbeatURL != "" {
+		e.heartbeat = newHeartbeat(setting.AlertingHeartbeatURL, setting.AlertingHeartbeatInterval, setting.AlertingClusteringInstance)
+	}
+
+	if e.Lease == nil && e.RemoteCacheService != nil {
+		lease := newCacheLease(e.RemoteCacheService, time.Second*time.Duration(setting.AlertingClusteringTimeout), e.clock)
+		lease.setBackoff(setting.AlertingClusteringStandbyBackoff)
+		e.Lease = lease
+	}
+
+	var presenceCache remotecache.CacheStorage
+	if e.RemoteCacheService != nil {
+		presenceCache = e.RemoteCacheService
+	}
+	e.pinned = newPinnedRules(presenceCache, time.Second*time.Duration(setting.AlertingClusteringTimeout))
+
+	if setting.AlertingClusteringEnabled && (len(setting.AlertingClusteringAssignments) > 0 || len(setting.AlertingClusteringWeights) > 0) {
+		partition, err := newWorkPartition(setting.AlertingClusteringAssignments, setting.AlertingClusteringWeights, setting.AlertingClusteringFallbackInstance)
+		if err != nil {
+			return err
+		}
+		e.partition = partition
+	}
+
+	if e.StateStore == nil {
+		if e.RemoteCacheService != nil {
+			e.StateStore = newCacheStateStore(e.RemoteCacheService)
+		} else {
+			e.StateStore = &memoryStateStore{}
+		}
+	}
+	if e.DeadLetterStore == nil {
+		e.DeadLetterStore = &memoryDeadLetters{}
+	}
+	if e.StateSeriesStore == nil {
+		e.StateSeriesStore = newMemoryStateSeries(stateSeriesRetention, stateSeriesMaxPoints)
+	}
+	e.stateSeries = newStateSeriesWriter(e.StateSeriesStore, e.handlePanic)
+	inhibitRules, err := parseInhibitRules(setting.AlertingInhibitRules)
+	if err != nil {
+		return err
+	}
+	e.inhibitor = newInhibitor(inhibitRules)
+	e.silences = newSilences(e.clock)
+	var dedupCache remotecache.CacheStorage
+	if e.RemoteCacheService != nil {
+		dedupCache = e.RemoteCacheService
+	}
+	resultHandler := newResultHandler(e.RenderService, e.StateStore, e.inhibitor, e.silences, dedupCache, e.clock)
+	e.notifier = resultHandler.notifier
+	e.notifierStats = resultHandler.notifier.stats
+	e.flapDetector = resultHandler.flapDetector
+	e.runtimes = resultHandler.runtimes
+	e.startupHold = resultHandler.startupHold
+	e.notifyReset = resultHandler.notifyReset
+	e.resultHandler = resultHandler
+	e.loadStates()
+	if setting.AlertingResultHandlerWorkers > 0 {
+		e.resultQueue = make(chan *EvalContext, 1000)
+	}
+
+	if e.Bus != nil {
+		e.Bus.AddHandler(e.handleReloadSettings)
+	}
+	return nil
+}
+
+// validateDependencies makes sure the injected services the engine relies on
+// are present, so a failed injection is reported at startup instead of
+// panicking during the first alert evaluation. The remote cache is optional,
+// the engine keeps its state in memory without it, but it is needed to elect
+// the active instance when clustering is enabled and no lease is set.
+func (e *AlertEngine) validateDependencies() error {
+	switch {
+	case e.DataService == nil:
+		return errors.New("alerting engine: missing dependency DataService")
+	case e.RenderService == nil:
+		return errors.New("alerting engine: missing dependency RenderService")
+	case setting.AlertingClusteringEnabled && e.Lease == nil:
+		return errors.New("alerting engine: missing dependency RemoteCacheService, required for clustering")
+	case e.Bus == nil:
+		return errors.New("alerting engine: missing dependency Bus")
+	}
 	return nil
 }
 
 // Run starts the alerting service background process.
 func (e *AlertEngine) Run(ctx context.Context) error {
+	return e.run(ctx, true)
+}
+
+// RunDispatcher evaluates the jobs put on the exec queue with Enqueue, without
+// the ticker and the scheduler producing the jobs of the alert rules, so that
+// another job source can drive the engine. It is stopped like Run.
+func (e *AlertEngine) RunDispatcher(ctx context.Context) error {
+	return e.run(ctx, false)
+}
+
+func (e *AlertEngine) run(ctx context.Context, scheduleRules bool) error {
+	if err := e.validateDependencies(); err != nil {
+		return err
+	}
+
+	e.startupHold.start(e.clock)
+	e.runningLock.Lock()
+	e.running = true
+	e.runningLock.Unlock()
+	defer close(e.runDone)
+
 	alertGroup, ctx := errgroup.WithContext(ctx)
-	alertGroup.Go(func() error { return e.alertingTicker(ctx) })
+	if scheduleRules {
+		alertGroup.Go(func() error { return e.alertingTicker(ctx) })
+	}
 	alertGroup.Go(func() error { return e.runJobDispatcher(ctx) })
+	alertGroup.Go(func() error { return e.evalEvents.run(ctx, e.dispatcherDone) })
+	alertGroup.Go(func() error { return e.stateSeries.run(ctx, e.dispatcherDone) })
+	alertGroup.Go(func() error { return e.runEvalWatchdog(ctx, e.dispatcherDone) })
+	if e.resultQueue != nil {
+		for i := 0; i < setting.AlertingResultHandlerWorkers; i++ {
+			alertGroup.Go(func() error { return e.runResultWorker(ctx) })
+		}
+	}
 
 	err := alertGroup.Wait()
 	return err
 }
 
+// handlePanic hands a panic recovered by the engine over to the panic
+// handler, logging it along with msg when there is none.
+func (e *AlertEngine) handlePanic(msg string, recovered interface{}) {
+	if e.PanicHandler != nil {
+		e.PanicHandler(recovered, debug.Stack())
+		return
+	}
+	e.log.Error(msg, "error", recovered, "stack", log.Stack(2))
+}
+
 func (e *AlertEngine) alertingTicker(grafanaCtx context.Context) error {
 	defer func() {
 		if err := recover(); err != nil {
-			e.log.Error("Scheduler Panic: stopping alertingTicker", "error", err, "stack", log.Stack(1))
+			e.handlePanic("Scheduler Panic: stopping alertingTicker", err)
 		}
 	}()
 
@@ -88,48 +357,60 @@ func (e *AlertEngine) alertingTicker(grafanaCtx context.Context) error {
 
 	tickIndex := 0
 
+	warmingUp := setting.AlertingWarmupPeriod > 0
+	warmupEnd := e.clock.Now().Add(setting.AlertingWarmupPeriod)
+	if warmingUp {
+		e.log.Info("Warming up, the alert rules are not evaluated until the warm-up is over", "period", setting.AlertingWarmupPeriod)
+	}
+
 	for {
 		select {
 		case <-grafanaCtx.Done():
 			return grafanaCtx.Err()
+		case <-e.stopChan:
+			return nil
 		case tick := <-e.ticker.C:
+			e.live.tick(e.clock.Now())
+			e.activity.tick(tick)
+			if e.heartbeat != nil {
+				e.heartbeat.beat(tick)
+			}
+
 			// TEMP SOLUTION update rules ever tenth tick
-			if tickIndex%10 == 0 {
-				e.scheduler.Update(e.ruleReader.fetch())
+			if atomic.SwapInt32(&e.rulesChanged, 0) == 1 || tickIndex%10 == 0 {
+				e.updateRules(cluster_alerting_instance)
 			}
 
 			schedule_alerts := true
 			current_active_instance := cluster_alerting_instance
 
-			if setting.AlertingClusteringEnabled {
-				cache_record, err := e.RemoteCacheService.Get("cluster_alerting_instance")
-				if err != nil {
-					e.log.Warn("Alert Clustering: Could not retrieve the alerting instance", "instance", cluster_alerting_instance, "err", err)
-				}
-
-				if cluster_instance_record, ok := cache_record.(*ClusterAlertingInstance); ok {
-					current_active_instance = cluster_instance_record.Instance
+			if setting.AlertingClusteringEnabled && e.partition == nil {
+				schedule_alerts, current_active_instance = e.checkActiveInstance(cluster_alerting_instance)
+				if e.pinned.setActive(schedule_alerts) {
+					// the instance only schedules its pinned rules while standby
+					e.updateRules(cluster_alerting_instance)
 				}
+			}
 
-				if cache_record == nil || current_active_instance == cluster_alerting_instance {
-					err = e.RemoteCacheService.Set("cluster_alerting_instance",
-						&ClusterAlertingInstance{
-							Instance: cluster_alerting_instance,
-						},
-						time.Second*time.Duration(setting.AlertingClusteringTimeout),
-					)
-
-					if err != nil {
-						e.log.Warn("Alert Clustering: Could not set the cluster_alerting_instance in cache", "err", err)
-					}
-				} else {
-					schedule_alerts = false
-				}
+			if warmingUp && !e.clock.Now().Before(warmupEnd) {
+				warmingUp = false
+				e.log.Info("Warm-up over, evaluating the alert rules")
 			}
 
-			if schedule_alerts {
+			if warmingUp {
+				// the rules and the clustering state are kept up to date, but no rule is evaluated
+				e.staleEvals.reset(e.clock.Now())
+			} else if schedule_alerts {
+				e.scheduler.Tick(tick, e.execQueue)
+				e.staleEvals.check(e.clock.Now())
+			} else if e.pinned.hasLocal() {
+				// the rules pinned to a standby instance are evaluated all the same
 				e.scheduler.Tick(tick, e.execQueue)
+				metrics.MAlertingClusteringSkippedTicks.Inc()
 			} else {
+				// standbys don't evaluate the rules
+				e.staleEvals.reset(e.clock.Now())
+				metrics.MAlertingClusteringSkippedTicks.Inc()
 				if tickIndex%10 == 0 {
 					e.log.Debug("Alert Clustering enabled but this instance is not marked active: Skipping alerting.",
 						"instance",
@@ -140,91 +421,439 @@ func (e *AlertEngine) alertingTicker(grafanaCtx context.Context) error {
 				}
 			}
 
+			e.updateStatsMetrics()
 			tickIndex++
 		}
 	}
 }
 
+// updateRules fetches the alert rules and schedules the ones evaluated by the instance.
+func (e *AlertEngine) updateRules(instance string) {
+	if err := e.refreshRules(instance); err != nil {
+		// keep the current schedule rather than taking the error for the deletion of every rule
+		e.log.Error("Could not load alerts", "error", err)
+	}
+}
+
+// RefreshRules fetches the alert rules and schedules them right away, instead
+// of on the next periodic refresh of the ticker, e.g. for a provisioning tool
+// to know its rules are live once it returns. It is safe to call while the
+// engine runs. The current schedule is kept if the rules cannot be fetched.
+func (e *AlertEngine) RefreshRules() error {
+	return e.refreshRules(setting.AlertingClusteringInstance)
+}
+
+func (e *AlertEngine) refreshRules(instance string) error {
+	e.updateRulesLock.Lock()
+	defer e.updateRulesLock.Unlock()
+
+	fetched, err := e.ruleReader.fetch()
+	if err != nil {
+		return err
+	}
+
+	rules := e.restoreStates(e.tombstones.update(fetched, e.clock.Now()))
+	e.stateResets.forget(rules)
+	// the source rules of the inhibitions may be evaluated by other instances
+	e.inhibitor.sync(rules)
+	rules = e.notifierless.filter(rules)
+	if setting.AlertingClusteringEnabled {
+		e.pinned.observe(rules, instance, e.clock.Now())
+	}
+	if e.partition != nil {
+		// with explicit assignments every instance is active for its own rules
+		rules = e.partitionRules(rules, instance)
+	} else if setting.AlertingClusteringEnabled {
+		rules = e.pinned.filter(rules, instance)
+	}
+	e.scheduler.Update(rules)
+	e.staleEvals.update(rules, e.clock.Now())
+	e.lastEvaluations.prune(rules)
+	e.configErrors.prune(rules)
+	e.previousValues.prune(rules)
+	e.traces.prune(rules)
+	e.evalLag.prune(rules)
+	for _, id := range e.dsHealth.prune(rules) {
+		e.scheduler.Throttle(id, 1)
+	}
+	e.ruleMetrics.prune(rules)
+	e.flapDetector.prune(rules)
+	e.runtimes.prune(rules)
+	e.silences.expire()
+	return nil
+}
+
+// checkActiveInstance returns true if this instance is the active cluster alerting instance,
+// along with the name of the active instance. The active instance renews its lease so that
+// it stays active until it stops doing so for the clustering timeout. When the active instance
+// cannot be retrieved, the instance keeps its previous status until the failures turn into an
+// outage of the remote cache, and then follows the fail mode until the cache is available again.
+func (e *AlertEngine) checkActiveInstance(cluster_alerting_instance string) (bool, string) {
+	current_active_instance, err := e.Lease.Acquire(cluster_alerting_instance)
+	if err != nil {
+		if !e.cacheOutage.failed(e.clock.Now(), setting.AlertingClusteringFailThreshold) {
+			e.log.Warn("Alert Clustering: Could not retrieve the alerting instance, keeping the previous one", "instance", cluster_alerting_instance, "err", err, "active", e.lastActiveInstance)
+			current_active_instance = e.lastActiveInstance
+		} else {
+			e.log.Warn("Alert Clustering: Could not retrieve the alerting instance", "instance", cluster_alerting_instance, "err", err, "failMode", setting.AlertingClusteringFailMode)
+			if setting.AlertingClusteringFailMode == setting.ClusteringFailClosed {
+				// another instance may be active, don't risk duplicate notifications
+				current_active_instance = ""
+			} else {
+				current_active_instance = cluster_alerting_instance
+			}
+		}
+	} else {
+		if outage := e.cacheOutage.recovered(e.clock.Now()); outage > 0 {
+			e.log.Info("Alert Clustering: The alerting instance can be retrieved again, resuming clustering", "instance", cluster_alerting_instance, "outage", outage)
+		}
+		e.lastActiveInstance = current_active_instance
+	}
+	active := current_active_instance == cluster_alerting_instance
+
+	if active != e.wasActiveInstance {
+		e.log.Info("Alert Clustering: Instance active status changed", "instance", cluster_alerting_instance, "isActive", active, "active", current_active_instance)
+		e.wasActiveInstance = active
+	}
+
+	if active {
+		metrics.MAlertingActiveInstance.WithLabelValues(cluster_alerting_instance).Set(1)
+	} else {
+		metrics.MAlertingActiveInstance.WithLabelValues(cluster_alerting_instance).Set(0)
+	}
+
+	return active, current_active_instance
+}
+
 func (e *AlertEngine) runJobDispatcher(grafanaCtx context.Context) error {
+	defer close(e.dispatcherDone)
 	dispatcherGroup, alertCtx := errgroup.WithContext(grafanaCtx)
 
 	for {
 		select {
 		case <-grafanaCtx.Done():
 			return dispatcherGroup.Wait()
+		case <-e.stopChan:
+			// stop accepting new jobs and let the in-flight ones finish
+			return dispatcherGroup.Wait()
 		case job := <-e.execQueue:
-			dispatcherGroup.Go(func() error { return e.processJobWithRetry(alertCtx, job) })
+			e.throughput.dequeued(e.clock.Now(), job.GetEnqueuedAt())
+			atomic.AddInt64(&e.live.workers, 1)
+			if budget, _ := e.budget(); budget == nil {
+				dispatcherGroup.Go(func() error {
+					defer atomic.AddInt64(&e.live.workers, -1)
+					return e.processJobWithRetry(alertCtx, job)
+				})
+			} else {
+				dispatcherGroup.Go(func() error {
+					defer atomic.AddInt64(&e.live.workers, -1)
+					return e.processJobWithinBudget(alertCtx, job)
+				})
+			}
 		}
 	}
 }
 
-var (
-	unfinishedWorkTimeout = time.Second * 5
-)
+// Enqueue puts the job on the exec queue for the dispatcher to evaluate its
+// rule, waiting for room on the queue. The job is dropped once the engine is stopped.
+func (e *AlertEngine) Enqueue(job *Job) {
+	job.SetEnqueuedAt(e.clock.Now())
+	select {
+	case e.execQueue <- job:
+		e.activity.enqueued(job)
+	case <-e.stopChan:
+		rule := job.GetRule()
+		e.log.Warn("Dropping job enqueued after the engine stopped", "alertId", rule.ID, "name", rule.Name)
+	}
+}
+
+// budget returns the in-flight cost budget and its size, the budget
+// being nil when the cost of the jobs in flight is not limited.
+func (e *AlertEngine) budget() (*semaphore.Weighted, int64) {
+	e.settingsLock.RLock()
+	defer e.settingsLock.RUnlock()
+	return e.costBudget, e.maxCost
+}
+
+// processJobWithinBudget waits for the total cost of the jobs in flight to
+// leave room for the cost of the job before processing it.
+func (e *AlertEngine) processJobWithinBudget(grafanaCtx context.Context, job *Job) error {
+	budget, maxCost := e.budget()
+	if budget == nil {
+		// the budget was removed by a reload of the settings
+		return e.processJobWithRetry(grafanaCtx, job)
+	}
+
+	cost := jobCost(job, maxCost)
+	if err := budget.Acquire(grafanaCtx, cost); err != nil {
+		job.SetRunning(false)
+		return nil
+	}
+	defer budget.Release(cost)
+	e.throughput.busy(e.clock.Now(), cost)
+	defer func() { e.throughput.busy(e.clock.Now(), -cost) }()
+
+	return e.processJobWithRetry(grafanaCtx, job)
+}
+
+// jobCost returns the cost of the job, capped to the budget so that
+// a job more expensive than the whole budget can still run on its own.
+func jobCost(job *Job, maxCost int64) int64 {
+	cost := job.GetRule().Cost
+	if cost < 1 {
+		cost = 1
+	}
+	if cost > maxCost {
+		cost = maxCost
+	}
+	return cost
+}
+
+// for stubbing in tests
+// nolint: gocritic
+var traceSampleRand = rand.Float64
+
+// for stubbing in tests
+// nolint: gocritic
+var retryJitterRand = rand.Int63n
+
+// retryBackoff returns the delay before the retry of the failed attempt,
+// picked at random between zero and the exponential backoff of the attempt
+// (full jitter), so that the rules failing at the same time on the same
+// datasource don't retry all at once. It is zero when base is zero.
+func retryBackoff(attempt int, base, cap time.Duration) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	backoff := cap
+	if attempt < 62 && (cap <= 0 || base <= cap>>uint(attempt)) {
+		backoff = base << uint(attempt)
+	}
+	if backoff <= 0 {
+		// the backoff overflowed without a cap
+		backoff = time.Duration(math.MaxInt64 - 1)
+	}
+	return time.Duration(retryJitterRand(int64(backoff) + 1))
+}
+
+// retryMaxElapsedExceeded returns true if retrying the job after the delay
+// would have it retried for longer than the retries are allowed to take.
+func (e *AlertEngine) retryMaxElapsedExceeded(job *Job, delay time.Duration) bool {
+	maxElapsed := setting.AlertingRetryMaxElapsed
+	startedAt := job.GetStartedAt()
+	if maxElapsed <= 0 || startedAt.IsZero() {
+		return false
+	}
+	return e.clock.Now().Add(delay).Sub(startedAt) > maxElapsed
+}
+
+// shouldTraceEvaluation decides whether the evaluation of an alert is traced
+// according to the configured sample rate.
+func shouldTraceEvaluation() bool {
+	rate := setting.AlertingTraceSampleRate
+	return rate >= 1 || (rate > 0 && traceSampleRand() < rate)
+}
+
+// startEvaluationSpan starts the span of an alert evaluation, which is a no-op
+// span when the evaluation is not sampled.
+func startEvaluationSpan(sampled bool, opts ...opentracing.StartSpanOption) opentracing.Span {
+	if !sampled {
+		return opentracing.NoopTracer{}.StartSpan("alert execution", opts...)
+	}
+	return opentracing.StartSpan("alert execution", opts...)
+}
 
 func (e *AlertEngine) processJobWithRetry(grafanaCtx context.Context, job *Job) error {
 	defer func() {
 		if err := recover(); err != nil {
-			e.log.Error("Alert Panic", "error", err, "stack", log.Stack(1))
+			e.handlePanic("Alert Panic", err)
 		}
 	}()
 
-	cancelChan := make(chan context.CancelFunc, setting.AlertingMaxAttempts*2)
+	atomic.AddInt64(&e.live.inFlight, 1)
+	defer atomic.AddInt64(&e.live.inFlight, -1)
+
+	cancels := newJobCancels()
+	defer e.runningJobs.add(job, cancels)()
 	attemptChan := make(chan int, 1)
 
 	// Initialize with first attemptID=1
 	attemptChan <- 1
 	job.SetRunning(true)
+	job.SetStartedAt(e.clock.Now())
 
 	for {
 		select {
 		case <-grafanaCtx.Done():
 			// In case grafana server context is cancel, let a chance to job processing
 			// to finish gracefully - by waiting a timeout duration - before forcing its end.
-			unfinishedWorkTimer := time.NewTimer(unfinishedWorkTimeout)
+			e.settingsLock.RLock()
+			unfinishedWorkTimeout := e.unfinishedWorkTimeout
+			e.settingsLock.RUnlock()
+			unfinishedWorkTimer := e.clock.Timer(unfinishedWorkTimeout)
+			defer unfinishedWorkTimer.Stop()
 			select {
 			case <-unfinishedWorkTimer.C:
-				return e.endJob(grafanaCtx.Err(), cancelChan, job)
+				return e.endJob(grafanaCtx.Err(), cancels, job)
 			case <-attemptChan:
-				return e.endJob(nil, cancelChan, job)
+				return e.endJob(nil, cancels, job)
 			}
 		case attemptID, more := <-attemptChan:
 			if !more {
-				return e.endJob(nil, cancelChan, job)
+				return e.endJob(nil, cancels, job)
 			}
-			go e.processJob(attemptID, attemptChan, cancelChan, job)
+			go e.processJob(grafanaCtx, attemptID, attemptChan, cancels, job)
+		case <-cancels.abandoned:
+			// the attempt in progress is stuck, free the worker without waiting for it
+			return e.endJob(nil, cancels, job)
 		}
 	}
 }
 
-func (e *AlertEngine) endJob(err error, cancelChan chan context.CancelFunc, job *Job) error {
+// waitRetry waits for the delay before the next attempt of an evaluation,
+// and returns false when the engine stops meanwhile.
+func (e *AlertEngine) waitRetry(grafanaCtx context.Context, delay time.Duration) bool {
+	timer := e.clock.Timer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-grafanaCtx.Done():
+		return false
+	case <-e.stopChan:
+		return false
+	}
+}
+
+func (e *AlertEngine) endJob(err error, cancels *jobCancels, job *Job) error {
 	job.SetRunning(false)
-	close(cancelChan)
-	for cancelFn := range cancelChan {
+	e.throughput.evaluated(e.clock.Now())
+	cancels.cancelAll()
+	return err
+}
+
+// jobCancels keeps track of the cancel funcs of the contexts still in use
+// by the attempt in progress of a job, so they can be canceled if the job
+// is ended before the attempt completes. The job is ended right away, and
+// the result of its attempt dropped, once the attempt is abandoned.
+type jobCancels struct {
+	mtx       sync.Mutex
+	next      int
+	fns       map[int]context.CancelFunc
+	ended     bool
+	abandoned chan struct{}
+}
+
+func newJobCancels() *jobCancels {
+	return &jobCancels{fns: make(map[int]context.CancelFunc), abandoned: make(chan struct{})}
+}
+
+// add registers the cancel func of a context. It returns a func to call as
+// soon as the context is not needed anymore, which cancels and releases it.
+func (c *jobCancels) add(cancelFn context.CancelFunc) context.CancelFunc {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.ended {
 		cancelFn()
+		return cancelFn
+	}
+
+	id := c.next
+	c.next++
+	c.fns[id] = cancelFn
+
+	return func() {
+		c.mtx.Lock()
+		delete(c.fns, id)
+		c.mtx.Unlock()
+		cancelFn()
+	}
+}
+
+// cancelAll cancels the contexts still in use when the job ends.
+func (c *jobCancels) cancelAll() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.ended = true
+	for id, cancelFn := range c.fns {
+		cancelFn()
+		delete(c.fns, id)
+	}
+}
+
+// abandon cancels the contexts still in use and gives up on the attempt in progress.
+func (c *jobCancels) abandon() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	select {
+	case <-c.abandoned:
+		return
+	default:
+		close(c.abandoned)
+	}
+	for id, cancelFn := range c.fns {
+		cancelFn()
+		delete(c.fns, id)
 	}
-	return err
 }
 
-func (e *AlertEngine) processJob(attemptID int, attemptChan chan int, cancelChan chan context.CancelFunc, job *Job) {
+func (c *jobCancels) isAbandoned() bool {
+	select {
+	case <-c.abandoned:
+		return true
+	default:
+		return false
+	}
+}
+
+// len returns the number of contexts still in use.
+func (c *jobCancels) len() int {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return len(c.fns)
+}
+
+func (e *AlertEngine) processJob(grafanaCtx context.Context, attemptID int, attemptChan chan int, cancels *jobCancels, job *Job) {
 	defer func() {
 		if err := recover(); err != nil {
-			e.log.Error("Alert Panic", "error", err, "stack", log.Stack(1))
+			e.handlePanic("Alert Panic", err)
 		}
 	}()
 
 	alertCtx, cancelFn := context.WithTimeout(context.Background(), setting.AlertingEvaluationTimeout)
-	cancelChan <- cancelFn
-	span := opentracing.StartSpan("alert execution")
+	cancelFn = cancels.add(cancelFn)
+	sampled := shouldTraceEvaluation()
+	span := startEvaluationSpan(sampled)
 	alertCtx = opentracing.ContextWithSpan(alertCtx, span)
 
-	evalContext := NewEvalContext(alertCtx, job.Rule, e.RequestValidator)
+	// the scheduler replaces the rule of the job when the rules are reloaded
+	rule := job.GetRule()
+	e.restoreState(rule)
+	if e.stateResets.apply(rule) {
+		e.runtimes.reset(rule)
+	}
+	evalContext := NewEvalContext(alertCtx, rule, e.RequestValidator)
 	evalContext.Ctx = alertCtx
+	evalContext.runtime = e.runtimes.get(rule)
+	evalContext.IsDebug = e.traces.enabled(rule, e.clock.Now())
+	evalContext.batch = job.GetBatch()
+	evalContext.PreviousSeriesValues = e.previousValues.get(rule)
+	e.activity.evalStarted(evalContext, attemptID)
 
+	evaluated := e.inflight.add(rule, e.clock.Now(), cancels)
 	go func() {
 		defer func() {
 			if err := recover(); err != nil {
-				e.log.Error("Alert Panic", "error", err, "stack", log.Stack(1))
+				evaluated()
+				e.handlePanic("Alert Panic", err)
+				cancelFn()
+				if !sampled {
+					// failures are always traced
+					span = startEvaluationSpan(true, opentracing.StartTime(evalContext.StartTime))
+				}
 				ext.Error.Set(span, true)
 				span.LogFields(
 					tlog.Error(fmt.Errorf("%v", err)),
@@ -235,13 +864,35 @@ func (e *AlertEngine) processJob(attemptID int, attemptChan chan int, cancelChan
 			}
 		}()
 
-		e.evalHandler.Eval(evalContext)
+		e.eval(evalContext)
+		evaluated()
+		// the evaluation context is not needed anymore once the attempt is evaluated
+		cancelFn()
+
+		if cancels.isAbandoned() {
+			span.Finish()
+			e.log.Warn("Dropping the result of an abandoned alert rule evaluation", "alertId", evalContext.Rule.ID, "name", evalContext.Rule.Name, "attemptID", attemptID)
+			return
+		}
+
+		for id, slowdown := range e.dsHealth.observe(evalContext) {
+			e.scheduler.Throttle(id, slowdown)
+		}
+
+		if evalContext.Error != nil && !sampled {
+			// failures are always traced
+			sampled = true
+			span = startEvaluationSpan(sampled, opentracing.StartTime(evalContext.StartTime))
+		}
 
 		span.SetTag("alertId", evalContext.Rule.ID)
 		span.SetTag("dashboardId", evalContext.Rule.DashboardID)
 		span.SetTag("firing", evalContext.Firing)
 		span.SetTag("nodatapoints", evalContext.NoDataFound)
 		span.SetTag("attemptID", attemptID)
+		if evalContext.ConfigVersion != "" {
+			span.SetTag("configVersion", evalContext.ConfigVersion)
+		}
 
 		if evalContext.Error != nil {
 			ext.Error.Set(span, true)
@@ -249,33 +900,90 @@ func (e *AlertEngine) processJob(attemptID int, attemptChan chan int, cancelChan
 				tlog.Error(evalContext.Error),
 				tlog.String("message", "alerting execution attempt failed"),
 			)
-			if attemptID < setting.AlertingMaxAttempts {
-				span.Finish()
-				e.log.Debug("Job Execution attempt triggered retry", "timeMs", evalContext.GetDurationMs(), "alertId", evalContext.Rule.ID, "name", evalContext.Rule.Name, "firing", evalContext.Firing, "attemptID", attemptID)
-				attemptChan <- (attemptID + 1)
-				return
+			if attemptID < setting.AlertingMaxAttempts && isRetryable(evalContext.Error) {
+				delay := retryBackoff(attemptID, setting.AlertingRetryBackoffBase, setting.AlertingRetryBackoffCap)
+				if e.retryMaxElapsedExceeded(job, delay) {
+					e.log.Warn("Giving up retrying the alert rule evaluation, the retries are taking too long", "alertId", evalContext.Rule.ID, "name", evalContext.Rule.Name, "attemptID", attemptID, "maxElapsed", setting.AlertingRetryMaxElapsed)
+				} else {
+					span.Finish()
+					e.instruments.retried()
+					e.activity.evalDone(evalContext, attemptID)
+					e.log.Debug("Job Execution attempt triggered retry", "timeMs", evalContext.GetDurationMs(), "alertId", evalContext.Rule.ID, "name", evalContext.Rule.Name, "firing", evalContext.Firing, "attemptID", attemptID, "delay", delay)
+					if delay > 0 && !e.waitRetry(grafanaCtx, delay) {
+						e.log.Debug("Skipping the retry of the alert rule evaluation, the engine is stopping", "alertId", evalContext.Rule.ID, "name", evalContext.Rule.Name, "attemptID", attemptID)
+						close(attemptChan)
+						return
+					}
+					attemptChan <- (attemptID + 1)
+					return
+				}
+			}
+			if isRetryable(evalContext.Error) {
+				// the evaluation failed all its attempts
+				e.recordDeadLetter(evalContext, attemptID)
 			}
 		}
 
-		// create new context with timeout for notifications
-		resultHandleCtx, resultHandleCancelFn := context.WithTimeout(context.Background(), setting.AlertingNotificationTimeout)
-		cancelChan <- resultHandleCancelFn
-
-		// override the context used for evaluation with a new context for notifications.
-		// This makes it possible for notifiers to execute when datasources
-		// don't respond within the timeout limit. We should rewrite this so notifications
-		// don't reuse the evalContext and get its own context.
-		evalContext.Ctx = resultHandleCtx
-		evalContext.Rule.State = evalContext.GetNewState()
-		if err := e.resultHandler.handle(evalContext); err != nil {
-			switch {
-			case errors.Is(err, context.Canceled):
-				e.log.Debug("Result handler returned context.Canceled")
-			case errors.Is(err, context.DeadlineExceeded):
-				e.log.Debug("Result handler returned context.DeadlineExceeded")
-			default:
-				e.log.Error("Failed to handle result", "err", err)
-			}
+		now := e.clock.Now()
+		evalContext.Rule.State = evalContext.getNewStateAt(now)
+		evalContext.trackPendingState(now)
+		evalContext.trackResolvedState(now)
+		evalContext.trackBreaches()
+		evalContext.trackSeriesStates()
+		e.runtimes.record(evalContext)
+		if evalContext.Error != nil {
+			job.SetLastErrorAt(evalContext.EndTime)
+		} else {
+			job.SetLastErrorAt(time.Time{})
+		}
+		e.instruments.evaluated(evalContext)
+
+		if e.tombstones.isDeleted(evalContext.Rule) {
+			// the rule was deleted during the evaluation, don't write state or notify for it
+			span.Finish()
+			e.log.Debug("Dropping the result of a deleted alert rule", "alertId", evalContext.Rule.ID, "name", evalContext.Rule.Name, "attemptID", attemptID)
+			close(attemptChan)
+			return
+		}
+
+		e.lastEvaluations.record(evalContext)
+		e.configErrors.observe(evalContext)
+		e.previousValues.record(evalContext)
+		if evalContext.IsDebug {
+			e.traces.record(evalContext)
+		}
+		e.evalLag.observe(evalContext.Rule, time.Duration(evalContext.GetDurationMs()*float64(time.Millisecond)))
+		e.staleEvals.observe(evalContext.Rule, e.clock.Now())
+		e.ruleMetrics.observe(evalContext)
+		if e.evalWebhook != nil {
+			e.evalWebhook.send(evalContext)
+		}
+		e.evalEvents.publish(evalContext)
+		e.stateSeries.record(evalContext)
+		e.activity.evalDone(evalContext, attemptID)
+
+		queued := false
+		if e.resultQueue != nil {
+			// hand the result over to the result workers so that slow
+			// notifiers don't hold up the evaluation of the next rules. The
+			// workers get a copy of the rule since the next evaluation of
+			// the rule may start before the result is handled.
+			rule := *evalContext.Rule
+			evalContext.Rule = &rule
+			queued = e.enqueueResult(grafanaCtx, evalContext)
+		}
+		if !queued {
+			// create new context with timeout for notifications
+			resultHandleCtx, resultHandleCancelFn := context.WithTimeout(context.Background(), setting.AlertingNotificationTimeout)
+			resultHandleCancelFn = cancels.add(resultHandleCancelFn)
+
+			// override the context used for evaluation with a new context for notifications.
+			// This makes it possible for notifiers to execute when datasources
+			// don't respond within the timeout limit. We should rewrite this so notifications
+			// don't reuse the evalContext and get its own context.
+			evalContext.Ctx = resultHandleCtx
+			e.handleResult(evalContext)
+			resultHandleCancelFn()
 		}
 
 		span.Finish()
@@ -0,0 +1,143 @@
+package alerting
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// EngineEventType is the kind of activity of the engine an event is for.
+type EngineEventType string
+
+// Kinds of activity of the engine
+const (
+	EngineEventTick        EngineEventType = "tick"
+	EngineEventEnqueued    EngineEventType = "enqueued"
+	EngineEventEvalStarted EngineEventType = "eval_started"
+	EngineEventEvalDone    EngineEventType = "eval_done"
+	EngineEventStateChange EngineEventType = "state_change"
+)
+
+// EngineEvent is an activity of the engine streamed to the subscribers,
+// e.g. to tail what the engine is doing while debugging it live. The rule
+// fields are only set for the events of an alert rule.
+type EngineEvent struct {
+	Type      EngineEventType
+	Time      time.Time
+	RuleID    int64
+	RuleName  string
+	Attempt   int
+	State     models.AlertStateType
+	PrevState models.AlertStateType
+	Duration  time.Duration
+	Error     string
+}
+
+// engineSubscriberBuffer is the number of events a subscriber can lag
+// behind before its events are dropped.
+var engineSubscriberBuffer = 100
+
+// engineActivity streams the events of the engine to its subscribers. The
+// events are dropped for the subscribers which don't keep up, so that a
+// slow subscriber never holds up the engine.
+type engineActivity struct {
+	mtx         sync.RWMutex
+	subscribers map[int]chan EngineEvent
+	nextID      int
+	// count is the number of subscribers, read atomically for the events
+	// not to be built when nobody listens.
+	count int32
+}
+
+func newEngineActivity() *engineActivity {
+	return &engineActivity{subscribers: make(map[int]chan EngineEvent)}
+}
+
+func (a *engineActivity) subscribe() (<-chan EngineEvent, func()) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	id := a.nextID
+	a.nextID++
+	events := make(chan EngineEvent, engineSubscriberBuffer)
+	a.subscribers[id] = events
+	atomic.AddInt32(&a.count, 1)
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			a.mtx.Lock()
+			defer a.mtx.Unlock()
+			delete(a.subscribers, id)
+			atomic.AddInt32(&a.count, -1)
+			close(events)
+		})
+	}
+}
+
+// listened returns true if there is at least one subscriber.
+func (a *engineActivity) listened() bool {
+	return a != nil && atomic.LoadInt32(&a.count) > 0
+}
+
+func (a *engineActivity) publish(event EngineEvent) {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+	for _, events := range a.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+func (a *engineActivity) tick(tick time.Time) {
+	if a.listened() {
+		a.publish(EngineEvent{Type: EngineEventTick, Time: tick})
+	}
+}
+
+func (a *engineActivity) enqueued(job *Job) {
+	if a.listened() {
+		rule := job.GetRule()
+		a.publish(EngineEvent{Type: EngineEventEnqueued, Time: job.GetEnqueuedAt(), RuleID: rule.ID, RuleName: rule.Name})
+	}
+}
+
+func (a *engineActivity) evalStarted(evalContext *EvalContext, attempt int) {
+	if a.listened() {
+		a.publish(EngineEvent{Type: EngineEventEvalStarted, Time: evalContext.StartTime, RuleID: evalContext.Rule.ID,
+			RuleName: evalContext.Rule.Name, Attempt: attempt, State: evalContext.PrevAlertState})
+	}
+}
+
+// evalDone publishes the end of the evaluation, and the state change of
+// the rule when it changed.
+func (a *engineActivity) evalDone(evalContext *EvalContext, attempt int) {
+	if !a.listened() {
+		return
+	}
+
+	event := EngineEvent{Type: EngineEventEvalDone, Time: evalContext.EndTime, RuleID: evalContext.Rule.ID, RuleName: evalContext.Rule.Name,
+		Attempt: attempt, State: evalContext.Rule.State, PrevState: evalContext.PrevAlertState, Duration: evalContext.EndTime.Sub(evalContext.StartTime)}
+	if evalContext.Error != nil {
+		event.Error = evalContext.Error.Error()
+	}
+	a.publish(event)
+
+	if evalContext.shouldUpdateAlertState() {
+		event.Type = EngineEventStateChange
+		a.publish(event)
+	}
+}
+
+// Subscribe returns a channel streaming the activity of the engine, the
+// ticks, the jobs enqueued and the evaluations and state changes of the
+// alert rules, along with the function to unsubscribe, which closes the
+// channel. The events are dropped while the channel is full, so the
+// subscribers should drain it promptly.
+func (e *AlertEngine) Subscribe() (<-chan EngineEvent, func()) {
+	return e.activity.subscribe()
+}
@@ -0,0 +1,111 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineSubscribe(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 2
+
+	t.Run("subscribers receive the tick and evaluation events", func(t *testing.T) {
+		engine := newRunnableEngine(t)
+		engine.evalHandler = NewFakeEvalHandler(2)
+		engine.notifierless = newNotifierlessRules(setting.NotifierlessRulesAllow)
+		engine.ruleReader = &fakeRuleReader{rules: []*Rule{{ID: 1, Name: "rule", Frequency: 1, State: models.AlertStateOK}}}
+
+		events, unsubscribe := engine.Subscribe()
+		defer unsubscribe()
+		runErr := startEngine(t, engine)
+
+		var received []EngineEvent
+		require.Eventually(t, func() bool {
+			for {
+				select {
+				case event := <-events:
+					received = append(received, event)
+					if event.Type == EngineEventEvalDone && event.Error == "" {
+						return true
+					}
+				default:
+					return false
+				}
+			}
+		}, time.Second*5, time.Millisecond*10)
+		require.NoError(t, engine.Stop(context.Background()))
+		require.NoError(t, <-runErr)
+
+		var types []EngineEventType
+		for _, event := range received {
+			if event.Type != EngineEventTick {
+				require.Equal(t, int64(1), event.RuleID)
+				require.Equal(t, "rule", event.RuleName)
+			}
+			if len(types) == 0 || types[len(types)-1] != event.Type {
+				types = append(types, event.Type)
+			}
+		}
+		require.Equal(t, []EngineEventType{
+			EngineEventTick,
+			EngineEventEnqueued,
+			EngineEventEvalStarted,
+			EngineEventEvalDone,
+			EngineEventEvalStarted,
+			EngineEventEvalDone,
+		}, types)
+		last := received[len(received)-1]
+		require.Equal(t, 2, last.Attempt)
+	})
+
+	t.Run("state changes", func(t *testing.T) {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.resultHandler = &FakeResultHandler{}
+		engine.evalHandler = &scriptedEvalHandler{script: []scriptedResult{{firing: true}}}
+
+		events, unsubscribe := engine.Subscribe()
+		defer unsubscribe()
+		rule := &Rule{ID: 1, State: models.AlertStateOK}
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{Rule: rule}))
+
+		require.Equal(t, EngineEventEvalStarted, (<-events).Type)
+		done := <-events
+		require.Equal(t, EngineEventEvalDone, done.Type)
+		require.Equal(t, models.AlertStateAlerting, done.State)
+		change := <-events
+		require.Equal(t, EngineEventStateChange, change.Type)
+		require.Equal(t, models.AlertStateOK, change.PrevState)
+		require.Equal(t, models.AlertStateAlerting, change.State)
+	})
+
+	t.Run("slow subscribers miss events rather than block the engine", func(t *testing.T) {
+		activity := newEngineActivity()
+		slow, unsubscribeSlow := activity.subscribe()
+		defer unsubscribeSlow()
+
+		for i := 0; i < engineSubscriberBuffer*2; i++ {
+			activity.tick(time.Unix(int64(i), 0))
+		}
+		require.Len(t, slow, engineSubscriberBuffer)
+		require.Equal(t, time.Unix(0, 0), (<-slow).Time)
+	})
+
+	t.Run("unsubscribing closes the channel", func(t *testing.T) {
+		activity := newEngineActivity()
+		events, unsubscribe := activity.subscribe()
+		unsubscribe()
+		unsubscribe()
+
+		_, ok := <-events
+		require.False(t, ok)
+		require.False(t, activity.listened())
+		activity.tick(time.Now())
+	})
+}
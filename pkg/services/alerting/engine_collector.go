@@ -0,0 +1,101 @@
+package alerting
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/registry"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// liveStats are the counters of the work in progress in the engine. They
+// are only updated atomically to stay off the locks of the hot paths.
+type liveStats struct {
+	inFlight int64
+	workers  int64
+	// lastTick is the time of the last tick in unix nanoseconds.
+	lastTick int64
+}
+
+func (s *liveStats) tick(now time.Time) {
+	atomic.StoreInt64(&s.lastTick, now.UnixNano())
+}
+
+var (
+	execQueueLengthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.ExporterName, "", "alerting_exec_queue_length"),
+		"amount of alert jobs waiting on the exec queue", nil, nil)
+	inflightEvalsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.ExporterName, "", "alerting_inflight_evals"),
+		"amount of alert jobs being evaluated", nil, nil)
+	activeWorkersDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.ExporterName, "", "alerting_active_workers"),
+		"amount of alert jobs taken off the exec queue by the dispatcher and not done yet", nil, nil)
+	lastTickDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.ExporterName, "", "alerting_last_tick_seconds_ago"),
+		"time since the last tick of the alerting engine", nil, nil)
+	datasourceHealthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.ExporterName, "", "alerting_datasource_health_score"),
+		"health score of a datasource from the latency and error ratio of its recent alert evaluations, from 0 to 1", []string{"datasource_id"}, nil)
+	datasourceSlowdownDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.ExporterName, "", "alerting_datasource_slowdown"),
+		"number of times the intervals of the alert rules of a degraded datasource are stretched by", []string{"datasource_id"}, nil)
+)
+
+// EngineCollector reports the live state of the alerting engine, read
+// from its counters when the metrics are collected.
+type EngineCollector struct {
+	AlertEngine *AlertEngine `inject:""`
+}
+
+func init() {
+	registry.RegisterService(&EngineCollector{})
+}
+
+// Init registers the collector when the alerting engine runs.
+func (c *EngineCollector) Init() error {
+	if c.AlertEngine.IsDisabled() {
+		return nil
+	}
+
+	err := prometheus.Register(c)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		// replace the collector of a server started before in the same
+		// process, as in the integration tests
+		prometheus.Unregister(registered.ExistingCollector)
+		return prometheus.Register(c)
+	}
+	return err
+}
+
+// Describe implements prometheus.Collector.
+func (c *EngineCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- execQueueLengthDesc
+	ch <- inflightEvalsDesc
+	ch <- activeWorkersDesc
+	ch <- lastTickDesc
+	ch <- datasourceHealthDesc
+	ch <- datasourceSlowdownDesc
+}
+
+// Collect implements prometheus.Collector.
+func (c *EngineCollector) Collect(ch chan<- prometheus.Metric) {
+	e := c.AlertEngine
+	ch <- prometheus.MustNewConstMetric(execQueueLengthDesc, prometheus.GaugeValue, float64(len(e.execQueue)))
+	ch <- prometheus.MustNewConstMetric(inflightEvalsDesc, prometheus.GaugeValue, float64(atomic.LoadInt64(&e.live.inFlight)))
+	ch <- prometheus.MustNewConstMetric(activeWorkersDesc, prometheus.GaugeValue, float64(atomic.LoadInt64(&e.live.workers)))
+	// not reported until the engine ticks
+	if lastTick := atomic.LoadInt64(&e.live.lastTick); lastTick != 0 {
+		ago := e.clock.Now().Sub(time.Unix(0, lastTick))
+		ch <- prometheus.MustNewConstMetric(lastTickDesc, prometheus.GaugeValue, ago.Seconds())
+	}
+	for _, health := range e.dsHealth.scores() {
+		id := strconv.FormatInt(health.DatasourceID, 10)
+		ch <- prometheus.MustNewConstMetric(datasourceHealthDesc, prometheus.GaugeValue, health.Score, id)
+		ch <- prometheus.MustNewConstMetric(datasourceSlowdownDesc, prometheus.GaugeValue, float64(health.Slowdown), id)
+	}
+}
@@ -0,0 +1,82 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+)
+
+func collectGauges(t *testing.T, c prometheus.Collector) map[string]float64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 10)
+	c.Collect(ch)
+	close(ch)
+
+	gauges := make(map[string]float64)
+	for m := range ch {
+		var metric dto.Metric
+		require.NoError(t, m.Write(&metric))
+		gauges[m.Desc().String()] = metric.GetGauge().GetValue()
+	}
+	return gauges
+}
+
+func TestEngineCollector(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := newRunnableEngine(t)
+	mock := clock.NewMock()
+	mock.Add(time.Hour)
+	engine.clock = mock
+	evalHandler := &blockingEvalHandler{started: make(chan struct{}, 3), release: make(chan struct{})}
+	engine.evalHandler = evalHandler
+	collector := &EngineCollector{AlertEngine: engine}
+
+	gauges := collectGauges(t, collector)
+	require.Len(t, gauges, 3, "the time since the last tick is not reported before the first tick")
+	require.Zero(t, gauges[execQueueLengthDesc.String()])
+	require.Zero(t, gauges[inflightEvalsDesc.String()])
+	require.Zero(t, gauges[activeWorkersDesc.String()])
+
+	for id := int64(1); id <= 3; id++ {
+		engine.Enqueue(&Job{Rule: &Rule{ID: id, State: models.AlertStateOK}})
+	}
+	require.Equal(t, 3.0, collectGauges(t, collector)[execQueueLengthDesc.String()])
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- engine.RunDispatcher(context.Background()) }()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-evalHandler.started:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the jobs to be evaluated")
+		}
+	}
+
+	gauges = collectGauges(t, collector)
+	require.Zero(t, gauges[execQueueLengthDesc.String()])
+	require.Equal(t, 3.0, gauges[inflightEvalsDesc.String()])
+	require.Equal(t, 3.0, gauges[activeWorkersDesc.String()])
+
+	close(evalHandler.release)
+	require.Eventually(t, func() bool {
+		gauges := collectGauges(t, collector)
+		return gauges[inflightEvalsDesc.String()] == 0 && gauges[activeWorkersDesc.String()] == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, engine.Stop(context.Background()))
+	require.NoError(t, <-runErr)
+
+	engine.live.tick(mock.Now())
+	mock.Add(5 * time.Second)
+	require.Equal(t, 5.0, collectGauges(t, collector)[lastTickDesc.String()])
+}
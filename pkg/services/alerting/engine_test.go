@@ -4,12 +4,22 @@ import (
 	"context"
 	"errors"
 	"math"
+	"sync"
 	"testing"
 
 	"time"
 
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/services/rendering"
 	"github.com/grafana/grafana/pkg/setting"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/require"
 )
 
 type FakeEvalHandler struct {
@@ -54,41 +64,41 @@ func TestEngineProcessJob(t *testing.T) {
 
 				for i := 1; i < setting.AlertingMaxAttempts; i++ {
 					attemptChan := make(chan int, 1)
-					cancelChan := make(chan context.CancelFunc, setting.AlertingMaxAttempts)
+					cancels := newJobCancels()
 
-					engine.processJob(i, attemptChan, cancelChan, job)
+					engine.processJob(context.Background(), i, attemptChan, cancels, job)
 					nextAttemptID, more := <-attemptChan
 
 					So(nextAttemptID, ShouldEqual, i+1)
 					So(more, ShouldEqual, true)
-					So(<-cancelChan, ShouldNotBeNil)
+					So(cancels.len(), ShouldEqual, 0)
 				}
 			})
 
 			Convey("error + last attempt -> no retry", func() {
 				engine.evalHandler = NewFakeEvalHandler(0)
 				attemptChan := make(chan int, 1)
-				cancelChan := make(chan context.CancelFunc, setting.AlertingMaxAttempts)
+				cancels := newJobCancels()
 
-				engine.processJob(setting.AlertingMaxAttempts, attemptChan, cancelChan, job)
+				engine.processJob(context.Background(), setting.AlertingMaxAttempts, attemptChan, cancels, job)
 				nextAttemptID, more := <-attemptChan
 
 				So(nextAttemptID, ShouldEqual, 0)
 				So(more, ShouldEqual, false)
-				So(<-cancelChan, ShouldNotBeNil)
+				So(cancels.len(), ShouldEqual, 0)
 			})
 
 			Convey("no error -> no retry", func() {
 				engine.evalHandler = NewFakeEvalHandler(1)
 				attemptChan := make(chan int, 1)
-				cancelChan := make(chan context.CancelFunc, setting.AlertingMaxAttempts)
+				cancels := newJobCancels()
 
-				engine.processJob(1, attemptChan, cancelChan, job)
+				engine.processJob(context.Background(), 1, attemptChan, cancels, job)
 				nextAttemptID, more := <-attemptChan
 
 				So(nextAttemptID, ShouldEqual, 0)
 				So(more, ShouldEqual, false)
-				So(<-cancelChan, ShouldNotBeNil)
+				So(cancels.len(), ShouldEqual, 0)
 			})
 		})
 
@@ -125,3 +135,557 @@ func TestEngineProcessJob(t *testing.T) {
 		})
 	})
 }
+
+type fakeDataRequestHandler struct{}
+
+func (fakeDataRequestHandler) HandleRequest(context.Context, *models.DataSource, plugins.DataQuery) (plugins.DataResponse, error) {
+	return plugins.DataResponse{}, nil
+}
+
+func TestEngineRunValidatesDependencies(t *testing.T) {
+	newEngine := func() *AlertEngine {
+		return &AlertEngine{
+			DataService:        fakeDataRequestHandler{},
+			RenderService:      &rendering.RenderingService{},
+			RemoteCacheService: &remotecache.RemoteCache{},
+			StateStore:         &fakeStateStore{states: map[ruleKey]RuleState{}},
+			Bus:                bus.New(),
+		}
+	}
+
+	tcs := []struct {
+		dependency string
+		removeFn   func(e *AlertEngine)
+	}{
+		{dependency: "DataService", removeFn: func(e *AlertEngine) { e.DataService = nil }},
+		{dependency: "RenderService", removeFn: func(e *AlertEngine) { e.RenderService = nil }},
+		{dependency: "Bus", removeFn: func(e *AlertEngine) { e.Bus = nil }},
+	}
+
+	for _, tc := range tcs {
+		t.Run("missing "+tc.dependency, func(t *testing.T) {
+			engine := newEngine()
+			require.NoError(t, engine.Init())
+			tc.removeFn(engine)
+
+			err := engine.Run(context.Background())
+			require.EqualError(t, err, "alerting engine: missing dependency "+tc.dependency)
+		})
+	}
+
+	t.Run("missing RemoteCacheService with clustering", func(t *testing.T) {
+		origEnabled := setting.AlertingClusteringEnabled
+		t.Cleanup(func() { setting.AlertingClusteringEnabled = origEnabled })
+		setting.AlertingClusteringEnabled = true
+
+		engine := newEngine()
+		engine.RemoteCacheService = nil
+		require.NoError(t, engine.Init())
+
+		err := engine.Run(context.Background())
+		require.EqualError(t, err, "alerting engine: missing dependency RemoteCacheService, required for clustering")
+	})
+
+	t.Run("all dependencies present", func(t *testing.T) {
+		require.NoError(t, newEngine().validateDependencies())
+	})
+
+	t.Run("the remote cache is optional without clustering", func(t *testing.T) {
+		engine := newEngine()
+		engine.RemoteCacheService = nil
+		require.NoError(t, engine.Init())
+		require.NoError(t, engine.validateDependencies())
+	})
+}
+
+func TestEngineTraceSampling(t *testing.T) {
+	origTracer := opentracing.GlobalTracer()
+	origRate := setting.AlertingTraceSampleRate
+	origRand := traceSampleRand
+	t.Cleanup(func() {
+		opentracing.SetGlobalTracer(origTracer)
+		setting.AlertingTraceSampleRate = origRate
+		traceSampleRand = origRand
+	})
+
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	runJob := func(t *testing.T, evalHandler evalHandler) []*mocktracer.MockSpan {
+		tracer := mocktracer.New()
+		opentracing.SetGlobalTracer(tracer)
+
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.resultHandler = &FakeResultHandler{}
+		engine.evalHandler = evalHandler
+
+		err := engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{}})
+		require.NoError(t, err)
+		return tracer.FinishedSpans()
+	}
+
+	t.Run("successful evaluations are sampled", func(t *testing.T) {
+		setting.AlertingTraceSampleRate = 0.1
+		traceSampleRand = func() float64 { return 0.5 }
+		require.Empty(t, runJob(t, NewFakeEvalHandler(1)))
+
+		traceSampleRand = func() float64 { return 0.05 }
+		require.Len(t, runJob(t, NewFakeEvalHandler(1)), 1)
+	})
+
+	t.Run("failed evaluations are always traced", func(t *testing.T) {
+		setting.AlertingTraceSampleRate = 0
+		spans := runJob(t, NewFakeEvalHandler(0))
+		require.Len(t, spans, 1)
+		require.Equal(t, true, spans[0].Tag("error"))
+	})
+}
+
+type blockingEvalHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingEvalHandler) Eval(evalContext *EvalContext) {
+	h.started <- struct{}{}
+	<-h.release
+}
+
+func TestEngineShutdownGracePeriod(t *testing.T) {
+	origGracePeriod := setting.AlertingShutdownGracePeriod
+	t.Cleanup(func() { setting.AlertingShutdownGracePeriod = origGracePeriod })
+	setting.AlertingShutdownGracePeriod = 30 * time.Second
+	setting.AlertingEvaluationTimeout = time.Minute
+	setting.AlertingNotificationTimeout = time.Minute
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	require.Equal(t, 30*time.Second, engine.unfinishedWorkTimeout)
+
+	mockClock := clock.NewMock()
+	engine.clock = mockClock
+	resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+	engine.resultHandler = resultHandler
+	evalHandler := &blockingEvalHandler{started: make(chan struct{}, 1), release: make(chan struct{})}
+	defer func() {
+		// let the attempt left behind end before the next test changes the settings
+		close(evalHandler.release)
+		<-resultHandler.handled
+	}()
+	engine.evalHandler = evalHandler
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- engine.processJobWithRetry(ctx, &Job{running: true, Rule: &Rule{}}) }()
+
+	<-evalHandler.started
+	cancel()
+	// let the job notice the cancellation and start the grace period
+	time.Sleep(50 * time.Millisecond)
+
+	mockClock.Add(29 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("the job should not be ended before the grace period elapsed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mockClock.Add(time.Second)
+	select {
+	case err := <-done:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("the job should be ended once the grace period elapsed")
+	}
+}
+
+type ctxRecordingEvalHandler struct {
+	FakeEvalHandler
+	contexts []context.Context
+}
+
+func (handler *ctxRecordingEvalHandler) Eval(evalContext *EvalContext) {
+	handler.contexts = append(handler.contexts, evalContext.Ctx)
+	handler.FakeEvalHandler.Eval(evalContext)
+}
+
+func TestEngineCancelsCompletedAttempts(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 3
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.resultHandler = &FakeResultHandler{}
+	evalHandler := &ctxRecordingEvalHandler{FakeEvalHandler: *NewFakeEvalHandler(2)}
+	engine.evalHandler = evalHandler
+	job := &Job{running: true, Rule: &Rule{}}
+	cancels := newJobCancels()
+
+	t.Run("failed attempt", func(t *testing.T) {
+		attemptChan := make(chan int, 1)
+		engine.processJob(context.Background(), 1, attemptChan, cancels, job)
+		require.Equal(t, 2, <-attemptChan)
+
+		// the job is not ended yet but the context of the attempt is already canceled
+		require.Len(t, evalHandler.contexts, 1)
+		require.ErrorIs(t, evalHandler.contexts[0].Err(), context.Canceled)
+		require.Equal(t, 0, cancels.len())
+	})
+
+	t.Run("successful attempt", func(t *testing.T) {
+		attemptChan := make(chan int, 1)
+		engine.processJob(context.Background(), 2, attemptChan, cancels, job)
+		_, more := <-attemptChan
+		require.False(t, more)
+
+		require.Len(t, evalHandler.contexts, 2)
+		require.ErrorIs(t, evalHandler.contexts[1].Err(), context.Canceled)
+		require.Equal(t, 0, cancels.len())
+	})
+
+	t.Run("contexts registered after the job ended are canceled right away", func(t *testing.T) {
+		cancels.cancelAll()
+		ctx, cancelFn := context.WithCancel(context.Background())
+		cancels.add(cancelFn)
+		require.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+}
+
+func TestEngineRetryBackoff(t *testing.T) {
+	t.Run("the delays are picked at random up to the capped exponential backoff", func(t *testing.T) {
+		origRand := retryJitterRand
+		t.Cleanup(func() { retryJitterRand = origRand })
+		var ns []int64
+		retryJitterRand = func(n int64) int64 {
+			ns = append(ns, n)
+			return n - 1
+		}
+
+		base, cap := 100*time.Millisecond, time.Second
+		require.Equal(t, 200*time.Millisecond, retryBackoff(1, base, cap))
+		require.Equal(t, 400*time.Millisecond, retryBackoff(2, base, cap))
+		require.Equal(t, 800*time.Millisecond, retryBackoff(3, base, cap))
+		require.Equal(t, time.Second, retryBackoff(4, base, cap))
+		require.Equal(t, time.Second, retryBackoff(100, base, cap))
+		require.Equal(t, int64(200*time.Millisecond)+1, ns[0], "the delays range from zero to the backoff included")
+		require.Zero(t, retryBackoff(3, 0, cap), "no delay without a base")
+		require.Greater(t, retryBackoff(100, base, 0), time.Duration(0), "the backoff doesn't overflow without cap")
+	})
+
+	t.Run("the delays are jittered", func(t *testing.T) {
+		delays := make(map[time.Duration]struct{})
+		for i := 0; i < 20; i++ {
+			delay := retryBackoff(3, time.Second, time.Minute)
+			require.GreaterOrEqual(t, delay, time.Duration(0))
+			require.LessOrEqual(t, delay, 8*time.Second)
+			delays[delay] = struct{}{}
+		}
+		require.Greater(t, len(delays), 1)
+	})
+
+	t.Run("the retries stop once they take longer than the max elapsed time", func(t *testing.T) {
+		origBase, origCap, origMaxElapsed := setting.AlertingRetryBackoffBase, setting.AlertingRetryBackoffCap, setting.AlertingRetryMaxElapsed
+		t.Cleanup(func() {
+			setting.AlertingRetryBackoffBase, setting.AlertingRetryBackoffCap, setting.AlertingRetryMaxElapsed = origBase, origCap, origMaxElapsed
+		})
+		setting.AlertingEvaluationTimeout = 30 * time.Second
+		setting.AlertingNotificationTimeout = 30 * time.Second
+		setting.AlertingMaxAttempts = 100
+		setting.AlertingRetryBackoffBase = 10 * time.Millisecond
+		setting.AlertingRetryBackoffCap = 20 * time.Millisecond
+		setting.AlertingRetryMaxElapsed = 100 * time.Millisecond
+
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+		engine.resultHandler = resultHandler
+		engine.resultQueue = nil
+		evalHandler := NewFakeEvalHandler(0)
+		engine.evalHandler = evalHandler
+		job := &Job{running: true, Rule: &Rule{}}
+
+		start := time.Now()
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		require.Less(t, time.Since(start), time.Second)
+		require.Greater(t, evalHandler.CallNb, 1, "the evaluation should be retried")
+		require.Less(t, evalHandler.CallNb, setting.AlertingMaxAttempts)
+		evalContext := <-resultHandler.handled
+		require.Error(t, evalContext.Error, "the failure should be handled")
+	})
+
+	t.Run("the retries are skipped once the engine stops", func(t *testing.T) {
+		origBase, origCap := setting.AlertingRetryBackoffBase, setting.AlertingRetryBackoffCap
+		t.Cleanup(func() {
+			setting.AlertingRetryBackoffBase, setting.AlertingRetryBackoffCap = origBase, origCap
+		})
+		setting.AlertingEvaluationTimeout = 30 * time.Second
+		setting.AlertingNotificationTimeout = 30 * time.Second
+		setting.AlertingMaxAttempts = 3
+		setting.AlertingRetryBackoffBase = time.Hour
+		setting.AlertingRetryBackoffCap = time.Hour
+
+		origRand := retryJitterRand
+		t.Cleanup(func() { retryJitterRand = origRand })
+		retryJitterRand = func(n int64) int64 { return n - 1 }
+
+		for name, stop := range map[string]func(engine *AlertEngine, cancel context.CancelFunc){
+			"the server context is canceled": func(engine *AlertEngine, cancel context.CancelFunc) { cancel() },
+			"the engine is stopped": func(engine *AlertEngine, cancel context.CancelFunc) {
+				require.NoError(t, engine.Stop(context.Background()))
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				engine := &AlertEngine{}
+				require.NoError(t, engine.Init())
+				// the backoff never elapses on its own
+				engine.clock = clock.NewMock()
+				engine.resultHandler = &FakeResultHandler{}
+				evalHandler := NewFakeEvalHandler(0)
+				engine.evalHandler = evalHandler
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				attemptChan := make(chan int, 1)
+				engine.processJob(ctx, 1, attemptChan, newJobCancels(), &Job{running: true, Rule: &Rule{}})
+				stop(engine, cancel)
+
+				select {
+				case _, more := <-attemptChan:
+					require.False(t, more, "the evaluation should not be retried")
+				case <-time.After(5 * time.Second):
+					t.Fatal("expected the retry backoff to be interrupted")
+				}
+				require.Equal(t, 1, evalHandler.CallNb)
+			})
+		}
+	})
+}
+
+type countingRuleReader struct {
+	mtx     sync.Mutex
+	fetches int
+}
+
+func (r *countingRuleReader) fetch() ([]*Rule, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.fetches++
+	return []*Rule{{ID: 1, Frequency: 1}}, nil
+}
+
+func TestEngineRunDispatcher(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := newRunnableEngine(t)
+	ruleReader := &countingRuleReader{}
+	engine.ruleReader = ruleReader
+	resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 10)}
+	engine.resultHandler = resultHandler
+	engine.resultQueue = nil
+	engine.evalHandler = &slowEvalHandler{}
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- engine.RunDispatcher(context.Background()) }()
+
+	for _, id := range []int64{10, 11} {
+		engine.Enqueue(&Job{Rule: &Rule{ID: id, State: models.AlertStateOK}})
+	}
+	var evaluated []int64
+	for len(evaluated) < 2 {
+		select {
+		case evalContext := <-resultHandler.handled:
+			evaluated = append(evaluated, evalContext.Rule.ID)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the enqueued jobs to be processed")
+		}
+	}
+	require.ElementsMatch(t, []int64{10, 11}, evaluated)
+
+	require.NoError(t, engine.Stop(context.Background()))
+	require.NoError(t, <-runErr)
+
+	ruleReader.mtx.Lock()
+	defer ruleReader.mtx.Unlock()
+	require.Zero(t, ruleReader.fetches, "the rules should not be scheduled")
+
+	// the jobs enqueued once stopped are dropped rather than blocking
+	engine.execQueue = make(chan *Job)
+	engine.Enqueue(&Job{Rule: &Rule{ID: 12}})
+}
+
+type panickingEvalHandler struct{}
+
+func (handler *panickingEvalHandler) Eval(evalContext *EvalContext) {
+	panic("eval exploded")
+}
+
+func TestEnginePanicHandler(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	type recoveredPanic struct {
+		recovered interface{}
+		stack     []byte
+	}
+	panics := make(chan recoveredPanic, 1)
+	engine := &AlertEngine{
+		PanicHandler: func(recovered interface{}, stack []byte) {
+			panics <- recoveredPanic{recovered: recovered, stack: stack}
+		},
+	}
+	require.NoError(t, engine.Init())
+	engine.resultHandler = &FakeResultHandler{}
+	engine.evalHandler = &panickingEvalHandler{}
+
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 1}}))
+	select {
+	case p := <-panics:
+		require.Equal(t, "eval exploded", p.recovered)
+		require.Contains(t, string(p.stack), "panickingEvalHandler", "the stack should lead to the panic")
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the panic handler to be invoked")
+	}
+}
+
+func TestEngineWarmup(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+	origWarmupPeriod := setting.AlertingWarmupPeriod
+	t.Cleanup(func() { setting.AlertingWarmupPeriod = origWarmupPeriod })
+	setting.AlertingWarmupPeriod = 10 * time.Second
+
+	engine := newRunnableEngine(t)
+	mock := clock.NewMock()
+	mock.Set(time.Unix(1000, 0))
+	engine.clock = mock
+	ticks := make(chan time.Time)
+	engine.ticker = &Ticker{C: ticks}
+	engine.ruleReader = &storedRuleReader{rules: []Rule{{ID: 1, Name: "warming up", Frequency: 1, State: models.AlertStateOK}}}
+	engine.evalHandler = &slowEvalHandler{}
+	resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 100)}
+	engine.resultHandler = resultHandler
+	engine.notifierless = newNotifierlessRules(setting.NotifierlessRulesAllow)
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- engine.Run(context.Background()) }()
+
+	// evaluations returns the number of evaluations over a few ticks
+	evaluations := func() int {
+		for i := 0; i < 4; i++ {
+			ticks <- mock.Now()
+			mock.Add(time.Second)
+		}
+		count := 0
+		for {
+			select {
+			case <-resultHandler.handled:
+				count++
+			case <-time.After(100 * time.Millisecond):
+				return count
+			}
+		}
+	}
+
+	require.Zero(t, evaluations(), "no rule is evaluated during the warm-up")
+	require.Len(t, engine.ScheduleSnapshot(), 1, "the rules are loaded during the warm-up")
+	require.Zero(t, len(engine.execQueue))
+
+	mock.Set(time.Unix(1010, 0))
+	require.NotZero(t, evaluations(), "the rules are evaluated once the warm-up is over")
+
+	require.NoError(t, engine.Stop(context.Background()))
+	require.NoError(t, <-runErr)
+}
+
+func TestEngineRefreshRules(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	reader := &storedRuleReader{rules: []Rule{{ID: 1, Name: "imported first", Frequency: 60, State: models.AlertStateOK}}}
+	engine := newRunnableEngine(t)
+	mock := clock.NewMock()
+	mock.Set(time.Unix(1000, 0))
+	engine.clock = mock
+	ticks := make(chan time.Time)
+	engine.ticker = &Ticker{C: ticks}
+	engine.ruleReader = reader
+	engine.notifierless = newNotifierlessRules(setting.NotifierlessRulesAllow)
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- engine.Run(context.Background()) }()
+
+	// the first tick refreshes the rules, the next refresh is nine ticks away
+	ticks <- mock.Now()
+	require.Eventually(t, func() bool { return len(engine.ScheduleSnapshot()) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	reader.mtx.Lock()
+	reader.rules = append(reader.rules, Rule{ID: 2, Name: "imported next", Frequency: 60, State: models.AlertStateOK})
+	reader.mtx.Unlock()
+	require.NoError(t, engine.RefreshRules())
+
+	snapshot := engine.ScheduleSnapshot()
+	require.Len(t, snapshot, 2, "the rules are scheduled once RefreshRules returns")
+	require.Equal(t, "imported next", snapshot[1].Name)
+
+	require.NoError(t, engine.Stop(context.Background()))
+	require.NoError(t, <-runErr)
+
+	t.Run("keeps the schedule when the rules cannot be fetched", func(t *testing.T) {
+		engine.ruleReader = failingRuleReader{}
+		require.Error(t, engine.RefreshRules())
+		require.Len(t, engine.ScheduleSnapshot(), 2)
+	})
+}
+
+func TestEngineClock(t *testing.T) {
+	origEvaluationTimeout, origNotificationTimeout, origMaxAttempts := setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts
+	t.Cleanup(func() {
+		setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts = origEvaluationTimeout, origNotificationTimeout, origMaxAttempts
+	})
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	mock := clock.NewMock()
+	mock.Set(time.Unix(1000, 0))
+	engine.clock = mock
+	engine.resultHandler = &FakeResultHandler{}
+
+	t.Run("the for duration is measured with the clock of the engine", func(t *testing.T) {
+		rule := &Rule{ID: 1, OrgID: 1, For: time.Hour, State: models.AlertStateOK, Conditions: []Condition{&conditionStub{firing: true}}}
+		engine.evalHandler = NewEvalHandler(nil)
+		job := &Job{Rule: rule}
+
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		require.Equal(t, models.AlertStatePending, rule.State)
+		require.Equal(t, mock.Now(), engine.runtimes.get(rule).PendingSince)
+
+		mock.Add(30 * time.Minute)
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		require.Equal(t, models.AlertStatePending, rule.State)
+
+		mock.Add(time.Hour)
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		require.Equal(t, models.AlertStateAlerting, rule.State)
+	})
+
+	t.Run("the failed evaluations are recorded with the clock of the engine", func(t *testing.T) {
+		engine.evalHandler = NewFakeEvalHandler(0)
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{Rule: &Rule{ID: 2, OrgID: 1}}))
+
+		deadLetters := engine.DeadLetters()
+		require.Len(t, deadLetters, 1)
+		require.Equal(t, mock.Now(), deadLetters[0].Time)
+	})
+}
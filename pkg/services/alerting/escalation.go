@@ -0,0 +1,129 @@
+package alerting
+
+import (
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// EscalationLevel escalates the notifications of an alert rule firing for
+// longer than its duration to its notifiers, in addition to the notifiers
+// of the rule, such as `page the team lead after 30m of firing`.
+type EscalationLevel struct {
+	After         time.Duration
+	Notifications []string
+}
+
+// parseEscalationLevels parses the escalation levels of the rule, ordered by
+// duration.
+func parseEscalationLevels(model *Rule, rawLevels []interface{}, logTranslationFailures bool) ([]*EscalationLevel, error) {
+	var levels []*EscalationLevel
+	for _, raw := range rawLevels {
+		jsonModel := simplejson.NewFromAny(raw)
+
+		after, err := time.ParseDuration(jsonModel.Get("after").MustString())
+		if err != nil || after <= 0 {
+			return nil, ValidationError{Reason: "Could not parse after field of escalation level", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+		}
+		level := &EscalationLevel{After: after}
+
+		level.Notifications, err = parseNotifications(model, jsonModel.Get("notifications").MustArray(), logTranslationFailures)
+		if err != nil {
+			return nil, err
+		}
+		if len(level.Notifications) == 0 {
+			return nil, ValidationError{Reason: "Escalation level has no notifications", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+		}
+
+		levels = append(levels, level)
+	}
+	sort.SliceStable(levels, func(i, j int) bool {
+		return levels[i].After < levels[j].After
+	})
+	return levels, nil
+}
+
+// trackFiring records in the in-memory state of the rule since when the rule
+// has been firing without a break, and resets its escalation once it stops firing.
+func (c *EvalContext) trackFiring(runtime *ruleRuntime) {
+	if c.IsTestRun || len(c.Rule.Escalations) == 0 {
+		return
+	}
+	if c.Rule.State != models.AlertStateAlerting {
+		runtime.FiringSince = time.Time{}
+		runtime.Escalated = 0
+		return
+	}
+	if runtime.FiringSince.IsZero() {
+		runtime.FiringSince = c.StartTime
+	}
+}
+
+// dueEscalations returns the escalation levels the rule reached since its
+// last escalation, and marks them as escalated in the in-memory state of the rule.
+func (c *EvalContext) dueEscalations(runtime *ruleRuntime) []*EscalationLevel {
+	if c.IsTestRun || runtime.FiringSince.IsZero() {
+		return nil
+	}
+	firing := c.StartTime.Sub(runtime.FiringSince)
+
+	var due []*EscalationLevel
+	for runtime.Escalated < len(c.Rule.Escalations) && c.Rule.Escalations[runtime.Escalated].After <= firing {
+		due = append(due, c.Rule.Escalations[runtime.Escalated])
+		runtime.Escalated++
+	}
+	return due
+}
+
+// escalate notifies the notifiers of the escalation levels the rule reached.
+func (handler *defaultResultHandler) escalate(evalContext *EvalContext) {
+	var due []*EscalationLevel
+	var firingSince time.Time
+	handler.runtimes.update(evalContext.Rule, func(runtime *ruleRuntime) {
+		due = evalContext.dueEscalations(runtime)
+		firingSince = runtime.FiringSince
+	})
+	for _, level := range due {
+		handler.log.Info("Escalating the notifications of the alert rule", "ruleId", evalContext.Rule.ID, "firingSince", firingSince, "after", level.After)
+		if err := handler.notifier.sendEscalation(evalContext, level.Notifications); err != nil {
+			handler.log.Error("Failed to escalate the notifications of the alert rule", "ruleId", evalContext.Rule.ID, "error", err)
+		}
+	}
+	if len(due) > 0 {
+		handler.saveState(evalContext.Rule)
+	}
+}
+
+// sendEscalation notifies the notifiers of an escalation level. They are
+// notified whatever their own notification settings as the rule reached the
+// level, which only happens once until the rule stops firing.
+func (n *notificationService) sendEscalation(evalContext *EvalContext, notificationUids []string) error {
+	if setting.AlertingNotificationsDisabled {
+		n.log.Debug("Notifications are disabled, not escalating", "ruleId", evalContext.Rule.ID)
+		return nil
+	}
+
+	query := &models.GetAlertNotificationsWithUidToSendQuery{OrgId: evalContext.Rule.OrgID, Uids: notificationUids}
+	if err := bus.Dispatch(query); err != nil {
+		return err
+	}
+
+	for _, notification := range query.Result {
+		notifier, err := InitNotifier(notification)
+		if err != nil {
+			n.log.Error("Could not create notifier", "notifier", notification.Uid, "error", err)
+			continue
+		}
+		if err := evalContext.evaluateNotificationTemplateFields(); err != nil {
+			n.log.Error("failed trying to evaluate notification template fields", "uid", notifier.GetNotifierUID(), "error", err)
+		}
+		if err := n.deliver(evalContext, notifier); err != nil {
+			n.log.Error("Failed to send the escalation notification", "uid", notifier.GetNotifierUID(), "error", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultHandlerEscalations(t *testing.T) {
+	origNotificationTimeout := setting.AlertingNotificationTimeout
+	t.Cleanup(func() { setting.AlertingNotificationTimeout = origNotificationTimeout })
+	setting.AlertingNotificationTimeout = 30 * time.Second
+
+	origRepo := annotations.GetRepository()
+	annotations.SetRepository(&fakeAnnotationsRepo{})
+	t.Cleanup(func() { annotations.SetRepository(origRepo) })
+
+	notifiers := map[string]*capturingNotifier{}
+	for _, uid := range []string{"primary", "lead", "manager"} {
+		notifiers[uid] = &capturingNotifier{testNotifier: testNotifier{UID: uid, Type: "escalation"}}
+	}
+	RegisterNotifier(&NotifierPlugin{
+		Type: "escalation",
+		Name: "Escalation",
+		Factory: func(model *models.AlertNotification) (Notifier, error) {
+			return notifiers[model.Uid], nil
+		},
+	})
+	bus.AddHandler("test", func(cmd *models.SetAlertStateCommand) error {
+		cmd.Result = models.Alert{Id: cmd.AlertId, State: cmd.State, StateChanges: 1}
+		return nil
+	})
+	bus.AddHandler("test", func(query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = nil
+		for i, uid := range query.Uids {
+			query.Result = append(query.Result, &models.AlertNotification{Id: int64(i + 1), Uid: uid, Type: "escalation", Settings: simplejson.New()})
+		}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetOrCreateNotificationStateQuery) error {
+		query.Result = &models.AlertNotificationState{Id: 1, State: models.AlertNotificationStateUnknown}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		return nil
+	})
+
+	handler := newResultHandler(nil, &fakeStateStore{states: map[ruleKey]RuleState{}}, newInhibitor(nil), newSilences(clock.NewMock()), nil, clock.New())
+	rule := &Rule{ID: 1, OrgID: 1, Name: "sustained", State: models.AlertStateOK, Notifications: []string{"primary"},
+		Escalations: []*EscalationLevel{
+			{After: 10 * time.Minute, Notifications: []string{"lead"}},
+			{After: 30 * time.Minute, Notifications: []string{"manager"}},
+		}}
+	start := time.Now()
+	evaluate := func(at time.Duration, state models.AlertStateType) {
+		evalContext := NewEvalContext(context.Background(), rule, nil)
+		evalContext.StartTime = start.Add(at)
+		evalContext.PrevAlertState = rule.State
+		rule.State = state
+		require.NoError(t, handler.handle(evalContext))
+	}
+
+	evaluate(0, models.AlertStateAlerting)
+	evaluate(5*time.Minute, models.AlertStateAlerting)
+	require.Len(t, notifiers["primary"].notified, 2)
+	require.Empty(t, notifiers["lead"].notified)
+
+	evaluate(10*time.Minute, models.AlertStateAlerting)
+	evaluate(20*time.Minute, models.AlertStateAlerting)
+	require.Len(t, notifiers["lead"].notified, 1, "the first level is escalated to once it is reached")
+	require.Empty(t, notifiers["manager"].notified)
+
+	evaluate(35*time.Minute, models.AlertStateAlerting)
+	require.Len(t, notifiers["lead"].notified, 1)
+	require.Len(t, notifiers["manager"].notified, 1, "the second level is escalated to once it is reached")
+
+	// the rule resolves and fires again
+	evaluate(40*time.Minute, models.AlertStateOK)
+	evaluate(45*time.Minute, models.AlertStateAlerting)
+	evaluate(50*time.Minute, models.AlertStateAlerting)
+	require.Len(t, notifiers["lead"].notified, 1, "the escalation restarts once the rule resolves")
+
+	evaluate(55*time.Minute, models.AlertStateAlerting)
+	require.Len(t, notifiers["lead"].notified, 2)
+	require.Len(t, notifiers["manager"].notified, 1)
+}
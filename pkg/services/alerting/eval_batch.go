@@ -0,0 +1,226 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+)
+
+// maxBatchWait is the longest a query of an evaluation batch waits for the
+// queries of the other rules of the batch before being sent without them.
+var maxBatchWait = 2 * time.Second
+
+// evalBatch gathers the datasource queries of the rules of an evaluation
+// group due on the same tick. The queries share the time of the tick as
+// their time boundary and are sent in a single request per datasource and
+// time range, whose results are fanned out to the conditions of the rules.
+type evalBatch struct {
+	mtx      sync.Mutex
+	now      time.Time
+	requests map[int64]*batchRequest
+}
+
+// batchRequest is the request of the batch to a datasource.
+type batchRequest struct {
+	expected int
+	deadline time.Time
+	queries  []*batchedQuery
+	flushed  bool
+	done     chan struct{}
+	// withdrawn is closed and replaced when a rule of the batch withdraws
+	// its queries, for the queries waiting to check if they are the last.
+	withdrawn chan struct{}
+}
+
+type batchedQuery struct {
+	query    plugins.DataQuery
+	response plugins.DataResponse
+	err      error
+}
+
+// newEvalBatch returns the batch of the rules due at now, expecting the
+// queries of their datasource conditions.
+func newEvalBatch(now time.Time, rules []*Rule) *evalBatch {
+	b := &evalBatch{now: now, requests: make(map[int64]*batchRequest)}
+	for _, rule := range rules {
+		for _, condition := range rule.Conditions {
+			dc, ok := condition.(DatasourceCondition)
+			if !ok {
+				continue
+			}
+			req, ok := b.requests[dc.GetDatasourceID()]
+			if !ok {
+				req = &batchRequest{deadline: time.Now().Add(maxBatchWait), done: make(chan struct{}), withdrawn: make(chan struct{})}
+				b.requests[dc.GetDatasourceID()] = req
+			}
+			req.expected++
+		}
+	}
+	return b
+}
+
+// handler returns the request handler the conditions evaluated in the batch
+// send their queries through.
+func (b *evalBatch) handler(next plugins.DataRequestHandler) plugins.DataRequestHandler {
+	return &batchRequestHandler{batch: b, next: next}
+}
+
+type batchRequestHandler struct {
+	batch *evalBatch
+	next  plugins.DataRequestHandler
+}
+
+//nolint: staticcheck // plugins.DataQuery deprecated
+func (h *batchRequestHandler) HandleRequest(ctx context.Context, ds *models.DataSource, query plugins.DataQuery) (plugins.DataResponse, error) {
+	b := h.batch
+	if query.TimeRange != nil {
+		timeRange := *query.TimeRange
+		timeRange.Now = b.now
+		query.TimeRange = &timeRange
+	}
+
+	b.mtx.Lock()
+	req, ok := b.requests[ds.Id]
+	if !ok || req.flushed {
+		// the other queries of the batch were already sent
+		b.mtx.Unlock()
+		return h.next.HandleRequest(ctx, ds, query)
+	}
+	q := &batchedQuery{query: query}
+	req.queries = append(req.queries, q)
+	complete := len(req.queries) >= req.expected
+	if complete {
+		req.flushed = true
+	}
+	b.mtx.Unlock()
+
+	if complete {
+		h.send(ctx, ds, req)
+		return q.response, q.err
+	}
+
+	b.mtx.Lock()
+	withdrawn := req.withdrawn
+	b.mtx.Unlock()
+
+	wait := time.NewTimer(time.Until(req.deadline))
+	defer wait.Stop()
+	for {
+		select {
+		case <-req.done:
+			return q.response, q.err
+		case <-ctx.Done():
+			return plugins.DataResponse{}, ctx.Err()
+		case <-wait.C:
+			h.flush(ctx, ds, req, true)
+			return q.response, q.err
+		case <-withdrawn:
+			b.mtx.Lock()
+			withdrawn = req.withdrawn
+			b.mtx.Unlock()
+			if h.flush(ctx, ds, req, false) {
+				return q.response, q.err
+			}
+		}
+	}
+}
+
+// flush sends the queries of the request unless they were already sent,
+// only once all the expected queries arrived unless force is set. It
+// returns true once the queries are sent.
+func (h *batchRequestHandler) flush(ctx context.Context, ds *models.DataSource, req *batchRequest, force bool) bool {
+	h.batch.mtx.Lock()
+	flushed := req.flushed
+	send := !flushed && (force || len(req.queries) >= req.expected)
+	if send {
+		req.flushed = true
+	}
+	h.batch.mtx.Unlock()
+
+	switch {
+	case send:
+		h.send(ctx, ds, req)
+	case flushed:
+		<-req.done
+	default:
+		return false
+	}
+	return true
+}
+
+// withdraw removes the queries of the rule from the queries the batch
+// waits for, e.g. when the rule is not evaluated after all.
+func (b *evalBatch) withdraw(rule *Rule) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	for _, condition := range rule.Conditions {
+		dc, ok := condition.(DatasourceCondition)
+		if !ok {
+			continue
+		}
+		req, ok := b.requests[dc.GetDatasourceID()]
+		if !ok || req.flushed {
+			continue
+		}
+		req.expected--
+		close(req.withdrawn)
+		req.withdrawn = make(chan struct{})
+	}
+}
+
+// send sends the queries of the request to the datasource, in a single
+// request per time range, and sets the response of every query.
+//nolint: staticcheck // plugins.DataQuery deprecated
+func (h *batchRequestHandler) send(ctx context.Context, ds *models.DataSource, req *batchRequest) {
+	defer close(req.done)
+
+	var ranges []plugins.DataTimeRange
+	byRange := make(map[plugins.DataTimeRange][]*batchedQuery)
+	for _, q := range req.queries {
+		var timeRange plugins.DataTimeRange
+		if q.query.TimeRange != nil {
+			timeRange = *q.query.TimeRange
+		}
+		if _, ok := byRange[timeRange]; !ok {
+			ranges = append(ranges, timeRange)
+		}
+		byRange[timeRange] = append(byRange[timeRange], q)
+	}
+
+	for _, timeRange := range ranges {
+		queries := byRange[timeRange]
+		merged := queries[0].query
+		merged.Queries = nil
+		// the queries of the rules all use the same ref ids
+		for i, q := range queries {
+			for _, sub := range q.query.Queries {
+				sub.RefID = fmt.Sprintf("%s-%d", sub.RefID, i)
+				merged.Queries = append(merged.Queries, sub)
+			}
+			q.response = plugins.DataResponse{Results: make(map[string]plugins.DataQueryResult)}
+		}
+
+		resp, err := h.next.HandleRequest(ctx, ds, merged)
+		for _, q := range queries {
+			q.err = err
+		}
+		if err != nil {
+			continue
+		}
+		for i, q := range queries {
+			for _, sub := range q.query.Queries {
+				result, ok := resp.Results[fmt.Sprintf("%s-%d", sub.RefID, i)]
+				if !ok {
+					continue
+				}
+				result.RefID = sub.RefID
+				q.response.Results[sub.RefID] = result
+			}
+			q.response.Message = resp.Message
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package alerting
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+// queryingCondition queries its datasource for the series named after its rule.
+type queryingCondition struct {
+	datasourceID int64
+	metric       string
+}
+
+//nolint: staticcheck // plugins.DataQuery deprecated
+func (c *queryingCondition) Eval(context *EvalContext, reqHandler plugins.DataRequestHandler) (*ConditionResult, error) {
+	timeRange := plugins.NewDataTimeRange("5m", "now")
+	resp, err := reqHandler.HandleRequest(context.Ctx, &models.DataSource{Id: c.datasourceID}, plugins.DataQuery{
+		TimeRange: &timeRange,
+		Queries:   []plugins.DataSubQuery{{RefID: "A", Model: simplejson.NewFromAny(map[string]interface{}{"metric": c.metric})}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := resp.Results["A"]
+	return &ConditionResult{Firing: len(result.Series) == 1 && result.Series[0].Name == c.metric}, nil
+}
+
+func (c *queryingCondition) GetDatasourceID() int64 {
+	return c.datasourceID
+}
+
+// recordingRequestHandler returns a series named after the metric of every query.
+type recordingRequestHandler struct {
+	mtx      sync.Mutex
+	requests []plugins.DataQuery
+}
+
+//nolint: staticcheck // plugins.DataQuery deprecated
+func (h *recordingRequestHandler) HandleRequest(_ context.Context, _ *models.DataSource, query plugins.DataQuery) (plugins.DataResponse, error) {
+	h.mtx.Lock()
+	h.requests = append(h.requests, query)
+	h.mtx.Unlock()
+
+	resp := plugins.DataResponse{Results: make(map[string]plugins.DataQueryResult)}
+	for _, q := range query.Queries {
+		resp.Results[q.RefID] = plugins.DataQueryResult{
+			RefID:  q.RefID,
+			Series: plugins.DataTimeSeriesSlice{{Name: q.Model.Get("metric").MustString()}},
+		}
+	}
+	return resp, nil
+}
+
+func TestEvaluationGroups(t *testing.T) {
+	origMinInterval := setting.AlertingMinInterval
+	t.Cleanup(func() { setting.AlertingMinInterval = origMinInterval })
+	setting.AlertingMinInterval = 1
+
+	newRule := func(id int64, group string) *Rule {
+		return &Rule{ID: id, OrgID: 1, Frequency: 10, EvaluationGroup: group, Conditions: []Condition{
+			&queryingCondition{datasourceID: 1, metric: "metric-" + string(rune('a'+id))},
+		}}
+	}
+
+	// evaluates the rules of the jobs concurrently, as the dispatcher does
+	evaluate := func(handler *DefaultEvalHandler, jobs []*Job) []*EvalContext {
+		contexts := make([]*EvalContext, len(jobs))
+		var wg sync.WaitGroup
+		for i, job := range jobs {
+			contexts[i] = NewEvalContext(context.Background(), job.Rule, &validations.OSSPluginRequestValidator{})
+			contexts[i].batch = job.GetBatch()
+			wg.Add(1)
+			go func(evalContext *EvalContext) {
+				defer wg.Done()
+				handler.Eval(evalContext)
+			}(contexts[i])
+		}
+		wg.Wait()
+		return contexts
+	}
+
+	t.Run("the rules of a group are scheduled together", func(t *testing.T) {
+		s := newScheduler().(*schedulerImpl)
+		s.Update([]*Rule{newRule(1, "db"), newRule(2, ""), newRule(3, "db"), newRule(4, "db")})
+		require.Equal(t, s.jobs[ruleKey{orgID: 1, id: 1}].Offset, s.jobs[ruleKey{orgID: 1, id: 3}].Offset)
+		require.Equal(t, s.jobs[ruleKey{orgID: 1, id: 1}].Offset, s.jobs[ruleKey{orgID: 1, id: 4}].Offset)
+
+		execQueue := make(chan *Job, 10)
+		start := time.Unix(1000, 0)
+		for i := 0; i < 20; i++ {
+			s.Tick(start.Add(time.Duration(i)*time.Second), execQueue)
+		}
+		require.NotNil(t, s.jobs[ruleKey{orgID: 1, id: 1}].GetBatch())
+		require.Same(t, s.jobs[ruleKey{orgID: 1, id: 1}].GetBatch(), s.jobs[ruleKey{orgID: 1, id: 3}].GetBatch())
+		require.Same(t, s.jobs[ruleKey{orgID: 1, id: 1}].GetBatch(), s.jobs[ruleKey{orgID: 1, id: 4}].GetBatch())
+		require.Nil(t, s.jobs[ruleKey{orgID: 1, id: 2}].GetBatch())
+	})
+
+	t.Run("a group issues a single query for its rules", func(t *testing.T) {
+		rules := []*Rule{newRule(1, "db"), newRule(2, "db"), newRule(3, "db")}
+		batch := newEvalBatch(time.Unix(1000, 0), rules)
+		var jobs []*Job
+		for _, rule := range rules {
+			job := &Job{Rule: rule}
+			job.SetBatch(batch)
+			jobs = append(jobs, job)
+		}
+
+		requestHandler := &recordingRequestHandler{}
+		for _, evalContext := range evaluate(NewEvalHandler(requestHandler), jobs) {
+			require.NoError(t, evalContext.Error)
+			require.True(t, evalContext.Firing, "rule %d should receive its own series", evalContext.Rule.ID)
+		}
+
+		require.Len(t, requestHandler.requests, 1)
+		require.Len(t, requestHandler.requests[0].Queries, 3)
+		require.Equal(t, time.Unix(1000, 0), requestHandler.requests[0].TimeRange.Now)
+
+		// a retry of a rule queries the datasource on its own
+		evaluate(NewEvalHandler(requestHandler), jobs[:1])
+		require.Len(t, requestHandler.requests, 2)
+		require.Len(t, requestHandler.requests[1].Queries, 1)
+	})
+
+	t.Run("the queries are sent without the rules which are not evaluated", func(t *testing.T) {
+		origMaxBatchWait := maxBatchWait
+		t.Cleanup(func() { maxBatchWait = origMaxBatchWait })
+		maxBatchWait = 50 * time.Millisecond
+
+		rules := []*Rule{newRule(1, "db"), newRule(2, "db"), newRule(3, "db")}
+		batch := newEvalBatch(time.Unix(1000, 0), rules)
+		var jobs []*Job
+		for _, rule := range rules[:2] {
+			job := &Job{Rule: rule}
+			job.SetBatch(batch)
+			jobs = append(jobs, job)
+		}
+
+		requestHandler := &recordingRequestHandler{}
+		for _, evalContext := range evaluate(NewEvalHandler(requestHandler), jobs) {
+			require.NoError(t, evalContext.Error)
+			require.True(t, evalContext.Firing)
+		}
+		require.Len(t, requestHandler.requests, 1)
+		require.Len(t, requestHandler.requests[0].Queries, 2)
+	})
+
+	t.Run("the rules skipped by their pre-check are not waited for", func(t *testing.T) {
+		rules := []*Rule{newRule(1, "db"), newRule(2, "db"), newRule(3, "db")}
+		rules[1].PreCheck = []Condition{&conditionStub{firing: false}}
+		batch := newEvalBatch(time.Unix(1000, 0), rules)
+		var jobs []*Job
+		for _, rule := range rules {
+			job := &Job{Rule: rule}
+			job.SetBatch(batch)
+			jobs = append(jobs, job)
+		}
+
+		start := time.Now()
+		requestHandler := &recordingRequestHandler{}
+		for _, evalContext := range evaluate(NewEvalHandler(requestHandler), jobs) {
+			require.NoError(t, evalContext.Error)
+			require.Equal(t, evalContext.Rule.ID != 2, evalContext.Firing)
+		}
+		require.Less(t, time.Since(start), maxBatchWait)
+		require.Len(t, requestHandler.requests, 1)
+		require.Len(t, requestHandler.requests[0].Queries, 2)
+	})
+}
@@ -18,6 +18,7 @@ type EvalContext struct {
 	IsTestRun      bool
 	IsDebug        bool
 	EvalMatches    []*EvalMatch
+	QueryTraces    []*QueryTrace
 	Logs           []*ResultLogEntry
 	Error          error
 	ConditionEvals string
@@ -33,11 +34,94 @@ type EvalContext struct {
 	NoDataFound     bool
 	PrevAlertState  models.AlertStateType
 
+	// ConditionResults holds the result of every condition of the rule,
+	// including the ones evaluated after a condition failed.
+	ConditionResults []*ConditionEvalResult
+
 	RequestValidator models.PluginRequestValidator
 
+	// User is the identity the datasource queries of the evaluation
+	// are attributed to and permission checked with.
+	User *models.SignedInUser
+
+	// IdempotencyKey identifies the state transition the notifications are
+	// sent for. It is only set when the notifications are deduplicated.
+	IdempotencyKey string
+
+	// Skipped is set when the conditions of the rule were not evaluated
+	// because its pre-check is false, the rule keeping its state.
+	Skipped bool
+
+	// Degraded is set when the evaluation completed but took longer
+	// than the soft timeout of the evaluations.
+	Degraded bool
+
+	// ShadowFiring is the verdict of the shadow conditions of the rule, nil
+	// when the rule has none or they could not be evaluated.
+	ShadowFiring *bool
+
+	// Notifications are the uids of the notifiers the notifications of the
+	// evaluation are routed to, the notifiers of the rule when nil.
+	Notifications []string
+
+	// SeriesStates are the states of the series of a per-series rule after
+	// the evaluation, by series key, and PrevSeriesStates the alerting series
+	// before it. They are nil when the series states were not evaluated.
+	SeriesStates     map[string]models.AlertStateType
+	PrevSeriesStates map[string]models.AlertStateType
+
+	// SeriesValues are the values the conditions of the rule tracked for
+	// their series, and PreviousSeriesValues those of the last successful
+	// evaluation of the rule.
+	SeriesValues         SeriesValues
+	PreviousSeriesValues SeriesValues
+
+	// Window is the window of the rule the conditions are evaluated over,
+	// set on the copies of the context the conditions are evaluated with.
+	Window *EvalWindow
+
+	// WindowResults are the results of the windows of the rule, by name.
+	WindowResults map[string]*WindowResult
+
+	// ConfigVersion is the version of the configuration which defined the
+	// rule when it was evaluated.
+	ConfigVersion string
+
+	// TruncatedMatches is the number of eval matches left out of the
+	// notifications of the evaluation by the cap on their matches.
+	TruncatedMatches int
+
+	// SeriesKey is the key of the series the notifications of the evaluation
+	// are sent for, empty when they are sent for the whole rule.
+	SeriesKey string
+
+	// batch is the batch of the evaluation group the rule is evaluated with.
+	batch *evalBatch
+
+	// runtime is the in-memory state of the rule the evaluation starts
+	// from, and tracks once the state of the rule is decided.
+	runtime ruleRuntime
+
+	// datapoints is the number of datapoints the conditions consumed, shared
+	// with the copies of the context, e.g. to evaluate the windows of the rule.
+	datapoints *int64
+
 	Ctx context.Context
 }
 
+// AlertingUserLogin is the login of the synthetic user the scheduled
+// evaluations of the alert rules query the datasources as.
+const AlertingUserLogin = "grafana_alerting"
+
+func newAlertingUser(orgID int64) *models.SignedInUser {
+	return &models.SignedInUser{
+		OrgId:   orgID,
+		OrgRole: models.ROLE_ADMIN,
+		Login:   AlertingUserLogin,
+		Name:    "Grafana Alerting",
+	}
+}
+
 // NewEvalContext is the EvalContext constructor.
 func NewEvalContext(alertCtx context.Context, rule *Rule, requestValidator models.PluginRequestValidator) *EvalContext {
 	return &EvalContext{
@@ -49,6 +133,9 @@ func NewEvalContext(alertCtx context.Context, rule *Rule, requestValidator model
 		log:              log.New("alerting.evalContext"),
 		PrevAlertState:   rule.State,
 		RequestValidator: requestValidator,
+		User:             newAlertingUser(rule.OrgID),
+		ConfigVersion:    rule.ConfigVersion,
+		datapoints:       new(int64),
 	}
 }
 
@@ -82,6 +169,11 @@ func (c *EvalContext) GetStateModel() *StateDescription {
 			Color: "#888888",
 			Text:  "Unknown",
 		}
+	case models.AlertStateConfigError:
+		return &StateDescription{
+			Color: "#D63232",
+			Text:  "Configuration Error",
+		}
 	default:
 		panic("Unknown rule state for alert " + c.Rule.State)
 	}
@@ -91,9 +183,33 @@ func (c *EvalContext) shouldUpdateAlertState() bool {
 	return c.Rule.State != c.PrevAlertState
 }
 
+// stateChanges returns the count of the state changes of the rule, the rule
+// being possibly loaded before the last state change was saved.
+func (c *EvalContext) stateChanges() int64 {
+	if c.runtime.StateChanges > c.Rule.StateChanges {
+		return c.runtime.StateChanges
+	}
+	return c.Rule.StateChanges
+}
+
+// GetIdempotencyKey returns a key identifying the state transition of the rule
+// on the evaluation tick, which is the same for the instances evaluating the rule
+// on the same tick.
+func (c *EvalContext) GetIdempotencyKey() string {
+	frequency := c.Rule.Frequency
+	if frequency < 1 {
+		frequency = 1
+	}
+	key := fmt.Sprintf("%d-%s-%s-%d", c.Rule.ID, c.PrevAlertState, c.Rule.State, c.StartTime.Unix()/frequency)
+	if c.SeriesKey != "" {
+		key += "-" + c.SeriesKey
+	}
+	return key
+}
+
 // GetDurationMs returns the duration of the alert evaluation.
 func (c *EvalContext) GetDurationMs() float64 {
-	return float64(c.EndTime.Nanosecond()-c.StartTime.Nanosecond()) / float64(1000000)
+	return float64(c.EndTime.Sub(c.StartTime)) / float64(time.Millisecond)
 }
 
 // GetNotificationTitle returns the title of the alert rule including alert state.
@@ -133,12 +249,35 @@ func (c *EvalContext) GetRuleURL() (string, error) {
 
 // GetNewState returns the new state from the alert rule evaluation.
 func (c *EvalContext) GetNewState() models.AlertStateType {
+	return c.getNewStateAt(time.Now())
+}
+
+// getNewStateAt returns the new state from the alert rule evaluation, the
+// `For` duration of the rule being measured up to now.
+func (c *EvalContext) getNewStateAt(now time.Time) models.AlertStateType {
+	if c.Skipped {
+		return c.PrevAlertState
+	}
+
 	ns := getNewStateInternal(c)
+	if ns == models.AlertStateAlerting && c.inResolveCooldown(now) {
+		c.log.Debug("Alert rule is in its resolve cooldown, not firing", "ruleId", c.Rule.ID, "resolvedAt", c.runtime.ResolvedAt, "cooldown", c.Rule.ResolveCooldown)
+		return models.AlertStateOK
+	}
+	if ns == models.AlertStateAlerting && c.breachesMissing() {
+		c.log.Debug("Alert rule has not breached enough times in a row, not firing", "ruleId", c.Rule.ID, "breaches", c.runtime.Breaches+1, "consecutiveBreaches", c.Rule.ConsecutiveBreaches)
+		return c.PrevAlertState
+	}
 	if ns != models.AlertStateAlerting || c.Rule.For == 0 {
 		return ns
 	}
 
-	since := time.Since(c.Rule.LastStateChange)
+	pendingSince := c.Rule.LastStateChange
+	if !c.runtime.PendingSince.IsZero() {
+		pendingSince = c.runtime.PendingSince
+	}
+
+	since := now.Sub(pendingSince)
 	if c.PrevAlertState == models.AlertStatePending && since > c.Rule.For {
 		return models.AlertStateAlerting
 	}
@@ -150,7 +289,70 @@ func (c *EvalContext) GetNewState() models.AlertStateType {
 	return models.AlertStatePending
 }
 
+// trackPendingState records when the rule entered the pending state so the `For`
+// duration is measured from that moment, even if the state change could not be saved.
+func (c *EvalContext) trackPendingState(now time.Time) {
+	if c.Rule.State != models.AlertStatePending {
+		c.runtime.PendingSince = time.Time{}
+		return
+	}
+
+	if c.PrevAlertState != models.AlertStatePending {
+		c.runtime.PendingSince = now
+	}
+}
+
+// inResolveCooldown returns true if the rule resolved less than its resolve
+// cooldown ago and its conditions are firing. The rules failing to evaluate
+// are not held by the cooldown.
+func (c *EvalContext) inResolveCooldown(now time.Time) bool {
+	return c.Rule.ResolveCooldown > 0 && c.Error == nil && c.PrevAlertState == models.AlertStateOK &&
+		!c.runtime.ResolvedAt.IsZero() && now.Sub(c.runtime.ResolvedAt) < c.Rule.ResolveCooldown
+}
+
+// breachesMissing returns true if the conditions of the rule are firing
+// but have not been for as many evaluations in a row as the rule requires,
+// this one included. The rules already alerting and the ones failing to
+// evaluate are not held.
+func (c *EvalContext) breachesMissing() bool {
+	return c.Rule.ConsecutiveBreaches > 1 && c.Error == nil && c.Firing &&
+		c.PrevAlertState != models.AlertStateAlerting && c.runtime.Breaches+1 < c.Rule.ConsecutiveBreaches
+}
+
+// trackBreaches counts the evaluations in a row the conditions of the rule
+// were firing on. A passing evaluation resets the count, the failing and the
+// skipped ones leave it as is.
+func (c *EvalContext) trackBreaches() {
+	if c.Error != nil || c.Skipped {
+		return
+	}
+	if !c.Firing {
+		c.runtime.Breaches = 0
+		return
+	}
+	if c.runtime.Breaches < c.Rule.ConsecutiveBreaches {
+		c.runtime.Breaches++
+	}
+}
+
+// trackResolvedState records when the rule went from alerting to ok so the
+// resolve cooldown is measured from that moment.
+func (c *EvalContext) trackResolvedState(now time.Time) {
+	if c.Rule.State == models.AlertStateOK && c.PrevAlertState == models.AlertStateAlerting {
+		c.runtime.ResolvedAt = now
+	}
+}
+
 func getNewStateInternal(c *EvalContext) models.AlertStateType {
+	if isConfigError(c.Error) {
+		c.log.Error("Alert Rule Configuration Error",
+			"ruleId", c.Rule.ID,
+			"name", c.Rule.Name,
+			"error", c.Error,
+			"changing state to", models.AlertStateConfigError)
+		return models.AlertStateConfigError
+	}
+
 	if c.Error != nil {
 		c.log.Error("Alert Rule Result Error",
 			"ruleId", c.Rule.ID,
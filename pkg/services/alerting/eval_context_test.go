@@ -340,3 +340,178 @@ func TestEvaluateTemplate(t *testing.T) {
 		})
 	}
 }
+
+// ruleRuntimesOf returns the in-memory state of the rules, which the
+// evaluations of the rules start from and track.
+func ruleRuntimesOf() func(rule *Rule) *ruleRuntime {
+	runtimes := make(map[*Rule]*ruleRuntime)
+	return func(rule *Rule) *ruleRuntime {
+		if runtimes[rule] == nil {
+			runtimes[rule] = &ruleRuntime{}
+		}
+		return runtimes[rule]
+	}
+}
+
+func TestPendingDurationIsHonored(t *testing.T) {
+	runtimeOf := ruleRuntimesOf()
+	evaluate := func(rule *Rule, firing bool, now time.Time) models.AlertStateType {
+		ec := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		ec.runtime = *runtimeOf(rule)
+		ec.Firing = firing
+		rule.State = ec.GetNewState()
+		ec.trackPendingState(now)
+		*runtimeOf(rule) = ec.runtime
+		return rule.State
+	}
+
+	t.Run("a single spike never fires", func(t *testing.T) {
+		rule := &Rule{State: models.AlertStateOK, For: time.Minute * 5, LastStateChange: time.Now().Add(-time.Hour)}
+
+		require.Equal(t, models.AlertStatePending, evaluate(rule, true, time.Now()))
+		require.False(t, runtimeOf(rule).PendingSince.IsZero())
+
+		require.Equal(t, models.AlertStateOK, evaluate(rule, false, time.Now()))
+		require.True(t, runtimeOf(rule).PendingSince.IsZero())
+	})
+
+	t.Run("a sustained condition fires after the for duration", func(t *testing.T) {
+		rule := &Rule{State: models.AlertStateOK, For: time.Minute * 5, LastStateChange: time.Now().Add(-time.Hour)}
+
+		require.Equal(t, models.AlertStatePending, evaluate(rule, true, time.Now().Add(-time.Minute*3)))
+		require.Equal(t, models.AlertStatePending, evaluate(rule, true, time.Now()))
+
+		runtimeOf(rule).PendingSince = time.Now().Add(-time.Minute * 6)
+		require.Equal(t, models.AlertStateAlerting, evaluate(rule, true, time.Now()))
+		require.True(t, runtimeOf(rule).PendingSince.IsZero())
+	})
+
+	t.Run("pending since takes precedence over the last state change", func(t *testing.T) {
+		// the last state change is old because saving the pending state failed
+		rule := &Rule{State: models.AlertStatePending, For: time.Minute * 5, LastStateChange: time.Now().Add(-time.Hour)}
+		runtimeOf(rule).PendingSince = time.Now().Add(-time.Minute)
+
+		require.Equal(t, models.AlertStatePending, evaluate(rule, true, time.Now()))
+	})
+}
+
+func TestResolveCooldownIsHonored(t *testing.T) {
+	runtimeOf := ruleRuntimesOf()
+	evaluate := func(rule *Rule, firing bool, now time.Time) models.AlertStateType {
+		ec := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		ec.runtime = *runtimeOf(rule)
+		ec.Firing = firing
+		rule.State = ec.getNewStateAt(now)
+		ec.trackPendingState(now)
+		ec.trackResolvedState(now)
+		*runtimeOf(rule) = ec.runtime
+		return rule.State
+	}
+	start := time.Now()
+
+	t.Run("the rule does not fire again within the cooldown", func(t *testing.T) {
+		rule := &Rule{State: models.AlertStateOK, ResolveCooldown: time.Minute * 10}
+
+		require.Equal(t, models.AlertStateAlerting, evaluate(rule, true, start))
+		require.Equal(t, models.AlertStateOK, evaluate(rule, false, start.Add(time.Minute)))
+		require.Equal(t, start.Add(time.Minute), runtimeOf(rule).ResolvedAt)
+
+		require.Equal(t, models.AlertStateOK, evaluate(rule, true, start.Add(time.Minute*2)))
+		require.Equal(t, models.AlertStateOK, evaluate(rule, true, start.Add(time.Minute*10)))
+		require.Equal(t, start.Add(time.Minute), runtimeOf(rule).ResolvedAt, "the cooldown starts when the rule resolves")
+
+		require.Equal(t, models.AlertStateAlerting, evaluate(rule, true, start.Add(time.Minute*12)))
+	})
+
+	t.Run("the cooldown is measured before the for duration", func(t *testing.T) {
+		rule := &Rule{State: models.AlertStateOK, For: time.Minute, ResolveCooldown: time.Minute * 10}
+		runtimeOf(rule).ResolvedAt = start
+
+		require.Equal(t, models.AlertStateOK, evaluate(rule, true, start.Add(time.Minute*5)))
+		require.Equal(t, models.AlertStatePending, evaluate(rule, true, start.Add(time.Minute*11)))
+	})
+
+	t.Run("the rules which never resolved fire right away", func(t *testing.T) {
+		rule := &Rule{State: models.AlertStateOK, ResolveCooldown: time.Minute * 10, LastStateChange: start}
+
+		require.Equal(t, models.AlertStateAlerting, evaluate(rule, true, start.Add(time.Minute)))
+	})
+
+	t.Run("evaluation errors are not held by the cooldown", func(t *testing.T) {
+		rule := &Rule{State: models.AlertStateOK, ResolveCooldown: time.Minute * 10, ExecutionErrorState: models.ExecutionErrorSetAlerting}
+		ec := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		ec.runtime.ResolvedAt = start
+		ec.Error = errors.New("test error")
+
+		require.Equal(t, models.AlertStateAlerting, ec.getNewStateAt(start.Add(time.Minute)))
+	})
+}
+
+func TestConsecutiveBreachesAreHonored(t *testing.T) {
+	runtimeOf := ruleRuntimesOf()
+	evaluate := func(rule *Rule, firing bool) models.AlertStateType {
+		ec := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		ec.runtime = *runtimeOf(rule)
+		ec.Firing = firing
+		rule.State = ec.GetNewState()
+		ec.trackBreaches()
+		*runtimeOf(rule) = ec.runtime
+		return rule.State
+	}
+
+	t.Run("the rule fires after the consecutive breaches", func(t *testing.T) {
+		rule := &Rule{State: models.AlertStateOK, ConsecutiveBreaches: 3}
+
+		require.Equal(t, models.AlertStateOK, evaluate(rule, true))
+		require.Equal(t, models.AlertStateOK, evaluate(rule, true))
+		require.Equal(t, models.AlertStateAlerting, evaluate(rule, true))
+		require.Equal(t, models.AlertStateAlerting, evaluate(rule, true))
+		require.Equal(t, 3, runtimeOf(rule).Breaches, "the count stops at the consecutive breaches")
+		require.Equal(t, models.AlertStateOK, evaluate(rule, false))
+	})
+
+	t.Run("a passing evaluation resets the count", func(t *testing.T) {
+		rule := &Rule{State: models.AlertStateOK, ConsecutiveBreaches: 3}
+
+		for _, firing := range []bool{true, true, false, true, true} {
+			require.Equal(t, models.AlertStateOK, evaluate(rule, firing))
+		}
+		require.Equal(t, models.AlertStateAlerting, evaluate(rule, true))
+	})
+
+	t.Run("the failing evaluations leave the count as is", func(t *testing.T) {
+		rule := &Rule{State: models.AlertStateOK, ConsecutiveBreaches: 2, ExecutionErrorState: models.ExecutionErrorKeepState}
+		require.Equal(t, models.AlertStateOK, evaluate(rule, true))
+
+		ec := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		ec.runtime = *runtimeOf(rule)
+		ec.Error = errors.New("test error")
+		rule.State = ec.GetNewState()
+		ec.trackBreaches()
+		*runtimeOf(rule) = ec.runtime
+		require.Equal(t, 1, runtimeOf(rule).Breaches)
+
+		require.Equal(t, models.AlertStateAlerting, evaluate(rule, true))
+	})
+
+	t.Run("the consecutive breaches are counted before the for duration", func(t *testing.T) {
+		rule := &Rule{State: models.AlertStateOK, ConsecutiveBreaches: 2, For: time.Minute}
+
+		require.Equal(t, models.AlertStateOK, evaluate(rule, true))
+		require.Equal(t, models.AlertStatePending, evaluate(rule, true))
+	})
+
+	t.Run("the rules without consecutive breaches fire right away", func(t *testing.T) {
+		require.Equal(t, models.AlertStateAlerting, evaluate(&Rule{State: models.AlertStateOK}, true))
+		require.Equal(t, models.AlertStateAlerting, evaluate(&Rule{State: models.AlertStateOK, ConsecutiveBreaches: 1}, true))
+	})
+}
+
+func TestGetDurationMs(t *testing.T) {
+	ctx := NewEvalContext(context.TODO(), &Rule{}, &validations.OSSPluginRequestValidator{})
+	ctx.StartTime = time.Date(2021, 6, 1, 0, 0, 0, 900*int(time.Millisecond), time.UTC)
+
+	// the duration spans a second boundary
+	ctx.EndTime = ctx.StartTime.Add(1500 * time.Millisecond)
+	require.Equal(t, float64(1500), ctx.GetDurationMs())
+}
@@ -0,0 +1,158 @@
+package alerting
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// EvalEvent is the outcome of an alert evaluation published to the eval event sink.
+type EvalEvent struct {
+	RuleID         int64
+	OrgID          int64
+	DashboardID    int64
+	PanelID        int64
+	RuleName       string
+	State          models.AlertStateType
+	PrevState      models.AlertStateType
+	Firing         bool
+	NoDataFound    bool
+	Degraded       bool
+	ShadowFiring   *bool
+	ConditionEvals string
+	EvalMatches    []*EvalMatch
+	Duration       time.Duration
+	Error          string
+	Time           time.Time
+}
+
+func newEvalEvent(evalContext *EvalContext) EvalEvent {
+	event := EvalEvent{
+		RuleID:         evalContext.Rule.ID,
+		OrgID:          evalContext.Rule.OrgID,
+		DashboardID:    evalContext.Rule.DashboardID,
+		PanelID:        evalContext.Rule.PanelID,
+		RuleName:       evalContext.Rule.Name,
+		State:          evalContext.Rule.State,
+		PrevState:      evalContext.PrevAlertState,
+		Firing:         evalContext.Firing,
+		NoDataFound:    evalContext.NoDataFound,
+		Degraded:       evalContext.Degraded,
+		ShadowFiring:   evalContext.ShadowFiring,
+		ConditionEvals: evalContext.ConditionEvals,
+		EvalMatches:    evalContext.EvalMatches,
+		Duration:       evalContext.EndTime.Sub(evalContext.StartTime),
+		Time:           evalContext.EndTime,
+	}
+	if evalContext.Error != nil {
+		event.Error = evalContext.Error.Error()
+	}
+	return event
+}
+
+// EvalEventSink receives the outcome of every alert evaluation, e.g. to
+// stream it to an external queue. Events are published one at a time.
+type EvalEventSink interface {
+	Publish(ctx context.Context, event EvalEvent) error
+}
+
+type noopEvalEventSink struct{}
+
+func (noopEvalEventSink) Publish(context.Context, EvalEvent) error {
+	return nil
+}
+
+var (
+	evalEventSinkMtx sync.RWMutex
+	evalEventSink    EvalEventSink = noopEvalEventSink{}
+)
+
+// RegisterEvalEventSink sets the sink the outcome of the alert evaluations
+// is published to. It must be called before the engine is initialized.
+func RegisterEvalEventSink(sink EvalEventSink) {
+	evalEventSinkMtx.Lock()
+	defer evalEventSinkMtx.Unlock()
+	if sink == nil {
+		sink = noopEvalEventSink{}
+	}
+	evalEventSink = sink
+}
+
+func registeredEvalEventSink() EvalEventSink {
+	evalEventSinkMtx.RLock()
+	defer evalEventSinkMtx.RUnlock()
+	return evalEventSink
+}
+
+// evalEventBufferSize is the number of events waiting to be published
+// above which the events are dropped.
+var evalEventBufferSize = 1000
+
+// evalEventPublishTimeout bounds the time the sink is given to publish an event.
+var evalEventPublishTimeout = 10 * time.Second
+
+// evalEventPublisher publishes the evaluation events to the sink in the
+// background, so a slow sink never holds up the evaluation of the rules.
+type evalEventPublisher struct {
+	sink   EvalEventSink
+	events chan EvalEvent
+	log    log.Logger
+}
+
+func newEvalEventPublisher(sink EvalEventSink) *evalEventPublisher {
+	return &evalEventPublisher{
+		sink:   sink,
+		events: make(chan EvalEvent, evalEventBufferSize),
+		log:    log.New("alerting.evalEvents"),
+	}
+}
+
+// publish queues the event of the evaluation, dropping it when the buffer is full.
+func (p *evalEventPublisher) publish(evalContext *EvalContext) {
+	select {
+	case p.events <- newEvalEvent(evalContext):
+	default:
+		metrics.MAlertingEvalEventsDropped.Inc()
+		p.log.Debug("Dropping evaluation event, the buffer is full", "ruleId", evalContext.Rule.ID)
+	}
+}
+
+// run publishes the queued events until the grafana server context is
+// canceled or done is closed, once no more events can be queued.
+func (p *evalEventPublisher) run(grafanaCtx context.Context, done <-chan struct{}) error {
+	for {
+		select {
+		case <-grafanaCtx.Done():
+			return nil
+		case <-done:
+			for {
+				select {
+				case event := <-p.events:
+					p.send(grafanaCtx, event)
+				default:
+					return nil
+				}
+			}
+		case event := <-p.events:
+			p.send(grafanaCtx, event)
+		}
+	}
+}
+
+func (p *evalEventPublisher) send(grafanaCtx context.Context, event EvalEvent) {
+	defer func() {
+		if err := recover(); err != nil {
+			p.log.Error("Eval event sink panic", "error", err, "stack", log.Stack(1))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(grafanaCtx, evalEventPublishTimeout)
+	defer cancel()
+	if err := p.sink.Publish(ctx, event); err != nil {
+		p.log.Warn("Failed to publish evaluation event", "ruleId", event.RuleID, "error", err)
+	}
+}
@@ -0,0 +1,109 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeEvalEventSink struct {
+	events  chan EvalEvent
+	release chan struct{}
+}
+
+func (s *fakeEvalEventSink) Publish(ctx context.Context, event EvalEvent) error {
+	if s.release != nil {
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.events <- event
+	return nil
+}
+
+func TestEngineEvalEvents(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+	t.Cleanup(func() { RegisterEvalEventSink(nil) })
+
+	newEngine := func(sink EvalEventSink) (*AlertEngine, *slowResultHandler) {
+		RegisterEvalEventSink(sink)
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.evalHandler = NewFakeEvalHandler(1)
+		resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 10)}
+		engine.resultHandler = resultHandler
+		engine.resultQueue = nil
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go func() { _ = engine.evalEvents.run(ctx, nil) }()
+		return engine, resultHandler
+	}
+
+	process := func(engine *AlertEngine, resultHandler *slowResultHandler, rule *Rule) {
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}))
+		select {
+		case <-resultHandler.handled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the result to be handled")
+		}
+	}
+
+	t.Run("the outcome of the evaluations is published", func(t *testing.T) {
+		sink := &fakeEvalEventSink{events: make(chan EvalEvent, 10)}
+		engine, resultHandler := newEngine(sink)
+
+		process(engine, resultHandler, &Rule{ID: 1, OrgID: 2, Name: "rule", State: models.AlertStateOK})
+
+		select {
+		case event := <-sink.events:
+			require.Equal(t, int64(1), event.RuleID)
+			require.Equal(t, int64(2), event.OrgID)
+			require.Equal(t, "rule", event.RuleName)
+			require.Equal(t, models.AlertStateOK, event.State)
+			require.Empty(t, event.Error)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the event to be published")
+		}
+	})
+
+	t.Run("a slow sink doesn't block the evaluations", func(t *testing.T) {
+		origBufferSize := evalEventBufferSize
+		t.Cleanup(func() { evalEventBufferSize = origBufferSize })
+		evalEventBufferSize = 1
+
+		sink := &fakeEvalEventSink{events: make(chan EvalEvent, 10), release: make(chan struct{})}
+		engine, resultHandler := newEngine(sink)
+		dropped := testutil.ToFloat64(metrics.MAlertingEvalEventsDropped)
+
+		// the first event is held by the sink, the second one fills the buffer
+		for i := int64(1); i <= 4; i++ {
+			engine.evalHandler = NewFakeEvalHandler(1)
+			process(engine, resultHandler, &Rule{ID: i, State: models.AlertStateOK})
+			if i == 1 {
+				require.Eventually(t, func() bool { return len(engine.evalEvents.events) == 0 }, time.Second, time.Millisecond)
+			}
+		}
+		require.Equal(t, dropped+2, testutil.ToFloat64(metrics.MAlertingEvalEventsDropped))
+
+		close(sink.release)
+		for _, ruleID := range []int64{1, 2} {
+			select {
+			case event := <-sink.events:
+				require.Equal(t, ruleID, event.RuleID)
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the event to be published")
+			}
+		}
+	})
+}
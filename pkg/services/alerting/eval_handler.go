@@ -1,13 +1,17 @@
 package alerting
 
 import (
+	gocontext "context"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/grafana/grafana/pkg/components/null"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/infra/metrics"
 	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 // DefaultEvalHandler is responsible for evaluating the alert rule.
@@ -15,33 +19,119 @@ type DefaultEvalHandler struct {
 	log             log.Logger
 	alertJobTimeout time.Duration
 	requestHandler  plugins.DataRequestHandler
+
+	// conditionConcurrency is the maximum number of conditions of a rule
+	// evaluated at the same time.
+	conditionConcurrency int
+
+	queryCache *queryCache
 }
 
 // NewEvalHandler is the `DefaultEvalHandler` constructor.
 func NewEvalHandler(requestHandler plugins.DataRequestHandler) *DefaultEvalHandler {
 	return &DefaultEvalHandler{
-		log:             log.New("alerting.evalHandler"),
-		alertJobTimeout: time.Second * 5,
-		requestHandler:  requestHandler,
+		log:                  log.New("alerting.evalHandler"),
+		alertJobTimeout:      time.Second * 5,
+		requestHandler:       requestHandler,
+		conditionConcurrency: 4,
+		queryCache:           newQueryCache(),
 	}
 }
 
 // Eval evaluated the alert rule.
 func (e *DefaultEvalHandler) Eval(context *EvalContext) {
+	var firing, noDataFound bool
+	var latestDataPoint time.Time
+
+	if len(context.Rule.PreCheck) > 0 && !e.passesPreCheck(context) {
+		// the rule keeps its state while the pre-check is false
+		if context.batch != nil {
+			context.batch.withdraw(context.Rule)
+		}
+		context.Skipped = true
+		context.ConditionEvals = "pre-check = false"
+		context.EndTime = time.Now()
+		return
+	}
+
+	requestHandler := e.requestHandler
+	if context.batch != nil {
+		requestHandler = context.batch.handler(requestHandler)
+	} else if context.Rule.QueryCacheResolution > 0 && !context.IsTestRun {
+		// the batched rules are left out, their batch expects their queries
+		requestHandler = e.queryCache.handler(context.Rule, context.StartTime, requestHandler)
+	}
+	if len(context.Rule.Windows) > 0 {
+		firing, noDataFound, latestDataPoint = e.evalWindows(context, requestHandler)
+	} else {
+		firing, noDataFound, latestDataPoint, _ = e.evalRuleConditions(context, requestHandler)
+	}
+
+	if len(context.Rule.Shadow) > 0 {
+		e.evalShadow(context)
+	}
+
+	// stale data would keep the rule in its last state forever, so it is
+	// handled like missing data instead.
+	if context.Error == nil && isDataStale(context, latestDataPoint) {
+		age := dataAge(context, latestDataPoint)
+		e.log.Debug("Alert rule data is stale", "ruleId", context.Rule.ID, "age", age, "maxDataAge", context.Rule.MaxDataAge)
+		if context.IsTestRun || context.IsDebug {
+			context.Logs = append(context.Logs, &ResultLogEntry{
+				Message: fmt.Sprintf("Latest datapoint is %s old, older than the max data age of %s", age, context.Rule.MaxDataAge),
+			})
+		}
+		context.ConditionEvals += " (stale data)"
+		firing = false
+		noDataFound = true
+		context.EvalMatches = []*EvalMatch{}
+	}
+
+	context.Firing = firing
+	context.NoDataFound = noDataFound
+	if context.Rule.PerSeries {
+		evalSeriesStates(context)
+	}
+	context.EndTime = time.Now()
+
+	elapsedTime := context.EndTime.Sub(context.StartTime).Nanoseconds() / int64(time.Millisecond)
+	metrics.MAlertingExecutionTime.Observe(float64(elapsedTime))
+
+	// only the evaluations hitting the hard timeout fail, the slow ones
+	// are flagged to be monitored before they do.
+	if softTimeout := setting.AlertingEvaluationSoftTimeout; softTimeout > 0 && context.Error == nil {
+		if duration := context.EndTime.Sub(context.StartTime); duration > softTimeout {
+			context.Degraded = true
+			metrics.MAlertingDegradedEvaluations.Inc()
+			e.log.Warn("Alert rule evaluation exceeded the soft timeout", "ruleId", context.Rule.ID, "duration", duration, "softTimeout", softTimeout)
+		}
+	}
+}
+
+// evalRuleConditions evaluates the conditions of the rule and combines their
+// results with their operators. It returns the outcomes of the conditions
+// along with the combination.
+func (e *DefaultEvalHandler) evalRuleConditions(context *EvalContext, requestHandler plugins.DataRequestHandler) (bool, bool, time.Time, []conditionOutcome) {
 	firing := true
 	noDataFound := true
 	conditionEvals := ""
+	var latestDataPoint time.Time
 
+	outcomes := e.evalConditions(context, context.Rule.Conditions, requestHandler)
 	for i := 0; i < len(context.Rule.Conditions); i++ {
 		condition := context.Rule.Conditions[i]
-		cr, err := condition.Eval(context, e.requestHandler)
-		if err != nil {
+		cr, err := outcomes[i].result, outcomes[i].err
+		context.Logs = append(context.Logs, outcomes[i].logs...)
+		context.QueryTraces = append(context.QueryTraces, outcomes[i].queryTraces...)
+		context.ConditionResults = append(context.ConditionResults, newConditionEvalResult(i, condition, cr, err))
+		if err != nil && context.Error == nil {
 			context.Error = err
 		}
 
-		// break if condition could not be evaluated
+		// once a condition could not be evaluated the rule can't be either, the
+		// remaining conditions are still evaluated for their results to be known.
 		if context.Error != nil {
-			break
+			continue
 		}
 
 		if i == 0 {
@@ -65,13 +155,210 @@ func (e *DefaultEvalHandler) Eval(context *EvalContext) {
 		}
 
 		context.EvalMatches = append(context.EvalMatches, cr.EvalMatches...)
+		if len(cr.Values) > 0 {
+			if context.SeriesValues == nil {
+				context.SeriesValues = make(SeriesValues)
+			}
+			context.SeriesValues[i] = cr.Values
+		}
+		if cr.LatestDataPoint.After(latestDataPoint) {
+			latestDataPoint = cr.LatestDataPoint
+		}
 	}
 
 	context.ConditionEvals = conditionEvals + " = " + strconv.FormatBool(firing)
-	context.Firing = firing
-	context.NoDataFound = noDataFound
-	context.EndTime = time.Now()
+	return firing, noDataFound, latestDataPoint, outcomes
+}
 
-	elapsedTime := context.EndTime.Sub(context.StartTime).Nanoseconds() / int64(time.Millisecond)
-	metrics.MAlertingExecutionTime.Observe(float64(elapsedTime))
+// passesPreCheck evaluates the pre-check conditions of the rule, which gate
+// the evaluation of its conditions. The rule is evaluated when its pre-check
+// fails to be, so that a failing pre-check never hides an alert.
+func (e *DefaultEvalHandler) passesPreCheck(context *EvalContext) bool {
+	firing, err := e.evalVerdict(context, context.Rule.PreCheck)
+	if err != nil {
+		e.log.Warn("Failed to evaluate the pre-check of the alert rule, evaluating the rule", "ruleId", context.Rule.ID, "error", err)
+		return true
+	}
+
+	if !firing && (context.IsTestRun || context.IsDebug) {
+		context.Logs = append(context.Logs, &ResultLogEntry{Message: "Pre-check is false, skipping the evaluation of the conditions"})
+	}
+	return firing
+}
+
+// evalShadow evaluates the shadow conditions of the rule and records their
+// verdict, which never changes the firing decision of the rule.
+func (e *DefaultEvalHandler) evalShadow(context *EvalContext) {
+	firing, err := e.evalVerdict(context, context.Rule.Shadow)
+	if err != nil {
+		e.log.Warn("Failed to evaluate the shadow conditions of the alert rule", "ruleId", context.Rule.ID, "error", err)
+		metrics.MAlertingShadowVerdicts.WithLabelValues("error").Inc()
+		return
+	}
+
+	context.ShadowFiring = &firing
+	verdict := "ok"
+	if firing {
+		verdict = "firing"
+	}
+	metrics.MAlertingShadowVerdicts.WithLabelValues(verdict).Inc()
+	if context.IsTestRun || context.IsDebug {
+		context.Logs = append(context.Logs, &ResultLogEntry{Message: fmt.Sprintf("Shadow conditions = %t", firing)})
+	}
+}
+
+// evalVerdict evaluates the conditions, outside of the batch of the rule,
+// and combines their firing states with their operators.
+func (e *DefaultEvalHandler) evalVerdict(context *EvalContext, conditions []Condition) (bool, error) {
+	firing := true
+	for i, outcome := range e.evalConditions(context, conditions, e.requestHandler) {
+		context.Logs = append(context.Logs, outcome.logs...)
+		context.QueryTraces = append(context.QueryTraces, outcome.queryTraces...)
+		if outcome.err != nil {
+			return false, outcome.err
+		}
+
+		switch {
+		case i == 0:
+			firing = outcome.result.Firing
+		case outcome.result.Operator == "or":
+			firing = firing || outcome.result.Firing
+		default:
+			firing = firing && outcome.result.Firing
+		}
+	}
+	return firing, nil
+}
+
+// conditionOutcome is what the evaluation of a single condition produced.
+type conditionOutcome struct {
+	result      *ConditionResult
+	err         error
+	logs        []*ResultLogEntry
+	queryTraces []*QueryTrace
+}
+
+// evalConditions evaluates the conditions concurrently, so that
+// the latency of a rule is the one of its slowest condition. Every condition
+// is evaluated against its own copy of the context, its logs and query traces
+// are merged back by the caller in the order of the conditions. Conditions
+// that did not complete before the deadline of the context fail.
+func (e *DefaultEvalHandler) evalConditions(context *EvalContext, conditions []Condition, requestHandler plugins.DataRequestHandler) []conditionOutcome {
+	outcomes := make([]conditionOutcome, len(conditions))
+	if len(conditions) == 0 {
+		return outcomes
+	}
+
+	ctx := context.Ctx
+	if ctx == nil {
+		ctx = gocontext.Background()
+	}
+
+	type indexedOutcome struct {
+		index   int
+		outcome conditionOutcome
+	}
+	// buffered so that the conditions still running after the deadline
+	// don't block forever.
+	completed := make(chan indexedOutcome, len(conditions))
+	sem := make(chan struct{}, e.conditionConcurrency)
+	// copied up front since the caller changes the context once the
+	// deadline is reached, while late conditions may still be starting.
+	base := *context
+	base.Logs = nil
+	base.QueryTraces = nil
+
+	for i, condition := range conditions {
+		go func(i int, condition Condition) {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				completed <- indexedOutcome{index: i, outcome: conditionOutcome{err: ctx.Err()}}
+				return
+			}
+
+			conditionContext := base
+			cr, err := condition.Eval(&conditionContext, requestHandler)
+			if cr != nil {
+				cr.Firing = cr.aggregatedFiring()
+				if cr.EmptyResult && base.Rule.EmptyResultAsZero {
+					takeEmptyResultAsZero(cr)
+				}
+			}
+			completed <- indexedOutcome{index: i, outcome: conditionOutcome{
+				result:      cr,
+				err:         err,
+				logs:        conditionContext.Logs,
+				queryTraces: conditionContext.QueryTraces,
+			}}
+		}(i, condition)
+	}
+
+	done := make([]bool, len(conditions))
+	for remaining := len(conditions); remaining > 0; remaining-- {
+		select {
+		case c := <-completed:
+			outcomes[c.index] = c.outcome
+			done[c.index] = true
+		case <-ctx.Done():
+			// keep the outcomes that completed at the same time as the deadline
+			for drained := false; !drained; {
+				select {
+				case c := <-completed:
+					outcomes[c.index] = c.outcome
+					done[c.index] = true
+				default:
+					drained = true
+				}
+			}
+			for i := range outcomes {
+				if !done[i] {
+					outcomes[i] = conditionOutcome{err: fmt.Errorf("condition %d did not complete: %w", i, ctx.Err())}
+				}
+			}
+			return outcomes
+		}
+	}
+	return outcomes
+}
+
+// isDataStale returns true if the rule has a max data age and the most recent
+// datapoint is older than it.
+func isDataStale(context *EvalContext, latestDataPoint time.Time) bool {
+	if context.Rule.MaxDataAge <= 0 || latestDataPoint.IsZero() {
+		return false
+	}
+	return dataAge(context, latestDataPoint) > context.Rule.MaxDataAge
+}
+
+// dataAge returns the age of the datapoint at the time the evaluation
+// queried up to, that is before the evaluation offset of the rule.
+func dataAge(context *EvalContext, dataPoint time.Time) time.Duration {
+	return context.StartTime.Add(-context.Rule.EvaluationOffset).Sub(dataPoint)
+}
+
+// takeEmptyResultAsZero changes the empty result of the condition into the
+// result of a zero value, distinct from the no data of a failed query.
+func takeEmptyResultAsZero(cr *ConditionResult) {
+	cr.NoDataFound = false
+	cr.Firing = cr.ZeroFiring
+	cr.EvalMatches = nil
+	if cr.ZeroFiring {
+		cr.EvalMatches = []*EvalMatch{{Metric: "Empty result", Value: null.FloatFrom(0)}}
+	}
+}
+
+func newConditionEvalResult(index int, condition Condition, cr *ConditionResult, err error) *ConditionEvalResult {
+	result := &ConditionEvalResult{Index: index, Error: err}
+	if dc, ok := condition.(DatasourceCondition); ok {
+		result.DatasourceID = dc.GetDatasourceID()
+	}
+	if cr != nil {
+		result.Operator = cr.Operator
+		result.Firing = cr.Firing
+		result.NoDataFound = cr.NoDataFound
+		result.EvalMatches = cr.EvalMatches
+	}
+	return result
 }
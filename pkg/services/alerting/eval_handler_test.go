@@ -2,23 +2,54 @@ package alerting
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/plugins"
 	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
 
 type conditionStub struct {
-	firing   bool
-	operator string
-	matches  []*EvalMatch
-	noData   bool
+	firing       bool
+	operator     string
+	matches      []*EvalMatch
+	noData       bool
+	datasourceID int64
+	latest       time.Time
+	delay        time.Duration
+	err          error
+	calls        int
+	aggregation  AggregationMode
+	seriesCount  int
+	emptyResult  bool
+	zeroFiring   bool
 }
 
 func (c *conditionStub) Eval(context *EvalContext, reqHandler plugins.DataRequestHandler) (*ConditionResult, error) {
-	return &ConditionResult{Firing: c.firing, EvalMatches: c.matches, Operator: c.operator, NoDataFound: c.noData}, nil
+	c.calls++
+	if c.delay > 0 {
+		select {
+		case <-time.After(c.delay):
+		case <-context.Ctx.Done():
+			return nil, context.Ctx.Err()
+		}
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &ConditionResult{Firing: c.firing, EvalMatches: c.matches, Operator: c.operator, NoDataFound: c.noData, LatestDataPoint: c.latest,
+		AggregationMode: c.aggregation, SeriesCount: c.seriesCount, EmptyResult: c.emptyResult, ZeroFiring: c.zeroFiring}, nil
+}
+
+func (c *conditionStub) GetDatasourceID() int64 {
+	return c.datasourceID
 }
 
 func TestAlertingEvaluationHandler(t *testing.T) {
@@ -37,6 +68,24 @@ func TestAlertingEvaluationHandler(t *testing.T) {
 			So(context.ConditionEvals, ShouldEqual, "true = true")
 		})
 
+		Convey("Should aggregate the series of a condition with its aggregation mode", func() {
+			breaching := []*EvalMatch{{Metric: "web-1"}, {Metric: "web-3"}}
+			eval := func(mode AggregationMode, matches []*EvalMatch) *EvalContext {
+				context := NewEvalContext(context.TODO(), &Rule{
+					Conditions: []Condition{&conditionStub{firing: len(matches) > 0, matches: matches, aggregation: mode, seriesCount: 3}},
+				}, &validations.OSSPluginRequestValidator{})
+				handler.Eval(context)
+				return context
+			}
+
+			So(eval(AggregationAny, breaching).Firing, ShouldBeTrue)
+			So(eval(AggregationAll, breaching).Firing, ShouldBeFalse)
+			So(eval(AggregationAll, breaching).ConditionResults[0].Firing, ShouldBeFalse)
+			So(eval(AggregationAll, append(breaching, &EvalMatch{Metric: "web-2"})).Firing, ShouldBeTrue)
+			So(eval(AggregationAny, nil).Firing, ShouldBeFalse)
+			So(eval(AggregationAll, nil).Firing, ShouldBeFalse)
+		})
+
 		Convey("Show return triggered with single passing condition2", func() {
 			context := NewEvalContext(context.TODO(), &Rule{
 				Conditions: []Condition{&conditionStub{firing: true, operator: "and"}},
@@ -205,5 +254,298 @@ func TestAlertingEvaluationHandler(t *testing.T) {
 			handler.Eval(context)
 			So(context.NoDataFound, ShouldBeTrue)
 		})
+
+		Convey("Should keep the result of the condition on every datasource", func() {
+			context := NewEvalContext(context.TODO(), &Rule{
+				Conditions: []Condition{
+					&conditionStub{firing: true, datasourceID: 1, matches: []*EvalMatch{{Metric: "error_rate"}}},
+					&conditionStub{operator: "and", firing: true, datasourceID: 2, matches: []*EvalMatch{{Metric: "deploys"}}},
+				},
+			}, &validations.OSSPluginRequestValidator{})
+
+			handler.Eval(context)
+			So(context.Firing, ShouldBeTrue)
+			So(context.EvalMatches, ShouldHaveLength, 2)
+			So(context.ConditionResults, ShouldHaveLength, 2)
+			So(context.ConditionResults[0].DatasourceID, ShouldEqual, 1)
+			So(context.ConditionResults[0].EvalMatches[0].Metric, ShouldEqual, "error_rate")
+			So(context.ConditionResults[1].DatasourceID, ShouldEqual, 2)
+			So(context.ConditionResults[1].Operator, ShouldEqual, "and")
+			So(context.ConditionResults[1].Firing, ShouldBeTrue)
+		})
+
+		Convey("Should not fire when the condition on one datasource is not firing using AND", func() {
+			context := NewEvalContext(context.TODO(), &Rule{
+				Conditions: []Condition{
+					&conditionStub{firing: true, datasourceID: 1},
+					&conditionStub{operator: "and", firing: false, datasourceID: 2},
+				},
+			}, &validations.OSSPluginRequestValidator{})
+
+			handler.Eval(context)
+			So(context.Firing, ShouldBeFalse)
+			So(context.ConditionResults[0].Firing, ShouldBeTrue)
+			So(context.ConditionResults[1].Firing, ShouldBeFalse)
+		})
+
+		Convey("Should fire when the condition on one datasource is firing using OR", func() {
+			context := NewEvalContext(context.TODO(), &Rule{
+				Conditions: []Condition{
+					&conditionStub{firing: false, datasourceID: 1},
+					&conditionStub{operator: "or", firing: true, datasourceID: 2},
+				},
+			}, &validations.OSSPluginRequestValidator{})
+
+			handler.Eval(context)
+			So(context.Firing, ShouldBeTrue)
+		})
+
+		Convey("Should fail but keep the results of the other conditions when one datasource fails", func() {
+			queryErr := errors.New("datasource unavailable")
+			context := NewEvalContext(context.TODO(), &Rule{
+				Conditions: []Condition{
+					&conditionStub{firing: true, datasourceID: 1},
+					&conditionStub{operator: "or", datasourceID: 2, err: queryErr},
+					&conditionStub{operator: "or", firing: true, datasourceID: 3},
+				},
+			}, &validations.OSSPluginRequestValidator{})
+
+			handler.Eval(context)
+			So(context.Error, ShouldEqual, queryErr)
+			So(context.ConditionResults, ShouldHaveLength, 3)
+			So(context.ConditionResults[0].Error, ShouldBeNil)
+			So(context.ConditionResults[1].Error, ShouldEqual, queryErr)
+			So(context.ConditionResults[1].DatasourceID, ShouldEqual, 2)
+			So(context.ConditionResults[2].Error, ShouldBeNil)
+			So(context.ConditionResults[2].Firing, ShouldBeTrue)
+		})
+
+		Convey("Max data age", func() {
+			newContext := func(age time.Duration) *EvalContext {
+				context := NewEvalContext(context.TODO(), &Rule{
+					MaxDataAge: time.Minute,
+					Conditions: []Condition{&conditionStub{firing: true, matches: []*EvalMatch{{Metric: "cpu"}}}},
+				}, &validations.OSSPluginRequestValidator{})
+				context.Rule.Conditions[0].(*conditionStub).latest = context.StartTime.Add(-age)
+				return context
+			}
+
+			Convey("Should evaluate normally with fresh data", func() {
+				context := newContext(30 * time.Second)
+				handler.Eval(context)
+				So(context.Firing, ShouldBeTrue)
+				So(context.NoDataFound, ShouldBeFalse)
+				So(context.EvalMatches, ShouldHaveLength, 1)
+			})
+
+			Convey("Should evaluate normally with data exactly at the max age", func() {
+				context := newContext(time.Minute)
+				handler.Eval(context)
+				So(context.Firing, ShouldBeTrue)
+				So(context.NoDataFound, ShouldBeFalse)
+			})
+
+			Convey("Should report no data with stale data", func() {
+				context := newContext(2 * time.Minute)
+				handler.Eval(context)
+				So(context.Firing, ShouldBeFalse)
+				So(context.NoDataFound, ShouldBeTrue)
+				So(context.EvalMatches, ShouldBeEmpty)
+				So(context.ConditionEvals, ShouldEqual, "true = true (stale data)")
+			})
+		})
+
+		Convey("Empty results", func() {
+			newContext := func(emptyResultAsZero bool, condition *conditionStub) *EvalContext {
+				return NewEvalContext(context.TODO(), &Rule{
+					EmptyResultAsZero: emptyResultAsZero,
+					Conditions:        []Condition{condition},
+				}, &validations.OSSPluginRequestValidator{})
+			}
+			empty := func() *conditionStub {
+				return &conditionStub{noData: true, emptyResult: true, zeroFiring: true}
+			}
+
+			Convey("Should report no data for an empty result by default", func() {
+				context := newContext(false, empty())
+				handler.Eval(context)
+				So(context.Firing, ShouldBeFalse)
+				So(context.NoDataFound, ShouldBeTrue)
+			})
+
+			Convey("Should evaluate an empty result as zero when the rule takes it for zero", func() {
+				context := newContext(true, empty())
+				handler.Eval(context)
+				So(context.Firing, ShouldBeTrue)
+				So(context.NoDataFound, ShouldBeFalse)
+				So(context.EvalMatches, ShouldHaveLength, 1)
+				So(context.EvalMatches[0].Value.Float64, ShouldEqual, 0)
+			})
+
+			Convey("Should not fire for an empty result when zero doesn't breach", func() {
+				condition := empty()
+				condition.zeroFiring = false
+				context := newContext(true, condition)
+				handler.Eval(context)
+				So(context.Firing, ShouldBeFalse)
+				So(context.NoDataFound, ShouldBeFalse)
+				So(context.EvalMatches, ShouldBeEmpty)
+			})
+
+			Convey("Should still fail the evaluation when the query fails", func() {
+				context := newContext(true, &conditionStub{err: errors.New("datasource unavailable")})
+				handler.Eval(context)
+				So(context.Error, ShouldNotBeNil)
+			})
+		})
+
+		Convey("Should evaluate the conditions concurrently", func() {
+			context := NewEvalContext(context.TODO(), &Rule{
+				Conditions: []Condition{
+					&conditionStub{firing: true, delay: 200 * time.Millisecond},
+					&conditionStub{operator: "and", firing: true, delay: 200 * time.Millisecond},
+					&conditionStub{operator: "and", firing: true, delay: 200 * time.Millisecond},
+				},
+			}, &validations.OSSPluginRequestValidator{})
+
+			start := time.Now()
+			handler.Eval(context)
+			So(time.Since(start), ShouldBeLessThan, 500*time.Millisecond)
+			So(context.Error, ShouldBeNil)
+			So(context.Firing, ShouldBeTrue)
+			So(context.ConditionEvals, ShouldEqual, "[[true AND true] AND true] = true")
+		})
+
+		Convey("Should fail the conditions that did not complete before the deadline", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			deadlineExceeded := context.DeadlineExceeded
+			context := NewEvalContext(ctx, &Rule{
+				Conditions: []Condition{
+					&conditionStub{firing: true},
+					&conditionStub{operator: "and", firing: true, delay: time.Second},
+				},
+			}, &validations.OSSPluginRequestValidator{})
+
+			start := time.Now()
+			handler.Eval(context)
+			So(time.Since(start), ShouldBeLessThan, 500*time.Millisecond)
+			So(errors.Is(context.Error, deadlineExceeded), ShouldBeTrue)
+			So(context.ConditionResults[0].Error, ShouldBeNil)
+			So(context.ConditionResults[0].Firing, ShouldBeTrue)
+			So(context.ConditionResults[1].Error, ShouldNotBeNil)
+		})
+
+		Convey("Pre-check", func() {
+			newContext := func(preCheck ...Condition) (*EvalContext, *conditionStub) {
+				main := &conditionStub{firing: true}
+				return NewEvalContext(context.TODO(), &Rule{
+					State:      models.AlertStateAlerting,
+					PreCheck:   preCheck,
+					Conditions: []Condition{main},
+				}, &validations.OSSPluginRequestValidator{}), main
+			}
+
+			Convey("Should evaluate the conditions when the pre-check is firing", func() {
+				context, main := newContext(&conditionStub{firing: false}, &conditionStub{operator: "or", firing: true})
+				handler.Eval(context)
+				So(main.calls, ShouldEqual, 1)
+				So(context.Skipped, ShouldBeFalse)
+				So(context.Firing, ShouldBeTrue)
+			})
+
+			Convey("Should skip the conditions and keep the state when the pre-check is not firing", func() {
+				context, main := newContext(&conditionStub{firing: true}, &conditionStub{operator: "and", firing: false})
+				handler.Eval(context)
+				So(main.calls, ShouldEqual, 0)
+				So(context.Skipped, ShouldBeTrue)
+				So(context.Error, ShouldBeNil)
+				So(context.GetNewState(), ShouldEqual, models.AlertStateAlerting)
+			})
+
+			Convey("Should evaluate the conditions when the pre-check fails", func() {
+				context, main := newContext(&conditionStub{err: errors.New("gate failed")})
+				handler.Eval(context)
+				So(main.calls, ShouldEqual, 1)
+				So(context.Skipped, ShouldBeFalse)
+				So(context.Error, ShouldBeNil)
+				So(context.Firing, ShouldBeTrue)
+			})
+		})
+
+		Convey("Shadow conditions", func() {
+			newContext := func(shadow ...Condition) *EvalContext {
+				return NewEvalContext(context.TODO(), &Rule{
+					State:      models.AlertStateOK,
+					Conditions: []Condition{&conditionStub{firing: false}},
+					Shadow:     shadow,
+				}, &validations.OSSPluginRequestValidator{})
+			}
+
+			Convey("Should record the shadow verdict without changing the firing decision", func() {
+				firing := testutil.ToFloat64(metrics.MAlertingShadowVerdicts.WithLabelValues("firing"))
+				context := newContext(&conditionStub{firing: true})
+				handler.Eval(context)
+				So(context.Firing, ShouldBeFalse)
+				So(context.ShadowFiring, ShouldNotBeNil)
+				So(*context.ShadowFiring, ShouldBeTrue)
+				So(context.GetNewState(), ShouldEqual, models.AlertStateOK)
+				So(testutil.ToFloat64(metrics.MAlertingShadowVerdicts.WithLabelValues("firing")), ShouldEqual, firing+1)
+			})
+
+			Convey("Should not record a verdict when the shadow conditions fail", func() {
+				context := newContext(&conditionStub{err: errors.New("shadow failed")})
+				handler.Eval(context)
+				So(context.Error, ShouldBeNil)
+				So(context.ShadowFiring, ShouldBeNil)
+			})
+
+			Convey("Should not record a verdict for the rules without shadow conditions", func() {
+				context := newContext()
+				handler.Eval(context)
+				So(context.ShadowFiring, ShouldBeNil)
+			})
+		})
+
+		Convey("Soft timeout", func() {
+			origSoftTimeout := setting.AlertingEvaluationSoftTimeout
+			defer func() { setting.AlertingEvaluationSoftTimeout = origSoftTimeout }()
+			setting.AlertingEvaluationSoftTimeout = 50 * time.Millisecond
+
+			newContext := func(ctx context.Context, delay time.Duration) *EvalContext {
+				return NewEvalContext(ctx, &Rule{
+					Conditions: []Condition{&conditionStub{firing: true, delay: delay}},
+				}, &validations.OSSPluginRequestValidator{})
+			}
+			degraded := testutil.ToFloat64(metrics.MAlertingDegradedEvaluations)
+
+			Convey("Should not flag the evaluations under the soft timeout", func() {
+				context := newContext(context.Background(), 0)
+				handler.Eval(context)
+				So(context.Error, ShouldBeNil)
+				So(context.Degraded, ShouldBeFalse)
+				So(testutil.ToFloat64(metrics.MAlertingDegradedEvaluations), ShouldEqual, degraded)
+			})
+
+			Convey("Should flag the evaluations over the soft timeout as degraded", func() {
+				context := newContext(context.Background(), 100*time.Millisecond)
+				handler.Eval(context)
+				So(context.Error, ShouldBeNil)
+				So(context.Firing, ShouldBeTrue)
+				So(context.Degraded, ShouldBeTrue)
+				So(testutil.ToFloat64(metrics.MAlertingDegradedEvaluations), ShouldEqual, degraded+1)
+			})
+
+			Convey("Should fail the evaluations over the hard timeout", func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				defer cancel()
+				deadlineExceeded := context.DeadlineExceeded
+				context := newContext(ctx, time.Second)
+				handler.Eval(context)
+				So(errors.Is(context.Error, deadlineExceeded), ShouldBeTrue)
+				So(context.Degraded, ShouldBeFalse)
+				So(testutil.ToFloat64(metrics.MAlertingDegradedEvaluations), ShouldEqual, degraded)
+			})
+		})
 	})
 }
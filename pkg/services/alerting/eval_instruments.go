@@ -0,0 +1,108 @@
+package alerting
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/unit"
+)
+
+const instrumentationName = "github.com/grafana/grafana/pkg/services/alerting"
+
+// The outcomes of the evaluations of the alert rules.
+const (
+	evalOutcomeOK      = "ok"
+	evalOutcomeFiring  = "firing"
+	evalOutcomeNoData  = "no_data"
+	evalOutcomeError   = "error"
+	evalOutcomeSkipped = "skipped"
+)
+
+// evalInstruments records the evaluations of the alert rules through an
+// OpenTelemetry meter, for them to be exported by whatever reader the meter
+// provider has, e.g. over OTLP. The Prometheus metrics of the evaluations
+// are still recorded along with them, and the evaluations are recorded to
+// the StatsD client as well.
+type evalInstruments struct {
+	duration    metric.Float64ValueRecorder
+	evaluations metric.Int64Counter
+	retries     metric.Int64Counter
+	statsd      StatsdClient
+}
+
+func newEvalInstruments(meter metric.Meter) (*evalInstruments, error) {
+	duration, err := meter.NewFloat64ValueRecorder("alerting.evaluation.duration",
+		metric.WithUnit(unit.Unit("s")), metric.WithDescription("duration of the evaluations of the alert rules"))
+	if err != nil {
+		return nil, err
+	}
+	evaluations, err := meter.NewInt64Counter("alerting.evaluations",
+		metric.WithDescription("number of evaluations of the alert rules, by outcome"))
+	if err != nil {
+		return nil, err
+	}
+	retries, err := meter.NewInt64Counter("alerting.evaluation.retries",
+		metric.WithDescription("number of failed attempts of evaluations of the alert rules which are retried"))
+	if err != nil {
+		return nil, err
+	}
+	return &evalInstruments{duration: duration, evaluations: evaluations, retries: retries, statsd: noopStatsdClient{}}, nil
+}
+
+// newGlobalEvalInstruments returns the instruments of the global meter
+// provider, which delegates to the provider set with global.SetMeterProvider.
+func newGlobalEvalInstruments() *evalInstruments {
+	instruments, err := newEvalInstruments(global.Meter(instrumentationName))
+	if err != nil {
+		// the global meter only fails on invalid instrument names
+		panic(err)
+	}
+	return instruments
+}
+
+func evalOutcome(evalContext *EvalContext) string {
+	switch {
+	case evalContext.Error != nil:
+		return evalOutcomeError
+	case evalContext.Skipped:
+		return evalOutcomeSkipped
+	case evalContext.NoDataFound:
+		return evalOutcomeNoData
+	case evalContext.Firing:
+		return evalOutcomeFiring
+	default:
+		return evalOutcomeOK
+	}
+}
+
+// evaluated records the last attempt of the evaluation of a rule.
+func (i *evalInstruments) evaluated(evalContext *EvalContext) {
+	name := evalOutcome(evalContext)
+	outcome := attribute.String("outcome", name)
+	i.duration.Record(context.Background(), evalContext.GetDurationMs()/1000, outcome)
+	i.evaluations.Add(context.Background(), 1, outcome)
+
+	i.statsd.Timing(statsdEvalDuration, evalContext.EndTime.Sub(evalContext.StartTime))
+	i.statsd.Increment(statsdEvaluations + "." + name)
+}
+
+// retried records a failed attempt of the evaluation of a rule which is retried.
+func (i *evalInstruments) retried() {
+	i.retries.Add(context.Background(), 1)
+	i.statsd.Increment(statsdEvalRetries)
+}
+
+// SetMeter records the evaluations of the alert rules through the meter
+// instead of the meter of the global meter provider. It must be called
+// before the engine runs.
+func (e *AlertEngine) SetMeter(meter metric.Meter) error {
+	instruments, err := newEvalInstruments(meter)
+	if err != nil {
+		return err
+	}
+	instruments.statsd = e.instruments.statsd
+	e.instruments = instruments
+	return nil
+}
@@ -0,0 +1,118 @@
+package alerting
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/oteltest"
+)
+
+// measurements returns the sums of the integer measurements recorded by the
+// meter, and the counts of all of them, by instrument name and outcome.
+func measurements(impl *oteltest.MeterImpl) (map[string]map[string]int64, map[string]map[string]int) {
+	sums := make(map[string]map[string]int64)
+	counts := make(map[string]map[string]int)
+	for _, m := range oteltest.AsStructs(impl.MeasurementBatches) {
+		if sums[m.Name] == nil {
+			sums[m.Name], counts[m.Name] = make(map[string]int64), make(map[string]int)
+		}
+		outcome := m.Labels["outcome"].AsString()
+		sums[m.Name][outcome] += m.Number.AsInt64()
+		counts[m.Name][outcome]++
+	}
+	return sums, counts
+}
+
+func TestEngineEvalInstruments(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 3
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.resultHandler = &FakeResultHandler{}
+	impl, meter := oteltest.NewMeter()
+	require.NoError(t, engine.SetMeter(meter))
+
+	// succeeds on the second attempt
+	engine.evalHandler = NewFakeEvalHandler(2)
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 1}}))
+	// never succeeds
+	engine.evalHandler = NewFakeEvalHandler(0)
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 2}}))
+
+	sums, counts := measurements(impl)
+	require.Equal(t, map[string]int64{evalOutcomeOK: 1, evalOutcomeError: 1}, sums["alerting.evaluations"])
+	require.Equal(t, map[string]int64{"": 3}, sums["alerting.evaluation.retries"])
+	require.Equal(t, map[string]int{evalOutcomeOK: 1, evalOutcomeError: 1}, counts["alerting.evaluation.duration"])
+}
+
+func TestEvalOutcome(t *testing.T) {
+	require.Equal(t, evalOutcomeOK, evalOutcome(&EvalContext{}))
+	require.Equal(t, evalOutcomeFiring, evalOutcome(&EvalContext{Firing: true}))
+	require.Equal(t, evalOutcomeNoData, evalOutcome(&EvalContext{NoDataFound: true}))
+	require.Equal(t, evalOutcomeSkipped, evalOutcome(&EvalContext{Skipped: true}))
+	require.Equal(t, evalOutcomeError, evalOutcome(&EvalContext{Error: context.DeadlineExceeded, Firing: true}))
+}
+
+// fakeStatsdClient records the metrics sent to StatsD.
+type fakeStatsdClient struct {
+	mtx      sync.Mutex
+	timings  map[string][]time.Duration
+	counters map[string]int
+}
+
+func newFakeStatsdClient() *fakeStatsdClient {
+	return &fakeStatsdClient{timings: make(map[string][]time.Duration), counters: make(map[string]int)}
+}
+
+func (c *fakeStatsdClient) Timing(name string, value time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.timings[name] = append(c.timings[name], value)
+}
+
+func (c *fakeStatsdClient) Increment(name string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.counters[name]++
+}
+
+func TestEngineStatsdClient(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 3
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.resultHandler = &FakeResultHandler{}
+	statsd := newFakeStatsdClient()
+	engine.SetStatsdClient(statsd)
+	// the client is kept when the meter is set afterwards
+	_, meter := oteltest.NewMeter()
+	require.NoError(t, engine.SetMeter(meter))
+
+	// succeeds on the second attempt
+	engine.evalHandler = NewFakeEvalHandler(2)
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 1}}))
+	// never succeeds
+	engine.evalHandler = NewFakeEvalHandler(0)
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 2}}))
+
+	require.Equal(t, map[string]int{
+		"alerting.evaluations.ok":     1,
+		"alerting.evaluations.error":  1,
+		"alerting.evaluation.retries": 3,
+	}, statsd.counters)
+	require.Len(t, statsd.timings["alerting.evaluation.duration"], 2, "the last attempt of every evaluation is timed")
+
+	t.Run("a nil client disables it", func(t *testing.T) {
+		engine.SetStatsdClient(nil)
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 3}}))
+		require.Len(t, statsd.timings["alerting.evaluation.duration"], 2)
+	})
+}
@@ -0,0 +1,158 @@
+package alerting
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// evalLagSamples is the number of evaluations the rolling average
+// duration of a rule is computed on.
+const evalLagSamples = 10
+
+// LaggingRule is an alert rule whose evaluation takes about as long as,
+// or longer than, the interval between its evaluations.
+type LaggingRule struct {
+	RuleID          int64
+	OrgID           int64
+	Name            string
+	Frequency       time.Duration
+	AverageDuration time.Duration
+}
+
+// evalLagDetector tracks the rolling average duration of the evaluations
+// of every rule and flags the rules whose average duration reaches
+// `threshold` times their frequency.
+type evalLagDetector struct {
+	sync.Mutex
+	threshold float64
+	history   map[ruleKey]*evalLagHistory
+	log       log.Logger
+}
+
+type evalLagHistory struct {
+	durations []time.Duration
+	next      int
+	lagging   *LaggingRule
+}
+
+func newEvalLagDetector(threshold float64) *evalLagDetector {
+	return &evalLagDetector{
+		threshold: threshold,
+		history:   make(map[ruleKey]*evalLagHistory),
+		log:       log.New("alerting.evalLag"),
+	}
+}
+
+// observe records the duration of an evaluation of the rule and
+// returns true if the rule is lagging behind its schedule.
+func (d *evalLagDetector) observe(rule *Rule, duration time.Duration) bool {
+	if rule.Frequency <= 0 {
+		return false
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	if d.threshold <= 0 {
+		return false
+	}
+
+	h, ok := d.history[ruleKeyOf(rule)]
+	if !ok {
+		h = &evalLagHistory{}
+		d.history[ruleKeyOf(rule)] = h
+	}
+
+	if len(h.durations) < evalLagSamples {
+		h.durations = append(h.durations, duration)
+	} else {
+		h.durations[h.next] = duration
+		h.next = (h.next + 1) % evalLagSamples
+	}
+
+	var total time.Duration
+	for _, duration := range h.durations {
+		total += duration
+	}
+	average := total / time.Duration(len(h.durations))
+	frequency := time.Duration(rule.Frequency) * time.Second
+
+	if float64(average) >= d.threshold*float64(frequency) {
+		if h.lagging == nil {
+			d.log.Warn("Alert rule evaluation is lagging behind its frequency", "ruleId", rule.ID, "name", rule.Name,
+				"averageDuration", average, "frequency", frequency)
+		}
+		h.lagging = &LaggingRule{RuleID: rule.ID, OrgID: rule.OrgID, Name: rule.Name, Frequency: frequency, AverageDuration: average}
+	} else if h.lagging != nil {
+		d.log.Info("Alert rule evaluation caught up with its frequency", "ruleId", rule.ID, "name", rule.Name,
+			"averageDuration", average, "frequency", frequency)
+		h.lagging = nil
+	}
+
+	metrics.MAlertingLaggingRules.Set(float64(d.laggingCount()))
+	return h.lagging != nil
+}
+
+// setThreshold changes the ratio of the frequency of the rules
+// their average duration is compared to.
+func (d *evalLagDetector) setThreshold(threshold float64) {
+	d.Lock()
+	defer d.Unlock()
+	d.threshold = threshold
+}
+
+// lagging returns the rules currently lagging, ordered by rule and org id.
+func (d *evalLagDetector) lagging() []LaggingRule {
+	d.Lock()
+	defer d.Unlock()
+
+	rules := make([]LaggingRule, 0)
+	for _, h := range d.history {
+		if h.lagging != nil {
+			rules = append(rules, *h.lagging)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].RuleID != rules[j].RuleID {
+			return rules[i].RuleID < rules[j].RuleID
+		}
+		return rules[i].OrgID < rules[j].OrgID
+	})
+	return rules
+}
+
+// prune forgets the rules that are no longer scheduled.
+func (d *evalLagDetector) prune(rules []*Rule) {
+	scheduled := make(map[ruleKey]bool, len(rules))
+	for _, rule := range rules {
+		scheduled[ruleKeyOf(rule)] = true
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	for key := range d.history {
+		if !scheduled[key] {
+			delete(d.history, key)
+		}
+	}
+	metrics.MAlertingLaggingRules.Set(float64(d.laggingCount()))
+}
+
+func (d *evalLagDetector) laggingCount() int {
+	count := 0
+	for _, h := range d.history {
+		if h.lagging != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// LaggingRules returns the alert rules whose recent evaluations took
+// about as long as, or longer than, the interval between them.
+func (e *AlertEngine) LaggingRules() []LaggingRule {
+	return e.evalLag.lagging()
+}
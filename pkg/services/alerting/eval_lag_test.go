@@ -0,0 +1,100 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalLagDetector(t *testing.T) {
+	t.Run("fast evaluations are not lagging", func(t *testing.T) {
+		d := newEvalLagDetector(0.8)
+		rule := &Rule{ID: 1, Frequency: 10}
+		for i := 0; i < evalLagSamples; i++ {
+			require.False(t, d.observe(rule, time.Second))
+		}
+		require.Empty(t, d.lagging())
+	})
+
+	t.Run("slow evaluations are lagging", func(t *testing.T) {
+		d := newEvalLagDetector(0.8)
+		rule := &Rule{ID: 1, Name: "slow", Frequency: 10}
+		require.True(t, d.observe(rule, 30*time.Second))
+
+		require.Equal(t, []LaggingRule{{RuleID: 1, Name: "slow", Frequency: 10 * time.Second, AverageDuration: 30 * time.Second}}, d.lagging())
+		require.Equal(t, float64(1), testutil.ToFloat64(metrics.MAlertingLaggingRules))
+	})
+
+	t.Run("uses the rolling average", func(t *testing.T) {
+		d := newEvalLagDetector(0.8)
+		rule := &Rule{ID: 1, Frequency: 10}
+		for i := 0; i < evalLagSamples-1; i++ {
+			d.observe(rule, time.Second)
+		}
+		// a single slow evaluation doesn't make the rule lag
+		require.False(t, d.observe(rule, 20*time.Second))
+
+		for i := 0; i < evalLagSamples; i++ {
+			d.observe(rule, 9*time.Second)
+		}
+		require.True(t, d.observe(rule, 9*time.Second))
+
+		// the slow evaluations leave the window once the rule is fast again
+		for i := 0; i < evalLagSamples; i++ {
+			d.observe(rule, time.Second)
+		}
+		require.Empty(t, d.lagging())
+	})
+
+	t.Run("disabled when threshold is zero", func(t *testing.T) {
+		d := newEvalLagDetector(0)
+		require.False(t, d.observe(&Rule{ID: 1, Frequency: 10}, time.Minute))
+		require.Empty(t, d.lagging())
+	})
+
+	t.Run("forgets unscheduled rules", func(t *testing.T) {
+		d := newEvalLagDetector(0.8)
+		d.observe(&Rule{ID: 1, Frequency: 10}, time.Minute)
+		d.observe(&Rule{ID: 2, Frequency: 10}, time.Minute)
+
+		d.prune([]*Rule{{ID: 2}})
+		lagging := d.lagging()
+		require.Len(t, lagging, 1)
+		require.Equal(t, int64(2), lagging[0].RuleID)
+	})
+}
+
+type durationEvalHandler struct {
+	duration time.Duration
+}
+
+func (h *durationEvalHandler) Eval(evalContext *EvalContext) {
+	evalContext.EndTime = evalContext.StartTime.Add(h.duration)
+}
+
+func TestEngineEvalLag(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.evalLag = newEvalLagDetector(0.8)
+	engine.resultHandler = &FakeResultHandler{}
+
+	engine.evalHandler = &durationEvalHandler{duration: time.Second}
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 1, Frequency: 10}}))
+	require.Empty(t, engine.LaggingRules())
+
+	engine.evalHandler = &durationEvalHandler{duration: 30 * time.Second}
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 2, Frequency: 10}}))
+	lagging := engine.LaggingRules()
+	require.Len(t, lagging, 1)
+	require.Equal(t, int64(2), lagging[0].RuleID)
+	require.Equal(t, 30*time.Second, lagging[0].AverageDuration)
+}
@@ -0,0 +1,26 @@
+package alerting
+
+// EvalFunc evaluates an alert rule, filling in the EvalContext.
+type EvalFunc func(evalContext *EvalContext)
+
+// EvalMiddleware wraps the evaluation of the alert rules. It can modify
+// the EvalContext before and after calling next, or short-circuit the
+// evaluation by not calling next at all.
+type EvalMiddleware func(evalContext *EvalContext, next EvalFunc)
+
+// UseEvalMiddleware adds a middleware around the evaluation of the alert
+// rules. Middlewares run in the order they are added, the first one being
+// the outermost. It must be called before the engine runs.
+func (e *AlertEngine) UseEvalMiddleware(fn EvalMiddleware) {
+	e.evalMiddlewares = append(e.evalMiddlewares, fn)
+}
+
+// eval evaluates the alert rule through the middlewares.
+func (e *AlertEngine) eval(evalContext *EvalContext) {
+	next := e.evalHandler.Eval
+	for i := len(e.evalMiddlewares) - 1; i >= 0; i-- {
+		middleware, inner := e.evalMiddlewares[i], next
+		next = func(evalContext *EvalContext) { middleware(evalContext, inner) }
+	}
+	next(evalContext)
+}
@@ -0,0 +1,76 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineEvalMiddleware(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	newEngine := func() (*AlertEngine, *slowResultHandler) {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+		engine.resultHandler = resultHandler
+		engine.resultQueue = nil
+		return engine, resultHandler
+	}
+
+	process := func(engine *AlertEngine, resultHandler *slowResultHandler, rule *Rule) *EvalContext {
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}))
+		select {
+		case evalContext := <-resultHandler.handled:
+			return evalContext
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the result to be handled")
+			return nil
+		}
+	}
+
+	t.Run("middlewares can override the firing decision", func(t *testing.T) {
+		engine, resultHandler := newEngine()
+		engine.evalHandler = NewEvalHandler(nil)
+
+		var calls []string
+		engine.UseEvalMiddleware(func(evalContext *EvalContext, next EvalFunc) {
+			calls = append(calls, "outer:before")
+			next(evalContext)
+			calls = append(calls, "outer:after")
+		})
+		engine.UseEvalMiddleware(func(evalContext *EvalContext, next EvalFunc) {
+			calls = append(calls, "inner:before")
+			next(evalContext)
+			require.True(t, evalContext.Firing)
+			evalContext.Firing = false
+			calls = append(calls, "inner:after")
+		})
+
+		evalContext := process(engine, resultHandler, &Rule{ID: 1, Conditions: []Condition{&conditionStub{firing: true}}})
+		require.False(t, evalContext.Firing)
+		require.Equal(t, models.AlertStateOK, evalContext.Rule.State)
+		require.Equal(t, []string{"outer:before", "inner:before", "inner:after", "outer:after"}, calls)
+	})
+
+	t.Run("middlewares can short-circuit the evaluation", func(t *testing.T) {
+		engine, resultHandler := newEngine()
+		evalHandler := NewFakeEvalHandler(0)
+		engine.evalHandler = evalHandler
+
+		engine.UseEvalMiddleware(func(evalContext *EvalContext, next EvalFunc) {
+			evalContext.Firing = true
+			evalContext.EndTime = time.Now()
+		})
+
+		evalContext := process(engine, resultHandler, &Rule{ID: 1})
+		require.Equal(t, 0, evalHandler.CallNb)
+		require.Equal(t, models.AlertStateAlerting, evalContext.Rule.State)
+	})
+}
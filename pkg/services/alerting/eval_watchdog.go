@@ -0,0 +1,105 @@
+package alerting
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// evalAbandonFactor is the number of times the evaluation timeout an
+// evaluation must run for to be abandoned by the watchdog.
+const evalAbandonFactor = 2
+
+// for stubbing in tests
+//nolint: gocritic
+var evalWatchdogInterval = time.Second
+
+// inflightEval is an evaluation attempt in progress.
+type inflightEval struct {
+	rule    *Rule
+	started time.Time
+	cancels *jobCancels
+}
+
+// inflightEvals keeps track of the evaluation attempts in progress, so that
+// the ones stuck past their timeout can be abandoned. The datasource drivers
+// ignoring the cancellation of their context would otherwise hold on to a
+// worker forever.
+type inflightEvals struct {
+	mtx       sync.Mutex
+	next      int64
+	evals     map[int64]*inflightEval
+	abandoned int64
+	log       log.Logger
+}
+
+func newInflightEvals() *inflightEvals {
+	return &inflightEvals{evals: make(map[int64]*inflightEval), log: log.New("alerting.evalWatchdog")}
+}
+
+// add registers an evaluation attempt of the rule started at the given time.
+// It returns a func to call once the attempt completes.
+func (r *inflightEvals) add(rule *Rule, started time.Time, cancels *jobCancels) func() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	id := r.next
+	r.next++
+	r.evals[id] = &inflightEval{rule: rule, started: started, cancels: cancels}
+
+	return func() {
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		delete(r.evals, id)
+	}
+}
+
+// abandonStuck abandons the evaluation attempts running for longer than
+// evalAbandonFactor times the timeout as of now. Their job ends, freeing
+// the worker, and their result is dropped if they ever complete.
+func (r *inflightEvals) abandonStuck(now time.Time, timeout time.Duration) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for id, eval := range r.evals {
+		if now.Sub(eval.started) <= evalAbandonFactor*timeout {
+			continue
+		}
+		r.log.Error("Abandoning an alert rule evaluation stuck past its timeout, its goroutine may leak",
+			"alertId", eval.rule.ID, "orgId", eval.rule.OrgID, "name", eval.rule.Name, "running", now.Sub(eval.started), "timeout", timeout)
+		eval.cancels.abandon()
+		delete(r.evals, id)
+		r.abandoned++
+		metrics.MAlertingAbandonedEvaluations.Inc()
+	}
+}
+
+// runEvalWatchdog checks for stuck evaluations until the dispatcher is done, as the
+// dispatcher waits for the jobs in flight when the engine is stopped.
+func (e *AlertEngine) runEvalWatchdog(ctx context.Context, done <-chan struct{}) error {
+	ticker := e.clock.Ticker(evalWatchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-done:
+			return nil
+		case <-ticker.C:
+			e.inflight.abandonStuck(e.clock.Now(), setting.AlertingEvaluationTimeout)
+		}
+	}
+}
+
+// AbandonedEvaluations returns the number of evaluations abandoned by the
+// engine because they were stuck past their timeout.
+func (e *AlertEngine) AbandonedEvaluations() int64 {
+	e.inflight.mtx.Lock()
+	defer e.inflight.mtx.Unlock()
+	return e.inflight.abandoned
+}
@@ -0,0 +1,72 @@
+package alerting
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// uncancelableEvalHandler blocks until released, ignoring the cancellation
+// of the evaluation context like a hung datasource driver.
+type uncancelableEvalHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *uncancelableEvalHandler) Eval(evalContext *EvalContext) {
+	h.started <- struct{}{}
+	<-h.release
+}
+
+func TestEngineEvalWatchdog(t *testing.T) {
+	origInterval := evalWatchdogInterval
+	t.Cleanup(func() { evalWatchdogInterval = origInterval })
+	evalWatchdogInterval = 10 * time.Millisecond
+	setting.AlertingEvaluationTimeout = 50 * time.Millisecond
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := newRunnableEngine(t)
+	evalHandler := &uncancelableEvalHandler{started: make(chan struct{}, 1), release: make(chan struct{})}
+	engine.evalHandler = evalHandler
+	resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+	engine.resultHandler = resultHandler
+	engine.resultQueue = nil
+	abandoned := testutil.ToFloat64(metrics.MAlertingAbandonedEvaluations)
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- engine.RunDispatcher(context.Background()) }()
+
+	job := &Job{Rule: &Rule{ID: 1, State: models.AlertStateOK}}
+	engine.Enqueue(job)
+	select {
+	case <-evalHandler.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the job to be evaluated")
+	}
+
+	// the worker is freed even though the evaluation is still blocked
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&engine.live.workers) == 0 && !job.GetRunning()
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(1), engine.AbandonedEvaluations())
+	require.Equal(t, abandoned+1, testutil.ToFloat64(metrics.MAlertingAbandonedEvaluations))
+
+	// the result of the abandoned evaluation is dropped once it completes
+	close(evalHandler.release)
+	select {
+	case <-resultHandler.handled:
+		t.Fatal("the result of an abandoned evaluation should not be handled")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, engine.Stop(context.Background()))
+	require.NoError(t, <-runErr)
+}
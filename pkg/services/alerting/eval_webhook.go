@@ -0,0 +1,137 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// evalWebhookPayload is the body posted to the evaluation webhook
+// after every alert evaluation.
+type evalWebhookPayload struct {
+	RuleID         int64                 `json:"ruleId"`
+	OrgID          int64                 `json:"orgId"`
+	DashboardID    int64                 `json:"dashboardId"`
+	PanelID        int64                 `json:"panelId"`
+	RuleName       string                `json:"ruleName"`
+	State          models.AlertStateType `json:"state"`
+	PrevState      models.AlertStateType `json:"prevState"`
+	Firing         bool                  `json:"firing"`
+	NoDataFound    bool                  `json:"noDataFound"`
+	ConditionEvals string                `json:"conditionEvals"`
+	EvalMatches    []*EvalMatch          `json:"evalMatches"`
+	DurationMs     int64                 `json:"durationMs"`
+	Error          string                `json:"error,omitempty"`
+	ConfigVersion  string                `json:"configVersion,omitempty"`
+	Time           time.Time             `json:"time"`
+}
+
+func newEvalWebhookPayload(evalContext *EvalContext) *evalWebhookPayload {
+	payload := &evalWebhookPayload{
+		RuleID:         evalContext.Rule.ID,
+		OrgID:          evalContext.Rule.OrgID,
+		DashboardID:    evalContext.Rule.DashboardID,
+		PanelID:        evalContext.Rule.PanelID,
+		RuleName:       evalContext.Rule.Name,
+		State:          evalContext.Rule.State,
+		PrevState:      evalContext.PrevAlertState,
+		Firing:         evalContext.Firing,
+		NoDataFound:    evalContext.NoDataFound,
+		ConditionEvals: evalContext.ConditionEvals,
+		EvalMatches:    evalContext.EvalMatches,
+		DurationMs:     evalContext.EndTime.Sub(evalContext.StartTime).Milliseconds(),
+		Time:           evalContext.EndTime,
+		ConfigVersion:  evalContext.ConfigVersion,
+	}
+	if evalContext.Error != nil {
+		payload.Error = evalContext.Error.Error()
+	}
+	return payload
+}
+
+// evalWebhookSender posts the result of every alert evaluation to a webhook,
+// independently of the notification channels, e.g. to feed an analytics pipeline.
+type evalWebhookSender struct {
+	url         string
+	client      *http.Client
+	maxAttempts int
+	retryDelay  time.Duration
+	log         log.Logger
+}
+
+func newEvalWebhookSender(url string, timeout time.Duration, maxAttempts int) *evalWebhookSender {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &evalWebhookSender{
+		url:         url,
+		client:      &http.Client{Timeout: timeout},
+		maxAttempts: maxAttempts,
+		retryDelay:  time.Second,
+		log:         log.New("alerting.evalWebhook"),
+	}
+}
+
+// send posts the evaluation result in the background, so it never
+// holds up the evaluation nor affects its outcome.
+func (s *evalWebhookSender) send(evalContext *EvalContext) {
+	body, err := json.Marshal(newEvalWebhookPayload(evalContext))
+	if err != nil {
+		s.log.Error("Failed to marshal the evaluation webhook payload", "ruleId", evalContext.Rule.ID, "error", err)
+		return
+	}
+
+	go func() {
+		for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+			err := s.post(body)
+			if err == nil {
+				return
+			}
+
+			s.log.Debug("Evaluation webhook attempt failed", "ruleId", evalContext.Rule.ID, "attempt", attempt, "error", err)
+			if attempt < s.maxAttempts {
+				time.Sleep(s.retryDelay * time.Duration(attempt))
+			} else {
+				s.log.Warn("Failed to send evaluation webhook", "ruleId", evalContext.Rule.ID, "error", err)
+			}
+		}
+	}()
+}
+
+func (s *evalWebhookSender) post(body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Grafana")
+
+	resp, err := ctxhttp.Do(context.Background(), s.client, request)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			s.log.Warn("Failed to close response body", "err", err)
+		}
+	}()
+
+	// flushing the body enables the transport to reuse the same connection
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		s.log.Debug("Failed to copy resp.Body to ioutil.Discard", "err", err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook response status %v", resp.Status)
+	}
+	return nil
+}
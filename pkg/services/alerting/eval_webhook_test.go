@@ -0,0 +1,123 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalWebhookSender(t *testing.T) {
+	newEvalContext := func() *EvalContext {
+		evalContext := NewEvalContext(context.Background(), &Rule{ID: 1, OrgID: 2, DashboardID: 3, PanelID: 4, Name: "cpu", State: models.AlertStateAlerting}, nil)
+		evalContext.PrevAlertState = models.AlertStateOK
+		evalContext.Firing = true
+		evalContext.ConditionEvals = "[true]"
+		evalContext.EvalMatches = []*EvalMatch{{Metric: "cpu", Value: null.FloatFrom(42)}}
+		evalContext.EndTime = evalContext.StartTime.Add(150 * time.Millisecond)
+		return evalContext
+	}
+
+	t.Run("posts the evaluation result", func(t *testing.T) {
+		received := make(chan evalWebhookPayload, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+
+			var payload evalWebhookPayload
+			require.NoError(t, json.Unmarshal(body, &payload))
+			received <- payload
+		}))
+		defer server.Close()
+
+		evalContext := newEvalContext()
+		evalContext.Error = errors.New("query failed")
+		newEvalWebhookSender(server.URL, time.Second, 1).send(evalContext)
+
+		select {
+		case payload := <-received:
+			require.Equal(t, int64(1), payload.RuleID)
+			require.Equal(t, int64(2), payload.OrgID)
+			require.Equal(t, models.AlertStateAlerting, payload.State)
+			require.Equal(t, models.AlertStateOK, payload.PrevState)
+			require.True(t, payload.Firing)
+			require.Len(t, payload.EvalMatches, 1)
+			require.Equal(t, int64(150), payload.DurationMs)
+			require.Equal(t, "query failed", payload.Error)
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook was not called")
+		}
+	})
+
+	t.Run("retries failed posts", func(t *testing.T) {
+		var mtx sync.Mutex
+		calls := 0
+		done := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			close(done)
+		}))
+		defer server.Close()
+
+		sender := newEvalWebhookSender(server.URL, time.Second, 3)
+		sender.retryDelay = time.Millisecond
+		sender.send(newEvalContext())
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("webhook was not retried")
+		}
+
+		// give a buggy sender the chance to post again
+		time.Sleep(50 * time.Millisecond)
+		mtx.Lock()
+		defer mtx.Unlock()
+		require.Equal(t, 2, calls)
+	})
+
+	t.Run("does not affect the evaluation when failing", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		setting.AlertingEvaluationTimeout = 30 * time.Second
+		setting.AlertingNotificationTimeout = 30 * time.Second
+		setting.AlertingMaxAttempts = 1
+
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.evalHandler = NewFakeEvalHandler(1)
+		resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+		engine.resultHandler = resultHandler
+		engine.evalWebhook = newEvalWebhookSender(server.URL, time.Second, 1)
+
+		job := &Job{running: true, Rule: &Rule{}}
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+
+		select {
+		case evalContext := <-resultHandler.handled:
+			require.NoError(t, evalContext.Error)
+		case <-time.After(5 * time.Second):
+			t.Fatal("result was not handled")
+		}
+	})
+}
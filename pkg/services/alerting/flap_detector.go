@@ -0,0 +1,125 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// flapDetector keeps track of the recent state changes of every
+// alert rule and decides whether a rule is flapping, that is changing
+// state so often that its notifications should be suppressed.
+type flapDetector struct {
+	sync.Mutex
+	threshold     int
+	window        time.Duration
+	stabilization time.Duration
+	history       map[ruleKey]*flapHistory
+}
+
+type flapHistory struct {
+	transitions []time.Time
+	flapping    bool
+}
+
+func newFlapDetector(threshold int, window, stabilization time.Duration) *flapDetector {
+	return &flapDetector{
+		threshold:     threshold,
+		window:        window,
+		stabilization: stabilization,
+		history:       make(map[ruleKey]*flapHistory),
+	}
+}
+
+// observe records the outcome of an evaluation of the rule and returns
+// true if the rule is flapping. A rule starts flapping when it changed
+// state at least `threshold` times within `window` and stops flapping
+// once it kept the same state for the `stabilization` period.
+func (fd *flapDetector) observe(rule *Rule, stateChanged bool, now time.Time) bool {
+	if fd.threshold <= 0 {
+		return false
+	}
+
+	fd.Lock()
+	defer fd.Unlock()
+
+	h, ok := fd.history[ruleKeyOf(rule)]
+	if !ok {
+		h = &flapHistory{}
+		fd.history[ruleKeyOf(rule)] = h
+	}
+
+	if stateChanged {
+		h.transitions = append(h.transitions, now)
+	}
+
+	// only keep the transitions inside the largest period we care about.
+	keep := fd.window
+	if fd.stabilization > keep {
+		keep = fd.stabilization
+	}
+	for len(h.transitions) > 0 && now.Sub(h.transitions[0]) > keep {
+		h.transitions = h.transitions[1:]
+	}
+
+	if h.flapping {
+		if len(h.transitions) == 0 || now.Sub(h.transitions[len(h.transitions)-1]) >= fd.stabilization {
+			h.flapping = false
+			h.transitions = nil
+		}
+	} else if fd.transitionsWithinWindow(h, now) >= fd.threshold {
+		h.flapping = true
+	}
+
+	metrics.MAlertingFlappingAlerts.Set(float64(fd.flappingCount()))
+	return h.flapping
+}
+
+// isFlapping returns true if the rule was flapping at the time of its last evaluation.
+func (fd *flapDetector) isFlapping(rule *Rule) bool {
+	fd.Lock()
+	defer fd.Unlock()
+
+	if h, ok := fd.history[ruleKeyOf(rule)]; ok {
+		return h.flapping
+	}
+	return false
+}
+
+// prune forgets the rules that are no longer scheduled.
+func (fd *flapDetector) prune(rules []*Rule) {
+	scheduled := make(map[ruleKey]bool, len(rules))
+	for _, rule := range rules {
+		scheduled[ruleKeyOf(rule)] = true
+	}
+
+	fd.Lock()
+	defer fd.Unlock()
+	for key := range fd.history {
+		if !scheduled[key] {
+			delete(fd.history, key)
+		}
+	}
+	metrics.MAlertingFlappingAlerts.Set(float64(fd.flappingCount()))
+}
+
+func (fd *flapDetector) transitionsWithinWindow(h *flapHistory, now time.Time) int {
+	count := 0
+	for _, t := range h.transitions {
+		if now.Sub(t) <= fd.window {
+			count++
+		}
+	}
+	return count
+}
+
+func (fd *flapDetector) flappingCount() int {
+	count := 0
+	for _, h := range fd.history {
+		if h.flapping {
+			count++
+		}
+	}
+	return count
+}
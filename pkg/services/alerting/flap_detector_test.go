@@ -0,0 +1,76 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlapDetector(t *testing.T) {
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	rule, other := &Rule{ID: 1, OrgID: 1}, &Rule{ID: 2, OrgID: 1}
+
+	t.Run("disabled when threshold is zero", func(t *testing.T) {
+		fd := newFlapDetector(0, time.Hour, time.Minute*30)
+		for i := 0; i < 10; i++ {
+			require.False(t, fd.observe(rule, true, start.Add(time.Duration(i)*time.Minute)))
+		}
+	})
+
+	t.Run("alternating states marks rule as flapping", func(t *testing.T) {
+		fd := newFlapDetector(4, time.Hour, time.Minute*30)
+
+		var flapping bool
+		for i := 0; i < 4; i++ {
+			flapping = fd.observe(rule, true, start.Add(time.Duration(i)*time.Minute))
+		}
+		require.True(t, flapping)
+		require.True(t, fd.isFlapping(rule))
+		require.False(t, fd.isFlapping(other))
+	})
+
+	t.Run("infrequent state changes are not flapping", func(t *testing.T) {
+		fd := newFlapDetector(4, time.Hour, time.Minute*30)
+
+		for i := 0; i < 10; i++ {
+			require.False(t, fd.observe(rule, true, start.Add(time.Duration(i)*time.Hour)))
+		}
+	})
+
+	t.Run("keeps flapping while still changing state", func(t *testing.T) {
+		fd := newFlapDetector(3, time.Minute*10, time.Minute*30)
+
+		for i := 0; i < 3; i++ {
+			fd.observe(rule, true, start.Add(time.Duration(i)*time.Minute))
+		}
+		require.True(t, fd.isFlapping(rule))
+
+		// a single state change outside of the window but within the stabilization period
+		require.True(t, fd.observe(rule, true, start.Add(time.Minute*20)))
+	})
+
+	t.Run("stops flapping once stable for the stabilization period", func(t *testing.T) {
+		fd := newFlapDetector(3, time.Hour, time.Minute*30)
+
+		for i := 0; i < 3; i++ {
+			fd.observe(rule, true, start.Add(time.Duration(i)*time.Minute))
+		}
+		require.True(t, fd.isFlapping(rule))
+
+		require.True(t, fd.observe(rule, false, start.Add(time.Minute*10)))
+		require.False(t, fd.observe(rule, false, start.Add(time.Minute*40)))
+	})
+	t.Run("forgets the rules that are no longer scheduled", func(t *testing.T) {
+		fd := newFlapDetector(3, time.Hour, time.Minute*30)
+
+		for i := 0; i < 3; i++ {
+			fd.observe(rule, true, start.Add(time.Duration(i)*time.Minute))
+			fd.observe(other, true, start.Add(time.Duration(i)*time.Minute))
+		}
+		fd.prune([]*Rule{other})
+		require.False(t, fd.isFlapping(rule))
+		require.True(t, fd.isFlapping(other))
+		require.Len(t, fd.history, 1)
+	})
+}
@@ -0,0 +1,72 @@
+package alerting
+
+import (
+	"errors"
+	"time"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+var (
+	// ErrInvalidFrequencyBoost is returned when the frequency of an alert
+	// rule is boosted below a second or until a time already past.
+	ErrInvalidFrequencyBoost = errors.New("the boosted frequency must be at least a second and the boost must end in the future")
+	// ErrRuleNotScheduled is returned when the alert rule is not scheduled.
+	ErrRuleNotScheduled = errors.New("alert rule is not scheduled")
+)
+
+// frequencyBoost is a temporary override of the frequency of an alert rule.
+type frequencyBoost struct {
+	frequency int64
+	until     time.Time
+}
+
+// boostedFrequency returns the frequency of the rule on the tick, and
+// whether it is boosted. The boosts ending by the tick are cleared.
+func (s *schedulerImpl) boostedFrequency(job *Job, tickTime time.Time) (int64, bool) {
+	boost, ok := s.boosts[ruleKeyOf(job.Rule)]
+	if !ok {
+		return 0, false
+	}
+	if !tickTime.Before(boost.until) {
+		s.log.Info("Alert rule frequency boost ended", "ruleId", job.Rule.ID, "name", job.Rule.Name, "frequency", job.Rule.Frequency)
+		delete(s.boosts, ruleKeyOf(job.Rule))
+		return 0, false
+	}
+	return boost.frequency, true
+}
+
+func (s *schedulerImpl) Boost(key ruleKey, frequency int64, until time.Time) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.jobs[key]; !ok {
+		return ErrRuleNotScheduled
+	}
+	if frequency < setting.AlertingMinInterval {
+		frequency = setting.AlertingMinInterval
+	}
+	if frequency < 1 {
+		frequency = 1
+	}
+	s.boosts[key] = frequencyBoost{frequency: frequency, until: until}
+	return nil
+}
+
+// BoostFrequency evaluates the alert rule of the org every freq until the deadline,
+// e.g. every few seconds to confirm the recovery of an incident, after
+// which the rule is evaluated at its frequency again. The boosted frequency
+// is rounded down to the second and raised to the minimum interval. Boosting
+// a rule again replaces its boost, and the boost is dropped when the rule
+// is no longer scheduled. Rules on a wall-clock schedule follow the boosted
+// frequency until the deadline too.
+func (e *AlertEngine) BoostFrequency(orgID, ruleID int64, freq time.Duration, until time.Time) error {
+	if freq < time.Second || !until.After(e.clock.Now()) {
+		return ErrInvalidFrequencyBoost
+	}
+	if err := e.scheduler.Boost(ruleKey{orgID: orgID, id: ruleID}, int64(freq/time.Second), until); err != nil {
+		return err
+	}
+	e.log.Info("Boosting alert rule frequency", "ruleId", ruleID, "orgId", orgID, "frequency", freq, "until", until)
+	return nil
+}
@@ -0,0 +1,78 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchedulerFrequencyBoost(t *testing.T) {
+	origMinInterval := setting.AlertingMinInterval
+	t.Cleanup(func() { setting.AlertingMinInterval = origMinInterval })
+	setting.AlertingMinInterval = 1
+
+	s := newScheduler().(*schedulerImpl)
+	s.Update([]*Rule{{ID: 1, Frequency: 60}})
+
+	start := time.Unix(1200, 0)
+	require.ErrorIs(t, s.Boost(ruleKey{id: 2}, 5, start.Add(30*time.Second)), ErrRuleNotScheduled)
+	require.NoError(t, s.Boost(ruleKey{id: 1}, 5, start.Add(30*time.Second)))
+
+	snapshot := s.Snapshot(start.Add(-time.Second))
+	require.Equal(t, 5*time.Second, snapshot[0].Frequency)
+	require.Equal(t, start.Add(30*time.Second), snapshot[0].BoostedUntil)
+	require.Equal(t, start, snapshot[0].NextRun)
+
+	execQueue := make(chan *Job, 10)
+	var runs []int64
+	for i := 0; i < 120; i++ {
+		tick := start.Add(time.Duration(i) * time.Second)
+		s.Tick(tick, execQueue)
+		for len(execQueue) > 0 {
+			<-execQueue
+			runs = append(runs, tick.Unix())
+		}
+	}
+
+	// every 5s until the deadline, then back to every 60s past the offset of the rule
+	require.Equal(t, []int64{1200, 1205, 1210, 1215, 1220, 1225, 1261}, runs)
+	require.Empty(t, s.boosts, "the boost is cleared once it ends")
+	require.Equal(t, time.Minute, s.Snapshot(start)[0].Frequency)
+
+	t.Run("raises the boosted frequency to the minimum interval", func(t *testing.T) {
+		setting.AlertingMinInterval = 10
+		require.NoError(t, s.Boost(ruleKey{id: 1}, 5, start.Add(time.Hour)))
+		require.Equal(t, int64(10), s.boosts[ruleKey{id: 1}].frequency)
+	})
+
+	t.Run("drops the boost of the rules no longer scheduled", func(t *testing.T) {
+		require.NoError(t, s.Boost(ruleKey{id: 1}, 5, start.Add(time.Hour)))
+		s.Update([]*Rule{{ID: 2, Frequency: 60}})
+		require.Empty(t, s.boosts)
+	})
+}
+
+func TestEngineBoostFrequency(t *testing.T) {
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	mock := clock.NewMock()
+	mock.Set(time.Unix(1200, 0))
+	engine.clock = mock
+	engine.scheduler.Update([]*Rule{{ID: 1, OrgID: 1, Frequency: 60}, {ID: 1, OrgID: 2, Frequency: 60}})
+
+	require.ErrorIs(t, engine.BoostFrequency(1, 1, 500*time.Millisecond, mock.Now().Add(time.Minute)), ErrInvalidFrequencyBoost)
+	require.ErrorIs(t, engine.BoostFrequency(1, 1, 5*time.Second, mock.Now()), ErrInvalidFrequencyBoost)
+	require.ErrorIs(t, engine.BoostFrequency(1, 2, 5*time.Second, mock.Now().Add(time.Minute)), ErrRuleNotScheduled)
+	require.ErrorIs(t, engine.BoostFrequency(3, 1, 5*time.Second, mock.Now().Add(time.Minute)), ErrRuleNotScheduled)
+
+	require.NoError(t, engine.BoostFrequency(1, 1, 5*time.Second, mock.Now().Add(time.Minute)))
+	snapshot := engine.ScheduleSnapshot()
+	require.Len(t, snapshot, 2)
+	require.Equal(t, int64(1), snapshot[0].OrgID)
+	require.Equal(t, 5*time.Second, snapshot[0].Frequency)
+	require.Equal(t, mock.Now().Add(time.Minute), snapshot[0].BoostedUntil)
+	require.Equal(t, time.Minute, snapshot[1].Frequency, "the rule of another org with the same id is not boosted")
+}
@@ -0,0 +1,95 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// heartbeatPayload is the body posted to the heartbeat URL.
+type heartbeatPayload struct {
+	Instance string    `json:"instance"`
+	Time     time.Time `json:"time"`
+}
+
+// heartbeat posts to an external watchdog on every interval the engine
+// ticks, so that the watchdog fires when the engine stops evaluating.
+type heartbeat struct {
+	url      string
+	instance string
+	interval time.Duration
+	client   *http.Client
+	last     time.Time
+	log      log.Logger
+}
+
+func newHeartbeat(url string, interval time.Duration, instance string) *heartbeat {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return &heartbeat{
+		url:      url,
+		instance: instance,
+		interval: interval,
+		// a heartbeat not sent by the next one is worthless
+		client: &http.Client{Timeout: interval},
+		log:    log.New("alerting.heartbeat"),
+	}
+}
+
+// beat sends the heartbeat in the background when the interval has elapsed
+// since the last one, as of the tick of the engine.
+func (h *heartbeat) beat(tick time.Time) {
+	if !h.last.IsZero() && tick.Sub(h.last) < h.interval {
+		return
+	}
+	h.last = tick
+
+	body, err := json.Marshal(heartbeatPayload{Instance: h.instance, Time: tick})
+	if err != nil {
+		h.log.Error("Failed to marshal the heartbeat payload", "error", err)
+		return
+	}
+
+	go func() {
+		if err := h.post(body); err != nil {
+			h.log.Error("Failed to send the alerting engine heartbeat, the watchdog may report the engine as down", "url", h.url, "error", err)
+		}
+	}()
+}
+
+func (h *heartbeat) post(body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Grafana")
+
+	resp, err := ctxhttp.Do(context.Background(), h.client, request)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			h.log.Warn("Failed to close response body", "err", err)
+		}
+	}()
+
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		h.log.Debug("Failed to copy resp.Body to ioutil.Discard", "err", err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("heartbeat response status %v", resp.Status)
+	}
+	return nil
+}
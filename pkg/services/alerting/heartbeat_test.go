@@ -0,0 +1,72 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineHeartbeat(t *testing.T) {
+	beats := make(chan heartbeatPayload, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload heartbeatPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		beats <- payload
+	}))
+	defer server.Close()
+
+	origURL, origInterval := setting.AlertingHeartbeatURL, setting.AlertingHeartbeatInterval
+	t.Cleanup(func() { setting.AlertingHeartbeatURL, setting.AlertingHeartbeatInterval = origURL, origInterval })
+	setting.AlertingHeartbeatURL = server.URL
+	setting.AlertingHeartbeatInterval = 2 * time.Second
+
+	engine := newRunnableEngine(t)
+	ticks := make(chan time.Time)
+	engine.ticker = &Ticker{C: ticks}
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- engine.Run(context.Background()) }()
+
+	expectBeat := func(tick time.Time) {
+		select {
+		case beat := <-beats:
+			require.True(t, tick.Equal(beat.Time), "expected the heartbeat of %s, got %s", tick, beat.Time)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected a heartbeat")
+		}
+	}
+	expectNoBeat := func() {
+		select {
+		case beat := <-beats:
+			t.Fatalf("unexpected heartbeat of %s", beat.Time)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	start := time.Unix(1000, 0)
+	for i := 0; i < 5; i++ {
+		tick := start.Add(time.Duration(i) * time.Second)
+		ticks <- tick
+		if i%2 == 0 {
+			expectBeat(tick)
+		} else {
+			expectNoBeat()
+		}
+	}
+
+	require.NoError(t, engine.Stop(context.Background()))
+	require.NoError(t, <-runErr)
+
+	select {
+	case ticks <- start.Add(10 * time.Second):
+		t.Fatal("the engine should not tick once stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+	expectNoBeat()
+}
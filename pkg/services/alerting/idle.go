@@ -0,0 +1,46 @@
+package alerting
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// idlePollInterval is the interval at which WaitForIdle checks the engine
+// for work in progress. It is measured on the wall clock, the work being
+// done by goroutines regardless of the clock of the engine.
+const idlePollInterval = 10 * time.Millisecond
+
+// idle returns true if the exec queue is empty and no job is in flight,
+// whether waiting for the cost budget or being evaluated.
+func (e *AlertEngine) idle() bool {
+	return len(e.execQueue) == 0 &&
+		atomic.LoadInt64(&e.live.workers) == 0 &&
+		atomic.LoadInt64(&e.live.inFlight) == 0
+}
+
+// WaitForIdle blocks until the exec queue is empty and the jobs in flight
+// have completed, or until ctx is done, in which case its error is returned.
+// The engine must be found idle on two successive polls, as a job is briefly
+// neither queued nor counted in flight while the dispatcher picks it up.
+// Jobs enqueued by the next ticks are not waited for, so the engine may be
+// busy again by the time WaitForIdle returns unless its ticker is stopped,
+// e.g. to make integration tests deterministic or for maintenance.
+func (e *AlertEngine) WaitForIdle(ctx context.Context) error {
+	wasIdle := e.idle()
+
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			idle := e.idle()
+			if idle && wasIdle {
+				return nil
+			}
+			wasIdle = idle
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineWaitForIdle(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	t.Run("returns once the enqueued jobs completed", func(t *testing.T) {
+		engine := newRunnableEngine(t)
+		evalHandler := &slowEvalHandler{delay: time.Millisecond * 100}
+		engine.evalHandler = evalHandler
+		runErr := startEngine(t, engine)
+
+		for i := int64(1); i <= 5; i++ {
+			engine.Enqueue(&Job{Rule: &Rule{ID: i}})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		require.NoError(t, engine.WaitForIdle(ctx))
+		require.Equal(t, 5, evalHandler.callCount())
+		require.True(t, engine.idle())
+
+		require.NoError(t, engine.Stop(ctx))
+		require.NoError(t, <-runErr)
+	})
+
+	t.Run("returns when the context expires", func(t *testing.T) {
+		engine := newRunnableEngine(t)
+		evalHandler := &slowEvalHandler{delay: time.Second}
+		engine.evalHandler = evalHandler
+		runErr := startEngine(t, engine)
+
+		engine.Enqueue(&Job{Rule: &Rule{ID: 1}})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+		require.ErrorIs(t, engine.WaitForIdle(ctx), context.DeadlineExceeded)
+		require.Equal(t, 0, evalHandler.callCount())
+
+		require.NoError(t, engine.Stop(context.Background()))
+		require.NoError(t, <-runErr)
+	})
+
+	t.Run("returns when already idle", func(t *testing.T) {
+		engine := newRunnableEngine(t)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, engine.WaitForIdle(ctx))
+	})
+}
@@ -0,0 +1,169 @@
+package alerting
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// inhibitRule withholds the notifications of the target alert rules
+// while one of its source alert rules is alerting.
+type inhibitRule struct {
+	name   string
+	source labelSelector
+	target labelSelector
+	// equal are the tags the source and target rules must have the same values for
+	equal []string
+}
+
+// parseInhibitRules parses the inhibition rules configured by their
+// `<name>.source`, `<name>.target` and `<name>.equal` keys.
+func parseInhibitRules(raw map[string]string) ([]inhibitRule, error) {
+	fields := make(map[string]map[string]string)
+	for key, value := range raw {
+		i := strings.LastIndex(key, ".")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid inhibition rule key %q", key)
+		}
+		name, field := key[:i], key[i+1:]
+		if field != "source" && field != "target" && field != "equal" {
+			return nil, fmt.Errorf("invalid inhibition rule key %q: unknown field %q", key, field)
+		}
+		if fields[name] == nil {
+			fields[name] = make(map[string]string)
+		}
+		fields[name][field] = value
+	}
+
+	rules := make([]inhibitRule, 0, len(fields))
+	for name, rule := range fields {
+		if strings.TrimSpace(rule["source"]) == "" || strings.TrimSpace(rule["target"]) == "" {
+			return nil, fmt.Errorf("inhibition rule %q needs both a source and a target", name)
+		}
+
+		source, err := parseLabelSelector(rule["source"])
+		if err != nil {
+			return nil, fmt.Errorf("inhibition rule %q: %w", name, err)
+		}
+		target, err := parseLabelSelector(rule["target"])
+		if err != nil {
+			return nil, fmt.Errorf("inhibition rule %q: %w", name, err)
+		}
+
+		var equal []string
+		for _, tag := range strings.Split(rule["equal"], ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				equal = append(equal, tag)
+			}
+		}
+
+		rules = append(rules, inhibitRule{name: name, source: source, target: target, equal: equal})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].name < rules[j].name })
+	return rules, nil
+}
+
+// inhibitor keeps track of the alerting source rules of the inhibition
+// rules and decides whether the notifications of a rule are withheld.
+type inhibitor struct {
+	sync.Mutex
+	rules []inhibitRule
+	// firing are the tags of the alerting source rules, by rule
+	firing map[ruleKey][]*models.Tag
+}
+
+func newInhibitor(rules []inhibitRule) *inhibitor {
+	return &inhibitor{rules: rules, firing: make(map[ruleKey][]*models.Tag)}
+}
+
+// observe records the state of the rule after one of its evaluations.
+func (in *inhibitor) observe(rule *Rule) {
+	if len(in.rules) == 0 {
+		return
+	}
+
+	in.Lock()
+	defer in.Unlock()
+	in.record(rule)
+}
+
+// sync replaces the recorded states with the ones of the rules fetched
+// from the database, which include the rules evaluated by other instances.
+func (in *inhibitor) sync(rules []*Rule) {
+	if len(in.rules) == 0 {
+		return
+	}
+
+	in.Lock()
+	defer in.Unlock()
+	in.firing = make(map[ruleKey][]*models.Tag)
+	for _, rule := range rules {
+		in.record(rule)
+	}
+}
+
+func (in *inhibitor) record(rule *Rule) {
+	if rule.State != models.AlertStateAlerting {
+		delete(in.firing, ruleKeyOf(rule))
+		return
+	}
+	for _, ir := range in.rules {
+		if ir.source.matches(rule) {
+			in.firing[ruleKeyOf(rule)] = rule.AlertRuleTags
+			return
+		}
+	}
+	delete(in.firing, ruleKeyOf(rule))
+}
+
+// inhibits returns true, along with the name of the inhibition rule, if
+// the notifications of the rule are withheld by an alerting source rule.
+func (in *inhibitor) inhibits(rule *Rule) (string, bool) {
+	if len(in.rules) == 0 {
+		return "", false
+	}
+
+	in.Lock()
+	defer in.Unlock()
+	for _, ir := range in.rules {
+		if !ir.target.matches(rule) {
+			continue
+		}
+		for sourceKey, tags := range in.firing {
+			// a rule matching both selectors doesn't inhibit itself
+			if sourceKey == ruleKeyOf(rule) {
+				continue
+			}
+			source := &Rule{ID: sourceKey.id, OrgID: sourceKey.orgID, AlertRuleTags: tags}
+			if ir.source.matches(source) && equalTags(ir.equal, source, rule) {
+				return ir.name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// equalTags returns true if both rules have the same values for the tags,
+// a tag missing from both rules counting as the same value.
+func equalTags(tags []string, a, b *Rule) bool {
+	for _, tag := range tags {
+		va, oka := tagValue(a, tag)
+		vb, okb := tagValue(b, tag)
+		if oka != okb || va != vb {
+			return false
+		}
+	}
+	return true
+}
+
+func tagValue(rule *Rule, key string) (string, bool) {
+	for _, tag := range rule.AlertRuleTags {
+		if tag.Key == key {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
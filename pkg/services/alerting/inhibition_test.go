@@ -0,0 +1,123 @@
+package alerting
+
+import (
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInhibitRules(t *testing.T) {
+	rules, err := parseInhibitRules(map[string]string{
+		"network_down.source": "scope=network",
+		"network_down.target": "tier=service",
+		"network_down.equal":  "datacenter, region",
+		"db_down.source":      "scope=db",
+		"db_down.target":      "tier=~service|batch",
+	})
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	require.Equal(t, "db_down", rules[0].name)
+	require.Empty(t, rules[0].equal)
+	require.Equal(t, "network_down", rules[1].name)
+	require.Equal(t, []string{"datacenter", "region"}, rules[1].equal)
+
+	for _, raw := range []map[string]string{
+		{"network_down": "scope=network"},
+		{"network_down.sources": "scope=network"},
+		{"network_down.source": "scope=network"},
+		{"network_down.source": "scope", "network_down.target": "tier=service"},
+	} {
+		_, err := parseInhibitRules(raw)
+		require.Error(t, err, raw)
+	}
+}
+
+func TestInhibitor(t *testing.T) {
+	newRule := func(id int64, state models.AlertStateType, tags ...string) *Rule {
+		rule := &Rule{ID: id, State: state}
+		for i := 0; i < len(tags); i += 2 {
+			rule.AlertRuleTags = append(rule.AlertRuleTags, &models.Tag{Key: tags[i], Value: tags[i+1]})
+		}
+		return rule
+	}
+
+	rules, err := parseInhibitRules(map[string]string{
+		"network_down.source": "scope=network",
+		"network_down.target": "tier=service",
+		"network_down.equal":  "datacenter",
+	})
+	require.NoError(t, err)
+
+	t.Run("source firing suppresses target", func(t *testing.T) {
+		in := newInhibitor(rules)
+		target := newRule(2, models.AlertStateAlerting, "tier", "service", "datacenter", "dc1")
+
+		_, inhibited := in.inhibits(target)
+		require.False(t, inhibited)
+
+		in.observe(newRule(1, models.AlertStateAlerting, "scope", "network", "datacenter", "dc1"))
+		name, inhibited := in.inhibits(target)
+		require.True(t, inhibited)
+		require.Equal(t, "network_down", name)
+
+		// targets in other datacenters are not inhibited
+		_, inhibited = in.inhibits(newRule(3, models.AlertStateAlerting, "tier", "service", "datacenter", "dc2"))
+		require.False(t, inhibited)
+		// neither are rules not matching the target selector
+		_, inhibited = in.inhibits(newRule(4, models.AlertStateAlerting, "tier", "batch", "datacenter", "dc1"))
+		require.False(t, inhibited)
+	})
+
+	t.Run("source resolved releases target", func(t *testing.T) {
+		in := newInhibitor(rules)
+		target := newRule(2, models.AlertStateAlerting, "tier", "service", "datacenter", "dc1")
+
+		in.observe(newRule(1, models.AlertStateAlerting, "scope", "network", "datacenter", "dc1"))
+		_, inhibited := in.inhibits(target)
+		require.True(t, inhibited)
+
+		in.observe(newRule(1, models.AlertStateOK, "scope", "network", "datacenter", "dc1"))
+		_, inhibited = in.inhibits(target)
+		require.False(t, inhibited)
+	})
+
+	t.Run("source states are synced from the fetched rules", func(t *testing.T) {
+		in := newInhibitor(rules)
+		target := newRule(2, models.AlertStateAlerting, "tier", "service", "datacenter", "dc1")
+
+		in.sync([]*Rule{newRule(1, models.AlertStatePending, "scope", "network", "datacenter", "dc1"), target})
+		_, inhibited := in.inhibits(target)
+		require.False(t, inhibited)
+
+		in.sync([]*Rule{newRule(1, models.AlertStateAlerting, "scope", "network", "datacenter", "dc1"), target})
+		_, inhibited = in.inhibits(target)
+		require.True(t, inhibited)
+
+		// the source rule was deleted
+		in.sync([]*Rule{target})
+		_, inhibited = in.inhibits(target)
+		require.False(t, inhibited)
+	})
+
+	t.Run("the source rules of the orgs sharing an id are tracked apart", func(t *testing.T) {
+		in := newInhibitor(rules)
+		target := newRule(2, models.AlertStateAlerting, "tier", "service", "datacenter", "dc1")
+
+		in.observe(newRule(1, models.AlertStateAlerting, "scope", "network", "datacenter", "dc1"))
+		otherOrg := newRule(1, models.AlertStateOK, "scope", "network", "datacenter", "dc1")
+		otherOrg.OrgID = 2
+		in.observe(otherOrg)
+		_, inhibited := in.inhibits(target)
+		require.True(t, inhibited)
+	})
+
+	t.Run("rules matching both selectors don't inhibit themselves", func(t *testing.T) {
+		in := newInhibitor(rules)
+		rule := newRule(1, models.AlertStateAlerting, "scope", "network", "tier", "service")
+
+		in.observe(rule)
+		_, inhibited := in.inhibits(rule)
+		require.False(t, inhibited)
+	})
+}
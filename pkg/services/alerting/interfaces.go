@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/grafana/grafana/pkg/components/null"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/plugins"
 )
@@ -15,6 +16,10 @@ type evalHandler interface {
 type scheduler interface {
 	Tick(time time.Time, execQueue chan *Job)
 	Update(rules []*Rule)
+	Snapshot(now time.Time) []ScheduledRuleInfo
+	Boost(key ruleKey, frequency int64, until time.Time) error
+	Job(key ruleKey) (*Job, bool)
+	Throttle(datasourceID int64, slowdown int64)
 }
 
 // Notifier is responsible for sending alert notifications.
@@ -56,9 +61,53 @@ type ConditionResult struct {
 	NoDataFound bool
 	Operator    string
 	EvalMatches []*EvalMatch
+
+	// LatestDataPoint is the time of the most recent datapoint the condition
+	// was evaluated against, zero when it is unknown.
+	LatestDataPoint time.Time
+
+	// Values are the reduced values of the series by series key, set by the
+	// conditions comparing the series with their previous value.
+	Values map[string]null.Float
+
+	// Series are the reduced values of all the series, matching or not,
+	// set by the conditions evaluated over a window of the rule.
+	Series []*EvalMatch
+
+	// AggregationMode is how the verdicts of the SeriesCount series of the
+	// condition are aggregated, EvalMatches holding the breaching ones. The
+	// verdict of the condition is Firing when it is empty.
+	AggregationMode AggregationMode
+	SeriesCount     int
+
+	// EmptyResult is set when the query of the condition succeeded without
+	// returning any series, ZeroFiring being the verdict of the condition
+	// for a zero value then. It is used for the rules taking the empty
+	// results for zero.
+	EmptyResult bool
+	ZeroFiring  bool
+}
+
+// ConditionEvalResult is the outcome of the evaluation of one of the conditions of a rule.
+type ConditionEvalResult struct {
+	Index        int
+	DatasourceID int64
+	Operator     string
+	Firing       bool
+	NoDataFound  bool
+	EvalMatches  []*EvalMatch
+	Error        error
+	// Window is the name of the window of the rule the condition was
+	// evaluated over, empty when the rule has no windows.
+	Window string
 }
 
 // Condition is responsible for evaluating an alert condition.
 type Condition interface {
 	Eval(result *EvalContext, requestHandler plugins.DataRequestHandler) (*ConditionResult, error)
 }
+
+// DatasourceCondition is implemented by the conditions querying a datasource.
+type DatasourceCondition interface {
+	GetDatasourceID() int64
+}
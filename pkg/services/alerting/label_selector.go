@@ -0,0 +1,90 @@
+package alerting
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// labelMatcher matches an alert rule tag, either on its exact value
+// or on a regular expression.
+type labelMatcher struct {
+	key   string
+	value string
+	regex *regexp.Regexp
+}
+
+func (m labelMatcher) matches(rule *Rule) bool {
+	for _, tag := range rule.AlertRuleTags {
+		if tag.Key == m.key && m.matchesValue(tag.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m labelMatcher) matchesValue(value string) bool {
+	if m.regex != nil {
+		return m.regex.MatchString(value)
+	}
+	return value == m.value
+}
+
+// labelSelector selects the alert rules whose tags match all of its matchers.
+type labelSelector []labelMatcher
+
+// parseLabelSelector parses a comma separated list of matchers such as
+// `team=payments, env=~prod|staging`. The `=~` operator matches the tag
+// value against an anchored regular expression.
+func parseLabelSelector(raw string) (labelSelector, error) {
+	var selector labelSelector
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid rule selector %q", part)
+		}
+
+		matcher := labelMatcher{key: strings.TrimSpace(kv[0])}
+		value := strings.TrimSpace(kv[1])
+		if strings.HasPrefix(value, "~") {
+			regex, err := regexp.Compile("^(?:" + strings.TrimSpace(value[1:]) + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid rule selector %q: %w", part, err)
+			}
+			matcher.regex = regex
+		} else {
+			matcher.value = value
+		}
+
+		selector = append(selector, matcher)
+	}
+	return selector, nil
+}
+
+// matches returns true if the rule matches all the matchers of the selector.
+// An empty selector matches all the rules.
+func (s labelSelector) matches(rule *Rule) bool {
+	for _, matcher := range s {
+		if !matcher.matches(rule) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesLabels returns true if the labels, such as the tags of a series,
+// match all the matchers of the selector.
+func (s labelSelector) matchesLabels(labels map[string]string) bool {
+	for _, matcher := range s {
+		value, ok := labels[matcher.key]
+		if !ok || !matcher.matchesValue(value) {
+			return false
+		}
+	}
+	return true
+}
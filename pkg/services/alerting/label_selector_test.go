@@ -0,0 +1,85 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelSelector(t *testing.T) {
+	rule := &Rule{AlertRuleTags: []*models.Tag{
+		{Key: "team", Value: "payments"},
+		{Key: "env", Value: "staging"},
+	}}
+
+	tcs := []struct {
+		selector string
+		matches  bool
+	}{
+		{selector: "", matches: true},
+		{selector: "team=payments", matches: true},
+		{selector: "team=payments, env=staging", matches: true},
+		{selector: "team=payments, env=prod", matches: false},
+		{selector: "team=search", matches: false},
+		{selector: "owner=payments", matches: false},
+		{selector: "env=~prod|staging", matches: true},
+		{selector: "env=~stag", matches: false},
+	}
+
+	for _, tc := range tcs {
+		selector, err := parseLabelSelector(tc.selector)
+		require.NoError(t, err, tc.selector)
+		require.Equal(t, tc.matches, selector.matches(rule), tc.selector)
+	}
+
+	for _, raw := range []string{"team", "=payments", "env=~prod("} {
+		_, err := parseLabelSelector(raw)
+		require.Error(t, err, raw)
+	}
+}
+
+func TestRuleReaderSelector(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &conditionStub{}, nil
+	})
+
+	newAlert := func(id int64, tags string) *models.Alert {
+		settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}], "alertRuleTags": ` + tags + `}`))
+		require.NoError(t, err)
+		return &models.Alert{Id: id, Frequency: 1, Settings: settings}
+	}
+
+	bus.AddHandler("test", func(query *models.GetAllAlertsQuery) error {
+		query.Result = []*models.Alert{
+			newAlert(1, `{"team": "payments"}`),
+			newAlert(2, `{"team": "search"}`),
+			newAlert(3, `{}`),
+		}
+		return nil
+	})
+
+	selector, err := parseLabelSelector("team=payments")
+	require.NoError(t, err)
+	rules, err := newRuleReader(selector).fetch()
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	require.Equal(t, int64(1), rules[0].ID)
+
+	s := newScheduler()
+	s.Update(rules)
+
+	execQueue := make(chan *Job, 10)
+	start := time.Unix(1000, 0)
+	for i := 0; i < 3; i++ {
+		s.Tick(start.Add(time.Duration(i)*time.Second), execQueue)
+	}
+	close(execQueue)
+	require.NotEmpty(t, execQueue)
+	for job := range execQueue {
+		require.Equal(t, int64(1), job.Rule.ID)
+	}
+}
@@ -0,0 +1,26 @@
+package alerting
+
+import "fmt"
+
+// capMatches returns a copy of the evaluation carrying at most limit eval
+// matches into its notifications, the message of the rule mentioning how
+// many more series matched. The evaluation itself is returned when it has
+// no more than limit matches, or when limit is not positive.
+func (c *EvalContext) capMatches(limit int) *EvalContext {
+	if limit <= 0 || len(c.EvalMatches) <= limit {
+		return c
+	}
+
+	rule := *c.Rule
+	capped := *c
+	capped.Rule = &rule
+	capped.EvalMatches = c.EvalMatches[:limit:limit]
+	capped.TruncatedMatches = len(c.EvalMatches) - limit
+
+	summary := fmt.Sprintf("... and %d more matching series", capped.TruncatedMatches)
+	if rule.Message != "" {
+		summary = rule.Message + "\n\n" + summary
+	}
+	rule.Message = summary
+	return &capped
+}
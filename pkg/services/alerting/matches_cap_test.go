@@ -0,0 +1,118 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func newMatches(count int) []*EvalMatch {
+	matches := make([]*EvalMatch, 0, count)
+	for i := 0; i < count; i++ {
+		matches = append(matches, &EvalMatch{Metric: fmt.Sprintf("series-%d", i), Value: null.FloatFrom(float64(i))})
+	}
+	return matches
+}
+
+func TestEvalContextCapMatches(t *testing.T) {
+	t.Run("truncates the matches over the limit", func(t *testing.T) {
+		evalContext := NewEvalContext(context.Background(), &Rule{Message: "CPU is high"}, nil)
+		evalContext.EvalMatches = newMatches(5)
+
+		capped := evalContext.capMatches(2)
+		require.Equal(t, evalContext.EvalMatches[:2], capped.EvalMatches)
+		require.Equal(t, 3, capped.TruncatedMatches)
+		require.Equal(t, "CPU is high\n\n... and 3 more matching series", capped.Rule.Message)
+
+		capped.EvalMatches = append(capped.EvalMatches, &EvalMatch{})
+		require.Len(t, evalContext.EvalMatches, 5, "the evaluation should be left untouched")
+		require.Equal(t, "series-2", evalContext.EvalMatches[2].Metric)
+		require.Equal(t, "CPU is high", evalContext.Rule.Message)
+		require.Zero(t, evalContext.TruncatedMatches)
+	})
+
+	t.Run("summarizes the truncation without message", func(t *testing.T) {
+		evalContext := NewEvalContext(context.Background(), &Rule{}, nil)
+		evalContext.EvalMatches = newMatches(3)
+
+		require.Equal(t, "... and 2 more matching series", evalContext.capMatches(1).Rule.Message)
+	})
+
+	t.Run("keeps the matches under the limit", func(t *testing.T) {
+		evalContext := NewEvalContext(context.Background(), &Rule{}, nil)
+		evalContext.EvalMatches = newMatches(2)
+
+		require.Same(t, evalContext, evalContext.capMatches(2))
+		require.Same(t, evalContext, evalContext.capMatches(0))
+	})
+}
+
+type capturingNotifier struct {
+	testNotifier
+	notified []*EvalContext
+}
+
+func (n *capturingNotifier) Notify(evalCtx *EvalContext) error {
+	n.notified = append(n.notified, evalCtx)
+	return nil
+}
+
+func TestResultHandlerMaxMatchesInNotification(t *testing.T) {
+	origMaxMatches := setting.AlertingMaxMatchesInNotification
+	t.Cleanup(func() { setting.AlertingMaxMatchesInNotification = origMaxMatches })
+	setting.AlertingMaxMatchesInNotification = 10
+
+	origRepo := annotations.GetRepository()
+	annotations.SetRepository(&fakeAnnotationsRepo{})
+	t.Cleanup(func() { annotations.SetRepository(origRepo) })
+
+	notifier := &capturingNotifier{testNotifier: testNotifier{UID: "capture", Type: "capture"}}
+	RegisterNotifier(&NotifierPlugin{
+		Type: "capture",
+		Name: "Capture",
+		Factory: func(model *models.AlertNotification) (Notifier, error) {
+			return notifier, nil
+		},
+	})
+	bus.AddHandler("test", func(cmd *models.SetAlertStateCommand) error {
+		cmd.Result = models.Alert{Id: cmd.AlertId, State: cmd.State, StateChanges: 1}
+		return nil
+	})
+	bus.AddHandler("test", func(query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = []*models.AlertNotification{{Id: 1, Uid: "capture", Type: "capture", Settings: simplejson.New()}}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetOrCreateNotificationStateQuery) error {
+		query.Result = &models.AlertNotificationState{Id: 1, State: models.AlertNotificationStateUnknown}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		return nil
+	})
+
+	handler := newResultHandler(nil, &fakeStateStore{states: map[ruleKey]RuleState{}}, newInhibitor(nil), newSilences(clock.NewMock()), nil, clock.New())
+	rule := &Rule{ID: 1, OrgID: 1, Name: "CPU", Message: "CPU is high", State: models.AlertStateAlerting, Notifications: []string{"capture"}}
+	evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+	evalContext.EvalMatches = newMatches(1234)
+	require.NoError(t, handler.handle(evalContext))
+
+	require.Len(t, notifier.notified, 1)
+	notified := notifier.notified[0]
+	require.Len(t, notified.EvalMatches, 10)
+	require.Equal(t, 1224, notified.TruncatedMatches)
+	require.Equal(t, "CPU is high\n\n... and 1224 more matching series", notified.Rule.Message)
+	require.Len(t, evalContext.EvalMatches, 1234, "the evaluation keeps every match")
+}
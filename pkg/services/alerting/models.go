@@ -2,6 +2,7 @@ package alerting
 
 import (
 	"sync"
+	"time"
 
 	"github.com/grafana/grafana/pkg/components/null"
 )
@@ -12,8 +13,12 @@ type Job struct {
 	OffsetWait  bool
 	Delay       bool
 	running     bool
-	Rule        *Rule
+	Rule        *Rule      // Rule of the job, replaced by the scheduler when the rules are reloaded, guarded by runningLock
 	runningLock sync.Mutex // Lock for running property which is used in the Scheduler and AlertEngine execution
+	lastErrorAt time.Time  // Time of the last failed evaluation since the last successful one, guarded by runningLock
+	enqueuedAt  time.Time  // Time the job was last put on the exec queue, guarded by runningLock
+	batch       *evalBatch // Batch of the evaluation group the job was last put on the exec queue with, guarded by runningLock
+	startedAt   time.Time  // Time the first attempt of the current execution of the job started, guarded by runningLock
 }
 
 // GetRunning returns true if the job is running. A lock is taken and released on the Job to ensure atomicity.
@@ -30,6 +35,90 @@ func (j *Job) SetRunning(b bool) {
 	j.runningLock.Unlock()
 }
 
+// GetLastErrorAt returns the time of the last failed evaluation of the job, which is zero
+// when the last evaluation succeeded. A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) GetLastErrorAt() time.Time {
+	defer j.runningLock.Unlock()
+	j.runningLock.Lock()
+	return j.lastErrorAt
+}
+
+// SetLastErrorAt sets the time of the last failed evaluation of the job. A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) SetLastErrorAt(t time.Time) {
+	j.runningLock.Lock()
+	j.lastErrorAt = t
+	j.runningLock.Unlock()
+}
+
+// GetEnqueuedAt returns the time the job was last put on the exec queue. A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) GetEnqueuedAt() time.Time {
+	defer j.runningLock.Unlock()
+	j.runningLock.Lock()
+	return j.enqueuedAt
+}
+
+// SetEnqueuedAt sets the time the job was put on the exec queue. A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) SetEnqueuedAt(t time.Time) {
+	j.runningLock.Lock()
+	j.enqueuedAt = t
+	j.runningLock.Unlock()
+}
+
+// GetBatch returns the batch of the evaluation group the job was last put on the exec queue with,
+// nil when it was put alone. A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) GetBatch() *evalBatch {
+	defer j.runningLock.Unlock()
+	j.runningLock.Lock()
+	return j.batch
+}
+
+// SetBatch sets the batch of the evaluation group the job is put on the exec queue with. A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) SetBatch(b *evalBatch) {
+	j.runningLock.Lock()
+	j.batch = b
+	j.runningLock.Unlock()
+}
+
+// GetStartedAt returns the time the first attempt of the current execution of the job started.
+// A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) GetStartedAt() time.Time {
+	defer j.runningLock.Unlock()
+	j.runningLock.Lock()
+	return j.startedAt
+}
+
+// SetStartedAt sets the time the first attempt of the execution of the job started. A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) SetStartedAt(t time.Time) {
+	j.runningLock.Lock()
+	j.startedAt = t
+	j.runningLock.Unlock()
+}
+
+// claim sets the job as running unless it already is, and returns false if it was. A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) claim() bool {
+	defer j.runningLock.Unlock()
+	j.runningLock.Lock()
+	if j.running {
+		return false
+	}
+	j.running = true
+	return true
+}
+
+// GetRule returns the rule of the job. A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) GetRule() *Rule {
+	defer j.runningLock.Unlock()
+	j.runningLock.Lock()
+	return j.Rule
+}
+
+// SetRule sets the rule of the job. A lock is taken and released on the Job to ensure atomicity.
+func (j *Job) SetRule(rule *Rule) {
+	j.runningLock.Lock()
+	j.Rule = rule
+	j.runningLock.Unlock()
+}
+
 // ResultLogEntry represents log data for the alert evaluation.
 type ResultLogEntry struct {
 	Message string
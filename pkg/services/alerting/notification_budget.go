@@ -0,0 +1,127 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// notificationBudget caps the notifications sent by the engine per minute,
+// so that a massive outage firing thousands of rules at once doesn't get
+// the notification channels to rate limit us. The notifications over the
+// budget are dropped, and a single summary of the alerts suppressed in the
+// minute is sent to their notification channels once the minute is over.
+type notificationBudget struct {
+	mtx         sync.Mutex
+	limit       int
+	window      time.Duration
+	clock       clock.Clock
+	windowStart time.Time
+	sent        int
+	// suppressed holds the notifications suppressed since the last summary by org.
+	suppressed  map[int64]*suppressedNotifications
+	sendSummary func(orgID int64, alerts int, notifiers []Notifier)
+	log         log.Logger
+}
+
+type suppressedNotifications struct {
+	rules     map[ruleKey]struct{}
+	notifiers map[string]Notifier
+}
+
+func newNotificationBudget(limit int, clock clock.Clock, sendSummary func(orgID int64, alerts int, notifiers []Notifier)) *notificationBudget {
+	return &notificationBudget{
+		limit:       limit,
+		window:      time.Minute,
+		clock:       clock,
+		suppressed:  make(map[int64]*suppressedNotifications),
+		sendSummary: sendSummary,
+		log:         log.New("alerting.notificationBudget"),
+	}
+}
+
+// filter returns the notifications of the evaluation left in the budget,
+// recording the other ones for the summary.
+func (b *notificationBudget) filter(evalContext *EvalContext, notifierStates notifierStateSlice) notifierStateSlice {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := b.clock.Now()
+	if now.Sub(b.windowStart) >= b.window {
+		b.windowStart = now
+		b.sent = 0
+	}
+
+	var allowed notifierStateSlice
+	for _, notifierState := range notifierStates {
+		if b.sent < b.limit {
+			b.sent++
+			allowed = append(allowed, notifierState)
+			continue
+		}
+		b.suppress(evalContext.Rule, notifierState.notifier, now)
+	}
+	return allowed
+}
+
+func (b *notificationBudget) suppress(rule *Rule, notifier Notifier, now time.Time) {
+	metrics.MAlertingNotificationsRateLimited.Inc()
+	b.log.Debug("Notification suppressed by the global rate limit", "ruleId", rule.ID, "uid", notifier.GetNotifierUID())
+
+	if len(b.suppressed) == 0 {
+		b.clock.AfterFunc(b.windowStart.Add(b.window).Sub(now), b.flush)
+	}
+	suppressed, ok := b.suppressed[rule.OrgID]
+	if !ok {
+		suppressed = &suppressedNotifications{rules: make(map[ruleKey]struct{}), notifiers: make(map[string]Notifier)}
+		b.suppressed[rule.OrgID] = suppressed
+	}
+	suppressed.rules[ruleKeyOf(rule)] = struct{}{}
+	suppressed.notifiers[notifier.GetNotifierUID()] = notifier
+}
+
+// flush sends the summary of the alerts suppressed since the last one.
+func (b *notificationBudget) flush() {
+	b.mtx.Lock()
+	suppressed := b.suppressed
+	b.suppressed = make(map[int64]*suppressedNotifications)
+	b.mtx.Unlock()
+
+	for orgID, s := range suppressed {
+		notifiers := make([]Notifier, 0, len(s.notifiers))
+		for _, notifier := range s.notifiers {
+			notifiers = append(notifiers, notifier)
+		}
+		b.log.Warn("Alerts suppressed by the global rate limit", "orgId", orgID, "alerts", len(s.rules))
+		b.sendSummary(orgID, len(s.rules), notifiers)
+	}
+}
+
+// sendSuppressedSummary notifies the notification channels of the alerts
+// suppressed by the notification budget of how many were suppressed.
+func (n *notificationService) sendSuppressedSummary(orgID int64, alerts int, notifiers []Notifier) {
+	ctx, cancel := context.WithTimeout(context.Background(), setting.AlertingNotificationTimeout)
+	defer cancel()
+
+	rule := &Rule{
+		OrgID:   orgID,
+		Name:    fmt.Sprintf("%d alerts suppressed by global rate limit", alerts),
+		Message: "The notifications of these alerts exceeded the maximum number of notifications per minute and were not sent.",
+		State:   models.AlertStateAlerting,
+	}
+	evalContext := NewEvalContext(ctx, rule, nil)
+	evalContext.Firing = true
+
+	for _, notifier := range notifiers {
+		if err := n.deliver(evalContext, notifier); err != nil {
+			n.log.Error("Failed to send the summary of the suppressed notifications", "uid", notifier.GetNotifierUID(), "error", err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package alerting
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type countingTestNotifier struct {
+	testNotifier
+	mtx   sync.Mutex
+	rules []string
+}
+
+func (n *countingTestNotifier) Notify(evalCtx *EvalContext) error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.rules = append(n.rules, evalCtx.Rule.Name)
+	return nil
+}
+
+func (n *countingTestNotifier) notified() []string {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return append([]string(nil), n.rules...)
+}
+
+func TestNotificationBudget(t *testing.T) {
+	pager := &countingTestNotifier{testNotifier: testNotifier{UID: "pager", Type: "test-counting"}}
+	slack := &countingTestNotifier{testNotifier: testNotifier{UID: "slack", Type: "test-counting"}}
+	RegisterNotifier(&NotifierPlugin{
+		Type: "test-counting",
+		Name: "Test counting",
+		Factory: func(model *models.AlertNotification) (Notifier, error) {
+			if model.Uid == "pager" {
+				return pager, nil
+			}
+			return slack, nil
+		},
+	})
+
+	bus.AddHandler("test", func(query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = nil
+		for _, uid := range query.Uids {
+			query.Result = append(query.Result, &models.AlertNotification{Uid: uid, Type: "test-counting", Settings: simplejson.New()})
+		}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetOrCreateNotificationStateQuery) error {
+		query.Result = &models.AlertNotificationState{AlertId: query.AlertId, NotifierId: query.NotifierId}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		return nil
+	})
+
+	mock := clock.NewMock()
+	service := newNotificationService(nil)
+	service.budget = newNotificationBudget(3, mock, service.sendSuppressedSummary)
+	rateLimited := testutil.ToFloat64(metrics.MAlertingNotificationsRateLimited)
+
+	flood := func(names ...string) {
+		for i, name := range names {
+			rule := &Rule{ID: int64(i + 1), OrgID: 1, Name: name, State: models.AlertStateAlerting, Notifications: []string{"pager"}}
+			if i%2 == 1 {
+				rule.Notifications = []string{"slack"}
+			}
+			evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+			evalContext.Firing = true
+			require.NoError(t, service.SendIfNeeded(evalContext))
+		}
+	}
+
+	flood("a", "b", "c", "d", "e", "f", "g")
+	require.Equal(t, []string{"a", "c"}, pager.notified())
+	require.Equal(t, []string{"b"}, slack.notified())
+	require.Equal(t, rateLimited+4, testutil.ToFloat64(metrics.MAlertingNotificationsRateLimited))
+
+	// a single summary is sent to the channels of the suppressed alerts once the minute is over
+	mock.Add(time.Minute)
+	require.Eventually(t, func() bool {
+		return len(pager.notified()) == 3 && len(slack.notified()) == 2
+	}, time.Second, time.Millisecond)
+	require.Equal(t, "4 alerts suppressed by global rate limit", pager.notified()[2])
+	require.Equal(t, "4 alerts suppressed by global rate limit", slack.notified()[1])
+
+	// the notifications are sent again in the next minute
+	flood("h")
+	require.Equal(t, "h", pager.notified()[3])
+
+	mock.Add(time.Minute)
+	require.Len(t, pager.notified(), 4, "no summary should be sent when nothing was suppressed")
+}
+
+func TestResultHandlerNotificationBudgetClock(t *testing.T) {
+	origLimit := setting.AlertingMaxNotificationsPerMinute
+	t.Cleanup(func() { setting.AlertingMaxNotificationsPerMinute = origLimit })
+	setting.AlertingMaxNotificationsPerMinute = 3
+
+	mock := clock.NewMock()
+	handler := newResultHandler(nil, &fakeStateStore{states: map[ruleKey]RuleState{}}, newInhibitor(nil), newSilences(mock), nil, mock)
+	require.Equal(t, mock, handler.notifier.budget.clock, "the budget window is tracked with the clock of the engine")
+}
@@ -0,0 +1,55 @@
+package alerting
+
+import (
+	"errors"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+const notificationDedupKeyPrefix = "alert_notification_sent:"
+
+// notificationDedup keeps track in the remote cache of the notifications
+// recently sent by any instance, so that the instances evaluating the same
+// state transition during a failover don't all send its notifications.
+type notificationDedup struct {
+	cache remotecache.CacheStorage
+	ttl   time.Duration
+	log   log.Logger
+}
+
+func newNotificationDedup(cache remotecache.CacheStorage, ttl time.Duration) *notificationDedup {
+	return &notificationDedup{
+		cache: cache,
+		ttl:   ttl,
+		log:   log.New("alerting.notificationDedup"),
+	}
+}
+
+// claim records that the notification identified by key is being sent and
+// returns false if it was already sent recently. The notification is sent
+// when the remote cache is unavailable, a duplicate is better than nothing.
+func (d *notificationDedup) claim(key string) bool {
+	_, err := d.cache.Get(notificationDedupKeyPrefix + key)
+	if err == nil {
+		return false
+	}
+	if !errors.Is(err, remotecache.ErrCacheItemNotFound) {
+		d.log.Warn("Could not check whether the notification was already sent", "key", key, "error", err)
+		return true
+	}
+
+	if err := d.cache.Set(notificationDedupKeyPrefix+key, setting.AlertingClusteringInstance, d.ttl); err != nil {
+		d.log.Warn("Could not record the notification as sent", "key", key, "error", err)
+	}
+	return true
+}
+
+// release forgets the notification identified by key, which failed to be sent.
+func (d *notificationDedup) release(key string) {
+	if err := d.cache.Delete(notificationDedupKeyPrefix + key); err != nil {
+		d.log.Warn("Could not forget the failed notification", "key", key, "error", err)
+	}
+}
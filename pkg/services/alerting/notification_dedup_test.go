@@ -0,0 +1,97 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalContextIdempotencyKey(t *testing.T) {
+	newEvalContext := func(start time.Time, prev, state models.AlertStateType) *EvalContext {
+		evalCtx := NewEvalContext(context.Background(), &Rule{ID: 1, Frequency: 60, State: prev}, &validations.OSSPluginRequestValidator{})
+		evalCtx.StartTime = start
+		evalCtx.Rule.State = state
+		return evalCtx
+	}
+
+	tick := time.Unix(6000, 0)
+	key := newEvalContext(tick, models.AlertStateOK, models.AlertStateAlerting).GetIdempotencyKey()
+	require.Equal(t, key, newEvalContext(tick.Add(2*time.Second), models.AlertStateOK, models.AlertStateAlerting).GetIdempotencyKey())
+	require.NotEqual(t, key, newEvalContext(tick.Add(time.Minute), models.AlertStateOK, models.AlertStateAlerting).GetIdempotencyKey())
+	require.NotEqual(t, key, newEvalContext(tick, models.AlertStateAlerting, models.AlertStateOK).GetIdempotencyKey())
+}
+
+func TestNotificationServiceDedup(t *testing.T) {
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		return nil
+	})
+
+	newInstance := func(cache *fakeClusterCache) *notificationService {
+		n := newNotificationService(nil)
+		n.retryDelay = time.Millisecond
+		n.dedup = newNotificationDedup(cache, time.Minute)
+		return n
+	}
+	newEvalContext := func(start time.Time) *EvalContext {
+		evalCtx := NewEvalContext(context.Background(), &Rule{ID: 1, Frequency: 60, State: models.AlertStateOK}, &validations.OSSPluginRequestValidator{})
+		evalCtx.StartTime = start
+		evalCtx.Rule.State = models.AlertStateAlerting
+		return evalCtx
+	}
+	newNotifierStates := func(notifier *flakyNotifier) notifierStateSlice {
+		return notifierStateSlice{{notifier: notifier, state: &models.AlertNotificationState{Id: 1}}}
+	}
+
+	t.Run("instances sending the same transition during a failover notify once", func(t *testing.T) {
+		cache := newFakeClusterCache()
+		a, b := newInstance(cache), newInstance(cache)
+		notifier := &flakyNotifier{testNotifier: testNotifier{UID: "pager"}}
+		tick := time.Unix(6000, 0)
+
+		evalCtx := newEvalContext(tick)
+		require.NoError(t, a.sendNotifications(evalCtx, newNotifierStates(notifier)))
+		require.NotEmpty(t, evalCtx.IdempotencyKey)
+		require.NoError(t, b.sendNotifications(newEvalContext(tick.Add(time.Second)), newNotifierStates(notifier)))
+		require.Equal(t, 1, notifier.calls)
+
+		// the notifiers are deduplicated separately
+		other := &flakyNotifier{testNotifier: testNotifier{UID: "email"}}
+		require.NoError(t, b.sendNotifications(newEvalContext(tick.Add(time.Second)), newNotifierStates(other)))
+		require.Equal(t, 1, other.calls)
+
+		// the next firing of the rule is notified
+		require.NoError(t, b.sendNotifications(newEvalContext(tick.Add(time.Hour)), newNotifierStates(notifier)))
+		require.Equal(t, 2, notifier.calls)
+	})
+
+	t.Run("failed notifications are sent again by the other instance", func(t *testing.T) {
+		cache := newFakeClusterCache()
+		a, b := newInstance(cache), newInstance(cache)
+		tick := time.Unix(6000, 0)
+
+		failing := &flakyNotifier{testNotifier: testNotifier{UID: "pager"}, failures: 1}
+		require.NoError(t, a.sendNotifications(newEvalContext(tick), newNotifierStates(failing)))
+		require.NoError(t, b.sendNotifications(newEvalContext(tick), newNotifierStates(failing)))
+		require.Equal(t, 2, failing.calls)
+	})
+
+	t.Run("notifications are sent when the remote cache is unavailable", func(t *testing.T) {
+		cache := newFakeClusterCache()
+		cache.getErr = errors.New("connection refused")
+		n := newInstance(cache)
+		notifier := &flakyNotifier{testNotifier: testNotifier{UID: "pager"}}
+
+		require.NoError(t, n.sendNotifications(newEvalContext(time.Unix(6000, 0)), newNotifierStates(notifier)))
+		require.NoError(t, n.sendNotifications(newEvalContext(time.Unix(6000, 0)), newNotifierStates(notifier)))
+		require.Equal(t, 2, notifier.calls)
+	})
+}
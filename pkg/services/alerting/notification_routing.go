@@ -0,0 +1,109 @@
+package alerting
+
+import (
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// NotificationRoute routes the notifications of an alert rule to its
+// notifiers when the evaluation of the rule has an eval match above its
+// minimum value and whose series tags match its matchers, such as
+// `value > 90 pages the on-call`. A route without minimum value nor
+// matchers matches every evaluation.
+type NotificationRoute struct {
+	// MinValue is the value an eval match must exceed, nil for any value.
+	MinValue *float64
+	// Matchers is the comma separated list of matchers of the series tags
+	// of the eval matches, in the syntax of the rule selector.
+	Matchers      string
+	Notifications []string
+
+	selector labelSelector
+}
+
+// matches returns true if an eval match of the evaluation matches the route.
+func (r *NotificationRoute) matches(evalMatches []*EvalMatch) bool {
+	if r.MinValue == nil && len(r.selector) == 0 {
+		return true
+	}
+	for _, match := range evalMatches {
+		if r.MinValue != nil && (!match.Value.Valid || match.Value.Float64 <= *r.MinValue) {
+			continue
+		}
+		if r.selector.matchesLabels(match.Tags) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseNotificationRoutes(model *Rule, rawRoutes []interface{}, logTranslationFailures bool) ([]*NotificationRoute, error) {
+	var routes []*NotificationRoute
+	for _, raw := range rawRoutes {
+		jsonModel := simplejson.NewFromAny(raw)
+		route := &NotificationRoute{Matchers: jsonModel.Get("matchers").MustString()}
+
+		if rawMinValue, ok := jsonModel.CheckGet("minValue"); ok {
+			minValue, err := rawMinValue.Float64()
+			if err != nil {
+				return nil, ValidationError{Reason: "Could not parse minValue of notification route", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+			}
+			route.MinValue = &minValue
+		}
+
+		selector, err := parseLabelSelector(route.Matchers)
+		if err != nil {
+			return nil, ValidationError{Reason: "Could not parse matchers of notification route", Err: err, DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+		}
+		route.selector = selector
+
+		route.Notifications, err = parseNotifications(model, jsonModel.Get("notifications").MustArray(), logTranslationFailures)
+		if err != nil {
+			return nil, err
+		}
+		if len(route.Notifications) == 0 {
+			return nil, ValidationError{Reason: "Notification route has no notifications", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+		}
+
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+// routeNotifications returns the uids of the notifiers the notifications
+// of the evaluation are sent to: those of the first route matching the
+// evaluation of the alerting rule, the notifiers of the rule when none
+// does. The notifications of the other states are sent to the notifiers of
+// all the routes and of the rule, for the resolved notifications to reach
+// the notifiers of whichever route was matched.
+func routeNotifications(evalContext *EvalContext) []string {
+	rule := evalContext.Rule
+	if len(rule.NotificationRoutes) == 0 {
+		return rule.Notifications
+	}
+
+	if rule.State == models.AlertStateAlerting {
+		for _, route := range rule.NotificationRoutes {
+			if route.matches(evalContext.EvalMatches) {
+				return route.Notifications
+			}
+		}
+		return rule.Notifications
+	}
+
+	seen := make(map[string]bool)
+	var uids []string
+	add := func(notifications []string) {
+		for _, uid := range notifications {
+			if !seen[uid] {
+				seen[uid] = true
+				uids = append(uids, uid)
+			}
+		}
+	}
+	add(rule.Notifications)
+	for _, route := range rule.NotificationRoutes {
+		add(route.Notifications)
+	}
+	return uids
+}
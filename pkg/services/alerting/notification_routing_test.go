@@ -0,0 +1,149 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/stretchr/testify/require"
+)
+
+const routedRuleSettings = `{
+	"conditions": [{"type": "test"}],
+	"notifications": [{"uid": "email"}],
+	"notificationRoutes": [
+		{"minValue": 90, "notifications": [{"uid": "oncall"}]},
+		{"minValue": 70, "matchers": "env=~prod|staging", "notifications": [{"uid": "slack"}]}
+	]
+}`
+
+func TestAlertRuleNotificationRoutesParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	t.Run("the routes are parsed in order", func(t *testing.T) {
+		settings, err := simplejson.NewJson([]byte(routedRuleSettings))
+		require.NoError(t, err)
+		rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+		require.NoError(t, err)
+
+		require.Equal(t, []string{"email"}, rule.Notifications)
+		require.Len(t, rule.NotificationRoutes, 2)
+		require.Equal(t, 90.0, *rule.NotificationRoutes[0].MinValue)
+		require.Equal(t, []string{"oncall"}, rule.NotificationRoutes[0].Notifications)
+		require.Equal(t, "env=~prod|staging", rule.NotificationRoutes[1].Matchers)
+		require.Equal(t, []string{"slack"}, rule.NotificationRoutes[1].Notifications)
+	})
+
+	invalid := map[string]string{
+		"invalid min value":  `[{"minValue": "high", "notifications": [{"uid": "oncall"}]}]`,
+		"invalid matchers":   `[{"matchers": "env=~(", "notifications": [{"uid": "oncall"}]}]`,
+		"no notifications":   `[{"minValue": 90}]`,
+		"invalid notifier":   `[{"minValue": 90, "notifications": [{"name": "oncall"}]}]`,
+		"non numeric values": `[{"minValue": [90], "notifications": [{"uid": "oncall"}]}]`,
+	}
+	for name, routes := range invalid {
+		t.Run(name, func(t *testing.T) {
+			settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}], "notificationRoutes": ` + routes + `}`))
+			require.NoError(t, err)
+			_, err = NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+			var validationErr ValidationError
+			require.ErrorAs(t, err, &validationErr)
+		})
+	}
+}
+
+func TestRouteNotifications(t *testing.T) {
+	settings, err := simplejson.NewJson([]byte(routedRuleSettings))
+	require.NoError(t, err)
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+	rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+	require.NoError(t, err)
+
+	route := func(state models.AlertStateType, matches ...*EvalMatch) []string {
+		rule.State = state
+		return routeNotifications(&EvalContext{Rule: rule, EvalMatches: matches})
+	}
+	match := func(value float64, tags map[string]string) *EvalMatch {
+		return &EvalMatch{Value: null.FloatFrom(value), Tags: tags}
+	}
+	prod := map[string]string{"env": "prod"}
+
+	require.Equal(t, []string{"oncall"}, route(models.AlertStateAlerting, match(95, prod)))
+	require.Equal(t, []string{"oncall"}, route(models.AlertStateAlerting, match(75, prod), match(95, nil)),
+		"the first matching route wins")
+	require.Equal(t, []string{"slack"}, route(models.AlertStateAlerting, match(75, prod)))
+	require.Equal(t, []string{"email"}, route(models.AlertStateAlerting, match(75, map[string]string{"env": "dev"})),
+		"the series tags must match the matchers")
+	require.Equal(t, []string{"email"}, route(models.AlertStateAlerting, match(90, nil)),
+		"the value must exceed the minimum value")
+	require.Equal(t, []string{"email"}, route(models.AlertStateAlerting, &EvalMatch{Value: null.FloatFromPtr(nil)}))
+	require.Equal(t, []string{"email", "oncall", "slack"}, route(models.AlertStateOK),
+		"the resolved notifications reach the notifiers of all the routes")
+
+	t.Run("routes without minimum value nor matchers match every evaluation", func(t *testing.T) {
+		catchAll := &Rule{State: models.AlertStateAlerting, Notifications: []string{"email"},
+			NotificationRoutes: []*NotificationRoute{{Notifications: []string{"slack"}}}}
+		require.Equal(t, []string{"slack"}, routeNotifications(&EvalContext{Rule: catchAll}))
+	})
+
+	t.Run("rules without routes notify their notifiers", func(t *testing.T) {
+		plain := &Rule{State: models.AlertStateAlerting, Notifications: []string{"email"}}
+		require.Equal(t, []string{"email"}, routeNotifications(&EvalContext{Rule: plain}))
+	})
+}
+
+func TestResultHandlerNotificationRoutes(t *testing.T) {
+	origRepo := annotations.GetRepository()
+	annotations.SetRepository(&fakeAnnotationsRepo{})
+	t.Cleanup(func() { annotations.SetRepository(origRepo) })
+
+	bus.AddHandler("test", func(cmd *models.SetAlertStateCommand) error {
+		cmd.Result = models.Alert{Id: cmd.AlertId, State: cmd.State, StateChanges: 1}
+		return nil
+	})
+	var queried [][]string
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		queried = append(queried, query.Uids)
+		return nil
+	})
+
+	settings, err := simplejson.NewJson([]byte(routedRuleSettings))
+	require.NoError(t, err)
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+	rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, OrgId: 1, Frequency: 60, Settings: settings, State: models.AlertStateOK}, false)
+	require.NoError(t, err)
+	handler := newResultHandler(nil, &fakeStateStore{states: map[ruleKey]RuleState{}}, newInhibitor(nil), newSilences(clock.NewMock()), nil, clock.New())
+
+	handle := func(state models.AlertStateType, value float64) {
+		evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		evalContext.EvalMatches = []*EvalMatch{{Value: null.FloatFrom(value), Tags: map[string]string{"env": "prod"}}}
+		rule.State = state
+		require.NoError(t, handler.handle(evalContext))
+	}
+
+	handle(models.AlertStateAlerting, 95)
+	handle(models.AlertStateOK, 10)
+	handle(models.AlertStateAlerting, 75)
+	handle(models.AlertStateOK, 10)
+	handle(models.AlertStateAlerting, 50)
+
+	require.Equal(t, [][]string{
+		{"oncall"},
+		{"email", "oncall", "slack"},
+		{"slack"},
+		{"email", "oncall", "slack"},
+		{"email"},
+	}, queried)
+}
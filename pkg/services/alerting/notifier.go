@@ -87,21 +87,47 @@ func newNotificationService(renderService rendering.Service) *notificationServic
 	return &notificationService{
 		log:           log.New("alerting.notifier"),
 		renderService: renderService,
+		retryDelay:    time.Second,
+		stats:         newNotifierStats(),
 	}
 }
 
 type notificationService struct {
 	log           log.Logger
 	renderService rendering.Service
+	// retryDelay is the delay before the first retry of a failed
+	// notification, it doubles with every attempt.
+	retryDelay time.Duration
+	// dedup skips the notifications already sent by another instance, it
+	// is nil when the notifications are not deduplicated.
+	dedup *notificationDedup
+	// budget caps the notifications sent per minute, it is nil
+	// when the notifications are not rate limited.
+	budget *notificationBudget
+	// stats records the deliveries of the notifiers.
+	stats *notifierStats
 }
 
 func (n *notificationService) SendIfNeeded(evalCtx *EvalContext) error {
-	notifierStates, err := n.getNeededNotifiers(evalCtx.Rule.OrgID, evalCtx.Rule.Notifications, evalCtx)
+	if setting.AlertingNotificationsDisabled {
+		n.log.Debug("Notifications are disabled, not sending any", "ruleId", evalCtx.Rule.ID, "state", evalCtx.Rule.State)
+		return nil
+	}
+
+	notificationUids := evalCtx.Rule.Notifications
+	if evalCtx.Notifications != nil {
+		notificationUids = evalCtx.Notifications
+	}
+	notifierStates, err := n.getNeededNotifiers(evalCtx.Rule.OrgID, notificationUids, evalCtx)
 	if err != nil {
 		n.log.Error("Failed to get alert notifiers", "error", err)
 		return err
 	}
 
+	if n.budget != nil && !evalCtx.IsTestRun {
+		notifierStates = n.budget.filter(evalCtx, notifierStates)
+	}
+
 	if len(notifierStates) == 0 {
 		return nil
 	}
@@ -135,7 +161,7 @@ func (n *notificationService) sendAndMarkAsComplete(evalContext *EvalContext, no
 		n.log.Error("failed trying to evaluate notification template fields", "uid", notifier.GetNotifierUID(), "error", err)
 	}
 
-	if err := notifier.Notify(evalContext); err != nil {
+	if err := n.deliver(evalContext, notifier); err != nil {
 		n.log.Error("failed to send notification", "uid", notifier.GetNotifierUID(), "error", err)
 		metrics.MAlertingNotificationFailed.WithLabelValues(notifier.GetType()).Inc()
 		return err
@@ -153,12 +179,60 @@ func (n *notificationService) sendAndMarkAsComplete(evalContext *EvalContext, no
 	return bus.DispatchCtx(evalContext.Ctx, cmd)
 }
 
-func (n *notificationService) sendNotification(evalContext *EvalContext, notifierState *notifierState) error {
+// deliver sends the notification and records the delivery in the stats of
+// the notifier, the test runs included since they are delivered all the same.
+func (n *notificationService) deliver(evalContext *EvalContext, notifier Notifier) error {
+	start := time.Now()
+	attempts, err := n.notifyWithRetry(evalContext, notifier)
+	n.stats.record(evalContext.Rule.OrgID, notifier, attempts, time.Since(start), err, time.Now())
+	return err
+}
+
+// notifyWithRetry sends the notification, retrying with backoff up to
+// AlertingNotificationMaxAttempts times, and returns the number of attempts.
+// Test runs are never retried.
+func (n *notificationService) notifyWithRetry(evalContext *EvalContext, notifier Notifier) (int, error) {
+	maxAttempts := setting.AlertingNotificationMaxAttempts
+	if maxAttempts < 1 || evalContext.IsTestRun {
+		maxAttempts = 1
+	}
+
+	delay := n.retryDelay
+	for attempt := 1; ; attempt++ {
+		err := notifier.Notify(evalContext)
+		if err == nil || attempt >= maxAttempts {
+			return attempt, err
+		}
+
+		n.log.Warn("failed to send notification, retrying", "uid", notifier.GetNotifierUID(), "attempt", attempt, "error", err)
+		select {
+		case <-evalContext.Ctx.Done():
+			return attempt, err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (n *notificationService) sendNotification(evalContext *EvalContext, notifierState *notifierState) (err error) {
+	if n.dedup != nil && evalContext.IdempotencyKey != "" {
+		key := evalContext.IdempotencyKey + ":" + notifierState.notifier.GetNotifierUID()
+		if !n.dedup.claim(key) {
+			n.log.Debug("Skipping notification already sent", "uid", notifierState.notifier.GetNotifierUID(), "key", evalContext.IdempotencyKey)
+			return nil
+		}
+		defer func() {
+			if err != nil {
+				n.dedup.release(key)
+			}
+		}()
+	}
+
 	if !evalContext.IsTestRun {
 		setPendingCmd := &models.SetAlertNotificationStateToPendingCommand{
 			Id:                           notifierState.state.Id,
 			Version:                      notifierState.state.Version,
-			AlertRuleStateUpdatedVersion: evalContext.Rule.StateChanges,
+			AlertRuleStateUpdatedVersion: evalContext.stateChanges(),
 		}
 
 		err := bus.DispatchCtx(evalContext.Ctx, setPendingCmd)
@@ -179,6 +253,10 @@ func (n *notificationService) sendNotification(evalContext *EvalContext, notifie
 }
 
 func (n *notificationService) sendNotifications(evalContext *EvalContext, notifierStates notifierStateSlice) error {
+	if n.dedup != nil && !evalContext.IsTestRun {
+		evalContext.IdempotencyKey = evalContext.GetIdempotencyKey()
+	}
+
 	for _, notifierState := range notifierStates {
 		err := n.sendNotification(evalContext, notifierState)
 		if err != nil {
@@ -197,10 +275,11 @@ func (n *notificationService) renderAndUploadImage(evalCtx *EvalContext, timeout
 		return err
 	}
 
+	renderTimeout := imageRenderTimeout(timeout)
 	renderOpts := rendering.Opts{
 		Width:           1000,
 		Height:          500,
-		Timeout:         timeout,
+		Timeout:         renderTimeout,
 		OrgID:           evalCtx.Rule.OrgID,
 		OrgRole:         models.ROLE_ADMIN,
 		ConcurrentLimit: setting.AlertingRenderLimit,
@@ -215,8 +294,13 @@ func (n *notificationService) renderAndUploadImage(evalCtx *EvalContext, timeout
 
 	n.log.Debug("Rendering alert panel image", "ruleId", evalCtx.Rule.ID, "urlPath", renderOpts.Path)
 	start := time.Now()
-	result, err := n.renderService.Render(evalCtx.Ctx, renderOpts)
+	renderCtx, renderCtxCancel := context.WithTimeout(evalCtx.Ctx, renderTimeout)
+	result, err := n.renderService.Render(renderCtx, renderOpts)
+	renderCtxCancel()
 	if err != nil {
+		if errors.Is(renderCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("rendering did not complete within %s, sending the notification without image: %w", renderTimeout, err)
+		}
 		return err
 	}
 	took := time.Since(start)
@@ -241,6 +325,15 @@ func (n *notificationService) renderAndUploadImage(evalCtx *EvalContext, timeout
 	return nil
 }
 
+// imageRenderTimeout returns the time allowed to render the image of a
+// notification, out of the time allowed to render and upload it.
+func imageRenderTimeout(imageTimeout time.Duration) time.Duration {
+	if setting.AlertingRenderTimeout > 0 && setting.AlertingRenderTimeout < imageTimeout {
+		return setting.AlertingRenderTimeout
+	}
+	return imageTimeout
+}
+
 func (n *notificationService) getNeededNotifiers(orgID int64, notificationUids []string, evalContext *EvalContext) (notifierStateSlice, error) {
 	query := &models.GetAlertNotificationsWithUidToSendQuery{OrgId: orgID, Uids: notificationUids}
 
@@ -0,0 +1,105 @@
+package alerting
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// NotifierStat is the delivery record of a notifier since the engine
+// started. A delivery is counted once however many times it was retried.
+type NotifierStat struct {
+	OrgID int64
+	UID   string
+	Type  string
+	// Attempts is the number of times the notifier was called, retries
+	// included.
+	Attempts  int64
+	Successes int64
+	Failures  int64
+	// LastLatency is the duration of the last delivery and AverageLatency
+	// the average duration of the deliveries, retries included.
+	LastLatency    time.Duration
+	AverageLatency time.Duration
+	LastSuccessAt  time.Time
+	LastError      string
+	LastErrorAt    time.Time
+}
+
+type notifierKey struct {
+	orgID int64
+	uid   string
+}
+
+// notifierStats records the deliveries of the notifiers, for the notifiers
+// failing silently to be noticed before the alerts are found missing.
+type notifierStats struct {
+	mtx          sync.Mutex
+	stats        map[notifierKey]*NotifierStat
+	totalLatency map[notifierKey]time.Duration
+}
+
+func newNotifierStats() *notifierStats {
+	return &notifierStats{
+		stats:        make(map[notifierKey]*NotifierStat),
+		totalLatency: make(map[notifierKey]time.Duration),
+	}
+}
+
+// record records a delivery of the notification by the notifier, which
+// took the attempts and ended with err.
+func (s *notifierStats) record(orgID int64, notifier Notifier, attempts int, took time.Duration, err error, now time.Time) {
+	metrics.MAlertingNotificationDuration.WithLabelValues(notifier.GetType()).Observe(float64(took / time.Millisecond))
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	key := notifierKey{orgID: orgID, uid: notifier.GetNotifierUID()}
+	stat, ok := s.stats[key]
+	if !ok {
+		stat = &NotifierStat{OrgID: orgID, UID: key.uid}
+		s.stats[key] = stat
+	}
+	stat.Type = notifier.GetType()
+	stat.Attempts += int64(attempts)
+	if err != nil {
+		stat.Failures++
+		stat.LastError = err.Error()
+		stat.LastErrorAt = now
+	} else {
+		stat.Successes++
+		stat.LastSuccessAt = now
+	}
+	stat.LastLatency = took
+	s.totalLatency[key] += took
+	stat.AverageLatency = s.totalLatency[key] / time.Duration(stat.Successes+stat.Failures)
+}
+
+func (s *notifierStats) snapshot() []NotifierStat {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	stats := make([]NotifierStat, 0, len(s.stats))
+	for _, stat := range s.stats {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].OrgID != stats[j].OrgID {
+			return stats[i].OrgID < stats[j].OrgID
+		}
+		return stats[i].UID < stats[j].UID
+	})
+	return stats
+}
+
+// NotifierStatus returns the delivery record of every notifier which sent
+// a notification since the engine started, ordered by org and uid. The
+// notifications of test runs are not recorded.
+func (e *AlertEngine) NotifierStatus() []NotifierStat {
+	if e.notifierStats == nil {
+		return []NotifierStat{}
+	}
+	return e.notifierStats.snapshot()
+}
@@ -0,0 +1,77 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifierStats(t *testing.T) {
+	origMaxAttempts := setting.AlertingNotificationMaxAttempts
+	t.Cleanup(func() { setting.AlertingNotificationMaxAttempts = origMaxAttempts })
+	setting.AlertingNotificationMaxAttempts = 2
+
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		return nil
+	})
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	require.Empty(t, engine.NotifierStatus())
+
+	n := engine.resultHandler.(*defaultResultHandler).notifier
+	n.retryDelay = time.Millisecond
+
+	slack := &flakyNotifier{testNotifier: testNotifier{UID: "slack", Type: "slack"}, failures: 5}
+	email := &flakyNotifier{testNotifier: testNotifier{UID: "email", Type: "email"}, failures: 1}
+	states := notifierStateSlice{
+		&notifierState{notifier: slack, state: &models.AlertNotificationState{Id: 1}},
+		&notifierState{notifier: email, state: &models.AlertNotificationState{Id: 2}},
+	}
+
+	send := func(isTestRun bool) {
+		evalCtx := NewEvalContext(context.Background(), &Rule{OrgID: 1}, &validations.OSSPluginRequestValidator{})
+		evalCtx.IsTestRun = isTestRun
+		_ = n.sendNotifications(evalCtx, states)
+	}
+
+	send(false)
+	send(false)
+
+	stats := engine.NotifierStatus()
+	require.Len(t, stats, 2)
+
+	require.Equal(t, "email", stats[0].UID)
+	require.Equal(t, int64(1), stats[0].OrgID)
+	require.Equal(t, int64(3), stats[0].Attempts, "the first delivery is retried once")
+	require.Equal(t, int64(2), stats[0].Successes)
+	require.Zero(t, stats[0].Failures)
+	require.Empty(t, stats[0].LastError)
+	require.False(t, stats[0].LastSuccessAt.IsZero())
+
+	require.Equal(t, "slack", stats[1].UID)
+	require.Equal(t, "slack", stats[1].Type)
+	require.Equal(t, int64(4), stats[1].Attempts)
+	require.Zero(t, stats[1].Successes)
+	require.Equal(t, int64(2), stats[1].Failures)
+	require.Equal(t, "service unavailable", stats[1].LastError)
+	require.False(t, stats[1].LastErrorAt.IsZero())
+	require.True(t, stats[1].LastSuccessAt.IsZero())
+	require.Positive(t, int64(stats[1].AverageLatency), "the retries are waited for")
+
+	t.Run("records the test runs, which are delivered all the same", func(t *testing.T) {
+		send(true)
+		stats := engine.NotifierStatus()
+		require.Equal(t, int64(3), stats[1].Failures)
+		require.Equal(t, int64(5), stats[1].Attempts, "the test runs are not retried")
+	})
+}
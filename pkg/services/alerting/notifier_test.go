@@ -2,6 +2,7 @@ package alerting
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -96,6 +97,52 @@ func TestNotificationService(t *testing.T) {
 			require.Truef(sc.t, evalCtx.Ctx.Value(notificationSent{}).(bool), "expected notification to be sent, but wasn't")
 		})
 
+	evalCtxSlowRender := NewEvalContext(context.Background(), testRule, &validations.OSSPluginRequestValidator{})
+	notificationServiceScenario(t, "Given alert rule with upload image enabled and render exceeds its budget should send notification without image",
+		evalCtxSlowRender, true, func(sc *scenarioContext) {
+			setting.AlertingRenderTimeout = 50 * time.Millisecond
+			defer func() { setting.AlertingRenderTimeout = 0 }()
+
+			var renderTimeout time.Duration
+			sc.renderProvider = func(ctx context.Context, opts rendering.Opts) (*rendering.RenderResult, error) {
+				renderTimeout = opts.Timeout
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(5 * time.Second):
+					return nil, nil
+				}
+			}
+
+			start := time.Now()
+			err := sc.notificationService.SendIfNeeded(evalCtxSlowRender)
+			require.NoError(sc.t, err)
+
+			require.Less(sc.t, int64(time.Since(start)), int64(time.Second), "expected rendering to be cut at its budget")
+			require.Equal(sc.t, 50*time.Millisecond, renderTimeout)
+			require.Equalf(sc.t, 0, sc.renderCount, "expected render not to complete, but it did")
+			require.Equalf(sc.t, 0, sc.imageUploadCount, "expected image not to be uploaded, but it was")
+			require.Empty(sc.t, evalCtxSlowRender.ImageOnDiskPath)
+			require.Truef(sc.t, evalCtxSlowRender.Ctx.Value(notificationSent{}).(bool), "expected notification to be sent, but wasn't")
+		})
+
+	notificationServiceScenario(t, "Given a render budget above the image budget should render within the image budget",
+		evalCtx, true, func(sc *scenarioContext) {
+			setting.AlertingRenderTimeout = time.Minute
+			defer func() { setting.AlertingRenderTimeout = 0 }()
+
+			var renderTimeout time.Duration
+			sc.renderProvider = func(ctx context.Context, opts rendering.Opts) (*rendering.RenderResult, error) {
+				renderTimeout = opts.Timeout
+				return nil, nil
+			}
+			err := sc.notificationService.SendIfNeeded(evalCtx)
+			require.NoError(sc.t, err)
+
+			require.Equal(sc.t, setting.AlertingNotificationTimeout/2, renderTimeout)
+			require.Equalf(sc.t, 1, sc.imageUploadCount, "expected image to be uploaded, but wasn't")
+		})
+
 	notificationServiceScenario(t, "Given alert rule with upload image enabled and upload times out should send notification",
 		evalCtx, true, func(sc *scenarioContext) {
 			setting.AlertingNotificationTimeout = 200 * time.Millisecond
@@ -396,3 +443,80 @@ func (u *testImageUploader) Upload(ctx context.Context, path string) (string, er
 }
 
 var _ imguploader.ImageUploader = &testImageUploader{}
+
+type flakyNotifier struct {
+	testNotifier
+	failures int
+	calls    int
+}
+
+func (n *flakyNotifier) Notify(evalCtx *EvalContext) error {
+	n.calls++
+	if n.calls <= n.failures {
+		return errors.New("service unavailable")
+	}
+	return nil
+}
+
+func TestNotificationServiceRetries(t *testing.T) {
+	origMaxAttempts := setting.AlertingNotificationMaxAttempts
+	t.Cleanup(func() { setting.AlertingNotificationMaxAttempts = origMaxAttempts })
+	setting.AlertingNotificationMaxAttempts = 3
+
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	completed := map[int64]int{}
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		completed[cmd.Id]++
+		return nil
+	})
+
+	newNotifierStates := func(notifiers ...*flakyNotifier) notifierStateSlice {
+		var states notifierStateSlice
+		for i, notifier := range notifiers {
+			states = append(states, &notifierState{notifier: notifier, state: &models.AlertNotificationState{Id: int64(i + 1)}})
+		}
+		return states
+	}
+
+	t.Run("retries the failed notifier only", func(t *testing.T) {
+		completed = map[int64]int{}
+		n := newNotificationService(nil)
+		n.retryDelay = time.Millisecond
+
+		flaky := &flakyNotifier{testNotifier: testNotifier{UID: "flaky"}, failures: 2}
+		healthy := &flakyNotifier{testNotifier: testNotifier{UID: "healthy"}}
+		evalCtx := NewEvalContext(context.Background(), &Rule{}, &validations.OSSPluginRequestValidator{})
+
+		require.NoError(t, n.sendNotifications(evalCtx, newNotifierStates(flaky, healthy)))
+		require.Equal(t, 3, flaky.calls)
+		require.Equal(t, 1, healthy.calls)
+		require.Equal(t, map[int64]int{1: 1, 2: 1}, completed)
+	})
+
+	t.Run("gives up after the max attempts", func(t *testing.T) {
+		completed = map[int64]int{}
+		n := newNotificationService(nil)
+		n.retryDelay = time.Millisecond
+
+		flaky := &flakyNotifier{testNotifier: testNotifier{UID: "flaky"}, failures: 5}
+		evalCtx := NewEvalContext(context.Background(), &Rule{}, &validations.OSSPluginRequestValidator{})
+
+		require.NoError(t, n.sendNotifications(evalCtx, newNotifierStates(flaky)))
+		require.Equal(t, 3, flaky.calls)
+		require.Empty(t, completed)
+	})
+
+	t.Run("does not retry test runs", func(t *testing.T) {
+		n := newNotificationService(nil)
+		n.retryDelay = time.Millisecond
+
+		flaky := &flakyNotifier{testNotifier: testNotifier{UID: "flaky"}, failures: 1}
+		evalCtx := NewEvalContext(context.Background(), &Rule{}, &validations.OSSPluginRequestValidator{})
+		evalCtx.IsTestRun = true
+
+		require.Error(t, n.sendNotifications(evalCtx, newNotifierStates(flaky)))
+		require.Equal(t, 1, flaky.calls)
+	})
+}
@@ -0,0 +1,87 @@
+package alerting
+
+import (
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// notifierlessRules detects the alert rules which send no notification,
+// having no notification channel while their org has no default one, and
+// warns about them or keeps them from being scheduled.
+type notifierlessRules struct {
+	mode string
+	// flagged are the rules already logged, so they are only logged once
+	flagged map[ruleKey]bool
+	log     log.Logger
+}
+
+func newNotifierlessRules(mode string) *notifierlessRules {
+	return &notifierlessRules{
+		mode:    mode,
+		flagged: make(map[ruleKey]bool),
+		log:     log.New("alerting.notifierless"),
+	}
+}
+
+// filter logs the notifierless rules seen for the first time and returns
+// the rules to schedule, which exclude them in skip mode.
+func (n *notifierlessRules) filter(rules []*Rule) []*Rule {
+	if n.mode == setting.NotifierlessRulesAllow {
+		return rules
+	}
+
+	flagged := make(map[ruleKey]bool)
+	hasDefault := make(map[int64]bool)
+	scheduled := make([]*Rule, 0, len(rules))
+	for _, rule := range rules {
+		if len(rule.Notifications) > 0 {
+			scheduled = append(scheduled, rule)
+			continue
+		}
+
+		withDefault, ok := hasDefault[rule.OrgID]
+		if !ok {
+			withDefault = n.orgHasDefaultChannel(rule.OrgID)
+			hasDefault[rule.OrgID] = withDefault
+		}
+		if withDefault {
+			scheduled = append(scheduled, rule)
+			continue
+		}
+
+		flagged[ruleKeyOf(rule)] = true
+		skip := n.mode == setting.NotifierlessRulesSkip
+		if !n.flagged[ruleKeyOf(rule)] {
+			if skip {
+				n.log.Warn("Not scheduling alert rule without notification channels", "ruleId", rule.ID, "orgId", rule.OrgID, "name", rule.Name)
+			} else {
+				n.log.Warn("Alert rule has no notification channels, its state changes will not be notified", "ruleId", rule.ID, "orgId", rule.OrgID, "name", rule.Name)
+			}
+		}
+		if !skip {
+			scheduled = append(scheduled, rule)
+		}
+	}
+
+	n.flagged = flagged
+	return scheduled
+}
+
+// orgHasDefaultChannel returns true if the org has a default notification
+// channel, which notifies the rules without notification channels. The org
+// is assumed to have one when the channels cannot be queried.
+func (n *notifierlessRules) orgHasDefaultChannel(orgID int64) bool {
+	query := &models.GetAlertNotificationsWithUidToSendQuery{OrgId: orgID}
+	if err := bus.Dispatch(query); err != nil {
+		n.log.Error("Could not get the default notification channels", "orgId", orgID, "error", err)
+		return true
+	}
+	for _, notification := range query.Result {
+		if notification.IsDefault {
+			return true
+		}
+	}
+	return false
+}
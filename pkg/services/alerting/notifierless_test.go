@@ -0,0 +1,77 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineNotifierlessRules(t *testing.T) {
+	origMode := setting.AlertingNotifierlessRules
+	t.Cleanup(func() { setting.AlertingNotifierlessRules = origMode })
+
+	// org 2 has a default notification channel
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = nil
+		if query.OrgId == 2 {
+			query.Result = []*models.AlertNotification{{Uid: "default", IsDefault: true}}
+		}
+		return nil
+	})
+
+	rules := func() []*Rule {
+		return []*Rule{
+			{ID: 1, OrgID: 1, Frequency: 10, Notifications: []string{"pager"}},
+			{ID: 2, OrgID: 1, Frequency: 10},
+			{ID: 3, OrgID: 2, Frequency: 10},
+		}
+	}
+	scheduledIDs := func(engine *AlertEngine) []int64 {
+		var ids []int64
+		for _, info := range engine.ScheduleSnapshot() {
+			ids = append(ids, info.RuleID)
+		}
+		return ids
+	}
+
+	t.Run("warn mode schedules the rules and warns once", func(t *testing.T) {
+		setting.AlertingNotifierlessRules = setting.NotifierlessRulesWarn
+		engine := newRunnableEngine(t)
+		logger := &recordingLogger{}
+		engine.notifierless.log = logger
+
+		engine.ruleReader = &fakeRuleReader{rules: rules()}
+		engine.updateRules("localhost")
+		engine.updateRules("localhost")
+
+		require.Equal(t, []int64{1, 2, 3}, scheduledIDs(engine))
+		require.Len(t, logger.warnings, 1)
+		require.Contains(t, logger.warnings[0], "ruleId2")
+	})
+
+	t.Run("skip mode doesn't schedule the rules", func(t *testing.T) {
+		setting.AlertingNotifierlessRules = setting.NotifierlessRulesSkip
+		engine := newRunnableEngine(t)
+		logger := &recordingLogger{}
+		engine.notifierless.log = logger
+
+		engine.ruleReader = &fakeRuleReader{rules: rules()}
+		engine.updateRules("localhost")
+		engine.updateRules("localhost")
+
+		require.Equal(t, []int64{1, 3}, scheduledIDs(engine))
+		require.Len(t, logger.warnings, 1)
+		require.Contains(t, logger.warnings[0], "Not scheduling")
+
+		// the rule is scheduled once a notification channel is attached
+		withChannel := rules()
+		withChannel[1].Notifications = []string{"email"}
+		engine.ruleReader = &fakeRuleReader{rules: withChannel}
+		engine.updateRules("localhost")
+		require.Equal(t, []int64{1, 2, 3}, scheduledIDs(engine))
+	})
+}
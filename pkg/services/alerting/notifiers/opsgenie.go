@@ -188,6 +188,9 @@ func (on *OpsGenieNotifier) createAlert(evalContext *alerting.EvalContext) error
 			}
 		}
 	}
+	if evalContext.IdempotencyKey != "" {
+		details.Set("idempotencyKey", evalContext.IdempotencyKey)
+	}
 	bodyJSON.Set("tags", tags)
 	bodyJSON.Set("details", details)
 
@@ -182,6 +182,9 @@ func (pn *PagerdutyNotifier) buildEventPayload(evalContext *alerting.EvalContext
 		payloadJSON.Set("source", hostname)
 	}
 	payloadJSON.Set("timestamp", time.Now())
+	if evalContext.IdempotencyKey != "" {
+		customData.Set("idempotency_key", evalContext.IdempotencyKey)
+	}
 	payloadJSON.Set("custom_details", customData)
 	bodyJSON := simplejson.New()
 	bodyJSON.Set("routing_key", pn.Key)
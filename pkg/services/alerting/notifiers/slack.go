@@ -354,6 +354,21 @@ func (sn *SlackNotifier) sendRequest(ctx context.Context, data []byte) error {
 		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", sn.token))
 	}
 
+	// the request is recorded rather than sent when the notifications are rendered
+	header := make(map[string]string, len(request.Header))
+	for name := range request.Header {
+		header[name] = request.Header.Get(name)
+	}
+	if models.RecordNotification(ctx, &models.SendWebhookSync{
+		Url:         sn.url.String(),
+		Body:        string(data),
+		HttpMethod:  http.MethodPost,
+		HttpHeader:  header,
+		ContentType: "application/json",
+	}) {
+		return nil
+	}
+
 	netTransport := &http.Transport{
 		TLSClientConfig: &tls.Config{
 			Renegotiation: tls.RenegotiateFreelyAsClient,
@@ -1,11 +1,18 @@
 package notifiers
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/components/securejsondata"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/services/alerting"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -214,3 +221,56 @@ func TestSlackNotifier(t *testing.T) {
 		assert.Equal(t, "1ABCDE", slackNotifier.recipient)
 	})
 }
+
+type slackTestCondition struct{}
+
+func (slackTestCondition) Eval(*alerting.EvalContext, plugins.DataRequestHandler) (*alerting.ConditionResult, error) {
+	return &alerting.ConditionResult{}, nil
+}
+
+func TestSlackNotifierRenderNotifications(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the Slack request should not be sent when rendering the notifications")
+	}))
+	t.Cleanup(server.Close)
+
+	alerting.RegisterCondition("slack-test", func(model *simplejson.Json, index int) (alerting.Condition, error) {
+		return slackTestCondition{}, nil
+	})
+	settings, err := simplejson.NewJson([]byte(`{
+		"notifications": [{"uid": "slack"}],
+		"conditions": [{"type": "slack-test"}]
+	}`))
+	require.NoError(t, err)
+	bus.AddHandler("test", func(query *models.GetAlertByIdQuery) error {
+		query.Result = &models.Alert{Id: query.Id, OrgId: 1, Name: "High CPU", Message: "CPU usage is above 90%", Settings: settings, State: models.AlertStateOK}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = []*models.AlertNotification{
+			{Uid: "slack", Type: "slack", Settings: simplejson.NewFromAny(map[string]interface{}{"url": server.URL, "token": "xoxb-token", "uploadImage": false})},
+		}
+		return nil
+	})
+	bus.AddHandlerCtx("alerting", func(ctx context.Context, cmd *models.SendWebhookSync) error {
+		if models.RecordNotification(ctx, cmd) {
+			return nil
+		}
+		return errors.New("the webhook request should not be sent")
+	})
+
+	engine := &alerting.AlertEngine{}
+	payloads, err := engine.RenderNotifications(42, models.AlertStateAlerting)
+	require.NoError(t, err)
+	require.Len(t, payloads, 1)
+	require.NoError(t, payloads[0].Error)
+	require.Len(t, payloads[0].Webhooks, 1)
+
+	webhook := payloads[0].Webhooks[0]
+	assert.Equal(t, server.URL, webhook.Url)
+	assert.Equal(t, http.MethodPost, webhook.HttpMethod)
+	assert.Equal(t, "Bearer xoxb-token", webhook.HttpHeader["Authorization"])
+	body, err := simplejson.NewJson([]byte(webhook.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "[Alerting] High CPU", body.Get("text").MustString())
+}
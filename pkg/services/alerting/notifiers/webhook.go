@@ -100,6 +100,9 @@ func (wn *WebhookNotifier) Notify(evalContext *alerting.EvalContext) error {
 	bodyJSON.Set("orgId", evalContext.Rule.OrgID)
 	bodyJSON.Set("dashboardId", evalContext.Rule.DashboardID)
 	bodyJSON.Set("panelId", evalContext.Rule.PanelID)
+	if evalContext.ConfigVersion != "" {
+		bodyJSON.Set("configVersion", evalContext.ConfigVersion)
+	}
 
 	tags := make(map[string]string)
 
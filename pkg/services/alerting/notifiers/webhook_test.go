@@ -1,10 +1,14 @@
 package notifiers
 
 import (
+	"context"
 	"testing"
 
+	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/alerting"
+	"github.com/grafana/grafana/pkg/services/validations"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -45,3 +49,37 @@ func TestWebhookNotifier_parsingFromSettings(t *testing.T) {
 		assert.Equal(t, "http://google.com", webhookNotifier.URL)
 	})
 }
+
+func TestWebhookNotifier_configVersion(t *testing.T) {
+	settingsJSON, err := simplejson.NewJson([]byte(`{"url": "http://google.com"}`))
+	require.NoError(t, err)
+	not, err := NewWebHookNotifier(&models.AlertNotification{Name: "ops", Type: "webhook", Settings: settingsJSON})
+	require.NoError(t, err)
+
+	bus.AddHandler("test", func(query *models.GetDashboardRefByIdQuery) error {
+		query.Result = &models.DashboardRef{Uid: "ops", Slug: "ops"}
+		return nil
+	})
+	var body *simplejson.Json
+	bus.AddHandlerCtx("alerting", func(ctx context.Context, cmd *models.SendWebhookSync) error {
+		body, err = simplejson.NewJson([]byte(cmd.Body))
+		return err
+	})
+
+	t.Run("carries the config version of the rule", func(t *testing.T) {
+		rule := &alerting.Rule{ID: 1, Name: "rule", State: models.AlertStateAlerting, ConfigVersion: "9f2c1e"}
+		evalContext := alerting.NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+
+		require.NoError(t, not.Notify(evalContext))
+		assert.Equal(t, "9f2c1e", body.Get("configVersion").MustString())
+	})
+
+	t.Run("omits the config version when unknown", func(t *testing.T) {
+		rule := &alerting.Rule{ID: 1, Name: "rule", State: models.AlertStateAlerting}
+		evalContext := alerting.NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+
+		require.NoError(t, not.Notify(evalContext))
+		_, ok := body.CheckGet("configVersion")
+		assert.False(t, ok)
+	})
+}
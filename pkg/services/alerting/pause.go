@@ -0,0 +1,72 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ErrEmptyPauseSelector is returned when pausing the alert rules by label
+// without any label, use the pause of all the alert rules instead.
+var ErrEmptyPauseSelector = errors.New("pausing alert rules by label needs at least one label")
+
+// pauseSelector returns the selector of the alert rules whose tags have
+// all the values of the labels.
+func pauseSelector(labels map[string]string) (labelSelector, error) {
+	if len(labels) == 0 {
+		return nil, ErrEmptyPauseSelector
+	}
+
+	selector := make(labelSelector, 0, len(labels))
+	for key, value := range labels {
+		if key == "" {
+			return nil, fmt.Errorf("invalid pause selector: empty label for value %q", value)
+		}
+		selector = append(selector, labelMatcher{key: key, value: value})
+	}
+	sort.Slice(selector, func(i, j int) bool { return selector[i].key < selector[j].key })
+	return selector, nil
+}
+
+// SetPausedByLabel pauses or resumes the alert rules loaded by the engine
+// whose tags have all the values of the selector, e.g. all the rules of
+// a team during a maintenance. The rules are updated in a single
+// transaction and the number of rules whose state changed is returned,
+// the rules already in the requested state are left as is. The rules are
+// reloaded on the next tick for the change to take effect.
+func (e *AlertEngine) SetPausedByLabel(selector map[string]string, paused bool) (int, error) {
+	matchers, err := pauseSelector(selector)
+	if err != nil {
+		return 0, err
+	}
+
+	rules, err := e.ruleReader.fetch()
+	if err != nil {
+		return 0, err
+	}
+
+	var ids []int64
+	for _, rule := range rules {
+		if !matchers.matches(rule) || (rule.State == models.AlertStatePaused) == paused {
+			continue
+		}
+		ids = append(ids, rule.ID)
+	}
+	if len(ids) == 0 {
+		e.log.Info("No alert rule to pause or resume", "selector", selector, "paused", paused)
+		return 0, nil
+	}
+
+	cmd := &models.PauseAlertCommand{AlertIds: ids, Paused: paused}
+	if err := bus.Dispatch(cmd); err != nil {
+		return 0, err
+	}
+	atomic.StoreInt32(&e.rulesChanged, 1)
+
+	e.log.Info("Alert rules paused or resumed by label", "selector", selector, "paused", paused, "count", len(ids))
+	return len(ids), nil
+}
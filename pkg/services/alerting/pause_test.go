@@ -0,0 +1,141 @@
+package alerting
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+// storedRuleReader returns copies of the stored rules, as the rules are
+// read from the database on every fetch.
+type storedRuleReader struct {
+	mtx   sync.Mutex
+	rules []Rule
+}
+
+func (r *storedRuleReader) fetch() ([]*Rule, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	rules := make([]*Rule, 0, len(r.rules))
+	for i := range r.rules {
+		rule := r.rules[i]
+		rules = append(rules, &rule)
+	}
+	return rules, nil
+}
+
+func (r *storedRuleReader) pause(cmd *models.PauseAlertCommand) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, id := range cmd.AlertIds {
+		for i := range r.rules {
+			if r.rules[i].ID != id {
+				continue
+			}
+			if cmd.Paused {
+				r.rules[i].State = models.AlertStatePaused
+			} else {
+				r.rules[i].State = models.AlertStateUnknown
+			}
+		}
+	}
+	cmd.ResultCount = int64(len(cmd.AlertIds))
+	return nil
+}
+
+func TestPauseSelector(t *testing.T) {
+	t.Run("an empty selector is rejected", func(t *testing.T) {
+		_, err := pauseSelector(map[string]string{})
+		require.Equal(t, ErrEmptyPauseSelector, err)
+	})
+
+	t.Run("an empty label is rejected", func(t *testing.T) {
+		_, err := pauseSelector(map[string]string{"": "payments"})
+		require.Error(t, err)
+	})
+
+	t.Run("rules need all the labels", func(t *testing.T) {
+		selector, err := pauseSelector(map[string]string{"team": "payments", "env": "prod"})
+		require.NoError(t, err)
+
+		both := &Rule{AlertRuleTags: []*models.Tag{{Key: "team", Value: "payments"}, {Key: "env", Value: "prod"}}}
+		team := &Rule{AlertRuleTags: []*models.Tag{{Key: "team", Value: "payments"}}}
+		require.True(t, selector.matches(both))
+		require.False(t, selector.matches(team))
+	})
+}
+
+func TestEngineSetPausedByLabel(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	payments := []*models.Tag{{Key: "team", Value: "payments"}}
+	reader := &storedRuleReader{rules: []Rule{
+		{ID: 1, Name: "payments latency", Frequency: 1, State: models.AlertStateOK, AlertRuleTags: payments},
+		{ID: 2, Name: "payments errors", Frequency: 1, State: models.AlertStateOK, AlertRuleTags: payments},
+		{ID: 3, Name: "search latency", Frequency: 1, State: models.AlertStateOK,
+			AlertRuleTags: []*models.Tag{{Key: "team", Value: "search"}}},
+	}}
+	bus.AddHandler("test", reader.pause)
+
+	engine := newRunnableEngine(t)
+	mock := clock.NewMock()
+	mock.Set(time.Unix(1000, 0))
+	engine.clock = mock
+	ticks := make(chan time.Time)
+	engine.ticker = &Ticker{C: ticks}
+	engine.ruleReader = reader
+	engine.evalHandler = &slowEvalHandler{}
+	resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 100)}
+	engine.resultHandler = resultHandler
+	engine.notifierless = newNotifierlessRules(setting.NotifierlessRulesAllow)
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- engine.Run(context.Background()) }()
+
+	// evaluated returns the rules evaluated over a few ticks
+	evaluated := func() map[int64]bool {
+		rules := make(map[int64]bool)
+		for i := 0; i < 4; i++ {
+			ticks <- mock.Now()
+			mock.Add(time.Second)
+		}
+		for {
+			select {
+			case evalContext := <-resultHandler.handled:
+				rules[evalContext.Rule.ID] = true
+			case <-time.After(100 * time.Millisecond):
+				return rules
+			}
+		}
+	}
+
+	require.Equal(t, map[int64]bool{1: true, 2: true, 3: true}, evaluated())
+
+	affected, err := engine.SetPausedByLabel(map[string]string{"team": "payments"}, true)
+	require.NoError(t, err)
+	require.Equal(t, 2, affected)
+	require.Equal(t, map[int64]bool{3: true}, evaluated())
+
+	t.Run("rules already paused are not affected", func(t *testing.T) {
+		affected, err := engine.SetPausedByLabel(map[string]string{"team": "payments"}, true)
+		require.NoError(t, err)
+		require.Equal(t, 0, affected)
+	})
+
+	affected, err = engine.SetPausedByLabel(map[string]string{"team": "payments"}, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, affected)
+	require.Equal(t, map[int64]bool{1: true, 2: true, 3: true}, evaluated())
+
+	require.NoError(t, engine.Stop(context.Background()))
+	require.NoError(t, <-runErr)
+}
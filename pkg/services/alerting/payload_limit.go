@@ -0,0 +1,42 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// ErrResultTooLarge is returned when the datasources return more datapoints
+// than an evaluation processes, see setting.AlertingMaxEvalDatapoints. The
+// evaluations failing with it are not retried, the datasources returning as
+// many datapoints on the next attempts.
+var ErrResultTooLarge = errors.New("result too large")
+
+// CountDatapoints counts the datapoints returned by the datasources to the
+// conditions of the evaluation, which are consumed as they are counted. It
+// returns ErrResultTooLarge once the evaluation has more datapoints than the
+// maximum, for the condition to stop consuming the response of its query.
+func (c *EvalContext) CountDatapoints(n int64) error {
+	limit := setting.AlertingMaxEvalDatapoints
+	if limit <= 0 {
+		return nil
+	}
+
+	count := n
+	if c.datapoints != nil {
+		// the conditions of the rule may be evaluated concurrently
+		count = atomic.AddInt64(c.datapoints, n)
+	}
+	if count > limit {
+		return fmt.Errorf("%w: the queries returned more than %d datapoints", ErrResultTooLarge, limit)
+	}
+	return nil
+}
+
+// isRetryable returns false if the evaluation error would happen again on
+// the next attempts.
+func isRetryable(err error) bool {
+	return !isConfigError(err) && !errors.Is(err, ErrResultTooLarge)
+}
@@ -0,0 +1,76 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+// datapointsEvalHandler evaluates the rules as returning the datapoints.
+type datapointsEvalHandler struct {
+	datapoints int64
+	calls      int
+}
+
+func (h *datapointsEvalHandler) Eval(evalContext *EvalContext) {
+	h.calls++
+	evalContext.Error = evalContext.CountDatapoints(h.datapoints)
+	evalContext.EndTime = time.Now()
+}
+
+func TestEvalContextCountDatapoints(t *testing.T) {
+	origMaxDatapoints := setting.AlertingMaxEvalDatapoints
+	t.Cleanup(func() { setting.AlertingMaxEvalDatapoints = origMaxDatapoints })
+
+	t.Run("no limit", func(t *testing.T) {
+		setting.AlertingMaxEvalDatapoints = 0
+		evalContext := NewEvalContext(context.Background(), &Rule{}, &validations.OSSPluginRequestValidator{})
+		require.NoError(t, evalContext.CountDatapoints(1e9))
+	})
+
+	t.Run("the datapoints of the copies of the context are counted together", func(t *testing.T) {
+		setting.AlertingMaxEvalDatapoints = 1000
+		evalContext := NewEvalContext(context.Background(), &Rule{}, &validations.OSSPluginRequestValidator{})
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(windowContext EvalContext) {
+				defer wg.Done()
+				require.NoError(t, windowContext.CountDatapoints(100))
+			}(*evalContext)
+		}
+		wg.Wait()
+
+		err := evalContext.CountDatapoints(1)
+		require.True(t, errors.Is(err, ErrResultTooLarge))
+		require.EqualError(t, err, "result too large: the queries returned more than 1000 datapoints")
+	})
+}
+
+func TestEngineResultTooLarge(t *testing.T) {
+	origMaxDatapoints := setting.AlertingMaxEvalDatapoints
+	t.Cleanup(func() { setting.AlertingMaxEvalDatapoints = origMaxDatapoints })
+	setting.AlertingMaxEvalDatapoints = 1000
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 3
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+	engine.resultHandler = resultHandler
+	engine.resultQueue = nil
+	evalHandler := &datapointsEvalHandler{datapoints: 1001}
+	engine.evalHandler = evalHandler
+
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 1}}))
+	require.Equal(t, 1, evalHandler.calls, "the evaluation is not retried")
+	evalContext := <-resultHandler.handled
+	require.ErrorIs(t, evalContext.Error, ErrResultTooLarge)
+}
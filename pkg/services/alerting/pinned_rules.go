@@ -0,0 +1,193 @@
+package alerting
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+)
+
+// clusterPresenceKeyPrefix prefixes the keys of the records the cluster
+// alerting instances announce their presence with in the remote cache.
+const clusterPresenceKeyPrefix = "cluster_alerting_presence_"
+
+// minPresenceTTL is the minimum time the presence of an instance lasts for
+// without being announced again, long enough for the instances to announce
+// it on every refresh of the rules.
+const minPresenceTTL = 30 * time.Second
+
+// UnschedulableRule is an alert rule pinned to a cluster alerting instance
+// which is not running, which no instance evaluates.
+type UnschedulableRule struct {
+	RuleID         int64
+	OrgID          int64
+	Name           string
+	PinnedInstance string
+	// Since is the time the rule was first found unschedulable.
+	Since time.Time
+}
+
+// pinnedRules restricts the rules pinned to a cluster alerting instance to
+// that instance, and keeps track of the pinned rules whose instance is not
+// running. The instances announce their presence in the remote cache for
+// the others to tell whether an instance is running.
+type pinnedRules struct {
+	mtx   sync.Mutex
+	cache remotecache.CacheStorage
+	ttl   time.Duration
+	log   log.Logger
+
+	// active is whether the instance is the active instance, with the lease
+	// based clustering, and local the number of rules pinned to the instance.
+	active        bool
+	local         int
+	unschedulable map[ruleKey]*UnschedulableRule
+}
+
+func newPinnedRules(cache remotecache.CacheStorage, ttl time.Duration) *pinnedRules {
+	if ttl < minPresenceTTL {
+		ttl = minPresenceTTL
+	}
+	return &pinnedRules{
+		cache:         cache,
+		ttl:           ttl,
+		log:           log.New("alerting.pinnedRules"),
+		unschedulable: make(map[ruleKey]*UnschedulableRule),
+	}
+}
+
+// observe announces the presence of the instance, and records the rules
+// pinned to the instances which are not running.
+func (p *pinnedRules) observe(rules []*Rule, instance string, now time.Time) {
+	if p.cache == nil {
+		// the presence of the other instances cannot be told
+		return
+	}
+	if err := p.cache.Set(clusterPresenceKeyPrefix+instance, &ClusterAlertingInstance{Instance: instance}, p.ttl); err != nil {
+		p.log.Warn("Alert Clustering: Could not announce the presence of the instance", "instance", instance, "err", err)
+	}
+
+	present := map[string]bool{instance: true}
+	unschedulable := make(map[ruleKey]*UnschedulableRule)
+
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	for _, rule := range rules {
+		if rule.PinnedInstance == "" || rule.PinnedInstance == instance {
+			continue
+		}
+
+		running, ok := present[rule.PinnedInstance]
+		if !ok {
+			_, err := p.cache.Get(clusterPresenceKeyPrefix + rule.PinnedInstance)
+			if err != nil && !errors.Is(err, remotecache.ErrCacheItemNotFound) {
+				p.log.Warn("Alert Clustering: Could not retrieve the presence of the instance", "instance", rule.PinnedInstance, "err", err)
+				// keep the previous status of the rules rather than flagging them
+				running = p.unschedulableOn(rule.PinnedInstance) == 0
+			} else {
+				running = err == nil
+			}
+			present[rule.PinnedInstance] = running
+		}
+		if running {
+			continue
+		}
+
+		key := ruleKeyOf(rule)
+		if previous, ok := p.unschedulable[key]; ok && previous.PinnedInstance == rule.PinnedInstance {
+			unschedulable[key] = previous
+			continue
+		}
+		p.log.Warn("Alert rule is pinned to an instance which is not running, no instance evaluates it", "ruleId", rule.ID, "name", rule.Name, "pinnedInstance", rule.PinnedInstance)
+		unschedulable[key] = &UnschedulableRule{RuleID: rule.ID, OrgID: rule.OrgID, Name: rule.Name, PinnedInstance: rule.PinnedInstance, Since: now}
+	}
+	p.unschedulable = unschedulable
+}
+
+// unschedulableOn returns the number of rules found unschedulable because
+// they are pinned to the instance.
+func (p *pinnedRules) unschedulableOn(instance string) int {
+	count := 0
+	for _, rule := range p.unschedulable {
+		if rule.PinnedInstance == instance {
+			count++
+		}
+	}
+	return count
+}
+
+// filter returns the rules evaluated by the instance with the lease based
+// clustering: the ones pinned to the instance, along with the rules not
+// pinned while the instance is active. All the rules not pinned to another
+// instance are scheduled when no rule is pinned to the instance, for the
+// standby instances to take over right away.
+func (p *pinnedRules) filter(rules []*Rule, instance string) []*Rule {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	local := 0
+	for _, rule := range rules {
+		if rule.PinnedInstance == instance {
+			local++
+		}
+	}
+	p.local = local
+
+	filtered := make([]*Rule, 0, len(rules))
+	for _, rule := range rules {
+		switch {
+		case rule.PinnedInstance == instance:
+		case rule.PinnedInstance != "":
+			continue
+		case local > 0 && !p.active:
+			continue
+		}
+		filtered = append(filtered, rule)
+	}
+	return filtered
+}
+
+// setActive records whether the instance is the active instance, and
+// returns true if the rules it evaluates changed with it.
+func (p *pinnedRules) setActive(active bool) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	changed := p.active != active && p.local > 0
+	p.active = active
+	return changed
+}
+
+// hasLocal returns true if rules are pinned to the instance.
+func (p *pinnedRules) hasLocal() bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.local > 0
+}
+
+func (p *pinnedRules) list() []UnschedulableRule {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	rules := make([]UnschedulableRule, 0, len(p.unschedulable))
+	for _, rule := range p.unschedulable {
+		rules = append(rules, *rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].RuleID != rules[j].RuleID {
+			return rules[i].RuleID < rules[j].RuleID
+		}
+		return rules[i].OrgID < rules[j].OrgID
+	})
+	return rules
+}
+
+// UnschedulableRules returns the alert rules pinned to a cluster alerting
+// instance which is not running, as of the last time the rules were loaded,
+// ordered by rule id. No instance evaluates them until theirs is running.
+func (e *AlertEngine) UnschedulableRules() []UnschedulableRule {
+	return e.pinned.list()
+}
@@ -0,0 +1,86 @@
+package alerting
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnginePinnedRules(t *testing.T) {
+	origEnabled := setting.AlertingClusteringEnabled
+	t.Cleanup(func() { setting.AlertingClusteringEnabled = origEnabled })
+	setting.AlertingClusteringEnabled = true
+
+	reader := &fakeRuleReader{rules: []*Rule{
+		{ID: 1, OrgID: 1, Frequency: 10, State: models.AlertStateOK},
+		{ID: 2, OrgID: 1, Frequency: 10, State: models.AlertStateOK, PinnedInstance: "instance-b"},
+		{ID: 3, OrgID: 1, Frequency: 10, State: models.AlertStateOK, PinnedInstance: "instance-c"},
+	}}
+	cache := newFakeClusterCache()
+	newEngine := func() *AlertEngine {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.ruleReader = reader
+		engine.notifierless = newNotifierlessRules(setting.NotifierlessRulesAllow)
+		engine.pinned = newPinnedRules(cache, 0)
+		return engine
+	}
+	scheduled := func(engine *AlertEngine) []int64 {
+		var ids []int64
+		for _, rule := range engine.ScheduleSnapshot() {
+			ids = append(ids, rule.RuleID)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids
+	}
+
+	t.Run("with the lease", func(t *testing.T) {
+		engineA, engineB := newEngine(), newEngine()
+		require.False(t, engineA.pinned.setActive(true))
+
+		require.NoError(t, engineB.refreshRules("instance-b"))
+		require.NoError(t, engineA.refreshRules("instance-a"))
+		require.Equal(t, []int64{1}, scheduled(engineA), "the active instance doesn't evaluate the rules pinned to others")
+		require.Equal(t, []int64{2}, scheduled(engineB), "the standby instance evaluates its pinned rules only")
+		require.True(t, engineB.pinned.hasLocal())
+		require.False(t, engineA.pinned.hasLocal())
+
+		unschedulable := engineA.UnschedulableRules()
+		require.Len(t, unschedulable, 1, "the rule pinned to an absent instance is unschedulable")
+		require.Equal(t, int64(3), unschedulable[0].RuleID)
+		require.Equal(t, "instance-c", unschedulable[0].PinnedInstance)
+
+		// instance-b takes over the lease
+		require.True(t, engineB.pinned.setActive(true), "the rules of the instance change with its status")
+		require.NoError(t, engineB.refreshRules("instance-b"))
+		require.Equal(t, []int64{1, 2}, scheduled(engineB))
+	})
+
+	t.Run("with explicit assignments", func(t *testing.T) {
+		engineA, engineB := newEngine(), newEngine()
+		partition, err := newWorkPartition(map[string]string{"instance-a": "rule=1-3"}, nil, "instance-a")
+		require.NoError(t, err)
+		engineA.partition, engineB.partition = partition, partition
+
+		require.NoError(t, engineA.refreshRules("instance-a"))
+		require.NoError(t, engineB.refreshRules("instance-b"))
+		require.Equal(t, []int64{1}, scheduled(engineA), "the pinned rules win over the assignments")
+		require.Equal(t, []int64{2}, scheduled(engineB))
+		require.Equal(t, []int64{3}, engineB.ClusterAssignment()["instance-c"])
+		require.Len(t, engineB.UnschedulableRules(), 1)
+	})
+
+	t.Run("the instance comes back", func(t *testing.T) {
+		engineA, engineC := newEngine(), newEngine()
+		require.NoError(t, engineA.refreshRules("instance-a"))
+		require.Len(t, engineA.UnschedulableRules(), 1)
+
+		require.NoError(t, engineC.refreshRules("instance-c"))
+		require.Equal(t, []int64{3}, scheduled(engineC))
+		require.NoError(t, engineA.refreshRules("instance-a"))
+		require.Empty(t, engineA.UnschedulableRules())
+	})
+}
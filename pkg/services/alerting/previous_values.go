@@ -0,0 +1,64 @@
+package alerting
+
+import (
+	"sync"
+
+	"github.com/grafana/grafana/pkg/components/null"
+)
+
+// SeriesValues are the reduced values of the series of the conditions of
+// an alert rule, by condition index and series key.
+type SeriesValues map[int]map[string]null.Float
+
+// previousValues keeps the reduced values of the last successful evaluation
+// of the rules whose conditions compare the series with their previous
+// value, e.g. to fire when the value increased by half since the last
+// evaluation. Only the scheduled rules are retained.
+type previousValues struct {
+	sync.RWMutex
+	values map[ruleKey]SeriesValues
+}
+
+func newPreviousValues() *previousValues {
+	return &previousValues{values: make(map[ruleKey]SeriesValues)}
+}
+
+// record keeps the values of the evaluation, unless it failed.
+func (p *previousValues) record(evalContext *EvalContext) {
+	if evalContext.Error != nil || len(evalContext.SeriesValues) == 0 {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.values[ruleKeyOf(evalContext.Rule)] = evalContext.SeriesValues
+}
+
+func (p *previousValues) get(rule *Rule) SeriesValues {
+	p.RLock()
+	defer p.RUnlock()
+	return p.values[ruleKeyOf(rule)]
+}
+
+// prune forgets the rules that are no longer scheduled.
+func (p *previousValues) prune(rules []*Rule) {
+	scheduled := make(map[ruleKey]bool, len(rules))
+	for _, rule := range rules {
+		scheduled[ruleKeyOf(rule)] = true
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	for key := range p.values {
+		if !scheduled[key] {
+			delete(p.values, key)
+		}
+	}
+}
+
+// PreviousValue returns the reduced value the series of the condition had
+// on the last successful evaluation of the rule, if the condition tracked it.
+func (c *EvalContext) PreviousValue(conditionIndex int, series string) (null.Float, bool) {
+	value, ok := c.PreviousSeriesValues[conditionIndex][series]
+	return value, ok
+}
@@ -0,0 +1,80 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+// deltaCondition fires when its value grew by more than its delta since the
+// previous evaluation of the rule.
+type deltaCondition struct {
+	value float64
+	delta float64
+	err   error
+}
+
+func (c *deltaCondition) Eval(context *EvalContext, _ plugins.DataRequestHandler) (*ConditionResult, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	result := &ConditionResult{Values: map[string]null.Float{"requests": null.FloatFrom(c.value)}}
+	if previous, ok := context.PreviousValue(0, "requests"); ok && c.value-previous.Float64 > c.delta {
+		result.Firing = true
+		result.EvalMatches = []*EvalMatch{{Metric: "requests", Value: null.FloatFrom(c.value)}}
+	}
+	return result, nil
+}
+
+func TestEnginePreviousValues(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.evalHandler = NewEvalHandler(nil)
+	engine.resultHandler = &FakeResultHandler{}
+
+	condition := &deltaCondition{value: 100, delta: 10}
+	rule := &Rule{ID: 1, OrgID: 1, Conditions: []Condition{condition}}
+	eval := func() *EvaluationDetails {
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}))
+		details, ok := engine.LastEvaluation(1, 1)
+		require.True(t, ok)
+		return details
+	}
+
+	require.False(t, eval().Firing, "there is no previous value on the first evaluation")
+
+	condition.value = 115
+	require.True(t, eval().Firing, "the value grew by 15 since the previous evaluation")
+
+	condition.value = 120
+	require.False(t, eval().Firing, "the value grew by 5 since the previous evaluation")
+
+	t.Run("keeps the values of the last successful evaluation", func(t *testing.T) {
+		condition.err = errors.New("query failed")
+		eval()
+		require.Equal(t, null.FloatFrom(120), engine.previousValues.get(rule)[0]["requests"])
+		condition.err = nil
+
+		condition.value = 135
+		require.True(t, eval().Firing)
+	})
+
+	t.Run("forgets the rules no longer scheduled", func(t *testing.T) {
+		engine.previousValues.prune([]*Rule{{ID: 2}})
+		require.Nil(t, engine.previousValues.get(rule))
+
+		condition.value = 200
+		require.False(t, eval().Firing)
+	})
+}
@@ -0,0 +1,138 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+)
+
+// queryCache caches the datasource responses of the rules evaluated more
+// often than the resolution of their data, which would otherwise query the
+// same data over and over. The responses of a rule are cached for the time
+// bucket of the evaluation, aligned to the resolution, so that a rule
+// evaluated every 5s against a metric scraped every minute only queries its
+// datasource once a minute.
+type queryCache struct {
+	mtx   sync.Mutex
+	rules map[ruleKey]*ruleQueryCache
+}
+
+// ruleQueryCache holds the responses of a rule for a time bucket, by query.
+type ruleQueryCache struct {
+	bucket     time.Time
+	resolution time.Duration
+	responses  map[string]plugins.DataResponse
+}
+
+func newQueryCache() *queryCache {
+	return &queryCache{rules: make(map[ruleKey]*ruleQueryCache)}
+}
+
+// handler returns the request handler caching the responses of the rule for
+// the time bucket of the evaluation.
+func (c *queryCache) handler(rule *Rule, evalTime time.Time, next plugins.DataRequestHandler) plugins.DataRequestHandler {
+	resolution := rule.QueryCacheResolution
+	return &cachingRequestHandler{cache: c, rule: ruleKeyOf(rule), resolution: resolution, bucket: evalTime.Truncate(resolution), next: next}
+}
+
+func (c *queryCache) get(rule ruleKey, bucket time.Time, key string) (plugins.DataResponse, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.rules[rule]
+	if !ok || !entry.bucket.Equal(bucket) {
+		return plugins.DataResponse{}, false
+	}
+	resp, ok := entry.responses[key]
+	return resp, ok
+}
+
+func (c *queryCache) set(rule ruleKey, resolution time.Duration, bucket time.Time, key string, resp plugins.DataResponse) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.rules[rule]
+	switch {
+	case ok && entry.bucket.Equal(bucket):
+	case ok && entry.bucket.After(bucket):
+		// a later evaluation moved on to the next bucket already
+		return
+	default:
+		entry = &ruleQueryCache{bucket: bucket, resolution: resolution, responses: make(map[string]plugins.DataResponse)}
+		c.rules[rule] = entry
+		c.expire(bucket)
+	}
+	entry.responses[key] = resp
+}
+
+// expire drops the responses of the buckets over by the time of the bucket,
+// e.g. the ones of the deleted rules.
+func (c *queryCache) expire(now time.Time) {
+	for rule, entry := range c.rules {
+		if !entry.bucket.Add(entry.resolution).After(now) {
+			delete(c.rules, rule)
+		}
+	}
+}
+
+type cachingRequestHandler struct {
+	cache      *queryCache
+	rule       ruleKey
+	resolution time.Duration
+	bucket     time.Time
+	next       plugins.DataRequestHandler
+}
+
+//nolint: staticcheck // plugins.DataQuery deprecated
+func (h *cachingRequestHandler) HandleRequest(ctx context.Context, ds *models.DataSource, query plugins.DataQuery) (plugins.DataResponse, error) {
+	key, err := queryCacheKey(ds, query)
+	if err != nil {
+		return h.next.HandleRequest(ctx, ds, query)
+	}
+	if resp, ok := h.cache.get(h.rule, h.bucket, key); ok {
+		return resp, nil
+	}
+
+	resp, err := h.next.HandleRequest(ctx, ds, query)
+	if err != nil {
+		return resp, err
+	}
+	h.cache.set(h.rule, h.resolution, h.bucket, key, resp)
+	return resp, nil
+}
+
+// queryCacheKey identifies the query of a datasource by its time range and
+// its subqueries.
+//nolint: staticcheck // plugins.DataQuery deprecated
+func queryCacheKey(ds *models.DataSource, query plugins.DataQuery) (string, error) {
+	type subQueryKey struct {
+		RefID         string           `json:"refId"`
+		Model         *simplejson.Json `json:"model"`
+		MaxDataPoints int64            `json:"maxDataPoints"`
+		IntervalMS    int64            `json:"intervalMs"`
+		QueryType     string           `json:"queryType"`
+	}
+	key := struct {
+		DatasourceID int64         `json:"datasourceId"`
+		From         string        `json:"from"`
+		To           string        `json:"to"`
+		Queries      []subQueryKey `json:"queries"`
+	}{DatasourceID: ds.Id}
+	if query.TimeRange != nil {
+		key.From, key.To = query.TimeRange.From, query.TimeRange.To
+	}
+	for _, q := range query.Queries {
+		key.Queries = append(key.Queries, subQueryKey{RefID: q.RefID, Model: q.Model, MaxDataPoints: q.MaxDataPoints, IntervalMS: q.IntervalMS, QueryType: q.QueryType})
+	}
+
+	encoded, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
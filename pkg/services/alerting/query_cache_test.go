@@ -0,0 +1,72 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryCache(t *testing.T) {
+	newRule := func(id int64, metric string, resolution time.Duration) *Rule {
+		return &Rule{ID: id, OrgID: 1, Frequency: 5, QueryCacheResolution: resolution, Conditions: []Condition{
+			&queryingCondition{datasourceID: 1, metric: metric},
+		}}
+	}
+
+	// evaluates the rule every 5s for 2 minutes
+	evaluate := func(handler *DefaultEvalHandler, rules ...*Rule) {
+		start := time.Date(2021, 6, 4, 18, 0, 0, 0, time.UTC)
+		for i := 0; i < 24; i++ {
+			for _, rule := range rules {
+				evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+				evalContext.StartTime = start.Add(time.Duration(i) * 5 * time.Second)
+				handler.Eval(evalContext)
+				require.NoError(t, evalContext.Error)
+				require.True(t, evalContext.Firing)
+			}
+		}
+	}
+
+	t.Run("a rule queries its datasource once per bucket", func(t *testing.T) {
+		requestHandler := &recordingRequestHandler{}
+		evaluate(NewEvalHandler(requestHandler), newRule(1, "metric-a", time.Minute))
+		require.Len(t, requestHandler.requests, 2)
+	})
+
+	t.Run("the responses are cached by rule and query", func(t *testing.T) {
+		requestHandler := &recordingRequestHandler{}
+		evaluate(NewEvalHandler(requestHandler), newRule(1, "metric-a", time.Minute), newRule(2, "metric-b", time.Minute))
+		require.Len(t, requestHandler.requests, 4)
+	})
+
+	t.Run("a rule without a resolution queries on every evaluation", func(t *testing.T) {
+		requestHandler := &recordingRequestHandler{}
+		evaluate(NewEvalHandler(requestHandler), newRule(1, "metric-a", 0))
+		require.Len(t, requestHandler.requests, 24)
+	})
+
+	t.Run("test runs are not cached", func(t *testing.T) {
+		requestHandler := &recordingRequestHandler{}
+		handler := NewEvalHandler(requestHandler)
+		rule := newRule(1, "metric-a", time.Minute)
+		for i := 0; i < 2; i++ {
+			evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+			evalContext.IsTestRun = true
+			handler.Eval(evalContext)
+		}
+		require.Len(t, requestHandler.requests, 2)
+	})
+
+	t.Run("the buckets over are expired", func(t *testing.T) {
+		handler := NewEvalHandler(&recordingRequestHandler{})
+		evaluate(handler, newRule(1, "metric-a", time.Minute), newRule(2, "metric-b", time.Minute))
+		// rule 1 is deleted, rule 2 moves on to the next bucket
+		evalContext := NewEvalContext(context.Background(), newRule(2, "metric-b", time.Minute), &validations.OSSPluginRequestValidator{})
+		evalContext.StartTime = time.Date(2021, 6, 4, 18, 5, 0, 0, time.UTC)
+		handler.Eval(evalContext)
+		require.Len(t, handler.queryCache.rules, 1)
+	})
+}
@@ -0,0 +1,142 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// Bounds of the query details retained for every evaluation.
+const (
+	maxTracedQueryLength = 4096
+	maxTracedSeries      = 100
+)
+
+// QueryTrace records a query executed by a condition during an
+// evaluation and the series it returned.
+type QueryTrace struct {
+	ConditionIndex int            `json:"conditionIndex"`
+	DatasourceID   int64          `json:"datasourceId"`
+	Query          string         `json:"query"`
+	Series         []*SeriesTrace `json:"series"`
+	// TruncatedSeries is the number of series left out of Series.
+	TruncatedSeries int `json:"truncatedSeries,omitempty"`
+}
+
+// SeriesTrace is a series returned by a query, reduced to a single value.
+type SeriesTrace struct {
+	Metric  string     `json:"metric"`
+	Value   null.Float `json:"value"`
+	Matched bool       `json:"matched"`
+}
+
+// TraceQuery records a query about to be executed by a condition.
+// Queries longer than maxTracedQueryLength are truncated.
+func (c *EvalContext) TraceQuery(conditionIndex int, datasourceID int64, query string) *QueryTrace {
+	if len(query) > maxTracedQueryLength {
+		query = query[:maxTracedQueryLength] + "..."
+	}
+
+	trace := &QueryTrace{
+		ConditionIndex: conditionIndex,
+		DatasourceID:   datasourceID,
+		Query:          query,
+		Series:         make([]*SeriesTrace, 0),
+	}
+	c.QueryTraces = append(c.QueryTraces, trace)
+	return trace
+}
+
+// AddSeries records a series returned by the query. Only the first
+// maxTracedSeries series are retained, the others are counted.
+func (t *QueryTrace) AddSeries(metric string, value null.Float, matched bool) {
+	if len(t.Series) >= maxTracedSeries {
+		t.TruncatedSeries++
+		return
+	}
+	t.Series = append(t.Series, &SeriesTrace{Metric: metric, Value: value, Matched: matched})
+}
+
+// EvaluationDetails is what is retained of the last evaluation of a rule.
+type EvaluationDetails struct {
+	RuleID      int64
+	State       models.AlertStateType
+	Firing      bool
+	NoDataFound bool
+	// Skipped is set when the pre-check of the rule was false.
+	Skipped        bool
+	ConditionEvals string
+	EvalMatches    []*EvalMatch
+	QueryTraces    []*QueryTrace
+	Error          error
+	StartTime      time.Time
+	EndTime        time.Time
+	// ShadowFiring is the verdict of the shadow conditions of the rule, if any.
+	ShadowFiring *bool
+}
+
+func newEvaluationDetails(evalContext *EvalContext) *EvaluationDetails {
+	return &EvaluationDetails{
+		RuleID:         evalContext.Rule.ID,
+		State:          evalContext.Rule.State,
+		Firing:         evalContext.Firing,
+		NoDataFound:    evalContext.NoDataFound,
+		Skipped:        evalContext.Skipped,
+		ConditionEvals: evalContext.ConditionEvals,
+		EvalMatches:    evalContext.EvalMatches,
+		QueryTraces:    evalContext.QueryTraces,
+		Error:          evalContext.Error,
+		StartTime:      evalContext.StartTime,
+		EndTime:        evalContext.EndTime,
+		ShadowFiring:   evalContext.ShadowFiring,
+	}
+}
+
+// lastEvaluations keeps the details of the last evaluation of every rule.
+type lastEvaluations struct {
+	sync.RWMutex
+	details map[ruleKey]*EvaluationDetails
+}
+
+func newLastEvaluations() *lastEvaluations {
+	return &lastEvaluations{details: make(map[ruleKey]*EvaluationDetails)}
+}
+
+func (l *lastEvaluations) record(evalContext *EvalContext) {
+	details := newEvaluationDetails(evalContext)
+
+	l.Lock()
+	defer l.Unlock()
+	l.details[ruleKeyOf(evalContext.Rule)] = details
+}
+
+func (l *lastEvaluations) get(key ruleKey) (*EvaluationDetails, bool) {
+	l.RLock()
+	defer l.RUnlock()
+	details, ok := l.details[key]
+	return details, ok
+}
+
+// prune forgets the rules that are no longer scheduled.
+func (l *lastEvaluations) prune(rules []*Rule) {
+	scheduled := make(map[ruleKey]bool, len(rules))
+	for _, rule := range rules {
+		scheduled[ruleKeyOf(rule)] = true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	for key := range l.details {
+		if !scheduled[key] {
+			delete(l.details, key)
+		}
+	}
+}
+
+// LastEvaluation returns the details of the last evaluation of the
+// rule of the org by this instance, including the queries it executed.
+func (e *AlertEngine) LastEvaluation(orgID, ruleID int64) (*EvaluationDetails, bool) {
+	return e.lastEvaluations.get(ruleKey{orgID: orgID, id: ruleID})
+}
@@ -0,0 +1,98 @@
+package alerting
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryTrace(t *testing.T) {
+	t.Run("truncates long queries", func(t *testing.T) {
+		evalContext := NewEvalContext(context.Background(), &Rule{}, nil)
+		trace := evalContext.TraceQuery(0, 1, strings.Repeat("a", maxTracedQueryLength+10))
+
+		require.Len(t, evalContext.QueryTraces, 1)
+		require.Equal(t, maxTracedQueryLength+len("..."), len(trace.Query))
+	})
+
+	t.Run("bounds the number of series", func(t *testing.T) {
+		evalContext := NewEvalContext(context.Background(), &Rule{}, nil)
+		trace := evalContext.TraceQuery(0, 1, "query")
+		for i := 0; i < maxTracedSeries+5; i++ {
+			trace.AddSeries("series", null.FloatFrom(float64(i)), i%2 == 0)
+		}
+
+		require.Len(t, trace.Series, maxTracedSeries)
+		require.Equal(t, 5, trace.TruncatedSeries)
+	})
+}
+
+func TestEngineLastEvaluation(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.evalHandler = NewFakeEvalHandler(1)
+	engine.resultHandler = &FakeResultHandler{}
+
+	_, ok := engine.LastEvaluation(1, 1)
+	require.False(t, ok)
+
+	rule := &Rule{ID: 1, OrgID: 1}
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}))
+
+	details, ok := engine.LastEvaluation(1, 1)
+	require.True(t, ok)
+	require.Equal(t, int64(1), details.RuleID)
+	require.NoError(t, details.Error)
+	_, ok = engine.LastEvaluation(2, 1)
+	require.False(t, ok, "the rules are looked up by org")
+
+	require.Nil(t, details.ShadowFiring)
+
+	engine.lastEvaluations.prune([]*Rule{{ID: 2, OrgID: 1}})
+	_, ok = engine.LastEvaluation(1, 1)
+	require.False(t, ok)
+}
+
+func TestEngineShadowConditions(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.evalHandler = NewEvalHandler(nil)
+	resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+	engine.resultHandler = resultHandler
+	engine.resultQueue = nil
+
+	rule := &Rule{
+		ID:         1,
+		OrgID:      1,
+		State:      models.AlertStateOK,
+		Conditions: []Condition{&conditionStub{firing: false}},
+		Shadow:     []Condition{&conditionStub{firing: true}},
+	}
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}))
+
+	// the live verdict drives the state the notifications are sent for
+	evalContext := <-resultHandler.handled
+	require.False(t, evalContext.Firing)
+	require.Equal(t, models.AlertStateOK, evalContext.Rule.State)
+	require.False(t, evalContext.shouldUpdateAlertState(), "the shadow verdict should not trigger a notification")
+
+	details, ok := engine.LastEvaluation(1, 1)
+	require.True(t, ok)
+	require.False(t, details.Firing)
+	require.NotNil(t, details.ShadowFiring)
+	require.True(t, *details.ShadowFiring)
+}
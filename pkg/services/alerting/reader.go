@@ -10,39 +10,68 @@ import (
 )
 
 type ruleReader interface {
-	fetch() []*Rule
+	fetch() ([]*Rule, error)
+}
+
+// ruleLoadErrorReader is implemented by the rule readers reporting the
+// rules which failed to load on the last fetch.
+type ruleLoadErrorReader interface {
+	loadErrors() []RuleLoadError
 }
 
 type defaultRuleReader struct {
 	sync.RWMutex
-	log log.Logger
+	log      log.Logger
+	selector labelSelector
+	invalid  []RuleLoadError
 }
 
-func newRuleReader() *defaultRuleReader {
+func newRuleReader(selector labelSelector) *defaultRuleReader {
 	ruleReader := &defaultRuleReader{
-		log: log.New("alerting.ruleReader"),
+		log:      log.New("alerting.ruleReader"),
+		selector: selector,
 	}
 
 	return ruleReader
 }
 
-func (arr *defaultRuleReader) fetch() []*Rule {
+func (arr *defaultRuleReader) fetch() ([]*Rule, error) {
 	cmd := &models.GetAllAlertsQuery{}
 
 	if err := bus.Dispatch(cmd); err != nil {
-		arr.log.Error("Could not load alerts", "error", err)
-		return []*Rule{}
+		return nil, err
 	}
 
 	res := make([]*Rule, 0)
+	invalid := make([]RuleLoadError, 0)
+	validator := newRuleValidator()
+	versions := newConfigVersions()
 	for _, ruleDef := range cmd.Result {
-		if model, err := NewRuleFromDBAlert(ruleDef, false); err != nil {
+		model, err := NewRuleFromDBAlert(ruleDef, false)
+		if err != nil {
 			arr.log.Error("Could not build alert model for rule", "ruleId", ruleDef.Id, "error", err)
+			invalid = append(invalid, newRuleLoadError(ruleDef, err))
+		} else if !arr.selector.matches(model) {
+			arr.log.Debug("Skipping alert rule not matching the rule selector", "ruleId", ruleDef.Id)
+		} else if err := validator.validate(model); err != nil {
+			arr.log.Error("Skipping invalid alert rule", "ruleId", ruleDef.Id, "error", err)
+			invalid = append(invalid, newRuleLoadError(ruleDef, err))
 		} else {
+			model.ConfigVersion = versions.get(model.OrgID, model.DashboardID)
 			res = append(res, model)
 		}
 	}
 
+	arr.Lock()
+	arr.invalid = invalid
+	arr.Unlock()
+
 	metrics.MAlertingActiveAlerts.Set(float64(len(res)))
-	return res
+	return res, nil
+}
+
+func (arr *defaultRuleReader) loadErrors() []RuleLoadError {
+	arr.RLock()
+	defer arr.RUnlock()
+	return arr.invalid
 }
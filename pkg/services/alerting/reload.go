@@ -0,0 +1,114 @@
+package alerting
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"golang.org/x/sync/semaphore"
+)
+
+// restartOnlySettings are the alerting settings used to set up the engine
+// when it starts, which cannot be changed while it runs.
+var restartOnlySettings = []struct {
+	key   string
+	value interface{}
+}{
+	{key: "enabled", value: &setting.AlertingEnabled},
+	{key: "execute_alerts", value: &setting.ExecuteAlerts},
+	{key: "clustering_instance", value: &setting.AlertingClusteringInstance},
+	{key: "clustering_fallback_instance", value: &setting.AlertingClusteringFallbackInstance},
+	{key: "alerting.clustering_assignments", value: &setting.AlertingClusteringAssignments},
+	{key: "result_handler_workers", value: &setting.AlertingResultHandlerWorkers},
+	{key: "rule_selector", value: &setting.AlertingRuleSelector},
+	{key: "eval_webhook_url", value: &setting.AlertingEvalWebhookURL},
+	{key: "eval_webhook_timeout_seconds", value: &setting.AlertingEvalWebhookTimeout},
+	{key: "eval_webhook_max_attempts", value: &setting.AlertingEvalWebhookMaxAttempts},
+	{key: "flap_detection_threshold", value: &setting.AlertingFlapDetectionThreshold},
+	{key: "flap_detection_window_seconds", value: &setting.AlertingFlapDetectionWindow},
+	{key: "flap_detection_stabilization_seconds", value: &setting.AlertingFlapDetectionStabilization},
+	{key: "alerting.inhibit_rules", value: &setting.AlertingInhibitRules},
+	{key: "notification_dedup_ttl_seconds", value: &setting.AlertingNotificationDedupTTL},
+	{key: "notifierless_rules", value: &setting.AlertingNotifierlessRules},
+	{key: "max_notifications_per_minute", value: &setting.AlertingMaxNotificationsPerMinute},
+	{key: "heartbeat_url", value: &setting.AlertingHeartbeatURL},
+	{key: "heartbeat_interval_seconds", value: &setting.AlertingHeartbeatInterval},
+	{key: "metrics_per_rule", value: &setting.AlertingMetricsPerRule},
+	{key: "metrics_per_rule_tag", value: &setting.AlertingMetricsPerRuleTag},
+	{key: "metrics_per_rule_max_labels", value: &setting.AlertingMetricsPerRuleMaxLabels},
+	{key: "startup_notification_delay_seconds", value: &setting.AlertingStartupNotificationDelay},
+	{key: "warmup_period_seconds", value: &setting.AlertingWarmupPeriod},
+}
+
+// Reload reads the alerting settings of cfg again and applies them to the
+// running engine. The settings read for every job, such as the timeouts
+// and the number of attempts, apply to the next jobs, as do the settings
+// cached by the engine which can be changed safely. The other settings
+// keep their current value until the next restart.
+func (e *AlertEngine) Reload(cfg *setting.Cfg) error {
+	current := make([]reflect.Value, len(restartOnlySettings))
+	for i, s := range restartOnlySettings {
+		value := reflect.ValueOf(s.value).Elem()
+		current[i] = reflect.New(value.Type()).Elem()
+		current[i].Set(value)
+	}
+	weights := setting.AlertingClusteringWeights
+
+	if err := cfg.ReadAlertingSettings(); err != nil {
+		return err
+	}
+
+	for i, s := range restartOnlySettings {
+		value := reflect.ValueOf(s.value).Elem()
+		if !reflect.DeepEqual(value.Interface(), current[i].Interface()) {
+			e.log.Warn("Alerting setting cannot be changed without a restart, keeping its current value", "setting", s.key)
+			value.Set(current[i])
+		}
+	}
+	// the weights can change but not whether the rules are shared by weight
+	if (len(weights) == 0) != (len(setting.AlertingClusteringWeights) == 0) {
+		e.log.Warn("Alerting setting cannot be changed without a restart, keeping its current value", "setting", "alerting.clustering_weights")
+		setting.AlertingClusteringWeights = weights
+	} else if e.partition != nil && !reflect.DeepEqual(weights, setting.AlertingClusteringWeights) {
+		if err := e.partition.setWeights(setting.AlertingClusteringWeights); err != nil {
+			setting.AlertingClusteringWeights = weights
+			return err
+		}
+		e.log.Info("Alert Clustering: Instance weights changed, the rules are rebalanced on their next update", "weights", setting.AlertingClusteringWeights)
+	}
+
+	maxCost := setting.AlertingMaxInFlightCost
+	if maxCost < 0 {
+		maxCost = 0
+	}
+
+	e.settingsLock.Lock()
+	e.unfinishedWorkTimeout = setting.AlertingShutdownGracePeriod
+	if maxCost != e.maxCost {
+		// the jobs in flight release their cost to the previous budget
+		e.costBudget = nil
+		if maxCost > 0 {
+			e.costBudget = semaphore.NewWeighted(maxCost)
+		}
+		e.maxCost = maxCost
+		e.throughput.setCapacity(e.clock.Now(), maxCost)
+	}
+	e.settingsLock.Unlock()
+
+	if lease, ok := e.Lease.(*cacheLease); ok {
+		lease.setTimeout(time.Second * time.Duration(setting.AlertingClusteringTimeout))
+		lease.setBackoff(setting.AlertingClusteringStandbyBackoff)
+	}
+	e.evalLag.setThreshold(setting.AlertingEvalLagThreshold)
+	e.staleEvals.setThreshold(setting.AlertingStaleEvaluationThreshold)
+	e.dsHealth.setSettings(setting.AlertingDatasourceHealthThreshold, setting.AlertingDatasourceHealthLatency)
+	e.tombstones.setGracePeriod(setting.AlertingDeletedRuleGracePeriod)
+
+	e.log.Info("Alerting settings reloaded")
+	return nil
+}
+
+func (e *AlertEngine) handleReloadSettings(cmd *models.ReloadAlertingSettingsCommand) error {
+	return e.Reload(cmd.Cfg)
+}
@@ -0,0 +1,178 @@
+package alerting
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+type deadlineEvalHandler struct {
+	timeouts []time.Duration
+}
+
+func (h *deadlineEvalHandler) Eval(evalContext *EvalContext) {
+	deadline, _ := evalContext.Ctx.Deadline()
+	h.timeouts = append(h.timeouts, time.Until(deadline))
+}
+
+func TestEngineReload(t *testing.T) {
+	newCfg := func(keys map[string]string) *setting.Cfg {
+		cfg := setting.NewCfg()
+		section, err := cfg.Raw.NewSection("alerting")
+		require.NoError(t, err)
+		for key, value := range keys {
+			_, err := section.NewKey(key, value)
+			require.NoError(t, err)
+		}
+		return cfg
+	}
+
+	// the settings are package globals, put back the ones the other tests rely on
+	defaultCfg := newCfg(map[string]string{"clustering_instance": setting.AlertingClusteringInstance})
+	t.Cleanup(func() {
+		require.NoError(t, defaultCfg.ReadAlertingSettings())
+		setting.AlertingEvaluationTimeout = 30 * time.Second
+		setting.AlertingNotificationTimeout = 30 * time.Second
+	})
+
+	require.NoError(t, defaultCfg.ReadAlertingSettings())
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.resultHandler = &FakeResultHandler{}
+	engine.resultQueue = nil
+	instance := setting.AlertingClusteringInstance
+	restartOnly := make([]interface{}, len(restartOnlySettings))
+	for i, s := range restartOnlySettings {
+		restartOnly[i] = reflect.ValueOf(s.value).Elem().Interface()
+	}
+
+	evalHandler := &deadlineEvalHandler{}
+	engine.evalHandler = evalHandler
+	require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 1}}))
+	require.InDelta(t, float64(30*time.Second), float64(evalHandler.timeouts[0]), float64(time.Second))
+
+	require.NoError(t, engine.Reload(newCfg(map[string]string{
+		"evaluation_timeout_seconds":    "7",
+		"max_attempts":                  "2",
+		"shutdown_grace_period_seconds": "12",
+		"max_in_flight_cost":            "4",
+		"clustering_instance":           "other-instance",
+
+		"notification_dedup_ttl_seconds":     "60",
+		"notifierless_rules":                 setting.NotifierlessRulesSkip,
+		"max_notifications_per_minute":       "10",
+		"heartbeat_url":                      "http://heartbeat.example.com",
+		"heartbeat_interval_seconds":         "5",
+		"metrics_per_rule":                   "true",
+		"metrics_per_rule_tag":               "team",
+		"metrics_per_rule_max_labels":        "5",
+		"startup_notification_delay_seconds": "30",
+		"warmup_period_seconds":              "30",
+	})))
+
+	t.Run("new timeouts take effect on the next jobs", func(t *testing.T) {
+		evalHandler := &deadlineEvalHandler{}
+		engine.evalHandler = evalHandler
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 1}}))
+		require.Len(t, evalHandler.timeouts, 1)
+		require.InDelta(t, float64(7*time.Second), float64(evalHandler.timeouts[0]), float64(time.Second))
+		require.Equal(t, 12*time.Second, engine.unfinishedWorkTimeout)
+	})
+
+	t.Run("new max attempts take effect on the next jobs", func(t *testing.T) {
+		evalHandler := NewFakeEvalHandler(0)
+		engine.evalHandler = evalHandler
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: &Rule{ID: 1}}))
+		require.Equal(t, 2, evalHandler.CallNb)
+	})
+
+	t.Run("the in-flight cost budget is resized", func(t *testing.T) {
+		budget, maxCost := engine.budget()
+		require.NotNil(t, budget)
+		require.Equal(t, int64(4), maxCost)
+
+		engine.evalHandler = NewFakeEvalHandler(1)
+		require.NoError(t, engine.processJobWithinBudget(context.Background(), &Job{running: true, Rule: &Rule{ID: 1, Cost: 10}}))
+		require.True(t, budget.TryAcquire(4), "the cost of the job should be released")
+	})
+
+	t.Run("settings used at startup keep their value", func(t *testing.T) {
+		require.Equal(t, instance, setting.AlertingClusteringInstance)
+		for i, s := range restartOnlySettings {
+			require.Equal(t, restartOnly[i], reflect.ValueOf(s.value).Elem().Interface(), s.key)
+		}
+		require.Equal(t, 600*time.Second, setting.AlertingNotificationDedupTTL)
+		require.Equal(t, setting.NotifierlessRulesWarn, setting.AlertingNotifierlessRules)
+		require.Zero(t, setting.AlertingMaxNotificationsPerMinute)
+		require.Empty(t, setting.AlertingHeartbeatURL)
+		require.Equal(t, 60*time.Second, setting.AlertingHeartbeatInterval)
+		require.False(t, setting.AlertingMetricsPerRule)
+		require.Empty(t, setting.AlertingMetricsPerRuleTag)
+		require.Equal(t, 100, setting.AlertingMetricsPerRuleMaxLabels)
+		require.Zero(t, setting.AlertingStartupNotificationDelay)
+		require.Zero(t, setting.AlertingWarmupPeriod)
+	})
+}
+
+func TestEngineReloadClusteringWeights(t *testing.T) {
+	newCfg := func(weights map[string]string) *setting.Cfg {
+		cfg := setting.NewCfg()
+		section, err := cfg.Raw.NewSection("alerting")
+		require.NoError(t, err)
+		_, err = section.NewKey("clustering_enabled", "true")
+		require.NoError(t, err)
+		_, err = section.NewKey("clustering_instance", setting.AlertingClusteringInstance)
+		require.NoError(t, err)
+		section, err = cfg.Raw.NewSection("alerting.clustering_weights")
+		require.NoError(t, err)
+		for instance, weight := range weights {
+			_, err := section.NewKey(instance, weight)
+			require.NoError(t, err)
+		}
+		return cfg
+	}
+
+	defaultCfg := setting.NewCfg()
+	_, err := defaultCfg.Raw.NewSection("alerting")
+	require.NoError(t, err)
+	_, err = defaultCfg.Raw.Section("alerting").NewKey("clustering_instance", setting.AlertingClusteringInstance)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, defaultCfg.ReadAlertingSettings())
+		setting.AlertingEvaluationTimeout = 30 * time.Second
+		setting.AlertingNotificationTimeout = 30 * time.Second
+	})
+
+	require.NoError(t, newCfg(map[string]string{"instance-a": "1", "instance-b": "3"}).ReadAlertingSettings())
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	require.NotNil(t, engine.partition)
+
+	rules := make([]*Rule, 0, 100)
+	for id := int64(1); id <= 100; id++ {
+		rules = append(rules, &Rule{ID: id})
+	}
+	require.Len(t, engine.partition.assign(rules), 2)
+
+	t.Run("a leaving instance hands its rules over on reload", func(t *testing.T) {
+		require.NoError(t, engine.Reload(newCfg(map[string]string{"instance-b": "3"})))
+		assignment := engine.partition.assign(rules)
+		require.Len(t, assignment, 1)
+		require.Len(t, assignment["instance-b"], 100)
+	})
+
+	t.Run("sharing the rules by weight cannot be turned off without a restart", func(t *testing.T) {
+		require.NoError(t, engine.Reload(newCfg(nil)))
+		require.Equal(t, map[string]float64{"instance-b": 3}, setting.AlertingClusteringWeights)
+	})
+
+	t.Run("invalid weights are rejected", func(t *testing.T) {
+		require.Error(t, engine.Reload(newCfg(map[string]string{"instance-b": "-1"})))
+		require.Error(t, engine.Reload(newCfg(map[string]string{"instance-b": "big"})))
+		require.Equal(t, map[string]float64{"instance-b": 3}, setting.AlertingClusteringWeights)
+	})
+}
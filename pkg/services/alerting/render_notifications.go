@@ -0,0 +1,94 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ErrInvalidRenderState is returned when notifications are rendered for a
+// state no notification is sent for.
+var ErrInvalidRenderState = errors.New("notifications are only sent for the alerting, ok and no_data states")
+
+// NotifierPayload is what a notifier of an alert rule would send, rendered
+// without being sent. Most notifiers make a single webhook request, the
+// email notifier sends an email instead.
+type NotifierPayload struct {
+	NotifierUID  string
+	NotifierType string
+	Webhooks     []*models.SendWebhookSync
+	Emails       []*models.SendEmailCommandSync
+	// Error is the error the notifier failed with while rendering.
+	Error error
+}
+
+// RenderNotifications renders the notifications the notifiers of the alert
+// rule would send for a synthetic evaluation moving the rule to the state,
+// e.g. for a CI to assert the output of the notification templates. The
+// notifiers run as they would for a real notification, but the requests
+// and emails they dispatch, or send with their own client like the Slack
+// notifier, are recorded instead of being sent, and no image is rendered. The alert and notification states are left untouched.
+func (e *AlertEngine) RenderNotifications(ruleID int64, state models.AlertStateType) ([]NotifierPayload, error) {
+	if state != models.AlertStateAlerting && state != models.AlertStateOK && state != models.AlertStateNoData {
+		return nil, ErrInvalidRenderState
+	}
+
+	alertQuery := &models.GetAlertByIdQuery{Id: ruleID}
+	if err := bus.Dispatch(alertQuery); err != nil {
+		return nil, err
+	}
+	rule, err := NewRuleFromDBAlert(alertQuery.Result, false)
+	if err != nil {
+		return nil, err
+	}
+
+	notificationsQuery := &models.GetAlertNotificationsWithUidToSendQuery{OrgId: rule.OrgID, Uids: rule.Notifications}
+	if err := bus.Dispatch(notificationsQuery); err != nil {
+		return nil, err
+	}
+
+	var recorded []interface{}
+	ctx := models.WithNotificationRecorder(context.Background(), func(msg interface{}) {
+		recorded = append(recorded, msg)
+	})
+
+	evalContext := NewEvalContext(ctx, rule, fakeRequestValidator{})
+	evalContext.IsTestRun = true
+	evalContext.Rule.State = state
+	switch state {
+	case models.AlertStateAlerting:
+		evalContext.Firing = true
+		evalContext.EvalMatches = evalMatchesBasedOnState()
+	case models.AlertStateNoData:
+		evalContext.NoDataFound = true
+	}
+	if err := evalContext.evaluateNotificationTemplateFields(); err != nil {
+		return nil, err
+	}
+
+	payloads := make([]NotifierPayload, 0, len(notificationsQuery.Result))
+	for _, notification := range notificationsQuery.Result {
+		payload := NotifierPayload{NotifierUID: notification.Uid, NotifierType: notification.Type}
+		notifier, err := InitNotifier(notification)
+		if err != nil {
+			payload.Error = err
+			payloads = append(payloads, payload)
+			continue
+		}
+
+		recorded = nil
+		payload.Error = notifier.Notify(evalContext)
+		for _, msg := range recorded {
+			switch msg := msg.(type) {
+			case *models.SendWebhookSync:
+				payload.Webhooks = append(payload.Webhooks, msg)
+			case *models.SendEmailCommandSync:
+				payload.Emails = append(payload.Emails, msg)
+			}
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads, nil
+}
@@ -0,0 +1,116 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+// renderingTestNotifier renders the evaluation into a webhook request, or
+// into an email for the email type.
+type renderingTestNotifier struct {
+	testNotifier
+}
+
+func (n *renderingTestNotifier) Notify(evalContext *EvalContext) error {
+	body := fmt.Sprintf("%s: %s (%d matches)", evalContext.GetNotificationTitle(), evalContext.Rule.Message, len(evalContext.EvalMatches))
+	if n.Type == "test-email" {
+		return bus.DispatchCtx(evalContext.Ctx, &models.SendEmailCommandSync{SendEmailCommand: models.SendEmailCommand{
+			To:      []string{"ops@example.com"},
+			Subject: evalContext.GetNotificationTitle(),
+			Data:    map[string]interface{}{"Body": body},
+		}})
+	}
+	return bus.DispatchCtx(evalContext.Ctx, &models.SendWebhookSync{Url: "http://example.com/hook", HttpMethod: "POST", Body: body})
+}
+
+func TestEngineRenderNotifications(t *testing.T) {
+	for _, notifierType := range []string{"test-webhook", "test-email"} {
+		RegisterNotifier(&NotifierPlugin{
+			Type: notifierType,
+			Name: notifierType,
+			Factory: func(model *models.AlertNotification) (Notifier, error) {
+				return &renderingTestNotifier{testNotifier{UID: model.Uid, Type: model.Type}}, nil
+			},
+		})
+	}
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &conditionStub{}, nil
+	})
+
+	settings, err := simplejson.NewJson([]byte(`{
+		"notifications": [{"uid": "hook"}, {"uid": "mail"}, {"uid": "unknown"}],
+		"conditions": [{"type": "test", "evaluator": {"type": "gt", "params": [1]}}]
+	}`))
+	require.NoError(t, err)
+	bus.AddHandler("test", func(query *models.GetAlertByIdQuery) error {
+		query.Result = &models.Alert{Id: query.Id, OrgId: 1, Name: "High CPU", Message: "CPU usage is above 90%", Settings: settings, State: models.AlertStateOK}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = []*models.AlertNotification{
+			{Uid: "hook", Type: "test-webhook", Settings: simplejson.New()},
+			{Uid: "mail", Type: "test-email", Settings: simplejson.New()},
+			{Uid: "unknown", Type: "test-unknown", Settings: simplejson.New()},
+		}
+		return nil
+	})
+
+	// the notifications service records the notifications instead of sending them
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SendWebhookSync) error {
+		if models.RecordNotification(ctx, cmd) {
+			return nil
+		}
+		return errors.New("the webhook request should not be sent")
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SendEmailCommandSync) error {
+		if models.RecordNotification(ctx, cmd) {
+			return nil
+		}
+		return errors.New("the email should not be sent")
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return errors.New("rendering the notifications should not change the notification state")
+	})
+
+	engine := &AlertEngine{}
+
+	t.Run("the payloads of the notifiers are rendered for the state", func(t *testing.T) {
+		payloads, err := engine.RenderNotifications(42, models.AlertStateAlerting)
+		require.NoError(t, err)
+		require.Len(t, payloads, 3)
+
+		require.Equal(t, "hook", payloads[0].NotifierUID)
+		require.NoError(t, payloads[0].Error)
+		require.Len(t, payloads[0].Webhooks, 1)
+		require.Equal(t, "[Alerting] High CPU: CPU usage is above 90% (2 matches)", payloads[0].Webhooks[0].Body)
+		require.Equal(t, "http://example.com/hook", payloads[0].Webhooks[0].Url)
+		require.Empty(t, payloads[0].Emails)
+
+		require.Equal(t, "mail", payloads[1].NotifierUID)
+		require.NoError(t, payloads[1].Error)
+		require.Len(t, payloads[1].Emails, 1)
+		require.Equal(t, "[Alerting] High CPU", payloads[1].Emails[0].Subject)
+		require.Empty(t, payloads[1].Webhooks)
+
+		require.Equal(t, "unknown", payloads[2].NotifierUID)
+		require.Error(t, payloads[2].Error)
+	})
+
+	t.Run("the resolved notifications are rendered", func(t *testing.T) {
+		payloads, err := engine.RenderNotifications(42, models.AlertStateOK)
+		require.NoError(t, err)
+		require.Equal(t, "[OK] High CPU: CPU usage is above 90% (0 matches)", payloads[0].Webhooks[0].Body)
+	})
+
+	t.Run("the states no notification is sent for are rejected", func(t *testing.T) {
+		_, err := engine.RenderNotifications(42, models.AlertStatePending)
+		require.ErrorIs(t, err, ErrInvalidRenderState)
+	})
+}
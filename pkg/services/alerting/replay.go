@@ -0,0 +1,101 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ErrNoTracedEvaluations is returned when replaying the evaluations of
+// a rule which has no traced evaluations.
+var ErrNoTracedEvaluations = errors.New("the alert rule has no traced evaluations, enable its trace first")
+
+// ReplayedEvaluation is an evaluation of an alert rule replayed from its
+// trace, along with the state decision reconstructed for it.
+type ReplayedEvaluation struct {
+	Time      time.Time
+	PrevState models.AlertStateType
+	State     models.AlertStateType
+	// StateChanged is set when the result handling updates the state of
+	// the rule and notifies for the evaluation.
+	StateChanged bool
+	// TracedState is the state the rule had after the traced evaluation,
+	// which differs from State when the rule was changed since.
+	TracedState models.AlertStateType
+}
+
+// replayEvaluations feeds the traced evaluations back through the state
+// decision of the rule, in order, and returns the reconstructed timeline.
+// The replay starts from the state the rule had before the first traced
+// evaluation, the `For` duration of a rule pending then being measured from
+// the first evaluation. Nothing is queried, saved or notified.
+func replayEvaluations(rule *Rule, evaluations []*EvaluationTrace) []ReplayedEvaluation {
+	timeline := make([]ReplayedEvaluation, 0, len(evaluations))
+	if len(evaluations) == 0 {
+		return timeline
+	}
+
+	replayed := *rule
+	replayed.State = evaluations[0].PrevState
+	var runtime ruleRuntime
+	if replayed.State == models.AlertStatePending {
+		runtime.PendingSince = evaluations[0].EndTime
+	}
+
+	for _, evaluation := range evaluations {
+		evalContext := NewEvalContext(context.Background(), &replayed, nil)
+		evalContext.Firing = evaluation.Firing
+		evalContext.NoDataFound = evaluation.NoDataFound
+		evalContext.Skipped = evaluation.Skipped
+		evalContext.Error = evaluation.Error
+		evalContext.StartTime = evaluation.StartTime
+		evalContext.EndTime = evaluation.EndTime
+		evalContext.runtime = runtime
+
+		replayed.State = evalContext.getNewStateAt(evaluation.EndTime)
+		evalContext.trackPendingState(evaluation.EndTime)
+		evalContext.trackResolvedState(evaluation.EndTime)
+		evalContext.trackBreaches()
+		runtime = evalContext.runtime
+		changed := evalContext.shouldUpdateAlertState()
+		if changed {
+			replayed.LastStateChange = evaluation.EndTime
+		}
+
+		timeline = append(timeline, ReplayedEvaluation{
+			Time:         evaluation.StartTime,
+			PrevState:    evalContext.PrevAlertState,
+			State:        replayed.State,
+			StateChanged: changed,
+			TracedState:  evaluation.State,
+		})
+	}
+	return timeline
+}
+
+// ReplayTrace replays the traced evaluations of the alert rule of the org
+// through its current state decision, e.g. to understand why it fired during
+// an incident, and returns the reconstructed state timeline. The datapoints
+// recorded in the trace are used instead of querying the datasources and
+// no notification is sent. Changing the settings of the rule, such as its
+// `For` duration, before replaying shows how they change the decisions.
+func (e *AlertEngine) ReplayTrace(orgID, ruleID int64) ([]ReplayedEvaluation, error) {
+	trace, ok := e.traces.get(ruleKey{orgID: orgID, id: ruleID})
+	if !ok || len(trace.Evaluations) == 0 {
+		return nil, ErrNoTracedEvaluations
+	}
+
+	alertQuery := &models.GetAlertByIdQuery{Id: ruleID}
+	if err := bus.Dispatch(alertQuery); err != nil {
+		return nil, err
+	}
+	rule, err := NewRuleFromDBAlert(alertQuery.Result, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return replayEvaluations(rule, trace.Evaluations), nil
+}
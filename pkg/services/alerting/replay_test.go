@@ -0,0 +1,110 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+type scriptedResult struct {
+	firing bool
+	noData bool
+	err    error
+	// wait is waited for before the evaluation
+	wait time.Duration
+}
+
+// scriptedEvalHandler evaluates the rule to the results of the script in turn.
+type scriptedEvalHandler struct {
+	script []scriptedResult
+	next   int
+}
+
+func (h *scriptedEvalHandler) Eval(evalContext *EvalContext) {
+	result := h.script[h.next]
+	h.next++
+	time.Sleep(result.wait)
+	evalContext.StartTime = time.Now()
+	evalContext.Firing = result.firing
+	evalContext.NoDataFound = result.noData
+	evalContext.Error = result.err
+	evalContext.EndTime = time.Now()
+}
+
+func TestEngineReplayTrace(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}], "noDataState": "no_data", "executionErrorState": "keep_state"}`))
+	require.NoError(t, err)
+	stored := &models.Alert{Id: 1, OrgId: 1, Frequency: 60, For: 30 * time.Millisecond, State: models.AlertStateOK, Settings: settings}
+	bus.AddHandler("test", func(query *models.GetAlertByIdQuery) error {
+		query.Result = stored
+		return nil
+	})
+	rule, err := NewRuleFromDBAlert(stored, false)
+	require.NoError(t, err)
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.resultHandler = &FakeResultHandler{}
+	engine.evalHandler = &scriptedEvalHandler{script: []scriptedResult{
+		{},
+		{firing: true},
+		{firing: true, wait: 50 * time.Millisecond},
+		{noData: true},
+		{err: errors.New("datasource unavailable")},
+		{},
+	}}
+
+	_, err = engine.ReplayTrace(rule.OrgID, rule.ID)
+	require.Equal(t, ErrNoTracedEvaluations, err)
+
+	engine.EnableTrace(rule.OrgID, rule.ID, time.Hour)
+	job := &Job{Rule: rule}
+	for i := 0; i < 6; i++ {
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+	}
+
+	timeline, err := engine.ReplayTrace(rule.OrgID, rule.ID)
+	require.NoError(t, err)
+
+	var states []models.AlertStateType
+	var changes []bool
+	for _, evaluation := range timeline {
+		require.Equal(t, evaluation.TracedState, evaluation.State, "the replay reproduces the traced states")
+		states = append(states, evaluation.State)
+		changes = append(changes, evaluation.StateChanged)
+	}
+	require.Equal(t, []models.AlertStateType{
+		models.AlertStateOK,
+		models.AlertStatePending,
+		models.AlertStateAlerting,
+		models.AlertStateNoData,
+		models.AlertStateNoData,
+		models.AlertStateOK,
+	}, states)
+	require.Equal(t, []bool{false, true, true, true, false, true}, changes)
+
+	t.Run("the replay uses the settings of the rule", func(t *testing.T) {
+		trace, ok := engine.GetTrace(rule.OrgID, rule.ID)
+		require.True(t, ok)
+		rule.For = time.Hour
+
+		timeline := replayEvaluations(rule, trace.Evaluations)
+		require.Equal(t, models.AlertStatePending, timeline[2].State)
+		require.Equal(t, models.AlertStateAlerting, timeline[2].TracedState)
+		require.False(t, timeline[2].StateChanged)
+	})
+}
@@ -0,0 +1,140 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// ErrInvalidResetState is returned when an alert rule is reset to
+// a state other than a baseline state.
+var ErrInvalidResetState = errors.New("alert rules can only be reset to the ok or no_data state")
+
+// stateResets holds the states the alert rules were reset to until they
+// are used by the next evaluation of the rules, so that the in-memory rules
+// are only changed by the goroutine evaluating them.
+type stateResets struct {
+	mtx    sync.Mutex
+	states map[ruleKey]RuleState
+}
+
+func newStateResets() *stateResets {
+	return &stateResets{states: make(map[ruleKey]RuleState)}
+}
+
+func (r *stateResets) record(rule *Rule, state RuleState) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.states[ruleKeyOf(rule)] = state
+}
+
+// apply sets the state the rule was reset to, if any, and returns true if it was reset.
+func (r *stateResets) apply(rule *Rule) bool {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	key := ruleKeyOf(rule)
+	state, ok := r.states[key]
+	if !ok {
+		return false
+	}
+	rule.State = state.State
+	rule.LastStateChange = state.LastStateChange
+	delete(r.states, key)
+	return true
+}
+
+// forget drops the resets of the rules loaded with the state they were reset to.
+func (r *stateResets) forget(rules []*Rule) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, rule := range rules {
+		if state, ok := r.states[ruleKeyOf(rule)]; ok && state.State == rule.State {
+			delete(r.states, ruleKeyOf(rule))
+		}
+	}
+}
+
+// ResetRuleState sets the state of the alert rule without waiting for its
+// next evaluation, e.g. to clear it after a false positive. The state is
+// persisted and used by the next evaluation of the rule. A resolved
+// notification is sent when the rule was alerting, unless its notifications
+// are suppressed.
+func (e *AlertEngine) ResetRuleState(orgID, ruleID int64, state models.AlertStateType) error {
+	if state != models.AlertStateOK && state != models.AlertStateNoData {
+		return ErrInvalidResetState
+	}
+
+	alertQuery := &models.GetAlertByIdQuery{Id: ruleID, OrgId: orgID}
+	if err := bus.Dispatch(alertQuery); err != nil {
+		return err
+	}
+
+	rule, err := NewRuleFromDBAlert(alertQuery.Result, false)
+	if err != nil {
+		return err
+	}
+	if rule.State == models.AlertStatePaused {
+		return models.ErrCannotChangeStateOnPausedAlert
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), setting.AlertingNotificationTimeout)
+	defer cancel()
+	evalContext := NewEvalContext(ctx, rule, e.RequestValidator)
+	evalContext.NoDataFound = state == models.AlertStateNoData
+	rule.State = state
+
+	if !evalContext.shouldUpdateAlertState() {
+		// the rule may still be pending in memory
+		e.stateResets.record(rule, RuleState{State: state, LastStateChange: rule.LastStateChange})
+		return nil
+	}
+
+	e.log.Info("Resetting alert state", "ruleId", rule.ID, "newState", state, "prev state", evalContext.PrevAlertState)
+
+	annotationData := simplejson.New()
+	annotationData.Set("reset", true)
+	cmd := &models.SetAlertStateCommand{
+		AlertId:  rule.ID,
+		OrgId:    rule.OrgID,
+		State:    state,
+		EvalData: annotationData,
+	}
+	if err := bus.Dispatch(cmd); err != nil {
+		return err
+	}
+	rule.StateChanges = cmd.Result.StateChanges
+	rule.LastStateChange = e.clock.Now()
+
+	resetState := RuleState{State: state, LastStateChange: rule.LastStateChange}
+	if err := e.StateStore.Save(rule.OrgID, rule.ID, resetState); err != nil {
+		e.log.Error("Failed to persist alert state", "ruleId", rule.ID, "error", err)
+	}
+	e.stateResets.record(rule, resetState)
+
+	item := annotations.Item{
+		OrgId:       rule.OrgID,
+		DashboardId: rule.DashboardID,
+		PanelId:     rule.PanelID,
+		AlertId:     rule.ID,
+		Text:        "Alert state reset",
+		NewState:    string(state),
+		PrevState:   string(evalContext.PrevAlertState),
+		Epoch:       rule.LastStateChange.UnixNano() / int64(time.Millisecond),
+		Data:        annotationData,
+	}
+	if err := annotations.GetRepository().Save(&item); err != nil {
+		e.log.Error("Failed to save annotation for new alert state", "error", err)
+	}
+
+	if evalContext.PrevAlertState == models.AlertStateAlerting {
+		e.notifyReset(evalContext)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAnnotationsRepo struct {
+	annotations.Repository
+	items []*annotations.Item
+}
+
+func (r *fakeAnnotationsRepo) Save(item *annotations.Item) error {
+	r.items = append(r.items, item)
+	return nil
+}
+
+type recordingTestNotifier struct {
+	testNotifier
+	states *[]models.AlertStateType
+}
+
+func (n *recordingTestNotifier) Notify(evalCtx *EvalContext) error {
+	*n.states = append(*n.states, evalCtx.Rule.State)
+	return nil
+}
+
+func TestEngineResetRuleState(t *testing.T) {
+	var notified []models.AlertStateType
+	RegisterNotifier(&NotifierPlugin{
+		Type: "test-recording",
+		Name: "Test recording",
+		Factory: func(model *models.AlertNotification) (Notifier, error) {
+			return &recordingTestNotifier{testNotifier: testNotifier{UID: model.Uid, Type: model.Type}, states: &notified}, nil
+		},
+	})
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &conditionStub{}, nil
+	})
+
+	origRepo := annotations.GetRepository()
+	repo := &fakeAnnotationsRepo{}
+	annotations.SetRepository(repo)
+	t.Cleanup(func() { annotations.SetRepository(origRepo) })
+
+	settings, err := simplejson.NewJson([]byte(`{
+		"notifications": [{"uid": "recording"}],
+		"conditions": [{"type": "test"}]
+	}`))
+	require.NoError(t, err)
+
+	var alert *models.Alert
+	bus.AddHandler("test", func(query *models.GetAlertByIdQuery) error {
+		query.Result = alert
+		return nil
+	})
+	var setStateCmds []*models.SetAlertStateCommand
+	bus.AddHandler("test", func(cmd *models.SetAlertStateCommand) error {
+		setStateCmds = append(setStateCmds, cmd)
+		cmd.Result = models.Alert{Id: cmd.AlertId, State: cmd.State, StateChanges: 4}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = []*models.AlertNotification{{Id: 1, Uid: "recording", Type: "test-recording", Settings: simplejson.New()}}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetOrCreateNotificationStateQuery) error {
+		query.Result = &models.AlertNotificationState{AlertId: query.AlertId, NotifierId: query.NotifierId}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		return nil
+	})
+
+	newEngine := func() (*AlertEngine, *fakeStateStore) {
+		store := &fakeStateStore{states: map[ruleKey]RuleState{}}
+		engine := &AlertEngine{StateStore: store}
+		require.NoError(t, engine.Init())
+		return engine, store
+	}
+
+	t.Run("resetting an alerting rule to ok sends a resolved notification", func(t *testing.T) {
+		notified, setStateCmds, repo.items = nil, nil, nil
+		alert = &models.Alert{Id: 1, OrgId: 1, Name: "rule", Settings: settings, State: models.AlertStateAlerting}
+		engine, store := newEngine()
+
+		require.NoError(t, engine.ResetRuleState(1, 1, models.AlertStateOK))
+
+		require.Len(t, setStateCmds, 1)
+		require.Equal(t, models.AlertStateOK, setStateCmds[0].State)
+		require.Equal(t, models.AlertStateOK, store.states[ruleKey{orgID: 1, id: 1}].State)
+		require.Len(t, repo.items, 1)
+		require.Equal(t, string(models.AlertStateAlerting), repo.items[0].PrevState)
+		require.Equal(t, []models.AlertStateType{models.AlertStateOK}, notified)
+
+		// the next evaluation of the rule starts from the reset state
+		otherOrg := &Rule{ID: 1, OrgID: 2, State: models.AlertStateAlerting}
+		require.False(t, engine.stateResets.apply(otherOrg), "the rule of another org with the same id is not reset")
+		rule := &Rule{ID: 1, OrgID: 1, State: models.AlertStateAlerting}
+		engine.stateResets.apply(rule)
+		require.Equal(t, models.AlertStateOK, rule.State)
+	})
+
+	t.Run("the resolved notification of a silenced rule is suppressed", func(t *testing.T) {
+		notified, setStateCmds, repo.items = nil, nil, nil
+		silencedSettings, err := simplejson.NewJson([]byte(`{
+			"notifications": [{"uid": "recording"}],
+			"conditions": [{"type": "test"}],
+			"alertRuleTags": {"team": "payments"}
+		}`))
+		require.NoError(t, err)
+		alert = &models.Alert{Id: 1, OrgId: 1, Name: "rule", Settings: silencedSettings, State: models.AlertStateAlerting}
+		engine, _ := newEngine()
+		now := time.Now()
+		_, err = engine.AddSilence(1, "team=payments", now.Add(-time.Minute), now.Add(time.Hour))
+		require.NoError(t, err)
+
+		require.NoError(t, engine.ResetRuleState(1, 1, models.AlertStateOK))
+		require.Len(t, setStateCmds, 1)
+		require.Empty(t, notified)
+	})
+
+	t.Run("resetting a rule that is not alerting sends no notification", func(t *testing.T) {
+		notified, setStateCmds, repo.items = nil, nil, nil
+		alert = &models.Alert{Id: 1, OrgId: 1, Name: "rule", Settings: settings, State: models.AlertStateNoData}
+		engine, _ := newEngine()
+
+		require.NoError(t, engine.ResetRuleState(1, 1, models.AlertStateOK))
+		require.Len(t, setStateCmds, 1)
+		require.Empty(t, notified)
+	})
+
+	t.Run("resetting a rule to its current state changes nothing", func(t *testing.T) {
+		notified, setStateCmds, repo.items = nil, nil, nil
+		alert = &models.Alert{Id: 1, OrgId: 1, Name: "rule", Settings: settings, State: models.AlertStateOK}
+		engine, _ := newEngine()
+
+		require.NoError(t, engine.ResetRuleState(1, 1, models.AlertStateOK))
+		require.Empty(t, setStateCmds)
+		require.Empty(t, repo.items)
+		require.Empty(t, notified)
+	})
+
+	t.Run("paused rules and non baseline states can't be reset", func(t *testing.T) {
+		alert = &models.Alert{Id: 1, OrgId: 1, Name: "rule", Settings: settings, State: models.AlertStatePaused}
+		engine, _ := newEngine()
+
+		require.ErrorIs(t, engine.ResetRuleState(1, 1, models.AlertStateOK), models.ErrCannotChangeStateOnPausedAlert)
+		require.ErrorIs(t, engine.ResetRuleState(1, 1, models.AlertStateAlerting), ErrInvalidResetState)
+	})
+}
@@ -5,14 +5,17 @@ import (
 	"errors"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
 	"github.com/grafana/grafana/pkg/models"
 
 	"github.com/grafana/grafana/pkg/services/annotations"
 	"github.com/grafana/grafana/pkg/services/rendering"
+	"github.com/grafana/grafana/pkg/setting"
 )
 
 type resultHandler interface {
@@ -20,15 +23,42 @@ type resultHandler interface {
 }
 
 type defaultResultHandler struct {
-	notifier *notificationService
-	log      log.Logger
+	notifier     *notificationService
+	flapDetector *flapDetector
+	inhibitor    *inhibitor
+	silences     *silences
+	stateStore   StateStore
+	startupHold  *startupHold
+	runtimes     *ruleRuntimes
+	clock        clock.Clock
+	log          log.Logger
 }
 
-func newResultHandler(renderService rendering.Service) *defaultResultHandler {
-	return &defaultResultHandler{
-		log:      log.New("alerting.resultHandler"),
-		notifier: newNotificationService(renderService),
+func newResultHandler(renderService rendering.Service, stateStore StateStore, inhibitor *inhibitor, silences *silences, dedupCache remotecache.CacheStorage, clock clock.Clock) *defaultResultHandler {
+	notifier := newNotificationService(renderService)
+	if dedupCache != nil && setting.AlertingNotificationDedupTTL > 0 {
+		notifier.dedup = newNotificationDedup(dedupCache, setting.AlertingNotificationDedupTTL)
 	}
+	if setting.AlertingMaxNotificationsPerMinute > 0 {
+		notifier.budget = newNotificationBudget(setting.AlertingMaxNotificationsPerMinute, clock, notifier.sendSuppressedSummary)
+	}
+
+	handler := &defaultResultHandler{
+		log:        log.New("alerting.resultHandler"),
+		notifier:   notifier,
+		stateStore: stateStore,
+		inhibitor:  inhibitor,
+		silences:   silences,
+		runtimes:   newRuleRuntimes(),
+		clock:      clock,
+		flapDetector: newFlapDetector(
+			setting.AlertingFlapDetectionThreshold,
+			setting.AlertingFlapDetectionWindow,
+			setting.AlertingFlapDetectionStabilization,
+		),
+	}
+	handler.startupHold = newStartupHold(setting.AlertingStartupNotificationDelay, handler.releaseHeld)
+	return handler
 }
 
 func (handler *defaultResultHandler) handle(evalContext *EvalContext) error {
@@ -47,6 +77,7 @@ func (handler *defaultResultHandler) handle(evalContext *EvalContext) error {
 	}
 
 	metrics.MAlertingResultState.WithLabelValues(string(evalContext.Rule.State)).Inc()
+	stateSaved := false
 	if evalContext.shouldUpdateAlertState() {
 		handler.log.Info("New state change", "ruleId", evalContext.Rule.ID, "newState", evalContext.Rule.State, "prev state", evalContext.PrevAlertState)
 
@@ -75,9 +106,11 @@ func (handler *defaultResultHandler) handle(evalContext *EvalContext) error {
 			// when two servers are raising. This makes sure that the server
 			// with the last state change always sends a notification.
 			evalContext.Rule.StateChanges = cmd.Result.StateChanges
+			handler.runtimes.update(evalContext.Rule, func(runtime *ruleRuntime) { runtime.StateChanges = cmd.Result.StateChanges })
 
 			// Update the last state change of the alert rule in memory
-			evalContext.Rule.LastStateChange = time.Now()
+			evalContext.Rule.LastStateChange = handler.clock.Now()
+			stateSaved = true
 		}
 
 		// save annotation
@@ -89,7 +122,7 @@ func (handler *defaultResultHandler) handle(evalContext *EvalContext) error {
 			Text:        "",
 			NewState:    string(evalContext.Rule.State),
 			PrevState:   string(evalContext.PrevAlertState),
-			Epoch:       time.Now().UnixNano() / int64(time.Millisecond),
+			Epoch:       handler.clock.Now().UnixNano() / int64(time.Millisecond),
 			Data:        annotationData,
 		}
 
@@ -99,6 +132,114 @@ func (handler *defaultResultHandler) handle(evalContext *EvalContext) error {
 		}
 	}
 
+	handler.inhibitor.observe(evalContext.Rule)
+	handler.runtimes.update(evalContext.Rule, evalContext.trackFiring)
+	if stateSaved || len(evalContext.changedSeries()) > 0 {
+		handler.saveState(evalContext.Rule)
+	}
+
+	evalContext.Rule.Flapping = handler.flapDetector.observe(evalContext.Rule, evalContext.shouldUpdateAlertState(), handler.clock.Now())
+	if evalContext.Rule.Flapping {
+		handler.log.Debug("Alert rule is flapping, suppressing notifications", "ruleId", evalContext.Rule.ID, "state", evalContext.Rule.State)
+		return nil
+	}
+
+	if evalContext.Rule.State == models.AlertStateConfigError && !evalContext.shouldUpdateAlertState() {
+		// the configuration error was notified already, until the rule is fixed
+		handler.log.Debug("Alert rule still has a configuration error, suppressing notifications", "ruleId", evalContext.Rule.ID, "error", evalContext.Error)
+		return nil
+	}
+
+	if name, inhibited := handler.inhibitor.inhibits(evalContext.Rule); inhibited {
+		handler.log.Debug("Alert rule is inhibited, suppressing notifications", "ruleId", evalContext.Rule.ID, "state", evalContext.Rule.State, "inhibitRule", name)
+		return nil
+	}
+
+	if id, silenced := handler.silences.silenced(evalContext.Rule); silenced {
+		handler.log.Debug("Alert rule is silenced, suppressing notifications", "ruleId", evalContext.Rule.ID, "state", evalContext.Rule.State, "silenceId", id)
+		return nil
+	}
+
+	handler.escalate(evalContext)
+
+	if evalContext.SeriesStates != nil {
+		// the series of per-series rules are notified for independently
+		for _, key := range evalContext.changedSeries() {
+			handler.notify(evalContext.forSeries(key))
+		}
+		return nil
+	}
+
+	handler.notify(evalContext)
+	return nil
+}
+
+// notifyReset notifies the reset of the state of the rule like a state change
+// of its evaluation, unless its notifications are suppressed.
+func (handler *defaultResultHandler) notifyReset(evalContext *EvalContext) {
+	if handler.flapDetector.isFlapping(evalContext.Rule) {
+		handler.log.Debug("Alert rule is flapping, suppressing notifications", "ruleId", evalContext.Rule.ID, "state", evalContext.Rule.State)
+		return
+	}
+	if name, inhibited := handler.inhibitor.inhibits(evalContext.Rule); inhibited {
+		handler.log.Debug("Alert rule is inhibited, suppressing notifications", "ruleId", evalContext.Rule.ID, "state", evalContext.Rule.State, "inhibitRule", name)
+		return
+	}
+	if id, silenced := handler.silences.silenced(evalContext.Rule); silenced {
+		handler.log.Debug("Alert rule is silenced, suppressing notifications", "ruleId", evalContext.Rule.ID, "state", evalContext.Rule.State, "silenceId", id)
+		return
+	}
+	handler.notify(evalContext)
+}
+
+// saveState persists the state of the rule along with its pending and
+// notification state, for the engine to resume from after a restart.
+func (handler *defaultResultHandler) saveState(rule *Rule) {
+	runtime := handler.runtimes.get(rule)
+	state := RuleState{
+		State:           rule.State,
+		LastStateChange: rule.LastStateChange,
+		PendingSince:    runtime.PendingSince,
+		FiringSince:     runtime.FiringSince,
+		Escalated:       runtime.Escalated,
+		SeriesStates:    runtime.SeriesStates,
+	}
+	if err := handler.stateStore.Save(rule.OrgID, rule.ID, state); err != nil {
+		handler.log.Error("Failed to persist alert state", "ruleId", rule.ID, "error", err)
+	}
+}
+
+func (handler *defaultResultHandler) notify(evalContext *EvalContext) {
+	evalContext.Notifications = routeNotifications(evalContext)
+	evalContext = evalContext.capMatches(setting.AlertingMaxMatchesInNotification)
+
+	if handler.startupHold.hold(evalContext) {
+		handler.log.Debug("Holding the notifications of the alert rule after startup", "ruleId", evalContext.Rule.ID, "state", evalContext.Rule.State)
+		return
+	}
+	handler.send(evalContext)
+}
+
+// releaseHeld notifies the evaluations held after startup, unless their rule
+// got inhibited or silenced meanwhile.
+func (handler *defaultResultHandler) releaseHeld(evalContexts []*EvalContext) {
+	for _, evalContext := range evalContexts {
+		if _, inhibited := handler.inhibitor.inhibits(evalContext.Rule); inhibited {
+			continue
+		}
+		if _, silenced := handler.silences.silenced(evalContext.Rule); silenced {
+			continue
+		}
+
+		// the context of the evaluation is done by now
+		ctx, cancel := context.WithTimeout(context.Background(), setting.AlertingNotificationTimeout)
+		evalContext.Ctx = ctx
+		handler.send(evalContext)
+		cancel()
+	}
+}
+
+func (handler *defaultResultHandler) send(evalContext *EvalContext) {
 	if err := handler.notifier.SendIfNeeded(evalContext); err != nil {
 		switch {
 		case errors.Is(err, context.Canceled):
@@ -109,6 +250,4 @@ func (handler *defaultResultHandler) handle(evalContext *EvalContext) error {
 			handler.log.Error("handler.notifier.SendIfNeeded failed", "err", err)
 		}
 	}
-
-	return nil
 }
@@ -0,0 +1,54 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultHandlerNotificationsDisabled(t *testing.T) {
+	origDisabled := setting.AlertingNotificationsDisabled
+	t.Cleanup(func() { setting.AlertingNotificationsDisabled = origDisabled })
+	setting.AlertingNotificationsDisabled = true
+
+	origRepo := annotations.GetRepository()
+	repo := &fakeAnnotationsRepo{}
+	annotations.SetRepository(repo)
+	t.Cleanup(func() { annotations.SetRepository(origRepo) })
+
+	var setStateCmds []*models.SetAlertStateCommand
+	bus.AddHandler("test", func(cmd *models.SetAlertStateCommand) error {
+		setStateCmds = append(setStateCmds, cmd)
+		cmd.Result = models.Alert{Id: cmd.AlertId, State: cmd.State, StateChanges: 1}
+		return nil
+	})
+	notifiersQueried := 0
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		notifiersQueried++
+		return nil
+	})
+
+	store := &fakeStateStore{states: map[ruleKey]RuleState{}}
+	handler := newResultHandler(nil, store, newInhibitor(nil), newSilences(clock.New()), nil, clock.New())
+
+	rule := &Rule{ID: 1, OrgID: 1, State: models.AlertStateOK, Notifications: []string{"notifier"}}
+	for _, state := range []models.AlertStateType{models.AlertStateAlerting, models.AlertStateOK} {
+		evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		rule.State = state
+		require.NoError(t, handler.handle(evalContext))
+	}
+
+	require.Len(t, setStateCmds, 2)
+	require.Equal(t, models.AlertStateAlerting, setStateCmds[0].State)
+	require.Equal(t, models.AlertStateOK, setStateCmds[1].State)
+	require.Equal(t, models.AlertStateOK, store.states[ruleKey{orgID: 1, id: 1}].State)
+	require.Len(t, repo.items, 2)
+	require.Zero(t, notifiersQueried, "no notifier should be invoked")
+}
@@ -0,0 +1,27 @@
+package alerting
+
+// ResultFunc handles the result of the evaluation of an alert rule, whose
+// state is already computed, e.g. by saving the state and notifying.
+type ResultFunc func(evalContext *EvalContext) error
+
+// ResultMiddleware wraps the handling of the results of the evaluations,
+// e.g. to route the alerts to an incident management system. It can call
+// next to keep the default handling, or override it by not calling next.
+type ResultMiddleware func(evalContext *EvalContext, next ResultFunc) error
+
+// UseResultMiddleware adds a middleware around the handling of the results
+// of the evaluations. Middlewares run in the order they are added, the first
+// one being the outermost. It must be called before the engine runs.
+func (e *AlertEngine) UseResultMiddleware(fn ResultMiddleware) {
+	e.resultMiddlewares = append(e.resultMiddlewares, fn)
+}
+
+// handle handles the result through the middlewares.
+func (e *AlertEngine) handle(evalContext *EvalContext) error {
+	next := e.resultHandler.handle
+	for i := len(e.resultMiddlewares) - 1; i >= 0; i-- {
+		middleware, inner := e.resultMiddlewares[i], next
+		next = func(evalContext *EvalContext) error { return middleware(evalContext, inner) }
+	}
+	return next(evalContext)
+}
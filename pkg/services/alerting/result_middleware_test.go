@@ -0,0 +1,70 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineResultMiddleware(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	newEngine := func() (*AlertEngine, *slowResultHandler) {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		engine.evalHandler = NewEvalHandler(nil)
+		resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+		engine.resultHandler = resultHandler
+		engine.resultQueue = nil
+		return engine, resultHandler
+	}
+	firingRule := func() *Rule {
+		return &Rule{ID: 1, State: models.AlertStateOK, Conditions: []Condition{&conditionStub{firing: true}}}
+	}
+
+	t.Run("middlewares receive the result and can call the default handler", func(t *testing.T) {
+		engine, resultHandler := newEngine()
+
+		var received []models.AlertStateType
+		engine.UseResultMiddleware(func(evalContext *EvalContext, next ResultFunc) error {
+			received = append(received, evalContext.Rule.State)
+			return next(evalContext)
+		})
+
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: firingRule()}))
+		require.Equal(t, []models.AlertStateType{models.AlertStateAlerting}, received, "the state should be computed before the result is handled")
+		select {
+		case evalContext := <-resultHandler.handled:
+			require.True(t, evalContext.Firing)
+		default:
+			t.Fatal("expected the default handler to handle the result")
+		}
+	})
+
+	t.Run("middlewares can override the default handler", func(t *testing.T) {
+		engine, resultHandler := newEngine()
+
+		var calls []string
+		engine.UseResultMiddleware(func(evalContext *EvalContext, next ResultFunc) error {
+			calls = append(calls, "outer")
+			return next(evalContext)
+		})
+		engine.UseResultMiddleware(func(evalContext *EvalContext, next ResultFunc) error {
+			calls = append(calls, "incident:"+evalContext.Rule.Name)
+			return errors.New("incident management system unavailable")
+		})
+
+		rule := firingRule()
+		rule.Name = "disk full"
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}))
+		require.Equal(t, []string{"outer", "incident:disk full"}, calls)
+		require.Empty(t, resultHandler.handled, "the default handler should not be called")
+	})
+}
@@ -0,0 +1,82 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// enqueueResult puts the evaluated alert on the result queue to be handled
+// by one of the result workers. It returns false when the workers are done,
+// leaving the result to the caller.
+func (e *AlertEngine) enqueueResult(grafanaCtx context.Context, evalContext *EvalContext) bool {
+	select {
+	case e.resultQueue <- evalContext:
+		metrics.MAlertingResultQueueDepth.Set(float64(len(e.resultQueue)))
+		return true
+	case <-grafanaCtx.Done():
+		return false
+	case <-e.dispatcherDone:
+		return false
+	}
+}
+
+// runResultWorker handles the results put on the result queue until
+// the grafana server context is canceled.
+func (e *AlertEngine) runResultWorker(grafanaCtx context.Context) error {
+	for {
+		select {
+		case <-grafanaCtx.Done():
+			return nil
+		case <-e.dispatcherDone:
+			// no more results will be queued, handle the remaining ones before leaving
+			for {
+				select {
+				case evalContext := <-e.resultQueue:
+					e.processQueuedResult(evalContext)
+				default:
+					return nil
+				}
+			}
+		case evalContext := <-e.resultQueue:
+			metrics.MAlertingResultQueueDepth.Set(float64(len(e.resultQueue)))
+			e.processQueuedResult(evalContext)
+		}
+	}
+}
+
+func (e *AlertEngine) processQueuedResult(evalContext *EvalContext) {
+	defer func() {
+		if err := recover(); err != nil {
+			e.handlePanic("Alert Result Panic", err)
+		}
+	}()
+
+	// the result gets its own context since the evaluation one
+	// may already have been canceled when the job ended.
+	resultHandleCtx, resultHandleCancelFn := context.WithTimeout(context.Background(), setting.AlertingNotificationTimeout)
+	defer resultHandleCancelFn()
+
+	evalContext.Ctx = resultHandleCtx
+	e.handleResult(evalContext)
+}
+
+func (e *AlertEngine) handleResult(evalContext *EvalContext) {
+	if e.tombstones.isDeleted(evalContext.Rule) {
+		e.log.Debug("Dropping the result of a deleted alert rule", "alertId", evalContext.Rule.ID)
+		return
+	}
+
+	if err := e.handle(evalContext); err != nil {
+		switch {
+		case errors.Is(err, context.Canceled):
+			e.log.Debug("Result handler returned context.Canceled")
+		case errors.Is(err, context.DeadlineExceeded):
+			e.log.Debug("Result handler returned context.DeadlineExceeded")
+		default:
+			e.log.Error("Failed to handle result", "err", err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+type slowResultHandler struct {
+	delay   time.Duration
+	handled chan *EvalContext
+}
+
+func (handler *slowResultHandler) handle(evalContext *EvalContext) error {
+	time.Sleep(handler.delay)
+	handler.handled <- evalContext
+	return nil
+}
+
+func TestEngineResultWorkers(t *testing.T) {
+	origWorkers := setting.AlertingResultHandlerWorkers
+	t.Cleanup(func() { setting.AlertingResultHandlerWorkers = origWorkers })
+	setting.AlertingResultHandlerWorkers = 2
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 3
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	require.NotNil(t, engine.resultQueue)
+
+	resultHandler := &slowResultHandler{delay: time.Second, handled: make(chan *EvalContext, 10)}
+	engine.resultHandler = resultHandler
+	engine.evalHandler = NewFakeEvalHandler(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < setting.AlertingResultHandlerWorkers; i++ {
+		go func() { _ = engine.runResultWorker(ctx) }()
+	}
+
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		job := &Job{running: true, Rule: &Rule{ID: int64(i)}}
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		engine.evalHandler = NewFakeEvalHandler(1)
+	}
+	require.Less(t, int64(time.Since(start)), int64(resultHandler.delay), "evaluations should not wait for the result handler")
+
+	for i := 0; i < 2; i++ {
+		select {
+		case evalContext := <-resultHandler.handled:
+			require.NotNil(t, evalContext.Ctx)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the result to be handled by a worker")
+		}
+	}
+}
+
+func TestEngineEnqueueResult(t *testing.T) {
+	origEvaluationTimeout, origNotificationTimeout, origMaxAttempts := setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts
+	t.Cleanup(func() {
+		setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts = origEvaluationTimeout, origNotificationTimeout, origMaxAttempts
+	})
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	setup := func(t *testing.T) (*AlertEngine, *slowResultHandler) {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		// no worker takes the results
+		engine.resultQueue = make(chan *EvalContext)
+		resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+		engine.resultHandler = resultHandler
+		engine.evalHandler = NewFakeEvalHandler(1)
+		return engine, resultHandler
+	}
+
+	t.Run("the results are handled inline once the dispatcher is done", func(t *testing.T) {
+		engine, resultHandler := setup(t)
+		close(engine.dispatcherDone)
+
+		job := &Job{running: true, Rule: &Rule{ID: 1}}
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		require.Len(t, resultHandler.handled, 1)
+	})
+
+	t.Run("the results are handled inline once the server is stopping", func(t *testing.T) {
+		engine, resultHandler := setup(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		engine.processJob(ctx, 1, make(chan int, 1), newJobCancels(), &Job{running: true, Rule: &Rule{ID: 1}})
+		select {
+		case <-resultHandler.handled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the result to be handled inline")
+		}
+	})
+
+	t.Run("the workers handle a copy of the rule", func(t *testing.T) {
+		engine, resultHandler := setup(t)
+		engine.resultQueue = make(chan *EvalContext, 1)
+
+		job := &Job{running: true, Rule: &Rule{ID: 1, State: models.AlertStateOK}}
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		evalContext := <-engine.resultQueue
+		require.NotSame(t, job.Rule, evalContext.Rule)
+		require.Equal(t, job.Rule.State, evalContext.Rule.State)
+		require.Empty(t, resultHandler.handled)
+	})
+}
@@ -6,11 +6,14 @@ import (
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/grafana/grafana/pkg/bus"
 	"github.com/grafana/grafana/pkg/components/simplejson"
 	"github.com/grafana/grafana/pkg/models"
+	"github.com/robfig/cron/v3"
 )
 
 var unitMultiplier = map[string]int{
@@ -56,6 +59,109 @@ type Rule struct {
 	AlertRuleTags       []*models.Tag
 
 	StateChanges int64
+	Flapping     bool
+
+	// Cost is the estimated cost of evaluating the rule, relative to
+	// a single series check which costs 1.
+	Cost int64
+
+	// MaxDataAge is the maximum age of the most recent datapoint for the
+	// rule to be evaluated normally, older data is treated as no data.
+	// Zero disables the check.
+	MaxDataAge time.Duration
+
+	// EmptyResultAsZero is set when the empty results of the queries of the
+	// rule stand for a zero value rather than for no data, e.g. for the
+	// datasources returning no series for zero requests. The failed queries
+	// are errors all the same.
+	EmptyResultAsZero bool
+
+	// Lookback is the window of the queries of the rule, ending at the
+	// time of the evaluation. The queries use the time range of their
+	// conditions when it is zero.
+	Lookback time.Duration
+
+	// EvaluationOffset shifts the time range of the queries of the rule back
+	// by the ingestion delay of its data, so that the evaluations only see
+	// settled data, e.g. `now-30s-5m` to `now-30s` for an offset of 30s. The
+	// rule is still evaluated at its frequency.
+	EvaluationOffset time.Duration
+
+	// QueryCacheResolution is the resolution of the data of the rule. The
+	// responses of its datasources are cached for a bucket of that size, so
+	// that a rule evaluated more often than its data changes does not query
+	// the same data again. Zero disables the cache.
+	QueryCacheResolution time.Duration
+
+	// Windows are the time windows the conditions of the rule are each
+	// evaluated over, e.g. a short and a long window for a burn rate alert,
+	// and WindowCondition combines their results into the verdict of the
+	// rule. The rule is evaluated over the time range of its conditions
+	// when it has no windows.
+	Windows         []*EvalWindow
+	WindowCondition *windowCondition
+
+	// DependsOn is the id of the rule of the same org gating the evaluations
+	// of the rule, e.g. a "service degraded" rule gating the rules of its
+	// endpoints. The rule is only evaluated while the rule it depends on is
+	// alerting, and keeps its state otherwise. Zero means no dependency.
+	DependsOn int64
+
+	// PreCheck holds cheap conditions gating the evaluation of the
+	// conditions of the rule, which are only evaluated when the pre-check
+	// is firing. The rule keeps its state otherwise.
+	PreCheck []Condition
+
+	// Shadow holds the conditions of a shadow threshold evaluated along
+	// with the conditions of the rule, e.g. to tune the threshold. Their
+	// verdict is recorded but never changes the state of the rule.
+	Shadow []Condition
+
+	// PinnedInstance is the cluster alerting instance the rule must be
+	// evaluated by, e.g. the one with network access to its datasource. The
+	// other instances never evaluate it. Empty when the rule is not pinned,
+	// it is ignored when clustering is disabled.
+	PinnedInstance string
+
+	// NotificationRoutes route the notifications of the rule to other
+	// notifiers than Notifications depending on its evaluation, e.g. to
+	// page the on-call on the highest values. The first one matching wins.
+	NotificationRoutes []*NotificationRoute
+
+	// Escalations escalate the notifications of the rule to more notifiers
+	// when it keeps firing, ordered by duration. Every level is notified
+	// once the rule has been firing for its duration, until it resolves.
+	Escalations []*EscalationLevel
+
+	// PerSeries is set when the series of the rule alert independently of
+	// each other, e.g. one alert per host for `CPU > 90% per host`. The
+	// notifications are then sent for the state changes of every series.
+	PerSeries bool
+
+	// EvaluationGroup is the group of rules the rule is scheduled with,
+	// sharing the time boundary and the datasource requests of the
+	// queries of their conditions. Empty when the rule isn't grouped.
+	EvaluationGroup string
+
+	// Schedule is the wall-clock schedule of the rule, e.g. to only evaluate
+	// it during business hours. The rule is then evaluated on the ticks the
+	// schedule matches instead of every `Frequency`. Nil when it is not set.
+	Schedule cron.Schedule
+
+	// ConfigVersion is the version of the configuration which defined the
+	// rule, the checksum of the provisioning file of its dashboard. Empty
+	// when the dashboard is not provisioned.
+	ConfigVersion string
+
+	// ResolveCooldown is the time after the rule resolves during which it
+	// does not fire again even though its conditions do, for the issue to
+	// settle instead of paging twice in a row. Zero disables the cooldown.
+	ResolveCooldown time.Duration
+
+	// ConsecutiveBreaches is the number of evaluations in a row the conditions
+	// of the rule must be firing on for the rule to fire, whatever its
+	// frequency, unlike the `For` duration. Zero or one fires right away.
+	ConsecutiveBreaches int
 }
 
 // ValidationError is a typed error with meta data
@@ -158,6 +264,81 @@ func NewRuleFromDBAlert(ruleDef *models.Alert, logTranslationFailures bool) (*Ru
 	model.NoDataState = models.NoDataOption(ruleDef.Settings.Get("noDataState").MustString("no_data"))
 	model.ExecutionErrorState = models.ExecutionErrorOption(ruleDef.Settings.Get("executionErrorState").MustString("alerting"))
 	model.StateChanges = ruleDef.StateChanges
+	model.Cost = ruleDef.Settings.Get("cost").MustInt64(1)
+	if model.Cost < 1 {
+		model.Cost = 1
+	}
+
+	model.EvaluationGroup = ruleDef.Settings.Get("evaluationGroup").MustString()
+	model.PerSeries = ruleDef.Settings.Get("perSeries").MustBool()
+	model.EmptyResultAsZero = ruleDef.Settings.Get("emptyResultAsZero").MustBool()
+
+	if rawMaxDataAge := ruleDef.Settings.Get("maxDataAge").MustString(); rawMaxDataAge != "" {
+		maxDataAge, err := time.ParseDuration(rawMaxDataAge)
+		if err != nil || maxDataAge < 0 {
+			return nil, ValidationError{Reason: "Could not parse maxDataAge field", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+		}
+		model.MaxDataAge = maxDataAge
+	}
+
+	if rawLookback := ruleDef.Settings.Get("lookback").MustString(); rawLookback != "" {
+		lookback, err := time.ParseDuration(rawLookback)
+		if err != nil || lookback <= 0 {
+			return nil, ValidationError{Reason: "Could not parse lookback field", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+		}
+		model.Lookback = lookback
+	}
+
+	model.DependsOn = ruleDef.Settings.Get("dependsOn").MustInt64()
+	if model.DependsOn < 0 || (model.DependsOn != 0 && model.DependsOn == model.ID) {
+		return nil, ValidationError{Reason: "Invalid dependsOn field, it must be the id of another alert rule", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+	}
+
+	if rawOffset := ruleDef.Settings.Get("evaluationOffset").MustString(); rawOffset != "" {
+		offset, err := time.ParseDuration(rawOffset)
+		if err != nil || offset < 0 {
+			return nil, ValidationError{Reason: "Could not parse evaluationOffset field", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+		}
+		model.EvaluationOffset = offset
+	}
+
+	if rawResolution := ruleDef.Settings.Get("queryCacheResolution").MustString(); rawResolution != "" {
+		resolution, err := time.ParseDuration(rawResolution)
+		if err != nil || resolution < 0 {
+			return nil, ValidationError{Reason: "Could not parse queryCacheResolution field", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+		}
+		model.QueryCacheResolution = resolution
+	}
+
+	windows, windowCondition, err := parseWindows(ruleDef.Settings.Get("windows").MustArray(), ruleDef.Settings.Get("windowCondition").MustString())
+	if err != nil {
+		return nil, ValidationError{Reason: fmt.Sprintf("Could not parse windows: %s", err), DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+	}
+	model.Windows = windows
+	model.WindowCondition = windowCondition
+
+	if rawCooldown := ruleDef.Settings.Get("resolveCooldown").MustString(); rawCooldown != "" {
+		cooldown, err := time.ParseDuration(rawCooldown)
+		if err != nil || cooldown < 0 {
+			return nil, ValidationError{Reason: "Could not parse resolveCooldown field", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+		}
+		model.ResolveCooldown = cooldown
+	}
+
+	model.PinnedInstance = strings.TrimSpace(ruleDef.Settings.Get("pinnedInstance").MustString())
+
+	model.ConsecutiveBreaches = ruleDef.Settings.Get("consecutiveBreaches").MustInt()
+	if model.ConsecutiveBreaches < 0 {
+		return nil, ValidationError{Reason: "Invalid consecutiveBreaches field, it cannot be negative", DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+	}
+
+	if rawSchedule := ruleDef.Settings.Get("schedule").MustString(); rawSchedule != "" {
+		schedule, err := parseSchedule(rawSchedule, ruleDef.Settings.Get("scheduleTimezone").MustString())
+		if err != nil {
+			return nil, ValidationError{Reason: fmt.Sprintf("Could not parse schedule field: %s", err), DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
+		}
+		model.Schedule = schedule
+	}
 
 	model.Frequency = ruleDef.Frequency
 	// frequency cannot be zero since that would not execute the alert rule.
@@ -166,10 +347,83 @@ func NewRuleFromDBAlert(ruleDef *models.Alert, logTranslationFailures bool) (*Ru
 		model.Frequency = 60
 	}
 
-	for _, v := range ruleDef.Settings.Get("notifications").MustArray() {
+	notifications, err := parseNotifications(model, ruleDef.Settings.Get("notifications").MustArray(), logTranslationFailures)
+	if err != nil {
+		return nil, err
+	}
+	model.Notifications = notifications
+
+	routes, err := parseNotificationRoutes(model, ruleDef.Settings.Get("notificationRoutes").MustArray(), logTranslationFailures)
+	if err != nil {
+		return nil, err
+	}
+	model.NotificationRoutes = routes
+
+	escalations, err := parseEscalationLevels(model, ruleDef.Settings.Get("escalations").MustArray(), logTranslationFailures)
+	if err != nil {
+		return nil, err
+	}
+	model.Escalations = escalations
+	model.AlertRuleTags = ruleDef.GetTagsFromSettings()
+
+	conditions, err := parseConditions(model, ruleDef.Settings.Get("conditions").MustArray())
+	if err != nil {
+		return nil, err
+	}
+	model.Conditions = conditions
+
+	if len(model.Conditions) == 0 {
+		return nil, ValidationError{Reason: "Alert is missing conditions"}
+	}
+
+	preCheck, err := parseConditions(model, ruleDef.Settings.Get("preCheck").MustArray())
+	if err != nil {
+		return nil, err
+	}
+	model.PreCheck = preCheck
+
+	shadow, err := parseConditions(model, ruleDef.Settings.Get("shadowConditions").MustArray())
+	if err != nil {
+		return nil, err
+	}
+	model.Shadow = shadow
+
+	return model, nil
+}
+
+// parseSchedule parses a standard cron expression, e.g. `0 18 * * 1-5` for
+// every weekday at 18:00, evaluated in the timezone, UTC when it is empty.
+func parseSchedule(expr string, timezone string) (cron.Schedule, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return nil, err
+	}
+	spec, ok := schedule.(*cron.SpecSchedule)
+	if !ok {
+		return nil, fmt.Errorf("%q is an interval, not a wall-clock schedule", expr)
+	}
+	spec.Location = location
+	return spec, nil
+}
+
+// scheduleMatches returns true if the wall-clock schedule matches the tick.
+func scheduleMatches(schedule cron.Schedule, tickTime time.Time) bool {
+	tick := tickTime.Truncate(time.Second)
+	return schedule.Next(tick.Add(-time.Second)).Equal(tick)
+}
+
+// parseNotifications returns the uids of the notifiers referenced by id or uid.
+func parseNotifications(model *Rule, rawNotifications []interface{}, logTranslationFailures bool) ([]string, error) {
+	var uids []string
+	for _, v := range rawNotifications {
 		jsonModel := simplejson.NewFromAny(v)
 		if id, err := jsonModel.Get("id").Int64(); err == nil {
-			uid, err := translateNotificationIDToUID(id, ruleDef.OrgId)
+			uid, err := translateNotificationIDToUID(id, model.OrgID)
 			if err != nil {
 				if !errors.Is(err, models.ErrAlertNotificationFailedTranslateUniqueID) {
 					logger.Error("Failed to translate notification id to uid", "error", err.Error(), "dashboardId", model.DashboardID, "alert", model.Name, "panelId", model.PanelID, "notificationId", id)
@@ -179,17 +433,20 @@ func NewRuleFromDBAlert(ruleDef *models.Alert, logTranslationFailures bool) (*Ru
 					logger.Warn("Unable to translate notification id to uid", "dashboardId", model.DashboardID, "alert", model.Name, "panelId", model.PanelID, "notificationId", id)
 				}
 			} else {
-				model.Notifications = append(model.Notifications, uid)
+				uids = append(uids, uid)
 			}
 		} else if uid, err := jsonModel.Get("uid").String(); err == nil {
-			model.Notifications = append(model.Notifications, uid)
+			uids = append(uids, uid)
 		} else {
 			return nil, ValidationError{Reason: "Neither id nor uid is specified in 'notifications' block, " + err.Error(), DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
 		}
 	}
-	model.AlertRuleTags = ruleDef.GetTagsFromSettings()
+	return uids, nil
+}
 
-	for index, condition := range ruleDef.Settings.Get("conditions").MustArray() {
+func parseConditions(model *Rule, rawConditions []interface{}) ([]Condition, error) {
+	var conditions []Condition
+	for index, condition := range rawConditions {
 		conditionModel := simplejson.NewFromAny(condition)
 		conditionType := conditionModel.Get("type").MustString()
 		factory, exist := conditionFactories[conditionType]
@@ -200,14 +457,9 @@ func NewRuleFromDBAlert(ruleDef *models.Alert, logTranslationFailures bool) (*Ru
 		if err != nil {
 			return nil, ValidationError{Err: err, DashboardID: model.DashboardID, AlertID: model.ID, PanelID: model.PanelID}
 		}
-		model.Conditions = append(model.Conditions, queryCondition)
-	}
-
-	if len(model.Conditions) == 0 {
-		return nil, ValidationError{Reason: "Alert is missing conditions"}
+		conditions = append(conditions, queryCondition)
 	}
-
-	return model, nil
+	return conditions, nil
 }
 
 func translateNotificationIDToUID(id int64, orgID int64) (string, error) {
@@ -241,3 +493,36 @@ var conditionFactories = make(map[string]ConditionFactory)
 func RegisterCondition(typeName string, factory ConditionFactory) {
 	conditionFactories[typeName] = factory
 }
+
+// ReducerFunc reduces the values of a series, without its null values,
+// to the single value the evaluator of a condition is evaluated against.
+type ReducerFunc func(series []float64) (float64, error)
+
+var (
+	reducersLock sync.RWMutex
+	reducers     = make(map[string]ReducerFunc)
+)
+
+// RegisterReducer adds support for a reducer, which the conditions of the
+// alert rules reference by its name. The built-in reducers can't be replaced,
+// but a reducer named like a percentile one, e.g. p90, is used instead of it.
+func RegisterReducer(name string, fn ReducerFunc) {
+	reducersLock.Lock()
+	defer reducersLock.Unlock()
+	reducers[name] = fn
+}
+
+// UnregisterReducer removes the reducer registered with the name.
+func UnregisterReducer(name string) {
+	reducersLock.Lock()
+	defer reducersLock.Unlock()
+	delete(reducers, name)
+}
+
+// GetReducer returns the reducer registered with the name.
+func GetReducer(name string) (ReducerFunc, bool) {
+	reducersLock.RLock()
+	defer reducersLock.RUnlock()
+	fn, ok := reducers[name]
+	return fn, ok
+}
@@ -0,0 +1,100 @@
+package alerting
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+const (
+	// ruleMetricsOverflow is the label of the rules beyond the cap of distinct labels.
+	ruleMetricsOverflow = "overflow"
+	// ruleMetricsUntagged is the label of the rules without the tag the metrics are broken down by.
+	ruleMetricsUntagged = "none"
+)
+
+// ruleMetrics breaks the evaluation metrics down by rule, or by the value
+// of a rule tag such as the team owning the rule. The number of distinct
+// labels is capped to keep the cardinality of the metrics in check, the
+// evaluations of the rules beyond the cap are counted in an overflow label.
+type ruleMetrics struct {
+	mtx       sync.Mutex
+	enabled   bool
+	tag       string
+	maxLabels int
+	labels    map[string]struct{}
+}
+
+// newRuleMetrics returns the per rule metrics, labeled by the value of the
+// tag of the rules or by their id when tag is empty.
+func newRuleMetrics(enabled bool, tag string, maxLabels int) *ruleMetrics {
+	return &ruleMetrics{
+		enabled:   enabled,
+		tag:       tag,
+		maxLabels: maxLabels,
+		labels:    make(map[string]struct{}),
+	}
+}
+
+func (m *ruleMetrics) ruleLabel(rule *Rule) string {
+	if m.tag == "" {
+		return strconv.FormatInt(rule.ID, 10)
+	}
+	for _, tag := range rule.AlertRuleTags {
+		if tag.Key == m.tag {
+			return tag.Value
+		}
+	}
+	return ruleMetricsUntagged
+}
+
+// label returns the label of the metrics of the rule, the overflow label
+// once the cap of distinct labels is reached.
+func (m *ruleMetrics) label(rule *Rule) string {
+	label := m.ruleLabel(rule)
+	if _, ok := m.labels[label]; ok {
+		return label
+	}
+	if len(m.labels) >= m.maxLabels {
+		return ruleMetricsOverflow
+	}
+	m.labels[label] = struct{}{}
+	return label
+}
+
+// observe records the evaluation of the rule in the per rule metrics.
+func (m *ruleMetrics) observe(evalContext *EvalContext) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if !m.enabled {
+		return
+	}
+
+	label := m.label(evalContext.Rule)
+	duration := evalContext.EndTime.Sub(evalContext.StartTime)
+	metrics.MAlertingRuleExecutionTime.WithLabelValues(label).Observe(float64(duration) / float64(time.Millisecond))
+	if evalContext.Error != nil {
+		metrics.MAlertingRuleEvaluationFailures.WithLabelValues(label).Inc()
+	}
+}
+
+// prune drops the metrics of the labels of the rules which don't exist anymore,
+// making room for the labels of the other rules.
+func (m *ruleMetrics) prune(rules []*Rule) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	current := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		current[m.ruleLabel(rule)] = struct{}{}
+	}
+	for label := range m.labels {
+		if _, ok := current[label]; !ok {
+			delete(m.labels, label)
+			metrics.MAlertingRuleExecutionTime.DeleteLabelValues(label)
+			metrics.MAlertingRuleEvaluationFailures.DeleteLabelValues(label)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleMetrics(t *testing.T) {
+	t.Cleanup(func() {
+		metrics.MAlertingRuleExecutionTime.Reset()
+		metrics.MAlertingRuleEvaluationFailures.Reset()
+	})
+
+	evaluate := func(m *ruleMetrics, rule *Rule) {
+		evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		evalContext.EndTime = evalContext.StartTime.Add(time.Second)
+		evalContext.Error = errors.New("failed")
+		m.observe(evalContext)
+	}
+	failures := func(label string) float64 {
+		return testutil.ToFloat64(metrics.MAlertingRuleEvaluationFailures.WithLabelValues(label))
+	}
+
+	t.Run("the rules beyond the cap are counted in the overflow label", func(t *testing.T) {
+		metrics.MAlertingRuleEvaluationFailures.Reset()
+		m := newRuleMetrics(true, "", 2)
+		rules := []*Rule{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}
+		for _, rule := range rules {
+			evaluate(m, rule)
+		}
+		evaluate(m, rules[0])
+
+		require.Equal(t, float64(2), failures("1"))
+		require.Equal(t, float64(1), failures("2"))
+		require.Equal(t, float64(2), failures(ruleMetricsOverflow))
+		require.Equal(t, 3, testutil.CollectAndCount(metrics.MAlertingRuleEvaluationFailures))
+
+		// the labels of the deleted rules make room for the other rules
+		m.prune(rules[1:])
+		require.Equal(t, 2, testutil.CollectAndCount(metrics.MAlertingRuleEvaluationFailures))
+		evaluate(m, rules[2])
+		require.Equal(t, float64(1), failures("3"))
+	})
+
+	t.Run("the rules are labeled by the value of their tag", func(t *testing.T) {
+		metrics.MAlertingRuleEvaluationFailures.Reset()
+		m := newRuleMetrics(true, "team", 2)
+		tagged := func(id int64, team string) *Rule {
+			return &Rule{ID: id, AlertRuleTags: []*models.Tag{{Key: "team", Value: team}}}
+		}
+		evaluate(m, tagged(1, "payments"))
+		evaluate(m, tagged(2, "payments"))
+		evaluate(m, &Rule{ID: 3})
+		evaluate(m, tagged(4, "search"))
+
+		require.Equal(t, float64(2), failures("payments"))
+		require.Equal(t, float64(1), failures(ruleMetricsUntagged))
+		require.Equal(t, float64(1), failures(ruleMetricsOverflow))
+	})
+
+	t.Run("the metrics are not broken down by default", func(t *testing.T) {
+		metrics.MAlertingRuleEvaluationFailures.Reset()
+		metrics.MAlertingRuleExecutionTime.Reset()
+		m := newRuleMetrics(false, "", 2)
+		evaluate(m, &Rule{ID: 1})
+		require.Zero(t, testutil.CollectAndCount(metrics.MAlertingRuleEvaluationFailures))
+		require.Zero(t, testutil.CollectAndCount(metrics.MAlertingRuleExecutionTime))
+	})
+}
@@ -0,0 +1,111 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ruleRuntime is the in-memory state of an alert rule carried from one of
+// its evaluations to the next, which is not persisted.
+type ruleRuntime struct {
+	// PendingSince is when the rule entered the pending state. It is used
+	// to honor the `For` duration.
+	PendingSince time.Time
+
+	// ResolvedAt is when the rule last went from alerting to ok. It is used
+	// to honor the `ResolveCooldown` duration.
+	ResolvedAt time.Time
+
+	// Breaches is the count of the evaluations in a row the conditions of
+	// the rule were firing on. It is used to honor the `ConsecutiveBreaches`
+	// count.
+	Breaches int
+
+	// FiringSince is when the rule started firing without a break, and
+	// Escalated the number of escalation levels it reached since. They are
+	// used to honor the `Escalations` levels.
+	FiringSince time.Time
+	Escalated   int
+
+	// SeriesStates are the alerting series of a per-series rule, by series key.
+	SeriesStates map[string]models.AlertStateType
+
+	// StateChanges is the count of the state changes of the rule last saved
+	// by the result handler, which may be newer than the one the rule was
+	// loaded with. It is used for de duping the notifications.
+	StateChanges int64
+}
+
+// ruleRuntimes keeps the in-memory state of the alert rules apart from the
+// rules, which the scheduler shares with the evaluations in flight and
+// replaces on every reload. The evaluations of a rule read its state when
+// they start and write it back once the state of the rule is decided, while
+// the result handler writes the escalations of the rule.
+type ruleRuntimes struct {
+	mtx      sync.Mutex
+	runtimes map[ruleKey]ruleRuntime
+}
+
+func newRuleRuntimes() *ruleRuntimes {
+	return &ruleRuntimes{runtimes: make(map[ruleKey]ruleRuntime)}
+}
+
+// get returns the in-memory state of the rule.
+func (r *ruleRuntimes) get(rule *Rule) ruleRuntime {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.runtimes[ruleKeyOf(rule)]
+}
+
+// record keeps the in-memory state of the rule tracked by the evaluation,
+// leaving its escalations to the result handler.
+func (r *ruleRuntimes) record(evalContext *EvalContext) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	key := ruleKeyOf(evalContext.Rule)
+	runtime := r.runtimes[key]
+	runtime.PendingSince = evalContext.runtime.PendingSince
+	runtime.ResolvedAt = evalContext.runtime.ResolvedAt
+	runtime.Breaches = evalContext.runtime.Breaches
+	runtime.SeriesStates = evalContext.runtime.SeriesStates
+	r.runtimes[key] = runtime
+}
+
+// update changes the in-memory state of the rule with fn.
+func (r *ruleRuntimes) update(rule *Rule, fn func(runtime *ruleRuntime)) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	key := ruleKeyOf(rule)
+	runtime := r.runtimes[key]
+	fn(&runtime)
+	r.runtimes[key] = runtime
+}
+
+// reset clears the in-memory state of the rule, e.g. once its state was
+// reset, but the count of its state changes.
+func (r *ruleRuntimes) reset(rule *Rule) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	key := ruleKeyOf(rule)
+	r.runtimes[key] = ruleRuntime{StateChanges: r.runtimes[key].StateChanges}
+}
+
+// prune forgets the rules that are no longer scheduled.
+func (r *ruleRuntimes) prune(rules []*Rule) {
+	scheduled := make(map[ruleKey]bool, len(rules))
+	for _, rule := range rules {
+		scheduled[ruleKeyOf(rule)] = true
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for key := range r.runtimes {
+		if !scheduled[key] {
+			delete(r.runtimes, key)
+		}
+	}
+}
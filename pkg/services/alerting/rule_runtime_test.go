@@ -0,0 +1,75 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineRuleRuntime(t *testing.T) {
+	origEvaluationTimeout, origNotificationTimeout, origMaxAttempts := setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts
+	t.Cleanup(func() {
+		setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts = origEvaluationTimeout, origNotificationTimeout, origMaxAttempts
+	})
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.resultHandler = &FakeResultHandler{}
+	engine.resultQueue = nil
+	reader := &fakeRuleReader{}
+	engine.ruleReader = reader
+	refresh := func(rules ...*Rule) {
+		reader.rules = rules
+		require.NoError(t, engine.RefreshRules())
+	}
+
+	// the rule as loaded from the database, without its in-memory state
+	load := func() *Rule {
+		return &Rule{ID: 1, OrgID: 1, Frequency: 10, For: time.Hour, State: models.AlertStateOK, Notifications: []string{"ops"}, Conditions: []Condition{&conditionStub{firing: true}}}
+	}
+	loaded := load()
+	refresh(loaded)
+	job, ok := engine.scheduler.Job(ruleKeyOf(loaded))
+	require.True(t, ok)
+
+	require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+	require.Equal(t, models.AlertStatePending, job.Rule.State)
+	pendingSince := engine.runtimes.get(loaded).PendingSince
+	require.False(t, pendingSince.IsZero())
+
+	t.Run("the in-memory state is kept across the reloads of the rules", func(t *testing.T) {
+		reloaded := load()
+		reloaded.State = models.AlertStatePending
+		refresh(reloaded)
+
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		require.Same(t, reloaded, job.Rule)
+		require.Equal(t, models.AlertStatePending, reloaded.State)
+		require.Equal(t, pendingSince, engine.runtimes.get(reloaded).PendingSince, "the for duration is measured from the first pending evaluation")
+	})
+
+	t.Run("the evaluations in flight during a reload keep their updates", func(t *testing.T) {
+		inFlight := job.Rule
+		reloaded := load()
+		reloaded.State = models.AlertStatePending
+		refresh(reloaded)
+
+		// the evaluation started before the reload resolves the rule
+		inFlight.Conditions = []Condition{&conditionStub{firing: false}}
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{Rule: inFlight}))
+		require.True(t, engine.runtimes.get(reloaded).PendingSince.IsZero())
+	})
+
+	t.Run("the in-memory state of the rules no longer scheduled is forgotten", func(t *testing.T) {
+		engine.runtimes.update(loaded, func(runtime *ruleRuntime) { runtime.Breaches = 1 })
+		refresh()
+		require.Equal(t, ruleRuntime{}, engine.runtimes.get(loaded))
+	})
+}
@@ -82,6 +82,300 @@ func TestAlertRuleForParsing(t *testing.T) {
 	}
 }
 
+func TestAlertRuleMaxDataAgeParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	tcs := []struct {
+		input  string
+		err    bool
+		result time.Duration
+	}{
+		{input: "", result: 0},
+		{input: "0s", result: 0},
+		{input: "90s", result: 90 * time.Second},
+		{input: "10m", result: 10 * time.Minute},
+		{input: "10", err: true},
+		{input: "-1m", err: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}]}`))
+			require.NoError(t, err)
+			settings.Set("maxDataAge", tc.input)
+
+			rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+			if tc.err {
+				var validationErr ValidationError
+				require.ErrorAs(t, err, &validationErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.result, rule.MaxDataAge)
+		})
+	}
+}
+
+func TestAlertRuleResolveCooldownParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	tcs := []struct {
+		input  string
+		err    bool
+		result time.Duration
+	}{
+		{input: "", result: 0},
+		{input: "15m", result: 15 * time.Minute},
+		{input: "15", err: true},
+		{input: "-15m", err: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}]}`))
+			require.NoError(t, err)
+			settings.Set("resolveCooldown", tc.input)
+
+			rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+			if tc.err {
+				var validationErr ValidationError
+				require.ErrorAs(t, err, &validationErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.result, rule.ResolveCooldown)
+		})
+	}
+}
+
+func TestAlertRuleScheduleParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	parse := func(schedule, timezone string) (*Rule, error) {
+		settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}]}`))
+		require.NoError(t, err)
+		settings.Set("schedule", schedule)
+		settings.Set("scheduleTimezone", timezone)
+		return NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+	}
+
+	rule, err := parse("", "")
+	require.NoError(t, err)
+	assert.Nil(t, rule.Schedule)
+
+	rule, err = parse("0 18 * * 1-5", "Europe/Paris")
+	require.NoError(t, err)
+	require.NotNil(t, rule.Schedule)
+	// Friday 2021-06-04 at 12:00 UTC, 14:00 in Paris
+	next := rule.Schedule.Next(time.Date(2021, 6, 4, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2021, 6, 4, 16, 0, 0, 0, time.UTC), next.UTC())
+	// the weekend is skipped
+	next = rule.Schedule.Next(next)
+	assert.Equal(t, time.Date(2021, 6, 7, 16, 0, 0, 0, time.UTC), next.UTC())
+
+	for _, tc := range []struct{ schedule, timezone string }{
+		{schedule: "0 18 * *", timezone: ""},
+		{schedule: "@every 1h", timezone: ""},
+		{schedule: "0 18 * * *", timezone: "Mars/Olympus"},
+	} {
+		_, err := parse(tc.schedule, tc.timezone)
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr, tc.schedule)
+	}
+}
+
+func TestAlertRuleLookbackParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	tcs := []struct {
+		input  string
+		err    bool
+		result time.Duration
+	}{
+		{input: "", result: 0},
+		{input: "5m", result: 5 * time.Minute},
+		{input: "1h", result: time.Hour},
+		{input: "0s", err: true},
+		{input: "-5m", err: true},
+		{input: "5", err: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}]}`))
+			require.NoError(t, err)
+			settings.Set("lookback", tc.input)
+
+			rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+			if tc.err {
+				var validationErr ValidationError
+				require.ErrorAs(t, err, &validationErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.result, rule.Lookback)
+		})
+	}
+}
+
+func TestAlertRuleEvaluationOffsetParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	tcs := []struct {
+		input  string
+		err    bool
+		result time.Duration
+	}{
+		{input: "", result: 0},
+		{input: "30s", result: 30 * time.Second},
+		{input: "2m", result: 2 * time.Minute},
+		{input: "-30s", err: true},
+		{input: "30", err: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}]}`))
+			require.NoError(t, err)
+			settings.Set("evaluationOffset", tc.input)
+
+			rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+			if tc.err {
+				var validationErr ValidationError
+				require.ErrorAs(t, err, &validationErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.result, rule.EvaluationOffset)
+		})
+	}
+}
+
+func TestAlertRuleQueryCacheResolutionParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	tcs := []struct {
+		input  string
+		err    bool
+		result time.Duration
+	}{
+		{input: "", result: 0},
+		{input: "0s", result: 0},
+		{input: "1m", result: time.Minute},
+		{input: "-1m", err: true},
+		{input: "60", err: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.input, func(t *testing.T) {
+			settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}]}`))
+			require.NoError(t, err)
+			settings.Set("queryCacheResolution", tc.input)
+
+			rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+			if tc.err {
+				var validationErr ValidationError
+				require.ErrorAs(t, err, &validationErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.result, rule.QueryCacheResolution)
+		})
+	}
+}
+
+func TestAlertRuleDependsOnParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	parse := func(dependsOn interface{}) (*Rule, error) {
+		settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}]}`))
+		require.NoError(t, err)
+		settings.Set("dependsOn", dependsOn)
+		return NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+	}
+
+	rule, err := parse(2)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), rule.DependsOn)
+
+	for _, dependsOn := range []int64{1, -1} {
+		_, err := parse(dependsOn)
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr, dependsOn)
+	}
+}
+
+func TestAlertRuleConsecutiveBreachesParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	parse := func(consecutiveBreaches int) (*Rule, error) {
+		settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}]}`))
+		require.NoError(t, err)
+		settings.Set("consecutiveBreaches", consecutiveBreaches)
+		return NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+	}
+
+	rule, err := parse(3)
+	require.NoError(t, err)
+	require.Equal(t, 3, rule.ConsecutiveBreaches)
+
+	_, err = parse(-1)
+	var validationErr ValidationError
+	require.ErrorAs(t, err, &validationErr)
+}
+
+func TestAlertRulePreCheckParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	t.Run("the pre-check conditions are parsed like the conditions", func(t *testing.T) {
+		settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}], "preCheck": [{"type": "test"}, {"type": "test"}]}`))
+		require.NoError(t, err)
+		rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+		require.NoError(t, err)
+		assert.Len(t, rule.Conditions, 1)
+		assert.Len(t, rule.PreCheck, 2)
+	})
+
+	t.Run("an unknown pre-check condition is invalid", func(t *testing.T) {
+		settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}], "preCheck": [{"type": "unknown"}]}`))
+		require.NoError(t, err)
+		_, err = NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr)
+	})
+}
+
+func TestAlertRuleShadowParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}], "shadowConditions": [{"type": "test"}]}`))
+	require.NoError(t, err)
+	rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+	require.NoError(t, err)
+	assert.Len(t, rule.Conditions, 1)
+	assert.Len(t, rule.Shadow, 1)
+}
+
 func TestAlertRuleModel(t *testing.T) {
 	sqlstore.InitTestDB(t)
 	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
@@ -204,6 +498,26 @@ func TestAlertRuleModel(t *testing.T) {
 		require.EqualValues(t, alertRule.Frequency, 60)
 	})
 
+	t.Run("Testing alert rule cost", func(t *testing.T) {
+		tcs := []struct {
+			settings string
+			cost     int64
+		}{
+			{settings: `{"conditions": [ { "type": "test", "prop": 123 } ]}`, cost: 1},
+			{settings: `{"cost": 5, "conditions": [ { "type": "test", "prop": 123 } ]}`, cost: 5},
+			{settings: `{"cost": 0, "conditions": [ { "type": "test", "prop": 123 } ]}`, cost: 1},
+		}
+
+		for _, tc := range tcs {
+			alertJSON, jsonErr := simplejson.NewJson([]byte(tc.settings))
+			require.Nil(t, jsonErr)
+
+			alertRule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, OrgId: 1, Frequency: 60, Settings: alertJSON}, false)
+			require.Nil(t, err)
+			require.Equal(t, tc.cost, alertRule.Cost)
+		}
+	})
+
 	t.Run("Testing alert rule which will raise error in case of missing notification id and uid", func(t *testing.T) {
 		json := `
 			{
@@ -242,3 +556,44 @@ func TestAlertRuleModel(t *testing.T) {
 		require.EqualValues(t, err.Error(), "alert validation error: Neither id nor uid is specified in 'notifications' block, type assertion to string failed AlertId: 1 PanelId: 1 DashboardId: 1")
 	})
 }
+
+func TestAlertRuleEscalationsParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	parse := func(escalations string) (*Rule, error) {
+		settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}], "escalations": ` + escalations + `}`))
+		require.NoError(t, err)
+		return NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+	}
+
+	rule, err := parse(`[{"after": "1h", "notifications": [{"uid": "manager"}]}, {"after": "30m", "notifications": [{"uid": "lead"}]}]`)
+	require.NoError(t, err)
+	require.Len(t, rule.Escalations, 2)
+	assert.Equal(t, 30*time.Minute, rule.Escalations[0].After, "the levels are ordered by duration")
+	assert.Equal(t, []string{"lead"}, rule.Escalations[0].Notifications)
+	assert.Equal(t, time.Hour, rule.Escalations[1].After)
+
+	for _, invalid := range []string{
+		`[{"after": "soon", "notifications": [{"uid": "lead"}]}]`,
+		`[{"after": "0s", "notifications": [{"uid": "lead"}]}]`,
+		`[{"after": "30m", "notifications": []}]`,
+	} {
+		_, err = parse(invalid)
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr, invalid)
+	}
+}
+
+func TestAlertRulePinnedInstanceParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}], "pinnedInstance": " instance-b "}`))
+	require.NoError(t, err)
+	rule, err := NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+	require.NoError(t, err)
+	assert.Equal(t, "instance-b", rule.PinnedInstance)
+}
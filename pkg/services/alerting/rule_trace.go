@@ -0,0 +1,118 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// maxTracedEvaluations is the number of evaluations retained in the trace
+// of a rule, the oldest ones being dropped first.
+const maxTracedEvaluations = 100
+
+// RuleTrace is the detailed trace of the evaluations of an alert rule
+// recorded while its tracing is enabled.
+type RuleTrace struct {
+	RuleID       int64
+	OrgID        int64
+	EnabledUntil time.Time
+	Evaluations  []*EvaluationTrace
+}
+
+// EvaluationTrace is the detailed trace of an evaluation of a rule: the
+// queries sent along with the datapoints they returned, recorded in Logs,
+// the evaluation of every condition and the resulting state decision.
+type EvaluationTrace struct {
+	*EvaluationDetails
+	Logs             []*ResultLogEntry
+	ConditionResults []*ConditionEvalResult
+	PrevState        models.AlertStateType
+}
+
+// ruleTraces keeps the traces of the rules whose tracing was enabled.
+type ruleTraces struct {
+	sync.Mutex
+	traces map[ruleKey]*RuleTrace
+}
+
+func newRuleTraces() *ruleTraces {
+	return &ruleTraces{traces: make(map[ruleKey]*RuleTrace)}
+}
+
+// enable starts a new trace of the rule, dropping the previous one.
+func (t *ruleTraces) enable(key ruleKey, until time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	t.traces[key] = &RuleTrace{RuleID: key.id, OrgID: key.orgID, EnabledUntil: until, Evaluations: make([]*EvaluationTrace, 0)}
+}
+
+// enabled returns true if the evaluations of the rule starting at now are traced.
+func (t *ruleTraces) enabled(rule *Rule, now time.Time) bool {
+	t.Lock()
+	defer t.Unlock()
+	trace, ok := t.traces[ruleKeyOf(rule)]
+	return ok && now.Before(trace.EnabledUntil)
+}
+
+// record adds the evaluation to the trace of its rule.
+func (t *ruleTraces) record(evalContext *EvalContext) {
+	t.Lock()
+	defer t.Unlock()
+
+	trace, ok := t.traces[ruleKeyOf(evalContext.Rule)]
+	if !ok {
+		return
+	}
+	if len(trace.Evaluations) >= maxTracedEvaluations {
+		trace.Evaluations = trace.Evaluations[1:]
+	}
+	trace.Evaluations = append(trace.Evaluations, &EvaluationTrace{
+		EvaluationDetails: newEvaluationDetails(evalContext),
+		Logs:              evalContext.Logs,
+		ConditionResults:  evalContext.ConditionResults,
+		PrevState:         evalContext.PrevAlertState,
+	})
+}
+
+func (t *ruleTraces) get(key ruleKey) (*RuleTrace, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	trace, ok := t.traces[key]
+	if !ok {
+		return nil, false
+	}
+	copied := *trace
+	copied.Evaluations = append([]*EvaluationTrace(nil), trace.Evaluations...)
+	return &copied, true
+}
+
+// prune forgets the rules that are no longer scheduled.
+func (t *ruleTraces) prune(rules []*Rule) {
+	scheduled := make(map[ruleKey]bool, len(rules))
+	for _, rule := range rules {
+		scheduled[ruleKeyOf(rule)] = true
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	for key := range t.traces {
+		if !scheduled[key] {
+			delete(t.traces, key)
+		}
+	}
+}
+
+// EnableTrace records a detailed trace of the evaluations of the rule of
+// the org starting within duration, which is then retrievable with
+// GetTrace. Tracing stops by itself after the duration.
+func (e *AlertEngine) EnableTrace(orgID, ruleID int64, duration time.Duration) {
+	e.traces.enable(ruleKey{orgID: orgID, id: ruleID}, e.clock.Now().Add(duration))
+}
+
+// GetTrace returns the trace of the evaluations of the rule of the org
+// recorded since its tracing was last enabled.
+func (e *AlertEngine) GetTrace(orgID, ruleID int64) (*RuleTrace, bool) {
+	return e.traces.get(ruleKey{orgID: orgID, id: ruleID})
+}
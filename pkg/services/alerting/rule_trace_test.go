@@ -0,0 +1,82 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineRuleTrace(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	mock := clock.NewMock()
+	engine.clock = mock
+	engine.resultHandler = &FakeResultHandler{}
+	engine.resultQueue = nil
+	engine.evalHandler = NewEvalHandler(nil)
+
+	traced := &Rule{ID: 1, OrgID: 1, State: models.AlertStateOK, Conditions: []Condition{&conditionStub{firing: true, datasourceID: 3}}}
+	// the rule of another org with the same id is not traced
+	other := &Rule{ID: 1, OrgID: 2, State: models.AlertStateOK, Conditions: []Condition{&conditionStub{firing: true}}}
+	process := func(rule *Rule) {
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}))
+	}
+
+	process(traced)
+	_, ok := engine.GetTrace(1, 1)
+	require.False(t, ok)
+
+	engine.EnableTrace(1, 1, time.Minute)
+	process(traced)
+	process(other)
+
+	trace, ok := engine.GetTrace(1, 1)
+	require.True(t, ok)
+	require.Equal(t, mock.Now().Add(time.Minute), trace.EnabledUntil)
+	require.Len(t, trace.Evaluations, 1)
+	evaluation := trace.Evaluations[0]
+	require.Equal(t, models.AlertStateAlerting, evaluation.PrevState)
+	require.Equal(t, models.AlertStateAlerting, evaluation.State)
+	require.True(t, evaluation.Firing)
+	require.Len(t, evaluation.ConditionResults, 1)
+	require.Equal(t, int64(3), evaluation.ConditionResults[0].DatasourceID)
+
+	_, ok = engine.GetTrace(2, 1)
+	require.False(t, ok)
+
+	// tracing stops by itself after the duration
+	mock.Add(time.Minute)
+	process(traced)
+	trace, _ = engine.GetTrace(1, 1)
+	require.Len(t, trace.Evaluations, 1)
+
+	// the trace is forgotten with the rule
+	engine.traces.prune(nil)
+	_, ok = engine.GetTrace(1, 1)
+	require.False(t, ok)
+}
+
+func TestRuleTracesBound(t *testing.T) {
+	traces := newRuleTraces()
+	traces.enable(ruleKey{id: 1}, time.Now().Add(time.Hour))
+
+	for i := 0; i < maxTracedEvaluations+5; i++ {
+		evalContext := NewEvalContext(context.Background(), &Rule{ID: 1}, nil)
+		evalContext.StartTime = time.Unix(int64(i), 0)
+		traces.record(evalContext)
+	}
+
+	trace, ok := traces.get(ruleKey{id: 1})
+	require.True(t, ok)
+	require.Len(t, trace.Evaluations, maxTracedEvaluations)
+	require.Equal(t, time.Unix(5, 0), trace.Evaluations[0].StartTime)
+}
@@ -0,0 +1,94 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// RuleLoadError is an alert rule which failed to load and is not
+// evaluated, along with the reason why.
+type RuleLoadError struct {
+	AlertID     int64  `json:"alertId"`
+	OrgID       int64  `json:"orgId"`
+	DashboardID int64  `json:"dashboardId"`
+	PanelID     int64  `json:"panelId"`
+	Name        string `json:"name"`
+	Reason      string `json:"reason"`
+}
+
+func newRuleLoadError(ruleDef *models.Alert, err error) RuleLoadError {
+	return RuleLoadError{
+		AlertID:     ruleDef.Id,
+		OrgID:       ruleDef.OrgId,
+		DashboardID: ruleDef.DashboardId,
+		PanelID:     ruleDef.PanelId,
+		Name:        ruleDef.Name,
+		Reason:      err.Error(),
+	}
+}
+
+type datasourceKey struct {
+	orgID int64
+	id    int64
+}
+
+// ruleValidator checks the alert rules for the mistakes which would only
+// surface when evaluating them. The datasources looked up are cached for
+// the lifetime of the validator, that is a single load of the rules.
+type ruleValidator struct {
+	datasources map[datasourceKey]error
+}
+
+func newRuleValidator() *ruleValidator {
+	return &ruleValidator{datasources: make(map[datasourceKey]error)}
+}
+
+// validate returns a ValidationError if the rule cannot be evaluated.
+func (v *ruleValidator) validate(rule *Rule) error {
+	if rule.Frequency <= 0 {
+		return ValidationError{Err: ErrFrequencyCannotBeZeroOrLess, DashboardID: rule.DashboardID, AlertID: rule.ID, PanelID: rule.PanelID}
+	}
+
+	conditions := append(append(append([]Condition{}, rule.PreCheck...), rule.Conditions...), rule.Shadow...)
+	for _, condition := range conditions {
+		dc, ok := condition.(DatasourceCondition)
+		if !ok {
+			continue
+		}
+		if err := v.checkDatasource(rule.OrgID, dc.GetDatasourceID()); err != nil {
+			return ValidationError{Reason: fmt.Sprintf("Could not find datasource %d: %s", dc.GetDatasourceID(), err), DashboardID: rule.DashboardID, AlertID: rule.ID, PanelID: rule.PanelID}
+		}
+	}
+	return nil
+}
+
+// checkDatasource returns an error if the datasource does not exist. The
+// failures to look the datasource up are not taken for its absence, for a
+// database hiccup not to drop the rules from the schedule.
+func (v *ruleValidator) checkDatasource(orgID, id int64) error {
+	key := datasourceKey{orgID: orgID, id: id}
+	if err, ok := v.datasources[key]; ok {
+		return err
+	}
+
+	query := &models.GetDataSourceQuery{Id: id, OrgId: orgID}
+	err := bus.Dispatch(query)
+	if !errors.Is(err, models.ErrDataSourceNotFound) && !errors.Is(err, models.ErrDataSourceIdentifierNotSet) {
+		err = nil
+	}
+	v.datasources[key] = err
+	return err
+}
+
+// InvalidRules returns the alert rules which failed to load on the last
+// fetch of the rules, and are not evaluated until they are fixed.
+func (e *AlertEngine) InvalidRules() []RuleLoadError {
+	reader, ok := e.ruleReader.(ruleLoadErrorReader)
+	if !ok {
+		return []RuleLoadError{}
+	}
+	return append([]RuleLoadError{}, reader.loadErrors()...)
+}
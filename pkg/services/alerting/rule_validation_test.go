@@ -0,0 +1,90 @@
+package alerting
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleReaderInvalidRules(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &conditionStub{datasourceID: model.Get("datasourceId").MustInt64(1)}, nil
+	})
+
+	newAlert := func(id int64, frequency int64, rawSettings string) *models.Alert {
+		settings, err := simplejson.NewJson([]byte(rawSettings))
+		require.NoError(t, err)
+		return &models.Alert{Id: id, OrgId: 1, Name: "rule", Frequency: frequency, Settings: settings}
+	}
+
+	lookups := 0
+	bus.AddHandler("test", func(query *models.GetDataSourceQuery) error {
+		lookups++
+		switch query.Id {
+		case 2:
+			return models.ErrDataSourceNotFound
+		case 3:
+			return errors.New("database is locked")
+		default:
+			query.Result = &models.DataSource{Id: query.Id, OrgId: query.OrgId}
+			return nil
+		}
+	})
+	bus.AddHandler("test", func(query *models.GetAllAlertsQuery) error {
+		query.Result = []*models.Alert{
+			newAlert(1, 60, `{"conditions": [{"type": "test"}]}`),
+			newAlert(2, 60, `{"conditions": []}`),
+			newAlert(3, 60, `{"conditions": [{"type": "test", "datasourceId": 2}]}`),
+			newAlert(4, -10, `{"conditions": [{"type": "test"}]}`),
+			newAlert(5, 60, `{"conditions": [{"type": "test"}, {"type": "test"}]}`),
+			newAlert(6, 60, `{"conditions": [{"type": "test"}], "preCheck": [{"type": "test", "datasourceId": 2}]}`),
+			newAlert(7, 60, `{"conditions": [{"type": "test", "datasourceId": 3}]}`),
+		}
+		return nil
+	})
+
+	engine := &AlertEngine{ruleReader: newRuleReader(nil)}
+	require.Empty(t, engine.InvalidRules(), "no rule is invalid before the rules are fetched")
+
+	rules, err := engine.ruleReader.fetch()
+	require.NoError(t, err)
+
+	var ids []int64
+	for _, rule := range rules {
+		ids = append(ids, rule.ID)
+	}
+	require.Equal(t, []int64{1, 5, 7}, ids, "the valid rules are loaded along with the invalid ones")
+	require.Equal(t, 3, lookups, "the datasources are looked up once per fetch")
+
+	invalid := engine.InvalidRules()
+	require.Len(t, invalid, 4)
+	reasons := make(map[int64]string)
+	for _, loadErr := range invalid {
+		require.Equal(t, int64(1), loadErr.OrgID)
+		require.Equal(t, "rule", loadErr.Name)
+		reasons[loadErr.AlertID] = loadErr.Reason
+	}
+	require.Contains(t, reasons[2], "Alert is missing conditions")
+	require.Contains(t, reasons[3], "Could not find datasource 2")
+	require.Contains(t, reasons[4], ErrFrequencyCannotBeZeroOrLess.Error())
+	require.Contains(t, reasons[6], "Could not find datasource 2")
+
+	t.Run("the invalid rules are those of the last fetch", func(t *testing.T) {
+		bus.AddHandler("test", func(query *models.GetAllAlertsQuery) error {
+			query.Result = []*models.Alert{newAlert(1, 60, `{"conditions": [{"type": "test"}]}`)}
+			return nil
+		})
+		_, err := engine.ruleReader.fetch()
+		require.NoError(t, err)
+		require.Empty(t, engine.InvalidRules())
+	})
+
+	t.Run("rule readers not reporting load errors", func(t *testing.T) {
+		engine := &AlertEngine{ruleReader: &fakeRuleReader{}}
+		require.Empty(t, engine.InvalidRules())
+	})
+}
@@ -0,0 +1,105 @@
+package alerting
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// RunningJob is a job of an alert rule in progress, being evaluated, retried
+// or notified.
+type RunningJob struct {
+	RuleID    int64
+	OrgID     int64
+	Name      string
+	StartedAt time.Time
+}
+
+// runningJob snapshots the key and name of the rule when the job starts,
+// the scheduler replacing the rule of the job when the rules are reloaded.
+type runningJob struct {
+	job     *Job
+	key     ruleKey
+	name    string
+	cancels *jobCancels
+}
+
+// runningJobs keeps track of the jobs in progress by rule, along with the
+// cancel funcs of their contexts, so that a stuck job can be canceled on
+// its own. A rule has a single job running at a time, the scheduler not
+// enqueuing the jobs still running.
+type runningJobs struct {
+	mtx  sync.Mutex
+	jobs map[ruleKey]*runningJob
+}
+
+func newRunningJobs() *runningJobs {
+	return &runningJobs{jobs: make(map[ruleKey]*runningJob)}
+}
+
+// add registers the job in progress. It returns a func to call once the job ends.
+func (r *runningJobs) add(job *Job, cancels *jobCancels) func() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	rule := job.GetRule()
+	running := &runningJob{job: job, key: ruleKeyOf(rule), name: rule.Name, cancels: cancels}
+	r.jobs[running.key] = running
+
+	return func() {
+		r.mtx.Lock()
+		defer r.mtx.Unlock()
+		if r.jobs[running.key] == running {
+			delete(r.jobs, running.key)
+		}
+	}
+}
+
+func (r *runningJobs) get(key ruleKey) (*runningJob, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	running, ok := r.jobs[key]
+	return running, ok
+}
+
+func (r *runningJobs) list() []RunningJob {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	jobs := make([]RunningJob, 0, len(r.jobs))
+	for _, running := range r.jobs {
+		jobs = append(jobs, RunningJob{
+			RuleID:    running.key.id,
+			OrgID:     running.key.orgID,
+			Name:      running.name,
+			StartedAt: running.job.GetStartedAt(),
+		})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].RuleID != jobs[j].RuleID {
+			return jobs[i].RuleID < jobs[j].RuleID
+		}
+		return jobs[i].OrgID < jobs[j].OrgID
+	})
+	return jobs
+}
+
+// RunningJobs returns the jobs in progress, ordered by rule and org id.
+func (e *AlertEngine) RunningJobs() []RunningJob {
+	return e.runningJobs.list()
+}
+
+// CancelJob cancels the job in progress of the alert rule of the org, e.g.
+// when it is stuck on a datasource, without restarting the engine. The
+// contexts of the job are canceled and the job ends right away, freeing its
+// worker, while the result of its evaluation is dropped. It returns false if
+// the rule has no job running.
+func (e *AlertEngine) CancelJob(orgID, ruleID int64) bool {
+	running, ok := e.runningJobs.get(ruleKey{orgID: orgID, id: ruleID})
+	if !ok {
+		return false
+	}
+	e.log.Info("Canceling alert rule job", "alertId", ruleID, "orgId", orgID, "name", running.name, "running", e.clock.Now().Sub(running.job.GetStartedAt()))
+	running.cancels.abandon()
+	return true
+}
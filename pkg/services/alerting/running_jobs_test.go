@@ -0,0 +1,82 @@
+package alerting
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+// cancelableEvalHandler blocks until the evaluation context is canceled.
+type cancelableEvalHandler struct {
+	started  chan struct{}
+	canceled chan error
+}
+
+func (h *cancelableEvalHandler) Eval(evalContext *EvalContext) {
+	h.started <- struct{}{}
+	<-evalContext.Ctx.Done()
+	h.canceled <- evalContext.Ctx.Err()
+}
+
+func TestEngineCancelJob(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := newRunnableEngine(t)
+	evalHandler := &cancelableEvalHandler{started: make(chan struct{}, 1), canceled: make(chan error, 1)}
+	engine.evalHandler = evalHandler
+	resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+	engine.resultHandler = resultHandler
+	engine.resultQueue = nil
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- engine.RunDispatcher(context.Background()) }()
+
+	require.Empty(t, engine.RunningJobs())
+	require.False(t, engine.CancelJob(1, 1), "no job is running")
+
+	job := &Job{Rule: &Rule{ID: 1, OrgID: 1, Name: "stuck", State: models.AlertStateOK}}
+	engine.Enqueue(job)
+	select {
+	case <-evalHandler.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the job to be evaluated")
+	}
+
+	running := engine.RunningJobs()
+	require.Len(t, running, 1)
+	require.Equal(t, int64(1), running[0].RuleID)
+	require.Equal(t, int64(1), running[0].OrgID)
+	require.Equal(t, "stuck", running[0].Name)
+	require.Equal(t, job.GetStartedAt(), running[0].StartedAt)
+
+	require.False(t, engine.CancelJob(1, 2), "the rule has no job running")
+	require.False(t, engine.CancelJob(2, 1), "the rule of the other org with the same id has no job running")
+	require.True(t, engine.CancelJob(1, 1))
+
+	select {
+	case err := <-evalHandler.canceled:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the evaluation context to be canceled")
+	}
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&engine.live.workers) == 0 && !job.GetRunning() && len(engine.RunningJobs()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the result of the canceled job is dropped
+	select {
+	case <-resultHandler.handled:
+		t.Fatal("the result of a canceled job should not be handled")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, engine.Stop(context.Background()))
+	require.NoError(t, <-runErr)
+}
@@ -0,0 +1,134 @@
+package alerting
+
+import (
+	"time"
+
+	"github.com/grafana/grafana/pkg/setting"
+)
+
+// The clustering modes of the engine.
+const (
+	ClusteringModeDisabled    = "disabled"
+	ClusteringModeLease       = "lease"
+	ClusteringModeAssignments = "assignments"
+	ClusteringModeWeights     = "weights"
+)
+
+// EngineConfig is the configuration the engine runs with, the settings it
+// was started with along with the ones changed since by reloads, once their
+// defaults are applied.
+type EngineConfig struct {
+	EvaluationTimeout   time.Duration
+	NotificationTimeout time.Duration
+	ShutdownGracePeriod time.Duration
+
+	MaxAttempts      int
+	RetryBackoffBase time.Duration
+	RetryBackoffCap  time.Duration
+	RetryMaxElapsed  time.Duration
+
+	MinInterval       time.Duration
+	EvalOrder         string
+	MaxInFlightCost   int64
+	MaxEvalDatapoints int64
+	ExecQueueSize     int
+	// ResultHandlerWorkers is the number of workers handling the results of
+	// the evaluations, zero when the evaluations handle their own result.
+	ResultHandlerWorkers int
+	ResultQueueSize      int
+
+	ClusteringMode     string
+	ClusteringInstance string
+	// ClusteringTimeout is the time the active instance must stop renewing
+	// its lease for before it is taken over, with the lease mode.
+	ClusteringTimeout  time.Duration
+	ClusteringFailMode string
+
+	NotificationsDisabled    bool
+	EvalLagThreshold         float64
+	StaleEvaluationThreshold float64
+	DeletedRuleGracePeriod   time.Duration
+
+	DatasourceHealthThreshold float64
+	DatasourceHealthLatency   time.Duration
+}
+
+// RuntimeConfig returns the configuration the engine runs with, e.g. to be
+// attached to a support request. The settings cached by the engine are
+// read from the engine rather than from the settings, which may have been
+// changed by a reload the engine kept their current value for.
+func (e *AlertEngine) RuntimeConfig() EngineConfig {
+	config := EngineConfig{
+		EvaluationTimeout:        setting.AlertingEvaluationTimeout,
+		NotificationTimeout:      setting.AlertingNotificationTimeout,
+		MaxAttempts:              setting.AlertingMaxAttempts,
+		RetryBackoffBase:         setting.AlertingRetryBackoffBase,
+		RetryBackoffCap:          setting.AlertingRetryBackoffCap,
+		RetryMaxElapsed:          setting.AlertingRetryMaxElapsed,
+		MinInterval:              time.Duration(setting.AlertingMinInterval) * time.Second,
+		EvalOrder:                setting.AlertingEvalOrder,
+		MaxEvalDatapoints:        setting.AlertingMaxEvalDatapoints,
+		ExecQueueSize:            cap(e.execQueue),
+		ClusteringMode:           e.clusteringMode(),
+		ClusteringInstance:       setting.AlertingClusteringInstance,
+		ClusteringTimeout:        time.Duration(setting.AlertingClusteringTimeout) * time.Second,
+		ClusteringFailMode:       setting.AlertingClusteringFailMode,
+		NotificationsDisabled:    setting.AlertingNotificationsDisabled,
+		EvalLagThreshold:         setting.AlertingEvalLagThreshold,
+		StaleEvaluationThreshold: setting.AlertingStaleEvaluationThreshold,
+		DeletedRuleGracePeriod:   setting.AlertingDeletedRuleGracePeriod,
+
+		DatasourceHealthThreshold: setting.AlertingDatasourceHealthThreshold,
+		DatasourceHealthLatency:   setting.AlertingDatasourceHealthLatency,
+	}
+	if e.resultQueue != nil {
+		config.ResultHandlerWorkers = setting.AlertingResultHandlerWorkers
+		config.ResultQueueSize = cap(e.resultQueue)
+	}
+
+	e.settingsLock.RLock()
+	config.ShutdownGracePeriod = e.unfinishedWorkTimeout
+	config.MaxInFlightCost = e.maxCost
+	e.settingsLock.RUnlock()
+
+	if lease, ok := e.Lease.(*cacheLease); ok {
+		lease.mtx.Lock()
+		config.ClusteringTimeout = lease.timeout
+		lease.mtx.Unlock()
+	}
+	if e.evalLag != nil {
+		e.evalLag.Lock()
+		config.EvalLagThreshold = e.evalLag.threshold
+		e.evalLag.Unlock()
+	}
+	if e.staleEvals != nil {
+		e.staleEvals.Lock()
+		config.StaleEvaluationThreshold = e.staleEvals.threshold
+		e.staleEvals.Unlock()
+	}
+	if e.dsHealth != nil {
+		e.dsHealth.Lock()
+		config.DatasourceHealthThreshold = e.dsHealth.threshold
+		config.DatasourceHealthLatency = e.dsHealth.latency
+		e.dsHealth.Unlock()
+	}
+	if e.tombstones != nil {
+		e.tombstones.Lock()
+		config.DeletedRuleGracePeriod = e.tombstones.gracePeriod
+		e.tombstones.Unlock()
+	}
+	return config
+}
+
+func (e *AlertEngine) clusteringMode() string {
+	switch {
+	case !setting.AlertingClusteringEnabled:
+		return ClusteringModeDisabled
+	case e.partition == nil:
+		return ClusteringModeLease
+	case len(setting.AlertingClusteringWeights) > 0:
+		return ClusteringModeWeights
+	default:
+		return ClusteringModeAssignments
+	}
+}
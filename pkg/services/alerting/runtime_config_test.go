@@ -0,0 +1,66 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngineRuntimeConfig(t *testing.T) {
+	newCfg := func(keys map[string]string) *setting.Cfg {
+		cfg := setting.NewCfg()
+		section, err := cfg.Raw.NewSection("alerting")
+		require.NoError(t, err)
+		for key, value := range keys {
+			_, err := section.NewKey(key, value)
+			require.NoError(t, err)
+		}
+		return cfg
+	}
+
+	// the settings are package globals, put back the ones the other tests rely on
+	defaultCfg := newCfg(map[string]string{"clustering_instance": setting.AlertingClusteringInstance})
+	t.Cleanup(func() {
+		require.NoError(t, defaultCfg.ReadAlertingSettings())
+		setting.AlertingEvaluationTimeout = 30 * time.Second
+		setting.AlertingNotificationTimeout = 30 * time.Second
+	})
+
+	require.NoError(t, defaultCfg.ReadAlertingSettings())
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+
+	config := engine.RuntimeConfig()
+	require.Equal(t, 30*time.Second, config.EvaluationTimeout)
+	require.Equal(t, 3, config.MaxAttempts)
+	require.Equal(t, 5*time.Second, config.ShutdownGracePeriod)
+	require.Equal(t, int64(0), config.MaxInFlightCost)
+	require.Equal(t, 1000, config.ExecQueueSize)
+	require.Equal(t, 0, config.ResultHandlerWorkers)
+	require.Equal(t, ClusteringModeDisabled, config.ClusteringMode)
+	require.Equal(t, 0.8, config.EvalLagThreshold)
+	require.Equal(t, 300*time.Second, config.DeletedRuleGracePeriod)
+
+	require.NoError(t, engine.Reload(newCfg(map[string]string{
+		"evaluation_timeout_seconds":        "7",
+		"max_attempts":                      "2",
+		"shutdown_grace_period_seconds":     "12",
+		"max_in_flight_cost":                "4",
+		"eval_lag_threshold":                "0.5",
+		"deleted_rule_grace_period_seconds": "60",
+		"result_handler_workers":            "4",
+		"datasource_health_threshold":       "0.3",
+	})))
+
+	config = engine.RuntimeConfig()
+	require.Equal(t, 7*time.Second, config.EvaluationTimeout)
+	require.Equal(t, 2, config.MaxAttempts)
+	require.Equal(t, 12*time.Second, config.ShutdownGracePeriod)
+	require.Equal(t, int64(4), config.MaxInFlightCost)
+	require.Equal(t, 0.5, config.EvalLagThreshold)
+	require.Equal(t, 60*time.Second, config.DeletedRuleGracePeriod)
+	require.Equal(t, 0.3, config.DatasourceHealthThreshold)
+	require.Equal(t, 0, config.ResultHandlerWorkers, "the result handler workers are only set up at startup")
+}
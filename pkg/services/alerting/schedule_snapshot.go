@@ -0,0 +1,111 @@
+package alerting
+
+import (
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// ScheduledRuleInfo describes an alert rule known to the scheduler.
+type ScheduledRuleInfo struct {
+	RuleID    int64
+	OrgID     int64
+	Name      string
+	Frequency time.Duration
+	Paused    bool
+	Running   bool
+	// LastRun is the time the rule was last put on the exec queue,
+	// it is zero when the rule was not evaluated since it was scheduled.
+	LastRun time.Time
+	// NextRun is the time the rule is next put on the exec queue,
+	// it is zero when the rule is paused.
+	NextRun time.Time
+	// BoostedUntil is the end of the boost of the frequency of the rule,
+	// Frequency being the boosted frequency until then. It is zero when
+	// the frequency is not boosted.
+	BoostedUntil time.Time
+}
+
+// Snapshot returns the scheduling state of every rule, ordered by rule id and org.
+// Next runs are computed from the last tick, or from now if there was none.
+func (s *schedulerImpl) Snapshot(now time.Time) []ScheduledRuleInfo {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	from := now
+	if !s.lastTick.IsZero() {
+		from = s.lastTick
+	}
+
+	infos := make([]ScheduledRuleInfo, 0, len(s.jobs))
+	for key, job := range s.jobs {
+		info := ScheduledRuleInfo{
+			RuleID:    job.Rule.ID,
+			OrgID:     job.Rule.OrgID,
+			Name:      job.Rule.Name,
+			Frequency: time.Duration(job.Rule.Frequency) * time.Second,
+			Paused:    job.Rule.State == models.AlertStatePaused,
+			Running:   job.GetRunning(),
+			LastRun:   s.lastRuns[key],
+		}
+		boost, boosted := s.boosts[key]
+		boosted = boosted && from.Before(boost.until)
+		if boosted {
+			info.Frequency = time.Duration(boost.frequency) * time.Second
+			info.BoostedUntil = boost.until
+		}
+		if !info.Paused {
+			info.NextRun = time.Unix(nextRun(job, from.Unix()), 0)
+			if boosted {
+				info.NextRun = time.Unix(nextMultiple(from.Unix()+1, boost.frequency), 0)
+				if !info.NextRun.Before(boost.until) {
+					// the rule is back to its frequency by then
+					info.NextRun = time.Unix(nextRun(job, boost.until.Unix()-1), 0)
+				}
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].RuleID != infos[j].RuleID {
+			return infos[i].RuleID < infos[j].RuleID
+		}
+		return infos[i].OrgID < infos[j].OrgID
+	})
+	return infos
+}
+
+// nextRun returns the first tick after `tick` at which Tick enqueues the job,
+// assuming it is not running by then.
+func nextRun(job *Job, tick int64) int64 {
+	if job.Rule.Schedule != nil {
+		return job.Rule.Schedule.Next(time.Unix(tick, 0)).Unix()
+	}
+
+	if job.Offset <= 0 {
+		return nextMultiple(tick+1, job.Rule.Frequency)
+	}
+
+	if !job.OffsetWait {
+		// the job waits for its offset from the next tick matching its frequency
+		tick = nextMultiple(tick+1, job.Rule.Frequency)
+	}
+	return nextMultiple(tick+1, job.Offset)
+}
+
+// nextMultiple returns the smallest multiple of m greater than or equal to n.
+func nextMultiple(n, m int64) int64 {
+	if r := n % m; r != 0 {
+		return n + m - r
+	}
+	return n
+}
+
+// ScheduleSnapshot returns every alert rule scheduled by the engine with
+// its frequency, its last and next runs and whether it is running.
+// It reads the scheduling state without altering it.
+func (e *AlertEngine) ScheduleSnapshot() []ScheduledRuleInfo {
+	return e.scheduler.Snapshot(e.clock.Now())
+}
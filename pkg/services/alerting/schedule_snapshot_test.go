@@ -0,0 +1,76 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScheduleSnapshot(t *testing.T) {
+	origMinInterval := setting.AlertingMinInterval
+	t.Cleanup(func() { setting.AlertingMinInterval = origMinInterval })
+	setting.AlertingMinInterval = 1
+
+	s := newScheduler().(*schedulerImpl)
+	s.Update([]*Rule{
+		{ID: 1, Name: "every 10s", Frequency: 10},
+		{ID: 2, Name: "every 30s", Frequency: 30},
+		{ID: 3, Name: "every 7s", Frequency: 7},
+		{ID: 4, Name: "paused", Frequency: 10, State: models.AlertStatePaused},
+	})
+
+	start := time.Unix(1000, 0)
+	snapshot := s.Snapshot(start)
+	require.Len(t, snapshot, 4)
+	for i, info := range snapshot {
+		require.Equal(t, int64(i+1), info.RuleID)
+		require.True(t, info.LastRun.IsZero())
+	}
+	require.Equal(t, 30*time.Second, snapshot[1].Frequency)
+	require.True(t, snapshot[3].Paused)
+	require.True(t, snapshot[3].NextRun.IsZero())
+
+	// the predicted next runs must match the ticks at which the rules are enqueued
+	predicted := map[int64]time.Time{}
+	for _, info := range snapshot[:3] {
+		predicted[info.RuleID] = info.NextRun
+	}
+
+	execQueue := make(chan *Job, 10)
+	enqueued := map[int64]time.Time{}
+	lastEnqueued := map[int64]time.Time{}
+	for i := 1; i <= 60 && len(enqueued) < 3; i++ {
+		tick := start.Add(time.Duration(i) * time.Second)
+		s.Tick(tick, execQueue)
+		for len(execQueue) > 0 {
+			job := <-execQueue
+			lastEnqueued[job.Rule.ID] = tick
+			if _, ok := enqueued[job.Rule.ID]; !ok {
+				enqueued[job.Rule.ID] = tick
+			}
+		}
+	}
+	require.Equal(t, predicted, enqueued)
+
+	snapshot = s.Snapshot(time.Now())
+	for _, info := range snapshot[:3] {
+		require.Equal(t, lastEnqueued[info.RuleID], info.LastRun)
+		require.True(t, info.NextRun.After(info.LastRun))
+	}
+
+	t.Run("keeps the last runs across updates", func(t *testing.T) {
+		s.Update([]*Rule{{ID: 1, Name: "every 10s", Frequency: 10}})
+
+		snapshot := s.Snapshot(time.Now())
+		require.Len(t, snapshot, 1)
+		require.Equal(t, lastEnqueued[1], snapshot[0].LastRun)
+	})
+
+	t.Run("reports running jobs", func(t *testing.T) {
+		s.jobs[ruleKey{id: 1}].SetRunning(true)
+		require.True(t, s.Snapshot(time.Now())[0].Running)
+	})
+}
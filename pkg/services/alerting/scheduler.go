@@ -1,84 +1,361 @@
 package alerting
 
 import (
+	"fmt"
 	"math"
+	"math/rand"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
 	"github.com/grafana/grafana/pkg/models"
 	"github.com/grafana/grafana/pkg/setting"
 )
 
+// ruleKey identifies an alert rule in the scheduler by its org and id, so
+// that rules of different orgs never overwrite each other, even if their
+// ids collide, e.g. after a faulty migration.
+type ruleKey struct {
+	orgID int64
+	id    int64
+}
+
+func ruleKeyOf(rule *Rule) ruleKey {
+	return ruleKey{orgID: rule.OrgID, id: rule.ID}
+}
+
 type schedulerImpl struct {
-	jobs map[int64]*Job
-	log  log.Logger
+	// mtx guards the scheduling state, which is read by ScheduleSnapshot
+	// while the alerting ticker updates it.
+	mtx      sync.Mutex
+	jobs     map[ruleKey]*Job
+	lastRuns map[ruleKey]time.Time
+	lastTick time.Time
+	log      log.Logger
+
+	// clampedRules holds the rules whose frequency has been raised to
+	// the minimum interval, so the warning is only logged once per rule.
+	clampedRules map[ruleKey]bool
+
+	// deferred holds the jobs that were due while the exec queue was full,
+	// which are enqueued before the jobs due on the next tick.
+	deferred []*Job
+
+	// activity streams the jobs enqueued, it is nil when not subscribed to.
+	activity *engineActivity
+
+	// boosts holds the temporary frequencies of the rules.
+	boosts map[ruleKey]frequencyBoost
+
+	// ungatedRules holds the dependent rules whose dependency is ignored,
+	// as their parent rule isn't scheduled or depends on them in turn.
+	ungatedRules map[ruleKey]bool
+
+	// throttles holds the slowdowns of the degraded datasources.
+	throttles map[int64]int64
 }
 
 func newScheduler() scheduler {
 	return &schedulerImpl{
-		jobs: make(map[int64]*Job),
-		log:  log.New("alerting.scheduler"),
+		jobs:         make(map[ruleKey]*Job),
+		lastRuns:     make(map[ruleKey]time.Time),
+		log:          log.New("alerting.scheduler"),
+		clampedRules: make(map[ruleKey]bool),
+		boosts:       make(map[ruleKey]frequencyBoost),
+		ungatedRules: make(map[ruleKey]bool),
+		throttles:    make(map[int64]int64),
 	}
 }
 
 func (s *schedulerImpl) Update(rules []*Rule) {
 	s.log.Debug("Scheduling update", "ruleCount", len(rules))
 
-	jobs := make(map[int64]*Job)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	jobs := make(map[ruleKey]*Job)
+	lastRuns := make(map[ruleKey]time.Time)
+	clampedRules := make(map[ruleKey]bool)
+	// the rules of an evaluation group share the offset of its first rule
+	// for them to be due on the same ticks
+	groupOffsets := make(map[string]int64)
+	orgsByID := make(map[int64]int64)
 
 	for i, rule := range rules {
+		key := ruleKeyOf(rule)
+		if _, ok := jobs[key]; ok {
+			s.log.Error("Alert rule is loaded twice, only scheduling it once", "ruleId", rule.ID, "orgId", rule.OrgID, "name", rule.Name)
+			continue
+		}
+		if orgID, ok := orgsByID[rule.ID]; ok && orgID != rule.OrgID {
+			s.log.Warn("Alert rule id is shared by several orgs, scheduling their rules independently",
+				"ruleId", rule.ID, "orgId", rule.OrgID, "otherOrgId", orgID, "name", rule.Name)
+		}
+		orgsByID[rule.ID] = rule.OrgID
+
+		// Enforce the minimum interval between evaluations
+		if rule.Frequency < setting.AlertingMinInterval {
+			if !s.clampedRules[key] {
+				s.log.Warn("Alert rule frequency is below the minimum interval, using the minimum interval instead",
+					"ruleId", rule.ID, "name", rule.Name, "frequency", rule.Frequency, "minInterval", setting.AlertingMinInterval)
+			}
+			clampedRules[key] = true
+			rule.Frequency = setting.AlertingMinInterval
+		}
+
 		var job *Job
-		if s.jobs[rule.ID] != nil {
-			job = s.jobs[rule.ID]
+		if s.jobs[key] != nil {
+			job = s.jobs[key]
 		} else {
 			job = &Job{}
 			job.SetRunning(false)
 		}
 
-		job.Rule = rule
+		job.SetRule(rule)
 
 		offset := ((rule.Frequency * 1000) / int64(len(rules))) * int64(i)
 		job.Offset = int64(math.Floor(float64(offset) / 1000))
 		if job.Offset == 0 { // zero offset causes division with 0 panics.
 			job.Offset = 1
 		}
-		jobs[rule.ID] = job
+		if rule.EvaluationGroup != "" {
+			if groupOffset, ok := groupOffsets[evaluationGroupKey(rule)]; ok {
+				job.Offset = groupOffset
+			} else {
+				groupOffsets[evaluationGroupKey(rule)] = job.Offset
+			}
+		}
+		jobs[key] = job
+		if lastRun, ok := s.lastRuns[key]; ok {
+			lastRuns[key] = lastRun
+		}
+	}
+
+	for key := range s.boosts {
+		if _, ok := jobs[key]; !ok {
+			delete(s.boosts, key)
+		}
 	}
 
 	s.jobs = jobs
+	s.lastRuns = lastRuns
+	s.clampedRules = clampedRules
+	s.ungatedRules = s.findUngatedRules(jobs)
+}
+
+// findUngatedRules returns the dependent rules whose dependency can't gate
+// their evaluations, which are evaluated at their frequency instead: the
+// ones depending on a rule which isn't scheduled, e.g. a deleted one, and
+// the ones depending on each other, which would never be evaluated.
+func (s *schedulerImpl) findUngatedRules(jobs map[ruleKey]*Job) map[ruleKey]bool {
+	ungated := make(map[ruleKey]bool)
+	for key, job := range jobs {
+		if job.Rule.DependsOn == 0 {
+			continue
+		}
+
+		reason := ""
+		parentKey := ruleKey{orgID: key.orgID, id: job.Rule.DependsOn}
+		if _, ok := jobs[parentKey]; !ok {
+			reason = "the rule it depends on is not scheduled"
+		} else {
+			// follows the dependencies for as many rules as there are
+			for i := 0; i < len(jobs) && parentKey.id != 0; i++ {
+				if parentKey == key {
+					reason = "its dependencies are cyclic"
+					break
+				}
+				parent, ok := jobs[parentKey]
+				if !ok {
+					break
+				}
+				parentKey.id = parent.Rule.DependsOn
+			}
+		}
+		if reason == "" {
+			continue
+		}
+
+		if !s.ungatedRules[key] {
+			s.log.Warn("Ignoring the dependency of the alert rule, "+reason, "ruleId", key.id, "orgId", key.orgID, "dependsOn", job.Rule.DependsOn)
+		}
+		ungated[key] = true
+	}
+	return ungated
+}
+
+// gateDependents drops the dependent rules whose parent rule isn't alerting
+// from the jobs due, they keep their state until it is. s.mtx must be held.
+func (s *schedulerImpl) gateDependents(due []*Job) []*Job {
+	gated := due[:0]
+	for _, job := range due {
+		key := ruleKeyOf(job.Rule)
+		if job.Rule.DependsOn != 0 && !s.ungatedRules[key] {
+			parent := s.jobs[ruleKey{orgID: key.orgID, id: job.Rule.DependsOn}]
+			if parent.Rule.State != models.AlertStateAlerting {
+				s.log.Debug("Skipping the alert rule, the rule it depends on is not alerting", "ruleId", key.id, "dependsOn", job.Rule.DependsOn, "parentState", parent.Rule.State)
+				continue
+			}
+		}
+		gated = append(gated, job)
+	}
+	return gated
 }
 
 func (s *schedulerImpl) Tick(tickTime time.Time, execQueue chan *Job) {
 	now := tickTime.Unix()
 
-	for _, job := range s.jobs {
+	s.mtx.Lock()
+	s.lastTick = tickTime
+	var deferred []*Job
+	isDeferred := make(map[ruleKey]bool, len(s.deferred))
+	for _, job := range s.deferred {
+		// the rule may have been removed or paused since
+		if s.jobs[ruleKeyOf(job.Rule)] != job || job.Rule.State == models.AlertStatePaused {
+			continue
+		}
+		deferred = append(deferred, job)
+		isDeferred[ruleKeyOf(job.Rule)] = true
+	}
+
+	var due []*Job
+	for key, job := range s.jobs {
 		if job.GetRunning() || job.Rule.State == models.AlertStatePaused {
 			continue
 		}
 
-		if job.OffsetWait && now%job.Offset == 0 {
-			job.OffsetWait = false
-			s.enqueue(job, execQueue)
+		if frequency, boosted := s.boostedFrequency(job, tickTime); boosted {
+			if now%frequency == 0 && !isDeferred[key] {
+				due = append(due, job)
+			}
 			continue
 		}
 
-		// Check the job frequency against the minimum interval required
-		interval := job.Rule.Frequency
-		if interval < setting.AlertingMinInterval {
-			interval = setting.AlertingMinInterval
+		if job.Rule.Schedule != nil {
+			if scheduleMatches(job.Rule.Schedule, tickTime) && !isDeferred[key] {
+				due = append(due, job)
+			}
+			continue
 		}
 
-		if now%interval == 0 {
+		if job.OffsetWait && now%job.Offset == 0 {
+			job.OffsetWait = false
+			if !isDeferred[key] {
+				due = append(due, job)
+			}
+			continue
+		}
+
+		if now%job.Rule.Frequency == 0 {
 			if job.Offset > 0 {
 				job.OffsetWait = true
-			} else {
-				s.enqueue(job, execQueue)
+			} else if !isDeferred[key] {
+				due = append(due, job)
 			}
 		}
 	}
+	due = s.admit(due, tickTime)
+	due = s.gateDependents(due)
+	groups := make(map[string][]*Job)
+	for _, job := range due {
+		s.lastRuns[ruleKeyOf(job.Rule)] = tickTime
+		job.SetEnqueuedAt(tickTime)
+		job.SetBatch(nil)
+		if job.Rule.EvaluationGroup != "" {
+			groups[evaluationGroupKey(job.Rule)] = append(groups[evaluationGroupKey(job.Rule)], job)
+		}
+	}
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		rules := make([]*Rule, 0, len(group))
+		for _, job := range group {
+			rules = append(rules, job.Rule)
+		}
+		batch := newEvalBatch(tickTime, rules)
+		for _, job := range group {
+			job.SetBatch(batch)
+		}
+	}
+	s.mtx.Unlock()
+
+	if len(due) > 1 {
+		orderJobs(due, setting.AlertingEvalOrder)
+	}
+
+	// the jobs deferred on the previous ticks keep their place ahead of
+	// the jobs due on this tick.
+	jobs := append(deferred, due...)
+	deferred = nil
+	for i, job := range jobs {
+		if !s.enqueue(job, execQueue) {
+			deferred = append(deferred, jobs[i:]...)
+			break
+		}
+	}
+
+	if len(deferred) > 0 {
+		metrics.MAlertingSchedulerBackpressure.Add(float64(len(deferred)))
+		s.log.Warn("Scheduler: exec queue is full, deferring jobs to the next tick", "deferred", len(deferred), "queueCapacity", cap(execQueue))
+	}
+
+	s.mtx.Lock()
+	s.deferred = deferred
+	s.mtx.Unlock()
 }
 
-func (s *schedulerImpl) enqueue(job *Job, execQueue chan *Job) {
-	s.log.Debug("Scheduler: Putting job on to exec queue", "name", job.Rule.Name, "id", job.Rule.ID)
-	execQueue <- job
+// evaluationGroupKey returns the key of the evaluation group of the rule,
+// the groups of different organizations are distinct.
+func evaluationGroupKey(rule *Rule) string {
+	return fmt.Sprintf("%d/%s", rule.OrgID, rule.EvaluationGroup)
+}
+
+// for stubbing in tests
+//nolint: gocritic
+var shuffleJobs = func(jobs []*Job) {
+	rand.Shuffle(len(jobs), func(i, j int) { jobs[i], jobs[j] = jobs[j], jobs[i] })
+}
+
+// orderJobs sorts the jobs due on the same tick in the order they are put on the exec queue.
+func orderJobs(jobs []*Job, order string) {
+	switch order {
+	case setting.EvalOrderRandom:
+		// avoid starving the same rules every time the engine is under load
+		shuffleJobs(jobs)
+	case setting.EvalOrderByLastError:
+		// evaluate the most recently failing rules first to confirm their recovery
+		sort.SliceStable(jobs, func(i, j int) bool {
+			ei, ej := jobs[i].GetLastErrorAt(), jobs[j].GetLastErrorAt()
+			if !ei.Equal(ej) {
+				return ei.After(ej)
+			}
+			return jobs[i].Rule.ID < jobs[j].Rule.ID
+		})
+	default:
+		sort.Slice(jobs, func(i, j int) bool { return jobs[i].Rule.ID < jobs[j].Rule.ID })
+	}
+}
+
+// Job returns the job of the scheduled rule.
+func (s *schedulerImpl) Job(key ruleKey) (*Job, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	job, ok := s.jobs[key]
+	return job, ok
+}
+
+// enqueue puts the job on the exec queue without blocking the ticker,
+// it returns false if the queue is full.
+func (s *schedulerImpl) enqueue(job *Job, execQueue chan *Job) bool {
+	select {
+	case execQueue <- job:
+		s.log.Debug("Scheduler: Putting job on to exec queue", "name", job.Rule.Name, "id", job.Rule.ID)
+		s.activity.enqueued(job)
+		return true
+	default:
+		return false
+	}
 }
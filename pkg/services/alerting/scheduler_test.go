@@ -0,0 +1,381 @@
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	log.Logger
+	warnings []string
+	errors   []string
+}
+
+func (l *recordingLogger) Debug(msg string, ctx ...interface{}) {}
+
+func (l *recordingLogger) Info(msg string, ctx ...interface{}) {}
+
+func (l *recordingLogger) Warn(msg string, ctx ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprint(append([]interface{}{msg}, ctx...)...))
+}
+
+func (l *recordingLogger) Error(msg string, ctx ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprint(append([]interface{}{msg}, ctx...)...))
+}
+
+func TestSchedulerMinInterval(t *testing.T) {
+	origMinInterval := setting.AlertingMinInterval
+	t.Cleanup(func() { setting.AlertingMinInterval = origMinInterval })
+	setting.AlertingMinInterval = 10
+
+	logger := &recordingLogger{}
+	s := newScheduler().(*schedulerImpl)
+	s.log = logger
+
+	s.Update([]*Rule{{ID: 1, Name: "fast rule", Frequency: 1}})
+	s.Update([]*Rule{{ID: 1, Name: "fast rule", Frequency: 1}})
+
+	require.Equal(t, int64(10), s.jobs[ruleKey{id: 1}].Rule.Frequency)
+	require.Len(t, logger.warnings, 1, "the clamp should only be logged once per rule")
+
+	execQueue := make(chan *Job, 10)
+	start := time.Unix(1000, 0)
+	for i := 0; i < 20; i++ {
+		s.Tick(start.Add(time.Duration(i)*time.Second), execQueue)
+	}
+	require.Len(t, execQueue, 2, "a 1s rule should only run every 10s")
+}
+
+func TestSchedulerRuleIDsAcrossOrgs(t *testing.T) {
+	logger := &recordingLogger{}
+	s := newScheduler().(*schedulerImpl)
+	s.log = logger
+
+	s.Update([]*Rule{
+		{ID: 7, OrgID: 1, Name: "org 1 rule", Frequency: 10},
+		{ID: 7, OrgID: 2, Name: "org 2 rule", Frequency: 30},
+		{ID: 7, OrgID: 1, Name: "org 1 rule loaded twice", Frequency: 10},
+	})
+
+	require.Len(t, s.jobs, 2)
+	require.Equal(t, "org 1 rule", s.jobs[ruleKey{orgID: 1, id: 7}].Rule.Name)
+	require.Equal(t, "org 2 rule", s.jobs[ruleKey{orgID: 2, id: 7}].Rule.Name)
+	require.Len(t, logger.warnings, 1, "the id shared by the orgs is logged")
+	require.Len(t, logger.errors, 1, "the rule loaded twice is logged")
+
+	execQueue := make(chan *Job, 10)
+	runs := map[int64]int{}
+	start := time.Unix(1200, 0)
+	for i := 0; i < 60; i++ {
+		s.Tick(start.Add(time.Duration(i)*time.Second), execQueue)
+		for len(execQueue) > 0 {
+			runs[(<-execQueue).Rule.OrgID]++
+		}
+	}
+	require.Equal(t, map[int64]int{1: 6, 2: 2}, runs, "the rules are scheduled at their own frequency")
+
+	snapshot := s.Snapshot(start)
+	require.Len(t, snapshot, 2)
+	require.Equal(t, int64(1), snapshot[0].OrgID)
+	require.Equal(t, 10*time.Second, snapshot[0].Frequency)
+	require.Equal(t, int64(2), snapshot[1].OrgID)
+	require.Equal(t, 30*time.Second, snapshot[1].Frequency)
+}
+
+func TestEngineRuleIDsAcrossOrgs(t *testing.T) {
+	origEvaluationTimeout, origNotificationTimeout, origMaxAttempts := setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts
+	t.Cleanup(func() {
+		setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts = origEvaluationTimeout, origNotificationTimeout, origMaxAttempts
+	})
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	engine.evalHandler = NewEvalHandler(nil)
+	engine.resultHandler = &FakeResultHandler{}
+	engine.resultQueue = nil
+
+	org1 := &Rule{ID: 7, OrgID: 1, Frequency: 10, Notifications: []string{"ops"}, Conditions: []Condition{&deltaCondition{value: 100, delta: 10}}}
+	org2 := &Rule{ID: 7, OrgID: 2, Frequency: 10, Notifications: []string{"ops"}, Conditions: []Condition{&deltaCondition{value: 500, delta: 10}}}
+	reader := &fakeRuleReader{rules: []*Rule{org1, org2}}
+	engine.ruleReader = reader
+	require.NoError(t, engine.RefreshRules())
+
+	for _, rule := range []*Rule{org1, org2} {
+		job, ok := engine.scheduler.Job(ruleKeyOf(rule))
+		require.True(t, ok)
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+	}
+
+	require.Equal(t, null.FloatFrom(100), engine.previousValues.get(org1)[0]["requests"])
+	require.Equal(t, null.FloatFrom(500), engine.previousValues.get(org2)[0]["requests"])
+
+	// the rule of org 1 compares its value with its own previous value
+	org1.Conditions = []Condition{&deltaCondition{value: 200, delta: 10}}
+	job, _ := engine.scheduler.Job(ruleKeyOf(org1))
+	require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+	details, ok := engine.LastEvaluation(1, 7)
+	require.True(t, ok)
+	require.True(t, details.Firing)
+	details, ok = engine.LastEvaluation(2, 7)
+	require.True(t, ok)
+	require.False(t, details.Firing)
+
+	// deleting the rule of org 2 leaves the rule of org 1 alone
+	reader.rules = []*Rule{org1}
+	require.NoError(t, engine.RefreshRules())
+	require.True(t, engine.tombstones.isDeleted(org2))
+	require.False(t, engine.tombstones.isDeleted(org1))
+	require.Nil(t, engine.previousValues.get(org2))
+	require.Equal(t, null.FloatFrom(200), engine.previousValues.get(org1)[0]["requests"])
+	_, ok = engine.LastEvaluation(1, 7)
+	require.True(t, ok)
+	_, ok = engine.LastEvaluation(2, 7)
+	require.False(t, ok)
+}
+
+func TestSchedulerEvaluationOffset(t *testing.T) {
+	// returns the ticks the rule runs on for a minute
+	runs := func(rule *Rule) []time.Time {
+		s := newScheduler().(*schedulerImpl)
+		s.Update([]*Rule{rule})
+
+		execQueue := make(chan *Job, 10)
+		var ticks []time.Time
+		start := time.Unix(1200, 0)
+		for i := 0; i < 60; i++ {
+			tick := start.Add(time.Duration(i) * time.Second)
+			s.Tick(tick, execQueue)
+			for len(execQueue) > 0 {
+				<-execQueue
+				ticks = append(ticks, tick)
+			}
+		}
+		return ticks
+	}
+
+	withOffset := runs(&Rule{ID: 1, Frequency: 10, EvaluationOffset: 30 * time.Second})
+	require.Len(t, withOffset, 6, "the offset doesn't change the frequency of the rule")
+	require.Equal(t, runs(&Rule{ID: 1, Frequency: 10}), withOffset, "the offset doesn't delay the evaluations")
+}
+
+func TestSchedulerDependentRules(t *testing.T) {
+	logger := &recordingLogger{}
+	s := newScheduler().(*schedulerImpl)
+	s.log = logger
+	s.Update([]*Rule{
+		{ID: 1, OrgID: 1, Name: "service degraded", Frequency: 10, State: models.AlertStateOK},
+		{ID: 2, OrgID: 1, Name: "endpoint a", Frequency: 10, DependsOn: 1, State: models.AlertStateOK},
+		{ID: 3, OrgID: 1, Name: "endpoint b", Frequency: 10, DependsOn: 1, State: models.AlertStateAlerting},
+	})
+	require.Empty(t, logger.warnings)
+
+	start := time.Unix(1200, 0)
+	// returns the ids of the rules run over 10s from the offset ticks on
+	runs := func(offset int) map[int64]int {
+		execQueue := make(chan *Job, 10)
+		ids := map[int64]int{}
+		for i := offset; i < offset+10; i++ {
+			s.Tick(start.Add(time.Duration(i)*time.Second), execQueue)
+			for len(execQueue) > 0 {
+				ids[(<-execQueue).Rule.ID]++
+			}
+		}
+		return ids
+	}
+
+	// the first runs wait for the offsets of the rules
+	runs(0)
+	require.Equal(t, map[int64]int{1: 1}, runs(10), "the dependents are skipped while the parent is ok")
+	require.Equal(t, models.AlertStateAlerting, s.jobs[ruleKey{orgID: 1, id: 3}].Rule.State, "the skipped dependents keep their state")
+
+	s.jobs[ruleKey{orgID: 1, id: 1}].Rule.State = models.AlertStateAlerting
+	require.Equal(t, map[int64]int{1: 1, 2: 1, 3: 1}, runs(20), "the dependents run while the parent is alerting")
+
+	s.jobs[ruleKey{orgID: 1, id: 1}].Rule.State = models.AlertStatePending
+	require.Equal(t, map[int64]int{1: 1}, runs(30))
+
+	t.Run("the dependencies which can't gate the rules are ignored", func(t *testing.T) {
+		logger := &recordingLogger{}
+		s := newScheduler().(*schedulerImpl)
+		s.log = logger
+		rules := []*Rule{
+			{ID: 1, OrgID: 1, Frequency: 10, DependsOn: 2},
+			{ID: 2, OrgID: 1, Frequency: 10, DependsOn: 1},
+			{ID: 3, OrgID: 1, Frequency: 10, DependsOn: 7},
+			// the parent of another org
+			{ID: 4, OrgID: 2, Frequency: 10, DependsOn: 5},
+			{ID: 5, OrgID: 1, Frequency: 10},
+		}
+		s.Update(rules)
+		s.Update(rules)
+
+		require.Equal(t, map[ruleKey]bool{{orgID: 1, id: 1}: true, {orgID: 1, id: 2}: true, {orgID: 1, id: 3}: true, {orgID: 2, id: 4}: true}, s.ungatedRules)
+		require.Len(t, logger.warnings, 4, "the ignored dependencies are logged once")
+	})
+}
+
+func TestSchedulerCronSchedule(t *testing.T) {
+	schedule, err := parseSchedule("0 18 * * *", "America/New_York")
+	require.NoError(t, err)
+
+	s := newScheduler().(*schedulerImpl)
+	s.Update([]*Rule{
+		{ID: 1, Frequency: 60, Schedule: schedule},
+		{ID: 2, Frequency: 60},
+	})
+
+	location, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	execQueue := make(chan *Job, 10)
+	var fired []time.Time
+	// from 17:58 to 18:02 in New York, on every second
+	start := time.Date(2021, 6, 4, 17, 58, 0, 0, location)
+	for i := 0; i < 4*60; i++ {
+		tick := start.Add(time.Duration(i) * time.Second)
+		s.Tick(tick, execQueue)
+		for len(execQueue) > 0 {
+			job := <-execQueue
+			if job.Rule.ID == 1 {
+				fired = append(fired, tick)
+			}
+		}
+	}
+
+	require.Equal(t, []time.Time{time.Date(2021, 6, 4, 18, 0, 0, 0, location)}, fired)
+
+	infos := s.Snapshot(start)
+	require.Equal(t, time.Date(2021, 6, 5, 18, 0, 0, 0, location).Unix(), infos[0].NextRun.Unix())
+}
+
+func TestSchedulerEvalOrder(t *testing.T) {
+	origMinInterval, origEvalOrder := setting.AlertingMinInterval, setting.AlertingEvalOrder
+	t.Cleanup(func() {
+		setting.AlertingMinInterval = origMinInterval
+		setting.AlertingEvalOrder = origEvalOrder
+	})
+	setting.AlertingMinInterval = 1
+
+	// returns the ids of the rules in the order they are enqueued on the first tick they are all due
+	enqueueOrder := func(t *testing.T, s *schedulerImpl) []int64 {
+		t.Helper()
+		execQueue := make(chan *Job, 10)
+		start := time.Unix(1000, 0)
+		for i := 0; i < 10 && len(execQueue) == 0; i++ {
+			s.Tick(start.Add(time.Duration(i)*time.Second), execQueue)
+		}
+
+		var ids []int64
+		for len(execQueue) > 0 {
+			ids = append(ids, (<-execQueue).Rule.ID)
+		}
+		return ids
+	}
+
+	newScheduler := func(ids ...int64) *schedulerImpl {
+		s := newScheduler().(*schedulerImpl)
+		var rules []*Rule
+		for _, id := range ids {
+			rules = append(rules, &Rule{ID: id, Frequency: 1})
+		}
+		s.Update(rules)
+		return s
+	}
+
+	t.Run("by id", func(t *testing.T) {
+		setting.AlertingEvalOrder = setting.EvalOrderByID
+		require.Equal(t, []int64{1, 2, 3, 4, 5}, enqueueOrder(t, newScheduler(4, 2, 5, 1, 3)))
+	})
+
+	t.Run("by last error", func(t *testing.T) {
+		setting.AlertingEvalOrder = setting.EvalOrderByLastError
+		s := newScheduler(1, 2, 3, 4, 5)
+		s.jobs[ruleKey{id: 4}].SetLastErrorAt(time.Unix(900, 0))
+		s.jobs[ruleKey{id: 2}].SetLastErrorAt(time.Unix(950, 0))
+
+		require.Equal(t, []int64{2, 4, 1, 3, 5}, enqueueOrder(t, s))
+	})
+
+	t.Run("random", func(t *testing.T) {
+		origShuffleJobs := shuffleJobs
+		t.Cleanup(func() { shuffleJobs = origShuffleJobs })
+		shuffled := 0
+		shuffleJobs = func(jobs []*Job) {
+			shuffled++
+			// a deterministic "shuffle" putting the highest ids first
+			sort.Slice(jobs, func(i, j int) bool { return jobs[i].Rule.ID > jobs[j].Rule.ID })
+		}
+
+		setting.AlertingEvalOrder = setting.EvalOrderRandom
+		require.Equal(t, []int64{5, 4, 3, 2, 1}, enqueueOrder(t, newScheduler(1, 2, 3, 4, 5)))
+		require.Equal(t, 1, shuffled)
+	})
+}
+
+func TestSchedulerBackpressure(t *testing.T) {
+	origMinInterval, origEvalOrder := setting.AlertingMinInterval, setting.AlertingEvalOrder
+	t.Cleanup(func() {
+		setting.AlertingMinInterval = origMinInterval
+		setting.AlertingEvalOrder = origEvalOrder
+	})
+	setting.AlertingMinInterval = 1
+	setting.AlertingEvalOrder = setting.EvalOrderByID
+
+	logger := &recordingLogger{}
+	s := newScheduler().(*schedulerImpl)
+	s.log = logger
+	var rules []*Rule
+	for id := int64(1); id <= 5; id++ {
+		rules = append(rules, &Rule{ID: id, Frequency: 1})
+	}
+	s.Update(rules)
+
+	drain := func(execQueue chan *Job) []int64 {
+		var ids []int64
+		for len(execQueue) > 0 {
+			ids = append(ids, (<-execQueue).Rule.ID)
+		}
+		return ids
+	}
+
+	// the exec queue only has room for 2 of the 5 rules due on the second tick
+	execQueue := make(chan *Job, 2)
+	deferredBefore := testutil.ToFloat64(metrics.MAlertingSchedulerBackpressure)
+	start := time.Unix(1000, 0)
+	s.Tick(start, execQueue)
+
+	done := make(chan struct{})
+	go func() {
+		s.Tick(start.Add(time.Second), execQueue)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the tick should not block on a full exec queue")
+	}
+
+	require.Equal(t, []int64{1, 2}, drain(execQueue))
+	require.Len(t, s.deferred, 3)
+	require.Equal(t, float64(3), testutil.ToFloat64(metrics.MAlertingSchedulerBackpressure)-deferredBefore)
+	require.Len(t, logger.warnings, 1)
+
+	// the deferred rules are enqueued first on the next tick, the paused ones are dropped
+	s.jobs[ruleKey{id: 4}].Rule.State = models.AlertStatePaused
+	s.Tick(start.Add(2*time.Second), execQueue)
+	require.Equal(t, []int64{3, 5}, drain(execQueue))
+	require.Empty(t, s.deferred)
+}
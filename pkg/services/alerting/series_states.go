@@ -0,0 +1,132 @@
+package alerting
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// seriesKey identifies the series of an eval match by its name and tags.
+func seriesKey(match *EvalMatch) string {
+	return SeriesKey(match.Metric, match.Tags)
+}
+
+// SeriesKey identifies a series by its name and tags, e.g. `cpu{host=a}`.
+func SeriesKey(name string, tags map[string]string) string {
+	if len(tags) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteString("{")
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(key)
+		b.WriteString("=")
+		b.WriteString(tags[key])
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// evalSeriesStates decides the state of every series of a per-series rule:
+// the series of the eval matches of a firing evaluation are alerting, and
+// the series which were alerting and no longer match are ok. The series
+// keep their states when the rule could not be evaluated or has no data,
+// its state then being decided for the whole rule.
+func evalSeriesStates(context *EvalContext) {
+	if context.Error != nil || context.NoDataFound || context.Skipped {
+		return
+	}
+
+	states := make(map[string]models.AlertStateType)
+	for key := range context.runtime.SeriesStates {
+		states[key] = models.AlertStateOK
+	}
+	if context.Firing {
+		for _, match := range context.EvalMatches {
+			states[seriesKey(match)] = models.AlertStateAlerting
+		}
+	}
+
+	context.PrevSeriesStates = context.runtime.SeriesStates
+	context.SeriesStates = states
+}
+
+// trackSeriesStates records the alerting series of the evaluation in the
+// in-memory state of the rule, once the state of the rule is decided. The series only start
+// alerting once the rule does, for its `For` duration to apply to them.
+func (c *EvalContext) trackSeriesStates() {
+	if c.SeriesStates == nil {
+		return
+	}
+
+	if c.Rule.State == models.AlertStatePending {
+		for key, state := range c.SeriesStates {
+			if state == models.AlertStateAlerting {
+				c.SeriesStates[key] = c.prevSeriesState(key)
+			}
+		}
+	}
+
+	alerting := make(map[string]models.AlertStateType)
+	for key, state := range c.SeriesStates {
+		if state == models.AlertStateAlerting {
+			alerting[key] = state
+		}
+	}
+	c.runtime.SeriesStates = alerting
+}
+
+// prevSeriesState returns the state of the series before the evaluation.
+func (c *EvalContext) prevSeriesState(key string) models.AlertStateType {
+	if state, ok := c.PrevSeriesStates[key]; ok {
+		return state
+	}
+	return models.AlertStateOK
+}
+
+// changedSeries returns the keys of the series whose state was changed by
+// the evaluation, in order.
+func (c *EvalContext) changedSeries() []string {
+	var keys []string
+	for key, state := range c.SeriesStates {
+		if state != c.prevSeriesState(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// forSeries returns a copy of the evaluation scoped to one of its series,
+// with the state change and the eval matches of the series, for its
+// notifications to be sent independently of the other series.
+func (c *EvalContext) forSeries(key string) *EvalContext {
+	rule := *c.Rule
+	rule.State = c.SeriesStates[key]
+
+	seriesContext := *c
+	seriesContext.Rule = &rule
+	seriesContext.PrevAlertState = c.prevSeriesState(key)
+	seriesContext.SeriesKey = key
+	seriesContext.EvalMatches = make([]*EvalMatch, 0)
+	for _, match := range c.EvalMatches {
+		if seriesKey(match) == key {
+			seriesContext.EvalMatches = append(seriesContext.EvalMatches, match)
+		}
+	}
+	seriesContext.Firing = len(seriesContext.EvalMatches) > 0
+	seriesContext.Notifications = nil
+	return &seriesContext
+}
@@ -0,0 +1,135 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+type seriesNotification struct {
+	series  string
+	state   models.AlertStateType
+	matches int
+}
+
+type seriesRecordingNotifier struct {
+	testNotifier
+	sent *[]seriesNotification
+}
+
+func (n *seriesRecordingNotifier) Notify(evalCtx *EvalContext) error {
+	*n.sent = append(*n.sent, seriesNotification{series: evalCtx.SeriesKey, state: evalCtx.Rule.State, matches: len(evalCtx.EvalMatches)})
+	return nil
+}
+
+func TestSeriesKey(t *testing.T) {
+	require.Equal(t, "cpu", seriesKey(&EvalMatch{Metric: "cpu"}))
+	require.Equal(t, "cpu{dc=eu,host=a}", seriesKey(&EvalMatch{Metric: "cpu", Tags: map[string]string{"host": "a", "dc": "eu"}}))
+}
+
+func TestEnginePerSeriesRule(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	var sent []seriesNotification
+	RegisterNotifier(&NotifierPlugin{
+		Type: "test-series",
+		Name: "Test series",
+		Factory: func(model *models.AlertNotification) (Notifier, error) {
+			return &seriesRecordingNotifier{testNotifier: testNotifier{UID: model.Uid, Type: model.Type}, sent: &sent}, nil
+		},
+	})
+
+	origRepo := annotations.GetRepository()
+	annotations.SetRepository(&fakeAnnotationsRepo{})
+	t.Cleanup(func() { annotations.SetRepository(origRepo) })
+
+	bus.AddHandler("test", func(cmd *models.SetAlertStateCommand) error {
+		cmd.Result = models.Alert{Id: cmd.AlertId, State: cmd.State, StateChanges: 1}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = []*models.AlertNotification{{Id: 1, Uid: "series", Type: "test-series", Settings: simplejson.New()}}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetOrCreateNotificationStateQuery) error {
+		query.Result = &models.AlertNotificationState{AlertId: query.AlertId, NotifierId: query.NotifierId}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		return nil
+	})
+
+	engine := &AlertEngine{StateStore: &fakeStateStore{states: map[ruleKey]RuleState{}}}
+	require.NoError(t, engine.Init())
+
+	condition := &conditionStub{}
+	rule := &Rule{ID: 1, OrgID: 1, Frequency: 60, State: models.AlertStateOK, PerSeries: true,
+		Notifications: []string{"series"}, Conditions: []Condition{condition}}
+	job := &Job{Rule: rule}
+
+	host := func(name string) *EvalMatch {
+		return &EvalMatch{Metric: "cpu", Value: null.FloatFrom(95), Tags: map[string]string{"host": name}}
+	}
+	evaluate := func(matches ...*EvalMatch) []seriesNotification {
+		sent = nil
+		condition.firing = len(matches) > 0
+		condition.matches = matches
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		return sent
+	}
+
+	require.Equal(t, []seriesNotification{{series: "cpu{host=a}", state: models.AlertStateAlerting, matches: 1}},
+		evaluate(host("a")))
+	require.Equal(t, models.AlertStateAlerting, rule.State)
+
+	require.Equal(t, []seriesNotification{{series: "cpu{host=b}", state: models.AlertStateAlerting, matches: 1}},
+		evaluate(host("a"), host("b")), "a series firing while the rule is alerting is notified for")
+
+	require.Empty(t, evaluate(host("a"), host("b")), "the series still firing are not notified for again")
+
+	require.Equal(t, []seriesNotification{{series: "cpu{host=a}", state: models.AlertStateOK}},
+		evaluate(host("b")), "a series resolving while the others fire is notified for")
+	require.Equal(t, models.AlertStateAlerting, rule.State)
+	require.Equal(t, map[string]models.AlertStateType{"cpu{host=b}": models.AlertStateAlerting}, engine.runtimes.get(rule).SeriesStates)
+
+	require.Equal(t, []seriesNotification{{series: "cpu{host=b}", state: models.AlertStateOK}}, evaluate())
+	require.Equal(t, models.AlertStateOK, rule.State)
+	require.Empty(t, engine.runtimes.get(rule).SeriesStates)
+
+	t.Run("the series start alerting once the rule does", func(t *testing.T) {
+		rule.For = time.Hour
+		t.Cleanup(func() { rule.For = 0 })
+
+		require.Empty(t, evaluate(host("a")))
+		require.Equal(t, models.AlertStatePending, rule.State)
+		require.Empty(t, engine.runtimes.get(rule).SeriesStates)
+	})
+
+	t.Run("the evaluations without data keep the series states", func(t *testing.T) {
+		rule.State = models.AlertStateOK
+		evaluate(host("a"))
+		require.Equal(t, models.AlertStateAlerting, rule.State)
+
+		rule.NoDataState = models.NoDataSetNoData
+		condition.firing, condition.matches, condition.noData = false, nil, true
+		t.Cleanup(func() { condition.noData = false })
+		sent = nil
+		require.NoError(t, engine.processJobWithRetry(context.Background(), job))
+		require.Equal(t, models.AlertStateNoData, rule.State)
+		require.Equal(t, []seriesNotification{{state: models.AlertStateNoData}}, sent, "the rule is notified for as a whole")
+		require.Equal(t, map[string]models.AlertStateType{"cpu{host=a}": models.AlertStateAlerting}, engine.runtimes.get(rule).SeriesStates)
+	})
+}
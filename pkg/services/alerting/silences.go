@@ -0,0 +1,206 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+var (
+	// ErrInvalidSilence is returned when a silence has no matchers or doesn't end after it starts.
+	ErrInvalidSilence = errors.New("silences need at least one matcher and must end after they start")
+	// ErrSilenceNotFound is returned when removing a silence which doesn't exist or has expired.
+	ErrSilenceNotFound = errors.New("silence not found")
+)
+
+// Silence suppresses the notifications of the alert rules of its org whose
+// tags match its matchers from the time it starts to the time it ends, e.g.
+// during a planned deployment. The silenced rules are still evaluated.
+type Silence struct {
+	ID    int64
+	OrgID int64
+	// Matchers is the comma separated list of matchers of the silenced
+	// rules, in the syntax of the rule selector.
+	Matchers string
+	StartsAt time.Time
+	EndsAt   time.Time
+
+	selector labelSelector
+}
+
+func (s *Silence) active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+// overlaps returns true if the silences of the same org have the same matchers
+// and their time ranges overlap or follow each other without a gap.
+func (s *Silence) overlaps(other *Silence) bool {
+	return s.OrgID == other.OrgID && s.Matchers == other.Matchers && !s.EndsAt.Before(other.StartsAt) && !other.EndsAt.Before(s.StartsAt)
+}
+
+// normalizeMatchers returns the matchers sorted and trimmed, so that the
+// silences of the same rules have the same matchers however they are written.
+func normalizeMatchers(raw string) string {
+	var matchers []string
+	for _, matcher := range strings.Split(raw, ",") {
+		if matcher = strings.TrimSpace(matcher); matcher != "" {
+			kv := strings.SplitN(matcher, "=", 2)
+			if len(kv) == 2 {
+				matcher = strings.TrimSpace(kv[0]) + "=" + strings.TrimSpace(kv[1])
+			}
+			matchers = append(matchers, matcher)
+		}
+	}
+	sort.Strings(matchers)
+	return strings.Join(matchers, ",")
+}
+
+// silences holds the silences of the engine. They are kept in memory,
+// so they only apply to the notifications sent by the instance they were
+// added to and don't survive a restart.
+type silences struct {
+	mtx      sync.Mutex
+	clock    clock.Clock
+	nextID   int64
+	silences map[int64]*Silence
+}
+
+func newSilences(clock clock.Clock) *silences {
+	return &silences{clock: clock, nextID: 1, silences: make(map[int64]*Silence)}
+}
+
+// add adds the silence and returns its id. A silence overlapping others
+// of the same org and matchers is merged with them into a single silence
+// covering all their time ranges, whose id is returned.
+func (s *silences) add(orgID int64, matchers string, startsAt, endsAt time.Time) (int64, error) {
+	matchers = normalizeMatchers(matchers)
+	if matchers == "" || !endsAt.After(startsAt) {
+		return 0, ErrInvalidSilence
+	}
+	selector, err := parseLabelSelector(matchers)
+	if err != nil {
+		return 0, fmt.Errorf("invalid silence matchers: %w", err)
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.gc()
+
+	silence := &Silence{OrgID: orgID, Matchers: matchers, StartsAt: startsAt, EndsAt: endsAt, selector: selector}
+	var merged []*Silence
+	for _, other := range s.silences {
+		if other.overlaps(silence) {
+			merged = append(merged, other)
+		}
+	}
+	if len(merged) == 0 {
+		silence.ID = s.nextID
+		s.nextID++
+		s.silences[silence.ID] = silence
+		return silence.ID, nil
+	}
+
+	// the oldest of the merged silences is kept
+	sort.Slice(merged, func(i, j int) bool { return merged[i].ID < merged[j].ID })
+	kept := merged[0]
+	for _, other := range append(merged[1:], silence) {
+		if other.StartsAt.Before(kept.StartsAt) {
+			kept.StartsAt = other.StartsAt
+		}
+		if other.EndsAt.After(kept.EndsAt) {
+			kept.EndsAt = other.EndsAt
+		}
+		delete(s.silences, other.ID)
+	}
+	return kept.ID, nil
+}
+
+func (s *silences) remove(id int64) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.gc()
+
+	if _, ok := s.silences[id]; !ok {
+		return ErrSilenceNotFound
+	}
+	delete(s.silences, id)
+	return nil
+}
+
+// list returns the silences which haven't expired, ordered by id.
+func (s *silences) list() []Silence {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.gc()
+
+	list := make([]Silence, 0, len(s.silences))
+	for _, silence := range s.silences {
+		list = append(list, *silence)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// silenced returns true, along with the id of the silence, if the
+// notifications of the rule are suppressed by an active silence.
+func (s *silences) silenced(rule *Rule) (int64, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := s.clock.Now()
+	for id, silence := range s.silences {
+		if silence.OrgID == rule.OrgID && silence.active(now) && silence.selector.matches(rule) {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// expire drops the silences which have ended.
+func (s *silences) expire() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.gc()
+}
+
+func (s *silences) gc() {
+	now := s.clock.Now()
+	for id, silence := range s.silences {
+		if !now.Before(silence.EndsAt) {
+			delete(s.silences, id)
+		}
+	}
+}
+
+// AddSilence silences the notifications of the alert rules of the org whose
+// tags match the comma separated matchers, such as `team=payments,
+// env=~prod|staging`, from startsAt to endsAt. A silence overlapping others
+// of the org with the same matchers is merged with them, the id of the
+// merged silence is returned.
+func (e *AlertEngine) AddSilence(orgID int64, matchers string, startsAt, endsAt time.Time) (int64, error) {
+	id, err := e.silences.add(orgID, matchers, startsAt, endsAt)
+	if err != nil {
+		return 0, err
+	}
+	e.log.Info("Silence added", "id", id, "orgId", orgID, "matchers", matchers, "startsAt", startsAt, "endsAt", endsAt)
+	return id, nil
+}
+
+// RemoveSilence removes the silence, lifting it before it ends.
+func (e *AlertEngine) RemoveSilence(id int64) error {
+	if err := e.silences.remove(id); err != nil {
+		return err
+	}
+	e.log.Info("Silence removed", "id", id)
+	return nil
+}
+
+// Silences returns the silences which haven't ended.
+func (e *AlertEngine) Silences() []Silence {
+	return e.silences.list()
+}
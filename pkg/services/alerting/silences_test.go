@@ -0,0 +1,167 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSilences(t *testing.T) {
+	newRule := func(id int64, tags ...string) *Rule {
+		rule := &Rule{ID: id, OrgID: 1, State: models.AlertStateAlerting}
+		for i := 0; i < len(tags); i += 2 {
+			rule.AlertRuleTags = append(rule.AlertRuleTags, &models.Tag{Key: tags[i], Value: tags[i+1]})
+		}
+		return rule
+	}
+
+	t.Run("silences suppress the matching rules between their start and end", func(t *testing.T) {
+		mock := clock.NewMock()
+		s := newSilences(mock)
+		start := mock.Now().Add(time.Hour)
+		id, err := s.add(1, "team=payments, env=~prod|staging", start, start.Add(time.Hour))
+		require.NoError(t, err)
+
+		payments := newRule(1, "team", "payments", "env", "prod")
+		_, silenced := s.silenced(payments)
+		require.False(t, silenced, "the silence has not started")
+
+		mock.Add(time.Hour)
+		silenceID, silenced := s.silenced(payments)
+		require.True(t, silenced)
+		require.Equal(t, id, silenceID)
+		_, silenced = s.silenced(newRule(2, "team", "payments", "env", "dev"))
+		require.False(t, silenced, "the rules not matching all the matchers are not silenced")
+		_, silenced = s.silenced(newRule(3, "team", "search", "env", "prod"))
+		require.False(t, silenced)
+		otherOrg := newRule(1, "team", "payments", "env", "prod")
+		otherOrg.OrgID = 2
+		_, silenced = s.silenced(otherOrg)
+		require.False(t, silenced, "the rules of the other orgs are not silenced")
+
+		mock.Add(time.Hour)
+		_, silenced = s.silenced(payments)
+		require.False(t, silenced, "the silence has ended")
+	})
+
+	t.Run("overlapping silences of the same rules are merged", func(t *testing.T) {
+		mock := clock.NewMock()
+		s := newSilences(mock)
+		start := mock.Now()
+
+		first, err := s.add(1, "team=payments", start, start.Add(time.Hour))
+		require.NoError(t, err)
+		second, err := s.add(1, "team=search", start.Add(30*time.Minute), start.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.NotEqual(t, first, second, "silences of other rules are not merged")
+		otherOrg, err := s.add(2, "team=payments", start, start.Add(time.Hour))
+		require.NoError(t, err)
+		require.NotEqual(t, first, otherOrg, "silences of other orgs are not merged")
+		require.NoError(t, s.remove(otherOrg))
+
+		merged, err := s.add(1, " team = payments ", start.Add(30*time.Minute), start.Add(2*time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, first, merged)
+		third, err := s.add(1, "team=payments", start.Add(3*time.Hour), start.Add(4*time.Hour))
+		require.NoError(t, err)
+		require.NotEqual(t, first, third, "silences with a gap between them are not merged")
+
+		// a silence bridging the gap merges all of them
+		merged, err = s.add(1, "team=payments", start.Add(-time.Hour), start.Add(3*time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, first, merged)
+
+		list := s.list()
+		require.Len(t, list, 2)
+		require.Equal(t, first, list[0].ID)
+		require.Equal(t, "team=payments", list[0].Matchers)
+		require.True(t, start.Add(-time.Hour).Equal(list[0].StartsAt))
+		require.True(t, start.Add(4*time.Hour).Equal(list[0].EndsAt))
+		require.Equal(t, second, list[1].ID)
+	})
+
+	t.Run("expired silences are garbage collected", func(t *testing.T) {
+		mock := clock.NewMock()
+		s := newSilences(mock)
+		start := mock.Now()
+		short, err := s.add(1, "team=payments", start, start.Add(time.Minute))
+		require.NoError(t, err)
+		_, err = s.add(1, "team=search", start, start.Add(time.Hour))
+		require.NoError(t, err)
+
+		mock.Add(time.Minute)
+		s.expire()
+		require.Len(t, s.silences, 1)
+		require.ErrorIs(t, s.remove(short), ErrSilenceNotFound)
+	})
+
+	t.Run("invalid silences are rejected", func(t *testing.T) {
+		s := newSilences(clock.NewMock())
+		now := time.Now()
+		_, err := s.add(1, "", now, now.Add(time.Hour))
+		require.ErrorIs(t, err, ErrInvalidSilence)
+		_, err = s.add(1, "team=payments", now, now)
+		require.ErrorIs(t, err, ErrInvalidSilence)
+		_, err = s.add(1, "team", now, now.Add(time.Hour))
+		require.Error(t, err)
+	})
+
+	t.Run("engine api", func(t *testing.T) {
+		engine := &AlertEngine{}
+		require.NoError(t, engine.Init())
+		now := time.Now()
+		id, err := engine.AddSilence(1, "team=payments", now, now.Add(time.Hour))
+		require.NoError(t, err)
+		require.Len(t, engine.Silences(), 1)
+		require.NoError(t, engine.RemoveSilence(id))
+		require.Empty(t, engine.Silences())
+		require.ErrorIs(t, engine.RemoveSilence(id), ErrSilenceNotFound)
+	})
+}
+
+func TestResultHandlerSilences(t *testing.T) {
+	origRepo := annotations.GetRepository()
+	annotations.SetRepository(&fakeAnnotationsRepo{})
+	t.Cleanup(func() { annotations.SetRepository(origRepo) })
+
+	var setStateCmds []*models.SetAlertStateCommand
+	bus.AddHandler("test", func(cmd *models.SetAlertStateCommand) error {
+		setStateCmds = append(setStateCmds, cmd)
+		cmd.Result = models.Alert{Id: cmd.AlertId, State: cmd.State, StateChanges: 1}
+		return nil
+	})
+	notifiersQueried := 0
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		notifiersQueried++
+		return nil
+	})
+
+	mock := clock.NewMock()
+	silences := newSilences(mock)
+	_, err := silences.add(1, "team=payments", mock.Now(), mock.Now().Add(time.Hour))
+	require.NoError(t, err)
+	handler := newResultHandler(nil, &fakeStateStore{states: map[ruleKey]RuleState{}}, newInhibitor(nil), silences, nil, clock.New())
+
+	rule := &Rule{ID: 1, OrgID: 1, State: models.AlertStateOK, Notifications: []string{"notifier"}, AlertRuleTags: []*models.Tag{{Key: "team", Value: "payments"}}}
+	handle := func(state models.AlertStateType) {
+		evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		rule.State = state
+		require.NoError(t, handler.handle(evalContext))
+	}
+
+	handle(models.AlertStateAlerting)
+	require.Len(t, setStateCmds, 1, "the state of silenced rules is still updated")
+	require.Zero(t, notifiersQueried, "no notifier should be invoked while silenced")
+
+	mock.Add(time.Hour)
+	handle(models.AlertStateOK)
+	require.Len(t, setStateCmds, 2)
+	require.Equal(t, 1, notifiersQueried, "the notifications are sent once the silence ends")
+}
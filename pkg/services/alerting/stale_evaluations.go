@@ -0,0 +1,181 @@
+package alerting
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// StaleRule is an alert rule which hasn't been evaluated for several times
+// its frequency, e.g. because the engine is overloaded or was down.
+type StaleRule struct {
+	RuleID         int64
+	OrgID          int64
+	Name           string
+	Frequency      time.Duration
+	LastEvaluation time.Time
+}
+
+// staleEvaluations tracks the last evaluation of the rules scheduled by
+// the instance and flags the rules whose last evaluation is older than
+// `threshold` times their frequency. Unlike the conditions of the rules,
+// it catches the rules silently not evaluated at all.
+type staleEvaluations struct {
+	sync.Mutex
+	threshold float64
+	rules     map[ruleKey]*staleEvaluationState
+	log       log.Logger
+}
+
+type staleEvaluationState struct {
+	rule StaleRule
+	// last is the time of the last evaluation of the rule, or the time it
+	// was scheduled from when it hasn't been evaluated since.
+	last  time.Time
+	stale bool
+}
+
+func newStaleEvaluations(threshold float64) *staleEvaluations {
+	return &staleEvaluations{
+		threshold: threshold,
+		rules:     make(map[ruleKey]*staleEvaluationState),
+		log:       log.New("alerting.staleEvaluations"),
+	}
+}
+
+// update tracks the rules scheduled by the instance as of now, forgetting
+// the other ones.
+func (s *staleEvaluations) update(rules []*Rule, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	scheduled := make(map[ruleKey]bool, len(rules))
+	for _, rule := range rules {
+		key := ruleKeyOf(rule)
+		scheduled[key] = true
+		state, ok := s.rules[key]
+		if !ok {
+			state = &staleEvaluationState{last: now}
+			s.rules[key] = state
+		}
+		state.rule.RuleID = rule.ID
+		state.rule.OrgID = rule.OrgID
+		state.rule.Name = rule.Name
+		state.rule.Frequency = time.Duration(rule.Frequency) * time.Second
+		if rule.Schedule != nil {
+			// the rules evaluated on a wall-clock schedule have no frequency
+			state.rule.Frequency = 0
+		}
+	}
+	for key := range s.rules {
+		if !scheduled[key] {
+			delete(s.rules, key)
+		}
+	}
+	metrics.MAlertingStaleRules.Set(float64(s.staleCount()))
+}
+
+// observe records an evaluation of the rule.
+func (s *staleEvaluations) observe(rule *Rule, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	state, ok := s.rules[ruleKeyOf(rule)]
+	if !ok {
+		return
+	}
+	state.last = now
+	if state.stale {
+		s.log.Info("Alert rule is evaluated again", "ruleId", rule.ID, "name", rule.Name)
+		state.stale = false
+		metrics.MAlertingStaleRules.Set(float64(s.staleCount()))
+	}
+}
+
+// check flags the rules whose last evaluation is too old as of now.
+func (s *staleEvaluations) check(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	if s.threshold <= 0 {
+		return
+	}
+
+	for _, state := range s.rules {
+		if state.stale || state.rule.Frequency <= 0 {
+			continue
+		}
+		if now.Sub(state.last) > time.Duration(s.threshold*float64(state.rule.Frequency)) {
+			s.log.Warn("Alert rule has not been evaluated for several times its frequency", "ruleId", state.rule.RuleID,
+				"name", state.rule.Name, "lastEvaluation", state.last, "frequency", state.rule.Frequency)
+			state.stale = true
+		}
+	}
+	metrics.MAlertingStaleRules.Set(float64(s.staleCount()))
+}
+
+// reset restarts the tracking of the rules as of now, e.g. while the
+// instance is a standby which doesn't evaluate the rules.
+func (s *staleEvaluations) reset(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	for _, state := range s.rules {
+		state.last = now
+		state.stale = false
+	}
+	metrics.MAlertingStaleRules.Set(0)
+}
+
+// setThreshold changes the number of times the frequency of the rules
+// their last evaluation must be older than.
+func (s *staleEvaluations) setThreshold(threshold float64) {
+	s.Lock()
+	defer s.Unlock()
+	s.threshold = threshold
+	if threshold <= 0 {
+		for _, state := range s.rules {
+			state.stale = false
+		}
+		metrics.MAlertingStaleRules.Set(0)
+	}
+}
+
+// stale returns the rules currently stale, ordered by rule and org id.
+func (s *staleEvaluations) stale() []StaleRule {
+	s.Lock()
+	defer s.Unlock()
+
+	rules := make([]StaleRule, 0)
+	for _, state := range s.rules {
+		if state.stale {
+			rule := state.rule
+			rule.LastEvaluation = state.last
+			rules = append(rules, rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].RuleID != rules[j].RuleID {
+			return rules[i].RuleID < rules[j].RuleID
+		}
+		return rules[i].OrgID < rules[j].OrgID
+	})
+	return rules
+}
+
+func (s *staleEvaluations) staleCount() int {
+	count := 0
+	for _, state := range s.rules {
+		if state.stale {
+			count++
+		}
+	}
+	return count
+}
+
+// StaleRules returns the alert rules scheduled by the instance which
+// haven't been evaluated for several times their frequency.
+func (e *AlertEngine) StaleRules() []StaleRule {
+	return e.staleEvals.stale()
+}
@@ -0,0 +1,128 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaleEvaluations(t *testing.T) {
+	start := time.Unix(1000, 0)
+	rules := []*Rule{{ID: 1, Name: "evaluated", Frequency: 10}, {ID: 2, Name: "skipped", Frequency: 10}}
+
+	t.Run("rules not evaluated for several times their frequency are stale", func(t *testing.T) {
+		s := newStaleEvaluations(3)
+		s.update(rules, start)
+
+		for i := 1; i <= 4; i++ {
+			now := start.Add(time.Duration(i) * 10 * time.Second)
+			s.observe(rules[0], now)
+			s.check(now)
+			if i < 4 {
+				require.Empty(t, s.stale(), "the rules are not stale before three times their frequency")
+			}
+		}
+
+		require.Equal(t, []StaleRule{{RuleID: 2, Name: "skipped", Frequency: 10 * time.Second, LastEvaluation: start}}, s.stale())
+		require.Equal(t, float64(1), testutil.ToFloat64(metrics.MAlertingStaleRules))
+
+		// the rule is no longer stale once evaluated
+		s.observe(rules[1], start.Add(41*time.Second))
+		require.Empty(t, s.stale())
+		require.Equal(t, float64(0), testutil.ToFloat64(metrics.MAlertingStaleRules))
+	})
+
+	t.Run("standbys don't flag the rules they don't evaluate", func(t *testing.T) {
+		s := newStaleEvaluations(3)
+		s.update(rules, start)
+		s.check(start.Add(time.Minute))
+		require.Len(t, s.stale(), 2)
+
+		s.reset(start.Add(2 * time.Minute))
+		require.Empty(t, s.stale())
+		s.check(start.Add(2*time.Minute + 10*time.Second))
+		require.Empty(t, s.stale(), "the tracking restarts when the instance becomes active")
+	})
+
+	t.Run("forgets unscheduled rules", func(t *testing.T) {
+		s := newStaleEvaluations(3)
+		s.update(rules, start)
+		s.update(rules[:1], start)
+		s.check(start.Add(time.Minute))
+		stale := s.stale()
+		require.Len(t, stale, 1)
+		require.Equal(t, int64(1), stale[0].RuleID)
+	})
+
+	t.Run("disabled when threshold is zero", func(t *testing.T) {
+		s := newStaleEvaluations(0)
+		s.update(rules, start)
+		s.check(start.Add(time.Hour))
+		require.Empty(t, s.stale())
+	})
+}
+
+// ruleBlockingEvalHandler never completes the evaluations of the blocked rules until released.
+type ruleBlockingEvalHandler struct {
+	blocked map[int64]bool
+	release chan struct{}
+}
+
+func (h *ruleBlockingEvalHandler) Eval(evalContext *EvalContext) {
+	if h.blocked[evalContext.Rule.ID] {
+		<-h.release
+	}
+}
+
+func TestEngineStaleEvaluations(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := newRunnableEngine(t)
+	mock := clock.NewMock()
+	mock.Set(time.Unix(1000, 0))
+	engine.clock = mock
+	ticks := make(chan time.Time)
+	engine.ticker = &Ticker{C: ticks}
+	engine.ruleReader = &fakeRuleReader{rules: []*Rule{
+		{ID: 1, Name: "evaluated", Frequency: 1, State: models.AlertStateOK},
+		{ID: 2, Name: "stuck", Frequency: 1, State: models.AlertStateOK},
+	}}
+	evalHandler := &ruleBlockingEvalHandler{blocked: map[int64]bool{2: true}, release: make(chan struct{})}
+	engine.evalHandler = evalHandler
+	resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 100)}
+	engine.resultHandler = resultHandler
+	engine.staleEvals = newStaleEvaluations(5)
+	engine.notifierless = newNotifierlessRules(setting.NotifierlessRulesAllow)
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- engine.Run(context.Background()) }()
+
+	for i := 0; i < 10; i++ {
+		ticks <- mock.Now()
+		// let the evaluation due on the tick, if any, complete before the next tick
+		select {
+		case <-resultHandler.handled:
+		case <-time.After(50 * time.Millisecond):
+		}
+		mock.Add(time.Second)
+	}
+	ticks <- mock.Now()
+
+	require.Eventually(t, func() bool {
+		stale := engine.StaleRules()
+		return len(stale) == 1 && stale[0].RuleID == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(evalHandler.release)
+	require.NoError(t, engine.Stop(context.Background()))
+	require.NoError(t, <-runErr)
+}
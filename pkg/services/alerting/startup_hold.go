@@ -0,0 +1,97 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+type heldNotificationKey struct {
+	rule      ruleKey
+	seriesKey string
+}
+
+// startupHold holds the notifications of the engine for a while after it
+// starts, so that a rolling restart doesn't send a wall of alerts. The states
+// of the rules are tracked as usual meanwhile. Once the delay is over, the
+// notifications of the rules, or series, which started alerting during the
+// delay and are still alerting are released, the other ones are dropped.
+type startupHold struct {
+	mtx      sync.Mutex
+	delay    time.Duration
+	released bool
+	// held holds the evaluations which started alerting during the delay.
+	held    map[heldNotificationKey]*EvalContext
+	release func(evalContexts []*EvalContext)
+	log     log.Logger
+}
+
+// newStartupHold returns a hold released once the delay is over after it is
+// started, nil when the delay is zero.
+func newStartupHold(delay time.Duration, release func(evalContexts []*EvalContext)) *startupHold {
+	if delay <= 0 {
+		return nil
+	}
+
+	return &startupHold{
+		delay:   delay,
+		held:    make(map[heldNotificationKey]*EvalContext),
+		release: release,
+		log:     log.New("alerting.startupHold"),
+	}
+}
+
+// start starts the delay on the clock, when the engine starts running.
+func (h *startupHold) start(clock clock.Clock) {
+	if h == nil {
+		return
+	}
+
+	h.log.Info("Holding the alert notifications after startup", "delay", h.delay)
+	clock.AfterFunc(h.delay, h.flush)
+}
+
+// hold returns true if the notifications of the evaluation are held, keeping
+// the evaluation to be notified once the delay is over if it started alerting.
+func (h *startupHold) hold(evalContext *EvalContext) bool {
+	if h == nil {
+		return false
+	}
+
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if h.released {
+		return false
+	}
+
+	key := heldNotificationKey{rule: ruleKeyOf(evalContext.Rule), seriesKey: evalContext.SeriesKey}
+	switch {
+	case evalContext.Rule.State != models.AlertStateAlerting:
+		delete(h.held, key)
+	case evalContext.PrevAlertState != models.AlertStateAlerting:
+		// the rule started alerting, it is notified once the delay is over if it still is
+		held := *evalContext
+		rule := *evalContext.Rule
+		held.Rule = &rule
+		h.held[key] = &held
+	}
+	return true
+}
+
+func (h *startupHold) flush() {
+	h.mtx.Lock()
+	h.released = true
+	evalContexts := make([]*EvalContext, 0, len(h.held))
+	for _, evalContext := range h.held {
+		evalContexts = append(evalContexts, evalContext)
+	}
+	h.held = nil
+	h.mtx.Unlock()
+
+	h.log.Info("Releasing the alert notifications held after startup", "alerting", len(evalContexts))
+	h.release(evalContexts)
+}
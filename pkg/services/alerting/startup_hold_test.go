@@ -0,0 +1,146 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultHandlerStartupNotificationDelay(t *testing.T) {
+	origTimeout := setting.AlertingNotificationTimeout
+	t.Cleanup(func() { setting.AlertingNotificationTimeout = origTimeout })
+	setting.AlertingNotificationTimeout = 30 * time.Second
+
+	origRepo := annotations.GetRepository()
+	annotations.SetRepository(&fakeAnnotationsRepo{})
+	t.Cleanup(func() { annotations.SetRepository(origRepo) })
+
+	notifier := &capturingNotifier{testNotifier: testNotifier{UID: "startup", Type: "startup"}}
+	RegisterNotifier(&NotifierPlugin{
+		Type: "startup",
+		Name: "Startup",
+		Factory: func(model *models.AlertNotification) (Notifier, error) {
+			return notifier, nil
+		},
+	})
+	bus.AddHandler("test", func(cmd *models.SetAlertStateCommand) error {
+		cmd.Result = models.Alert{Id: cmd.AlertId, State: cmd.State, StateChanges: 1}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = []*models.AlertNotification{{Id: 1, Uid: "startup", Type: "startup", Settings: simplejson.New()}}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetOrCreateNotificationStateQuery) error {
+		query.Result = &models.AlertNotificationState{Id: 1, State: models.AlertNotificationStateUnknown}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		return nil
+	})
+
+	mock := clock.NewMock()
+	handler := newResultHandler(nil, &fakeStateStore{states: map[ruleKey]RuleState{}}, newInhibitor(nil), newSilences(clock.NewMock()), nil, clock.New())
+	handler.startupHold = newStartupHold(time.Minute, handler.releaseHeld)
+	handler.startupHold.start(mock)
+
+	rules := map[int64]*Rule{}
+	evaluate := func(id int64, prevState, state models.AlertStateType) {
+		rule, ok := rules[id]
+		if !ok {
+			rule = &Rule{ID: id, OrgID: 1, Name: "rule", Notifications: []string{"startup"}}
+			rules[id] = rule
+		}
+		rule.State = prevState
+		evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		rule.State = state
+		require.NoError(t, handler.handle(evalContext))
+	}
+	notified := func() []int64 {
+		ids := []int64{}
+		for _, evalContext := range notifier.notified {
+			ids = append(ids, evalContext.Rule.ID)
+		}
+		notifier.notified = nil
+		return ids
+	}
+
+	// started alerting and still alerting
+	evaluate(1, models.AlertStateOK, models.AlertStateAlerting)
+	evaluate(1, models.AlertStateAlerting, models.AlertStateAlerting)
+	// recovered during the delay
+	evaluate(2, models.AlertStateOK, models.AlertStateAlerting)
+	evaluate(2, models.AlertStateAlerting, models.AlertStateOK)
+	// alerting before the engine started
+	evaluate(3, models.AlertStateAlerting, models.AlertStateAlerting)
+	require.Empty(t, notified(), "the notifications are held during the delay")
+
+	mock.Add(time.Minute)
+	require.Equal(t, []int64{1}, notified(), "only the rules which started alerting and still are are notified")
+
+	evaluate(4, models.AlertStateOK, models.AlertStateAlerting)
+	require.Equal(t, []int64{4}, notified(), "the notifications are sent once the delay is over")
+}
+
+func TestStartupHoldRuleIDsAcrossOrgs(t *testing.T) {
+	mock := clock.NewMock()
+	var released []*EvalContext
+	hold := newStartupHold(time.Minute, func(evalContexts []*EvalContext) { released = evalContexts })
+	hold.start(mock)
+
+	for _, orgID := range []int64{1, 2} {
+		evalContext := &EvalContext{Rule: &Rule{ID: 1, OrgID: orgID, State: models.AlertStateAlerting}, PrevAlertState: models.AlertStateOK}
+		require.True(t, hold.hold(evalContext))
+	}
+	mock.Add(time.Minute)
+	require.Len(t, released, 2, "the rules of the orgs sharing an id are held apart")
+}
+
+func TestEngineStartupHoldStartsWithTheEngine(t *testing.T) {
+	origDelay := setting.AlertingStartupNotificationDelay
+	t.Cleanup(func() { setting.AlertingStartupNotificationDelay = origDelay })
+	setting.AlertingStartupNotificationDelay = time.Minute
+
+	engine := newRunnableEngine(t)
+	mock := clock.NewMock()
+	engine.clock = mock
+	engine.ticker = &Ticker{C: make(chan time.Time)}
+	released := func() bool {
+		engine.startupHold.mtx.Lock()
+		defer engine.startupHold.mtx.Unlock()
+		return engine.startupHold.released
+	}
+
+	mock.Add(time.Hour)
+	require.False(t, released(), "the delay starts when the engine runs")
+
+	runErr := startEngine(t, engine)
+	mock.Add(59 * time.Second)
+	require.False(t, released())
+	mock.Add(time.Second)
+	require.True(t, released(), "the delay is tracked with the clock of the engine")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, engine.Stop(ctx))
+	require.NoError(t, <-runErr)
+}
+
+func TestStartupHoldDisabled(t *testing.T) {
+	hold := newStartupHold(0, func([]*EvalContext) {})
+	require.Nil(t, hold)
+	hold.start(clock.NewMock())
+	require.False(t, hold.hold(&EvalContext{Rule: &Rule{ID: 1, State: models.AlertStateAlerting}}))
+}
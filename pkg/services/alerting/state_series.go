@@ -0,0 +1,222 @@
+package alerting
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// The values of the state series of the alert rules.
+const (
+	StateSeriesOK      = 0
+	StateSeriesPending = 1
+	StateSeriesFiring  = 2
+	StateSeriesNoData  = 3
+	StateSeriesError   = 4
+)
+
+// StatePoint is the state of an alert rule after one of its evaluations, as
+// a point of the state series of the rule.
+type StatePoint struct {
+	RuleID int64
+	OrgID  int64
+	Time   time.Time
+	// Value is the code of the state, StateSeriesOK to StateSeriesError.
+	Value int
+}
+
+// stateSeriesValue returns the code of the state the rule is in after the
+// evaluation, false for the states which are not recorded.
+func stateSeriesValue(evalContext *EvalContext) (int, bool) {
+	if evalContext.Error != nil {
+		return StateSeriesError, true
+	}
+	switch evalContext.Rule.State {
+	case models.AlertStateOK:
+		return StateSeriesOK, true
+	case models.AlertStatePending:
+		return StateSeriesPending, true
+	case models.AlertStateAlerting:
+		return StateSeriesFiring, true
+	case models.AlertStateNoData:
+		return StateSeriesNoData, true
+	case models.AlertStateConfigError:
+		return StateSeriesError, true
+	default:
+		return 0, false
+	}
+}
+
+// StateSeriesStore stores the state series of the alert rules, e.g. in a
+// time series database for a state history panel to query them like any
+// other metric. The points of every evaluation are written, not only the
+// ones changing the state of the rules.
+type StateSeriesStore interface {
+	WriteStates(ctx context.Context, points []StatePoint) error
+	QueryStates(ctx context.Context, orgID, ruleID int64, from, to time.Time) ([]StatePoint, error)
+}
+
+// stateSeriesBufferSize is the number of points waiting to be written above
+// which the points are dropped.
+var stateSeriesBufferSize = 1000
+
+// stateSeriesBatchSize is the maximum number of points written at once.
+var stateSeriesBatchSize = 100
+
+// stateSeriesWriteTimeout bounds the time the store is given to write a batch.
+var stateSeriesWriteTimeout = 10 * time.Second
+
+// stateSeriesRetention is the time the points are kept for in memory.
+var stateSeriesRetention = 24 * time.Hour
+
+// stateSeriesMaxPoints is the number of points of a rule kept in memory,
+// the oldest ones being dropped first, e.g. a day of evaluations every minute.
+var stateSeriesMaxPoints = 1440
+
+// stateSeriesWriter writes the state series to the store in the background,
+// so a slow store never holds up the evaluation of the rules.
+type stateSeriesWriter struct {
+	store       StateSeriesStore
+	points      chan StatePoint
+	handlePanic func(msg string, recovered interface{})
+	log         log.Logger
+}
+
+func newStateSeriesWriter(store StateSeriesStore, handlePanic func(msg string, recovered interface{})) *stateSeriesWriter {
+	return &stateSeriesWriter{
+		store:       store,
+		points:      make(chan StatePoint, stateSeriesBufferSize),
+		handlePanic: handlePanic,
+		log:         log.New("alerting.stateSeries"),
+	}
+}
+
+// record queues the point of the evaluation, dropping it when the buffer is full.
+func (w *stateSeriesWriter) record(evalContext *EvalContext) {
+	value, ok := stateSeriesValue(evalContext)
+	if !ok {
+		return
+	}
+	point := StatePoint{RuleID: evalContext.Rule.ID, OrgID: evalContext.Rule.OrgID, Time: evalContext.EndTime, Value: value}
+
+	select {
+	case w.points <- point:
+	default:
+		metrics.MAlertingStatePointsDropped.Inc()
+		w.log.Debug("Dropping state point, the buffer is full", "ruleId", evalContext.Rule.ID)
+	}
+}
+
+// run writes the queued points until the grafana server context is
+// canceled or done is closed, once no more points can be queued.
+func (w *stateSeriesWriter) run(grafanaCtx context.Context, done <-chan struct{}) error {
+	for {
+		select {
+		case <-grafanaCtx.Done():
+			return nil
+		case <-done:
+			for len(w.points) > 0 {
+				w.write(grafanaCtx, w.batch(<-w.points))
+			}
+			return nil
+		case point := <-w.points:
+			w.write(grafanaCtx, w.batch(point))
+		}
+	}
+}
+
+// batch returns the point along with the points queued after it.
+func (w *stateSeriesWriter) batch(point StatePoint) []StatePoint {
+	points := []StatePoint{point}
+	for len(points) < stateSeriesBatchSize {
+		select {
+		case point := <-w.points:
+			points = append(points, point)
+		default:
+			return points
+		}
+	}
+	return points
+}
+
+func (w *stateSeriesWriter) write(grafanaCtx context.Context, points []StatePoint) {
+	defer func() {
+		if err := recover(); err != nil {
+			w.handlePanic("State series store panic", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(grafanaCtx, stateSeriesWriteTimeout)
+	defer cancel()
+	if err := w.store.WriteStates(ctx, points); err != nil {
+		w.log.Warn("Failed to write state points", "points", len(points), "error", err)
+	}
+}
+
+// memoryStateSeries keeps the last maxPoints points of the state series of
+// the rules in memory for the retention, when the engine has no store.
+type memoryStateSeries struct {
+	mtx       sync.Mutex
+	retention time.Duration
+	maxPoints int
+	rules     map[ruleKey][]StatePoint
+}
+
+func newMemoryStateSeries(retention time.Duration, maxPoints int) *memoryStateSeries {
+	return &memoryStateSeries{retention: retention, maxPoints: maxPoints, rules: make(map[ruleKey][]StatePoint)}
+}
+
+func (m *memoryStateSeries) WriteStates(ctx context.Context, points []StatePoint) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var latest time.Time
+	for _, point := range points {
+		key := ruleKey{orgID: point.OrgID, id: point.RuleID}
+		m.rules[key] = append(m.rules[key], point)
+		if point.Time.After(latest) {
+			latest = point.Time
+		}
+	}
+
+	// drop the points past the retention, along with the series of the
+	// rules not evaluated anymore
+	expiry := latest.Add(-m.retention)
+	for key, series := range m.rules {
+		i := sort.Search(len(series), func(i int) bool { return series[i].Time.After(expiry) })
+		if i == len(series) {
+			delete(m.rules, key)
+			continue
+		}
+		if len(series)-i > m.maxPoints {
+			i = len(series) - m.maxPoints
+		}
+		m.rules[key] = series[i:]
+	}
+	return nil
+}
+
+func (m *memoryStateSeries) QueryStates(ctx context.Context, orgID, ruleID int64, from, to time.Time) ([]StatePoint, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	var points []StatePoint
+	for _, point := range m.rules[ruleKey{orgID: orgID, id: ruleID}] {
+		if !point.Time.Before(from) && !point.Time.After(to) {
+			points = append(points, point)
+		}
+	}
+	return points, nil
+}
+
+// StateSeries returns the state series of the alert rule between from and
+// to, one point per evaluation. The points are written in the background,
+// the ones of the last evaluations may not be returned yet.
+func (e *AlertEngine) StateSeries(ctx context.Context, orgID, ruleID int64, from, to time.Time) ([]StatePoint, error) {
+	return e.stateSeries.store.QueryStates(ctx, orgID, ruleID, from, to)
+}
@@ -0,0 +1,140 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStateSeriesStore struct {
+	*memoryStateSeries
+	writes chan []StatePoint
+}
+
+func (s *fakeStateSeriesStore) WriteStates(ctx context.Context, points []StatePoint) error {
+	if err := s.memoryStateSeries.WriteStates(ctx, points); err != nil {
+		return err
+	}
+	s.writes <- points
+	return nil
+}
+
+func TestEngineStateSeries(t *testing.T) {
+	origEvaluationTimeout, origNotificationTimeout, origMaxAttempts := setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts
+	t.Cleanup(func() {
+		setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts = origEvaluationTimeout, origNotificationTimeout, origMaxAttempts
+	})
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	store := &fakeStateSeriesStore{memoryStateSeries: newMemoryStateSeries(time.Hour, stateSeriesMaxPoints), writes: make(chan []StatePoint, 10)}
+	engine := &AlertEngine{StateSeriesStore: store}
+	require.NoError(t, engine.Init())
+	engine.evalHandler = &scriptedEvalHandler{script: []scriptedResult{
+		{},
+		{firing: true},
+		{firing: true},
+		{noData: true},
+		{err: errors.New("datasource unavailable")},
+		{},
+	}}
+	engine.resultHandler = &FakeResultHandler{}
+	engine.resultQueue = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = engine.stateSeries.run(ctx, nil) }()
+
+	start := time.Now()
+	rule := &Rule{ID: 1, OrgID: 2, State: models.AlertStateUnknown, NoDataState: models.NoDataSetNoData, ExecutionErrorState: models.ExecutionErrorSetAlerting}
+	var values []int
+	for i := 0; i < 6; i++ {
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}))
+		select {
+		case points := <-store.writes:
+			require.Len(t, points, 1, "a point is written every evaluation")
+			require.Equal(t, int64(1), points[0].RuleID)
+			require.Equal(t, int64(2), points[0].OrgID)
+			values = append(values, points[0].Value)
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the state point to be written")
+		}
+	}
+	require.Equal(t, []int{StateSeriesOK, StateSeriesFiring, StateSeriesFiring, StateSeriesNoData, StateSeriesError, StateSeriesOK}, values)
+
+	points, err := engine.StateSeries(context.Background(), 2, 1, start, time.Now())
+	require.NoError(t, err)
+	require.Len(t, points, 6)
+	points, err = engine.StateSeries(context.Background(), 1, 1, start, time.Now())
+	require.NoError(t, err)
+	require.Empty(t, points, "the series are by organization")
+}
+
+func TestMemoryStateSeriesRetention(t *testing.T) {
+	series := newMemoryStateSeries(time.Hour, stateSeriesMaxPoints)
+	now := time.Now()
+	require.NoError(t, series.WriteStates(context.Background(), []StatePoint{
+		{RuleID: 1, OrgID: 1, Time: now.Add(-2 * time.Hour), Value: StateSeriesOK},
+		{RuleID: 1, OrgID: 1, Time: now.Add(-30 * time.Minute), Value: StateSeriesFiring},
+		{RuleID: 2, OrgID: 1, Time: now.Add(-90 * time.Minute), Value: StateSeriesOK},
+	}))
+	require.NoError(t, series.WriteStates(context.Background(), []StatePoint{{RuleID: 1, OrgID: 1, Time: now, Value: StateSeriesOK}}))
+
+	points, err := series.QueryStates(context.Background(), 1, 1, now.Add(-3*time.Hour), now)
+	require.NoError(t, err)
+	require.Equal(t, []StatePoint{
+		{RuleID: 1, OrgID: 1, Time: now.Add(-30 * time.Minute), Value: StateSeriesFiring},
+		{RuleID: 1, OrgID: 1, Time: now, Value: StateSeriesOK},
+	}, points)
+	require.NotContains(t, series.rules, ruleKey{orgID: 1, id: 2}, "the series past the retention are dropped")
+
+	points, err = series.QueryStates(context.Background(), 1, 1, now.Add(-time.Minute), now)
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+}
+
+func TestMemoryStateSeriesMaxPoints(t *testing.T) {
+	series := newMemoryStateSeries(time.Hour, 3)
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, series.WriteStates(context.Background(), []StatePoint{
+			{RuleID: 1, OrgID: 1, Time: now.Add(time.Duration(i) * time.Second), Value: i},
+		}))
+	}
+
+	points, err := series.QueryStates(context.Background(), 1, 1, now, now.Add(time.Minute))
+	require.NoError(t, err)
+	var values []int
+	for _, point := range points {
+		values = append(values, point.Value)
+	}
+	require.Equal(t, []int{2, 3, 4}, values, "the oldest points are dropped first")
+}
+
+type panickingStateSeriesStore struct {
+	StateSeriesStore
+}
+
+func (panickingStateSeriesStore) WriteStates(ctx context.Context, points []StatePoint) error {
+	panic("store is broken")
+}
+
+func TestStateSeriesWriterPanics(t *testing.T) {
+	var panics []interface{}
+	engine := &AlertEngine{
+		StateSeriesStore: panickingStateSeriesStore{},
+		PanicHandler: func(recovered interface{}, stack []byte) {
+			panics = append(panics, recovered)
+		},
+	}
+	require.NoError(t, engine.Init())
+
+	engine.stateSeries.write(context.Background(), []StatePoint{{RuleID: 1, OrgID: 1}})
+	require.Equal(t, []interface{}{"store is broken"}, panics, "the panics of the store are reported to the panic handler")
+}
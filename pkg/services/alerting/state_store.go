@@ -0,0 +1,198 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	"github.com/grafana/grafana/pkg/models"
+)
+
+// RuleState is the last known state of an alert rule, along with its
+// pending and notification state.
+type RuleState struct {
+	State           models.AlertStateType
+	LastStateChange time.Time
+
+	// PendingSince is when the rule entered the pending state.
+	PendingSince time.Time
+	// FiringSince is when the rule started firing without a break, and
+	// Escalated the number of escalation levels notified since.
+	FiringSince time.Time
+	Escalated   int
+	// SeriesStates are the alerting series of a per-series rule.
+	SeriesStates map[string]models.AlertStateType
+}
+
+// StateStore persists the state of the alert rules so the engine
+// can resume from the last known states after a restart.
+type StateStore interface {
+	// Load returns the last known state of every alert rule, keyed by org
+	// id and then by rule id.
+	Load() (map[int64]map[int64]RuleState, error)
+
+	// Save records a change of the state of an alert rule.
+	Save(orgID, ruleID int64, state RuleState) error
+}
+
+const ruleStateKeyPrefix = "alert_rule_state:"
+
+// ruleStateTTL is how long the state of a rule is kept in the remote cache
+// without being saved again.
+const ruleStateTTL = 30 * 24 * time.Hour
+
+// cacheStateStore is the default StateStore. The states of the rules are
+// read from the alert table which the result handler already keeps up to
+// date, while their pending and notification states are kept in the remote
+// cache.
+type cacheStateStore struct {
+	cache remotecache.CacheStorage
+}
+
+func newCacheStateStore(cache remotecache.CacheStorage) *cacheStateStore {
+	return &cacheStateStore{cache: cache}
+}
+
+func (s *cacheStateStore) Load() (map[int64]map[int64]RuleState, error) {
+	query := &models.GetAllAlertsQuery{}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	states := make(map[int64]map[int64]RuleState)
+	for _, alert := range query.Result {
+		state := RuleState{State: alert.State, LastStateChange: alert.NewStateDate}
+		saved, err := s.cache.Get(ruleStateKey(alert.OrgId, alert.Id))
+		switch {
+		case errors.Is(err, remotecache.ErrCacheItemNotFound):
+		case err != nil:
+			return nil, err
+		default:
+			// the state saved before the state of the rule last changed is outdated
+			if saved, ok := saved.(*RuleState); ok && saved.State == alert.State {
+				state.PendingSince = saved.PendingSince
+				state.FiringSince = saved.FiringSince
+				state.Escalated = saved.Escalated
+				state.SeriesStates = saved.SeriesStates
+			}
+		}
+		if states[alert.OrgId] == nil {
+			states[alert.OrgId] = make(map[int64]RuleState)
+		}
+		states[alert.OrgId][alert.Id] = state
+	}
+	return states, nil
+}
+
+func (s *cacheStateStore) Save(orgID, ruleID int64, state RuleState) error {
+	return s.cache.Set(ruleStateKey(orgID, ruleID), &state, ruleStateTTL)
+}
+
+func ruleStateKey(orgID, ruleID int64) string {
+	return fmt.Sprintf("%s%d:%d", ruleStateKeyPrefix, orgID, ruleID)
+}
+
+// memoryStateStore keeps the states in memory, for the engines without a
+// remote cache.
+type memoryStateStore struct {
+	mtx    sync.Mutex
+	states map[ruleKey]RuleState
+}
+
+func (s *memoryStateStore) Load() (map[int64]map[int64]RuleState, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return statesByOrg(s.states), nil
+}
+
+func (s *memoryStateStore) Save(orgID, ruleID int64, state RuleState) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.states == nil {
+		s.states = make(map[ruleKey]RuleState)
+	}
+	s.states[ruleKey{orgID: orgID, id: ruleID}] = state
+	return nil
+}
+
+// statesByOrg returns the states keyed by org id and then by rule id.
+func statesByOrg(states map[ruleKey]RuleState) map[int64]map[int64]RuleState {
+	byOrg := make(map[int64]map[int64]RuleState)
+	for key, state := range states {
+		if byOrg[key.orgID] == nil {
+			byOrg[key.orgID] = make(map[int64]RuleState)
+		}
+		byOrg[key.orgID][key.id] = state
+	}
+	return byOrg
+}
+
+// restoredStates are the last known states loaded at startup, until the
+// rules are seen for the first time.
+type restoredStates struct {
+	mtx    sync.Mutex
+	states map[ruleKey]RuleState
+}
+
+func newRestoredStates(byOrg map[int64]map[int64]RuleState) *restoredStates {
+	states := make(map[ruleKey]RuleState)
+	for orgID, rules := range byOrg {
+		for ruleID, state := range rules {
+			states[ruleKey{orgID: orgID, id: ruleID}] = state
+		}
+	}
+	return &restoredStates{states: states}
+}
+
+// take returns the last known state of the rule, if it was not taken yet.
+func (r *restoredStates) take(rule *Rule) (RuleState, bool) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	key := ruleKeyOf(rule)
+	state, ok := r.states[key]
+	delete(r.states, key)
+	return state, ok
+}
+
+// loadStates loads the last known alert states before the first rules are scheduled.
+func (e *AlertEngine) loadStates() {
+	states, err := e.StateStore.Load()
+	if err != nil {
+		e.log.Warn("Could not load the last known alert states", "error", err)
+		return
+	}
+	e.restoredStates = newRestoredStates(states)
+}
+
+// restoreStates seeds the rules seen for the first time since the engine
+// started with their last known state, so state transitions are computed
+// relative to the state the rule had before the restart, and the
+// notifications already sent before the restart are not sent again.
+func (e *AlertEngine) restoreStates(rules []*Rule) []*Rule {
+	for _, rule := range rules {
+		e.restoreState(rule)
+	}
+	return rules
+}
+
+func (e *AlertEngine) restoreState(rule *Rule) {
+	if e.restoredStates == nil {
+		return
+	}
+	state, ok := e.restoredStates.take(rule)
+	if !ok || rule.State == models.AlertStatePaused {
+		return
+	}
+
+	rule.State = state.State
+	rule.LastStateChange = state.LastStateChange
+	e.runtimes.update(rule, func(runtime *ruleRuntime) {
+		runtime.PendingSince = state.PendingSince
+		runtime.FiringSince = state.FiringSince
+		runtime.Escalated = state.Escalated
+		runtime.SeriesStates = state.SeriesStates
+	})
+}
@@ -0,0 +1,157 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/services/annotations"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStateStore struct {
+	states map[ruleKey]RuleState
+}
+
+func (s *fakeStateStore) Load() (map[int64]map[int64]RuleState, error) {
+	return statesByOrg(s.states), nil
+}
+
+func (s *fakeStateStore) Save(orgID, ruleID int64, state RuleState) error {
+	s.states[ruleKey{orgID: orgID, id: ruleID}] = state
+	return nil
+}
+
+func TestEngineRestoresStatesAfterRestart(t *testing.T) {
+	lastStateChange := time.Now().Add(-time.Hour)
+	store := &fakeStateStore{states: map[ruleKey]RuleState{
+		{orgID: 1, id: 1}: {State: models.AlertStateAlerting, LastStateChange: lastStateChange},
+		{orgID: 1, id: 2}: {State: models.AlertStateAlerting, LastStateChange: lastStateChange},
+		{orgID: 2, id: 1}: {State: models.AlertStateNoData, LastStateChange: lastStateChange},
+	}}
+
+	engine := &AlertEngine{StateStore: store}
+	require.NoError(t, engine.Init())
+
+	rules := engine.restoreStates([]*Rule{
+		{ID: 1, OrgID: 1, State: models.AlertStateUnknown},
+		{ID: 2, OrgID: 1, State: models.AlertStatePaused},
+		{ID: 3, OrgID: 1, State: models.AlertStateOK},
+		{ID: 1, OrgID: 2, State: models.AlertStateUnknown},
+	})
+
+	require.Equal(t, models.AlertStateAlerting, rules[0].State)
+	require.Equal(t, lastStateChange, rules[0].LastStateChange)
+	require.Equal(t, models.AlertStatePaused, rules[1].State, "paused rules should stay paused")
+	require.Equal(t, models.AlertStateOK, rules[2].State)
+	require.Equal(t, models.AlertStateNoData, rules[3].State, "the rule of another org with the same id has its own state")
+
+	t.Run("a rule still firing after the restart is not a state change", func(t *testing.T) {
+		evalContext := NewEvalContext(context.Background(), rules[0], &validations.OSSPluginRequestValidator{})
+		evalContext.Firing = true
+		evalContext.Rule.State = evalContext.GetNewState()
+
+		require.False(t, evalContext.shouldUpdateAlertState())
+	})
+
+	t.Run("states are only restored once", func(t *testing.T) {
+		rules := engine.restoreStates([]*Rule{{ID: 1, OrgID: 1, State: models.AlertStateOK}})
+		require.Equal(t, models.AlertStateOK, rules[0].State)
+	})
+}
+
+func TestEngineResumesNotificationsAfterRestart(t *testing.T) {
+	origEvaluationTimeout, origNotificationTimeout, origMaxAttempts := setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts
+	t.Cleanup(func() {
+		setting.AlertingEvaluationTimeout, setting.AlertingNotificationTimeout, setting.AlertingMaxAttempts = origEvaluationTimeout, origNotificationTimeout, origMaxAttempts
+	})
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	var sent []seriesNotification
+	RegisterNotifier(&NotifierPlugin{
+		Type: "test-restart",
+		Name: "Test restart",
+		Factory: func(model *models.AlertNotification) (Notifier, error) {
+			return &seriesRecordingNotifier{testNotifier: testNotifier{UID: model.Uid, Type: model.Type}, sent: &sent}, nil
+		},
+	})
+
+	origRepo := annotations.GetRepository()
+	annotations.SetRepository(&fakeAnnotationsRepo{})
+	t.Cleanup(func() { annotations.SetRepository(origRepo) })
+
+	bus.AddHandler("test", func(cmd *models.SetAlertStateCommand) error {
+		cmd.Result = models.Alert{Id: cmd.AlertId, State: cmd.State, StateChanges: 1}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		query.Result = []*models.AlertNotification{{Id: 1, Uid: "restart", Type: "test-restart", Settings: simplejson.New()}}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetOrCreateNotificationStateQuery) error {
+		query.Result = &models.AlertNotificationState{AlertId: query.AlertId, NotifierId: query.NotifierId}
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		return nil
+	})
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToCompleteCommand) error {
+		return nil
+	})
+
+	store := &fakeStateStore{states: map[ruleKey]RuleState{}}
+	condition := &conditionStub{firing: true, matches: []*EvalMatch{{Metric: "cpu", Value: null.FloatFrom(95), Tags: map[string]string{"host": "a"}}}}
+	// evaluate evaluates the rule, as loaded from the alert table, on a new engine
+	evaluate := func(state models.AlertStateType) []seriesNotification {
+		engine := &AlertEngine{StateStore: store}
+		require.NoError(t, engine.Init())
+		engine.resultQueue = nil
+
+		sent = nil
+		rule := &Rule{ID: 1, OrgID: 1, Frequency: 60, State: state, PerSeries: true,
+			Notifications: []string{"restart"}, Conditions: []Condition{condition}}
+		require.NoError(t, engine.processJobWithRetry(context.Background(), &Job{Rule: rule}))
+		return sent
+	}
+
+	require.Equal(t, []seriesNotification{{series: "cpu{host=a}", state: models.AlertStateAlerting, matches: 1}}, evaluate(models.AlertStateOK))
+	key := ruleKey{orgID: 1, id: 1}
+	require.Equal(t, models.AlertStateAlerting, store.states[key].State)
+	require.Equal(t, map[string]models.AlertStateType{"cpu{host=a}": models.AlertStateAlerting}, store.states[key].SeriesStates)
+
+	require.Empty(t, evaluate(models.AlertStateAlerting), "the series notified for before the restart are not notified for again")
+}
+
+func TestCacheStateStore(t *testing.T) {
+	lastStateChange := time.Now().Add(-time.Hour)
+	bus.AddHandler("test", func(query *models.GetAllAlertsQuery) error {
+		query.Result = []*models.Alert{
+			{Id: 1, OrgId: 1, State: models.AlertStatePending, NewStateDate: lastStateChange},
+			{Id: 2, OrgId: 1, State: models.AlertStateOK, NewStateDate: lastStateChange},
+			{Id: 3, OrgId: 1, State: models.AlertStateAlerting, NewStateDate: lastStateChange},
+			{Id: 1, OrgId: 2, State: models.AlertStatePending, NewStateDate: lastStateChange},
+		}
+		return nil
+	})
+
+	store := newCacheStateStore(newFakeClusterCache())
+	pendingSince := lastStateChange.Add(-time.Minute)
+	require.NoError(t, store.Save(1, 1, RuleState{State: models.AlertStatePending, LastStateChange: lastStateChange, PendingSince: pendingSince}))
+	require.NoError(t, store.Save(1, 2, RuleState{State: models.AlertStatePending, PendingSince: pendingSince}))
+
+	states, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, states[1], 3)
+	require.Equal(t, RuleState{State: models.AlertStatePending, LastStateChange: lastStateChange, PendingSince: pendingSince}, states[1][1])
+	require.Equal(t, RuleState{State: models.AlertStateOK, LastStateChange: lastStateChange}, states[1][2], "the state saved before the last state change is outdated")
+	require.Equal(t, RuleState{State: models.AlertStateAlerting, LastStateChange: lastStateChange}, states[1][3])
+	require.Equal(t, RuleState{State: models.AlertStatePending, LastStateChange: lastStateChange}, states[2][1], "the saved states are by org")
+}
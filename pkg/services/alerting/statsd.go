@@ -0,0 +1,41 @@
+package alerting
+
+import "time"
+
+// StatsdClient is a client of a StatsD server, the evaluations of the alert
+// rules can be recorded to for the monitoring stacks which don't consume the
+// Prometheus metrics, e.g. StatsD and Graphite.
+type StatsdClient interface {
+	// Timing records the duration of an event.
+	Timing(name string, value time.Duration)
+	// Increment increments a counter by one.
+	Increment(name string)
+}
+
+// noopStatsdClient is the StatsD client of the engine until one is set.
+type noopStatsdClient struct{}
+
+func (noopStatsdClient) Timing(name string, value time.Duration) {}
+
+func (noopStatsdClient) Increment(name string) {}
+
+// The names of the StatsD metrics of the evaluations, the outcome of the
+// evaluation being appended to the counter of the evaluations.
+const (
+	statsdEvalDuration = "alerting.evaluation.duration"
+	statsdEvaluations  = "alerting.evaluations"
+	statsdEvalRetries  = "alerting.evaluation.retries"
+)
+
+// SetStatsdClient records the evaluations of the alert rules to the StatsD
+// client, along with the Prometheus and OpenTelemetry metrics: the timing of
+// the evaluations as alerting.evaluation.duration, the evaluations by outcome
+// as alerting.evaluations.<outcome> and the retried attempts as
+// alerting.evaluation.retries. It must be called before the engine runs, a
+// nil client disables it.
+func (e *AlertEngine) SetStatsdClient(client StatsdClient) {
+	if client == nil {
+		client = noopStatsdClient{}
+	}
+	e.instruments.statsd = client
+}
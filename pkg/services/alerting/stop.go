@@ -0,0 +1,28 @@
+package alerting
+
+import (
+	"context"
+)
+
+// Stop stops the alerting engine without canceling the context it runs with.
+// The ticker is halted and no new jobs are accepted, while the in-flight
+// evaluations are given until the deadline of ctx to complete. It is safe to
+// call Stop several times and concurrently.
+func (e *AlertEngine) Stop(ctx context.Context) error {
+	e.runningLock.Lock()
+	running := e.running
+	e.runningLock.Unlock()
+
+	e.stopOnce.Do(func() { close(e.stopChan) })
+
+	if !running {
+		return nil
+	}
+
+	select {
+	case <-e.runDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,133 @@
+package alerting
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/infra/remotecache"
+	"github.com/grafana/grafana/pkg/services/rendering"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRuleReader struct {
+	rules []*Rule
+}
+
+func (r *fakeRuleReader) fetch() ([]*Rule, error) {
+	return r.rules, nil
+}
+
+type slowEvalHandler struct {
+	delay time.Duration
+	mtx   sync.Mutex
+	calls int
+}
+
+func (h *slowEvalHandler) Eval(evalContext *EvalContext) {
+	time.Sleep(h.delay)
+	h.mtx.Lock()
+	h.calls++
+	h.mtx.Unlock()
+}
+
+func (h *slowEvalHandler) callCount() int {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return h.calls
+}
+
+func newRunnableEngine(t *testing.T) *AlertEngine {
+	t.Helper()
+
+	engine := &AlertEngine{
+		DataService:        fakeDataRequestHandler{},
+		RenderService:      &rendering.RenderingService{},
+		RemoteCacheService: &remotecache.RemoteCache{},
+		Bus:                bus.New(),
+		StateStore:         &fakeStateStore{states: map[ruleKey]RuleState{}},
+	}
+	require.NoError(t, engine.Init())
+	engine.ruleReader = &fakeRuleReader{}
+	engine.resultHandler = &FakeResultHandler{}
+	return engine
+}
+
+// startEngine runs the engine until it is stopped and returns the channel
+// of the error it returns.
+func startEngine(t *testing.T, engine *AlertEngine) chan error {
+	t.Helper()
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- engine.Run(context.Background()) }()
+	require.Eventually(t, func() bool {
+		engine.runningLock.Lock()
+		defer engine.runningLock.Unlock()
+		return engine.running
+	}, time.Second, time.Millisecond*10)
+	return runErr
+}
+
+func TestEngineStop(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	t.Run("waits for in-flight evaluations", func(t *testing.T) {
+		engine := newRunnableEngine(t)
+		evalHandler := &slowEvalHandler{delay: time.Millisecond * 200}
+		engine.evalHandler = evalHandler
+		runErr := startEngine(t, engine)
+
+		engine.execQueue <- &Job{Rule: &Rule{ID: 1}}
+		require.Eventually(t, func() bool { return len(engine.execQueue) == 0 }, time.Second, time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		require.NoError(t, engine.Stop(ctx))
+		require.Equal(t, 1, evalHandler.callCount())
+		require.NoError(t, <-runErr)
+
+		// stopping again is a no-op
+		require.NoError(t, engine.Stop(ctx))
+	})
+
+	t.Run("returns when the deadline is exceeded", func(t *testing.T) {
+		engine := newRunnableEngine(t)
+		engine.evalHandler = &slowEvalHandler{delay: time.Second}
+		runErr := startEngine(t, engine)
+
+		engine.execQueue <- &Job{Rule: &Rule{ID: 1}}
+		require.Eventually(t, func() bool { return len(engine.execQueue) == 0 }, time.Second, time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+		require.ErrorIs(t, engine.Stop(ctx), context.DeadlineExceeded)
+		require.NoError(t, <-runErr)
+	})
+
+	t.Run("concurrent calls", func(t *testing.T) {
+		engine := newRunnableEngine(t)
+		engine.evalHandler = &slowEvalHandler{}
+		runErr := startEngine(t, engine)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				require.NoError(t, engine.Stop(context.Background()))
+			}()
+		}
+		wg.Wait()
+		require.NoError(t, <-runErr)
+	})
+
+	t.Run("engine not running", func(t *testing.T) {
+		engine := newRunnableEngine(t)
+		require.NoError(t, engine.Stop(context.Background()))
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/grafana/grafana/pkg/components/securejsondata"
 
@@ -118,3 +120,84 @@ type fakeRequestValidator struct{}
 func (fakeRequestValidator) Validate(_ string, _ *http.Request) error {
 	return nil
 }
+
+// NotifierTestErrors are the errors of the notifiers which failed to send
+// the test notification of an alert rule, keyed by the notifier uid.
+type NotifierTestErrors map[string]error
+
+func (errs NotifierTestErrors) Error() string {
+	uids := make([]string, 0, len(errs))
+	for uid := range errs {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	msgs := make([]string, 0, len(uids))
+	for _, uid := range uids {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", uid, errs[uid]))
+	}
+	return "failed to send the test notification: " + strings.Join(msgs, "; ")
+}
+
+// TestNotification sends a test notification for the alert rule through the
+// notification service of the engine, using a synthetic firing evaluation.
+// The notifications are routed, and their deliveries recorded in the notifier
+// stats, as for a real evaluation, but the alert and notification states are
+// left untouched. It returns NotifierTestErrors with the notifiers which
+// failed, nil when every notifier succeeded.
+func (e *AlertEngine) TestNotification(ctx context.Context, ruleID int64) error {
+	alertQuery := &models.GetAlertByIdQuery{Id: ruleID}
+	if err := bus.Dispatch(alertQuery); err != nil {
+		return err
+	}
+
+	rule, err := NewRuleFromDBAlert(alertQuery.Result, false)
+	if err != nil {
+		return err
+	}
+
+	rule.State = models.AlertStateAlerting
+	evalContext := NewEvalContext(ctx, rule, fakeRequestValidator{})
+	evalContext.IsTestRun = true
+	evalContext.Firing = true
+	evalContext.EvalMatches = evalMatchesBasedOnState()
+
+	results, err := e.notifier.sendTestNotifications(evalContext)
+	if err != nil {
+		return err
+	}
+
+	errs := NotifierTestErrors{}
+	for uid, err := range results {
+		if err != nil {
+			errs[uid] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// sendTestNotifications sends the notifications of the test run to the
+// notifiers they are routed to, whatever their notification state, and
+// returns the outcome of every notifier keyed by the notifier uid.
+func (n *notificationService) sendTestNotifications(evalContext *EvalContext) (map[string]error, error) {
+	evalContext.Notifications = routeNotifications(evalContext)
+	query := &models.GetAlertNotificationsWithUidToSendQuery{OrgId: evalContext.Rule.OrgID, Uids: evalContext.Notifications}
+	if err := bus.Dispatch(query); err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]error, len(query.Result))
+	for _, notification := range query.Result {
+		notifier, err := InitNotifier(notification)
+		if err != nil {
+			results[notification.Uid] = err
+			continue
+		}
+
+		results[notification.Uid] = n.sendNotification(evalContext, &notifierState{notifier: notifier})
+	}
+	return results, nil
+}
@@ -0,0 +1,102 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/stretchr/testify/require"
+)
+
+type failingTestNotifier struct {
+	testNotifier
+}
+
+func (n *failingTestNotifier) Notify(evalCtx *EvalContext) error {
+	return errors.New("invalid credentials")
+}
+
+func TestEngineTestNotification(t *testing.T) {
+	RegisterNotifier(&NotifierPlugin{
+		Type:    "test",
+		Name:    "Test",
+		Factory: newTestNotifier,
+	})
+	RegisterNotifier(&NotifierPlugin{
+		Type: "test-failing",
+		Name: "Test failing",
+		Factory: func(model *models.AlertNotification) (Notifier, error) {
+			return &failingTestNotifier{testNotifier{UID: model.Uid, Type: model.Type}}, nil
+		},
+	})
+
+	settings, err := simplejson.NewJson([]byte(`{
+		"notifications": [{"uid": "working"}, {"uid": "broken"}],
+		"conditions": [{"type": "test", "evaluator": {"type": "gt", "params": [1]}}]
+	}`))
+	require.NoError(t, err)
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &conditionStub{}, nil
+	})
+
+	bus.AddHandler("test", func(query *models.GetAlertByIdQuery) error {
+		query.Result = &models.Alert{Id: query.Id, OrgId: 1, Name: "rule", Settings: settings, State: models.AlertStateOK}
+		return nil
+	})
+
+	var requestedUids []string
+	bus.AddHandlerCtx("test", func(ctx context.Context, query *models.GetAlertNotificationsWithUidToSendQuery) error {
+		requestedUids = query.Uids
+		notifications := map[string]*models.AlertNotification{
+			"working": {Uid: "working", Type: "test", Settings: simplejson.New()},
+			"broken":  {Uid: "broken", Type: "test-failing", Settings: simplejson.New()},
+		}
+		query.Result = nil
+		for _, uid := range query.Uids {
+			query.Result = append(query.Result, notifications[uid])
+		}
+		return nil
+	})
+
+	bus.AddHandlerCtx("test", func(ctx context.Context, cmd *models.SetAlertNotificationStateToPendingCommand) error {
+		t.Fatal("test notifications should not change the notification state")
+		return nil
+	})
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	err = engine.TestNotification(context.Background(), 42)
+
+	require.Equal(t, []string{"working", "broken"}, requestedUids)
+	var errs NotifierTestErrors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 1)
+	require.EqualError(t, errs["broken"], "invalid credentials")
+	require.EqualError(t, err, "failed to send the test notification: broken: invalid credentials")
+
+	stats := engine.NotifierStatus()
+	require.Len(t, stats, 2, "the deliveries of the test are recorded in the notifier stats")
+	require.Equal(t, "broken", stats[0].UID)
+	require.Equal(t, int64(1), stats[0].Failures)
+	require.Equal(t, "working", stats[1].UID)
+	require.Equal(t, int64(1), stats[1].Successes)
+
+	t.Run("the notifications are routed", func(t *testing.T) {
+		routed, err := simplejson.NewJson([]byte(`{
+			"notifications": [{"uid": "working"}, {"uid": "broken"}],
+			"notificationRoutes": [{"notifications": [{"uid": "working"}]}],
+			"conditions": [{"type": "test", "evaluator": {"type": "gt", "params": [1]}}]
+		}`))
+		require.NoError(t, err)
+		bus.AddHandler("test", func(query *models.GetAlertByIdQuery) error {
+			query.Result = &models.Alert{Id: query.Id, OrgId: 1, Name: "rule", Settings: routed, State: models.AlertStateOK}
+			return nil
+		})
+
+		require.NoError(t, engine.TestNotification(context.Background(), 42))
+		require.Equal(t, []string{"working"}, requestedUids)
+	})
+}
@@ -32,6 +32,9 @@ func (e *AlertEngine) AlertTest(orgID int64, dashboard *simplejson.Json, panelID
 		context := NewEvalContext(context.Background(), rule, fakeRequestValidator{})
 		context.IsTestRun = true
 		context.IsDebug = true
+		if user != nil {
+			context.User = user
+		}
 
 		handler.Eval(context)
 		context.Rule.State = context.GetNewState()
@@ -0,0 +1,185 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/metrics"
+)
+
+// throughputWindow is the window, in seconds, the rolling throughput
+// statistics of the engine are computed on. They are sampled in buckets
+// of a second, the one of the current second being partial.
+const throughputWindow = 60
+
+// EngineStats are the throughput and saturation statistics of the
+// evaluations of an alerting engine over the last minute.
+type EngineStats struct {
+	// EvaluationsPerSecond is the rate of the evaluations completed.
+	EvaluationsPerSecond float64
+	// AverageQueueWait is the average time the jobs waited on the exec
+	// queue between being due and being picked up by the dispatcher.
+	AverageQueueWait time.Duration
+	// QueueLength and QueueCapacity are the number of jobs currently
+	// waiting on the exec queue and the number it can hold.
+	QueueLength   int
+	QueueCapacity int
+	// WorkerBusyRatio is the average share of the in-flight cost budget
+	// used by the evaluations. Evaluations are not bounded when no
+	// budget is configured, in which case it is always 0.
+	WorkerBusyRatio float64
+}
+
+type throughputBucket struct {
+	second    int64
+	evals     int64
+	waits     int64
+	waitTotal time.Duration
+	// busy is the in-flight cost integrated over the second, in cost-seconds
+	busy float64
+}
+
+// throughputStats tracks the evaluations of the engine in per-second
+// buckets covering the throughput window.
+type throughputStats struct {
+	sync.Mutex
+	start    time.Time
+	capacity int64
+	buckets  [throughputWindow + 1]throughputBucket
+
+	inFlight     int64
+	inFlightFrom time.Time
+}
+
+func newThroughputStats(now time.Time, capacity int64) *throughputStats {
+	return &throughputStats{start: now, capacity: capacity, inFlightFrom: now}
+}
+
+func (s *throughputStats) bucket(t time.Time) *throughputBucket {
+	second := t.Unix()
+	b := &s.buckets[second%int64(len(s.buckets))]
+	if b.second != second {
+		*b = throughputBucket{second: second}
+	}
+	return b
+}
+
+// dequeued records the time a job waited on the exec queue.
+func (s *throughputStats) dequeued(now time.Time, enqueuedAt time.Time) {
+	if enqueuedAt.IsZero() {
+		return
+	}
+	wait := now.Sub(enqueuedAt)
+	if wait < 0 {
+		wait = 0
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	b := s.bucket(now)
+	b.waits++
+	b.waitTotal += wait
+}
+
+// evaluated records the completion of a job.
+func (s *throughputStats) evaluated(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.bucket(now).evals++
+}
+
+// busy adds delta to the cost of the evaluations in flight.
+func (s *throughputStats) busy(now time.Time, delta int64) {
+	s.Lock()
+	defer s.Unlock()
+	s.integrateBusy(now)
+	s.inFlight += delta
+}
+
+// setCapacity changes the size of the in-flight cost budget.
+func (s *throughputStats) setCapacity(now time.Time, capacity int64) {
+	s.Lock()
+	defer s.Unlock()
+	s.integrateBusy(now)
+	s.capacity = capacity
+}
+
+// integrateBusy accounts for the cost in flight since the last change, split
+// over the buckets of the seconds it spans.
+func (s *throughputStats) integrateBusy(now time.Time) {
+	from := s.inFlightFrom
+	if windowStart := throughputWindowStart(now); from.Before(windowStart) {
+		from = windowStart
+	}
+	for s.inFlight > 0 && from.Before(now) {
+		to := time.Unix(from.Unix()+1, 0)
+		if to.After(now) {
+			to = now
+		}
+		s.bucket(from).busy += float64(s.inFlight) * to.Sub(from).Seconds()
+		from = to
+	}
+	s.inFlightFrom = now
+}
+
+// throughputWindowStart returns the start of the first second of the window.
+func throughputWindowStart(now time.Time) time.Time {
+	return time.Unix(now.Unix()-throughputWindow, 0)
+}
+
+// stats computes the statistics over the buckets of the throughput window.
+func (s *throughputStats) stats(now time.Time) EngineStats {
+	s.Lock()
+	defer s.Unlock()
+	s.integrateBusy(now)
+
+	var evals, waits int64
+	var waitTotal time.Duration
+	var busy float64
+	for _, b := range s.buckets {
+		if b.second < now.Unix()-throughputWindow || b.second > now.Unix() {
+			continue
+		}
+		evals += b.evals
+		waits += b.waits
+		waitTotal += b.waitTotal
+		busy += b.busy
+	}
+
+	// don't under-report the rates while the engine is younger than the window
+	windowStart := throughputWindowStart(now)
+	if s.start.After(windowStart) {
+		windowStart = s.start
+	}
+	window := now.Sub(windowStart).Seconds()
+	if window < 1 {
+		window = 1
+	}
+
+	stats := EngineStats{EvaluationsPerSecond: float64(evals) / window}
+	if waits > 0 {
+		stats.AverageQueueWait = waitTotal / time.Duration(waits)
+	}
+	if s.capacity > 0 {
+		stats.WorkerBusyRatio = busy / (window * float64(s.capacity))
+	}
+	return stats
+}
+
+// Stats returns the throughput and saturation statistics of the
+// evaluations of the engine over the last minute.
+func (e *AlertEngine) Stats() EngineStats {
+	stats := e.throughput.stats(e.clock.Now())
+	stats.QueueLength = len(e.execQueue)
+	stats.QueueCapacity = cap(e.execQueue)
+	return stats
+}
+
+// updateStatsMetrics exposes the current statistics of the engine as metrics.
+func (e *AlertEngine) updateStatsMetrics() {
+	stats := e.Stats()
+	metrics.MAlertingEvaluationsPerSecond.Set(stats.EvaluationsPerSecond)
+	metrics.MAlertingExecQueueWait.Set(stats.AverageQueueWait.Seconds())
+	metrics.MAlertingExecQueueDepth.Set(float64(stats.QueueLength))
+	metrics.MAlertingWorkerBusyRatio.Set(stats.WorkerBusyRatio)
+}
@@ -0,0 +1,87 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/grafana/pkg/infra/metrics"
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThroughputStats(t *testing.T) {
+	start := time.Unix(1000, 0)
+	s := newThroughputStats(start, 4)
+
+	s.busy(start, 2)
+	s.dequeued(start.Add(2*time.Second), start)
+	s.dequeued(start.Add(4*time.Second), start)
+	s.dequeued(start.Add(4*time.Second), time.Time{})
+	for i := 0; i < 30; i++ {
+		s.evaluated(start.Add(time.Duration(i) * 300 * time.Millisecond))
+	}
+	s.busy(start.Add(5*time.Second), -2)
+
+	stats := s.stats(start.Add(10 * time.Second))
+	require.Equal(t, 3.0, stats.EvaluationsPerSecond)
+	require.Equal(t, 3*time.Second, stats.AverageQueueWait)
+	require.InDelta(t, 0.25, stats.WorkerBusyRatio, 0.0001)
+
+	// the old evaluations leave the window
+	stats = s.stats(start.Add(2 * time.Minute))
+	require.Equal(t, EngineStats{}, stats)
+
+	// the evaluations still in flight keep the workers busy
+	s.busy(start.Add(2*time.Minute), 4)
+	stats = s.stats(start.Add(4 * time.Minute))
+	require.InDelta(t, 1, stats.WorkerBusyRatio, 0.0001)
+}
+
+func TestEngineStats(t *testing.T) {
+	origMaxCost := setting.AlertingMaxInFlightCost
+	t.Cleanup(func() { setting.AlertingMaxInFlightCost = origMaxCost })
+	setting.AlertingMaxInFlightCost = 2
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	engine := &AlertEngine{}
+	require.NoError(t, engine.Init())
+	mock := clock.NewMock()
+	engine.clock = mock
+	engine.throughput = newThroughputStats(mock.Now(), engine.maxCost)
+	engine.resultHandler = &FakeResultHandler{}
+	engine.resultQueue = nil
+
+	s := newScheduler()
+	s.Update([]*Rule{{ID: 1, Frequency: 1, Cost: 1}, {ID: 2, Frequency: 1, Cost: 1}})
+	// the rules wait for their offset on the first tick
+	s.Tick(mock.Now(), engine.execQueue)
+	mock.Add(time.Second)
+	s.Tick(mock.Now(), engine.execQueue)
+
+	stats := engine.Stats()
+	require.Equal(t, 2, stats.QueueLength)
+	require.Equal(t, 1000, stats.QueueCapacity)
+
+	mock.Add(time.Second)
+	for i := 0; i < 2; i++ {
+		job := <-engine.execQueue
+		engine.throughput.dequeued(mock.Now(), job.GetEnqueuedAt())
+		engine.evalHandler = NewFakeEvalHandler(1)
+		require.NoError(t, engine.processJobWithinBudget(context.Background(), job))
+	}
+
+	stats = engine.Stats()
+	require.Equal(t, 0, stats.QueueLength)
+	require.Equal(t, time.Second, stats.AverageQueueWait)
+	require.Equal(t, 1.0, stats.EvaluationsPerSecond)
+
+	engine.updateStatsMetrics()
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.MAlertingEvaluationsPerSecond))
+	require.Equal(t, 1.0, testutil.ToFloat64(metrics.MAlertingExecQueueWait))
+	require.Equal(t, 0.0, testutil.ToFloat64(metrics.MAlertingExecQueueDepth))
+}
@@ -0,0 +1,70 @@
+package alerting
+
+import (
+	"sync"
+	"time"
+)
+
+// ruleTombstones keeps track of the recently deleted alert rules, so that
+// the results of their in-flight evaluations are dropped and stale reads
+// don't schedule them again. Tombstones expire after the grace period.
+type ruleTombstones struct {
+	sync.Mutex
+	gracePeriod time.Duration
+	known       map[ruleKey]bool
+	deletedAt   map[ruleKey]time.Time
+}
+
+func newRuleTombstones(gracePeriod time.Duration) *ruleTombstones {
+	return &ruleTombstones{
+		gracePeriod: gracePeriod,
+		known:       make(map[ruleKey]bool),
+		deletedAt:   make(map[ruleKey]time.Time),
+	}
+}
+
+// update records the rules deleted since the previous fetch and returns
+// the fetched rules without the ones deleted within the grace period.
+func (t *ruleTombstones) update(rules []*Rule, now time.Time) []*Rule {
+	t.Lock()
+	defer t.Unlock()
+
+	for key, deletedAt := range t.deletedAt {
+		if now.Sub(deletedAt) >= t.gracePeriod {
+			delete(t.deletedAt, key)
+		}
+	}
+
+	fetched := make(map[ruleKey]bool, len(rules))
+	live := make([]*Rule, 0, len(rules))
+	for _, rule := range rules {
+		if _, deleted := t.deletedAt[ruleKeyOf(rule)]; deleted {
+			continue
+		}
+		fetched[ruleKeyOf(rule)] = true
+		live = append(live, rule)
+	}
+
+	for key := range t.known {
+		if !fetched[key] {
+			t.deletedAt[key] = now
+		}
+	}
+	t.known = fetched
+
+	return live
+}
+
+func (t *ruleTombstones) isDeleted(rule *Rule) bool {
+	t.Lock()
+	defer t.Unlock()
+	_, deleted := t.deletedAt[ruleKeyOf(rule)]
+	return deleted
+}
+
+// setGracePeriod changes how long the tombstones of the deleted rules are kept.
+func (t *ruleTombstones) setGracePeriod(gracePeriod time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+	t.gracePeriod = gracePeriod
+}
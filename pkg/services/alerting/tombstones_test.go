@@ -0,0 +1,99 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleTombstones(t *testing.T) {
+	start := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	ids := func(rules []*Rule) []int64 {
+		var ids []int64
+		for _, rule := range rules {
+			ids = append(ids, rule.ID)
+		}
+		return ids
+	}
+
+	deleted := &Rule{ID: 1}
+	tombstones := newRuleTombstones(time.Minute)
+	require.Equal(t, []int64{1, 2}, ids(tombstones.update([]*Rule{{ID: 1}, {ID: 2}}, start)))
+	require.False(t, tombstones.isDeleted(deleted))
+
+	// rule 1 is deleted
+	require.Equal(t, []int64{2}, ids(tombstones.update([]*Rule{{ID: 2}}, start.Add(10*time.Second))))
+	require.True(t, tombstones.isDeleted(deleted))
+	require.False(t, tombstones.isDeleted(&Rule{ID: 1, OrgID: 2}), "the rule of another org with the same id is not deleted")
+
+	// a stale read doesn't resurrect it
+	require.Equal(t, []int64{2}, ids(tombstones.update([]*Rule{{ID: 1}, {ID: 2}}, start.Add(20*time.Second))))
+	require.True(t, tombstones.isDeleted(deleted))
+
+	// the tombstone expires after the grace period
+	require.Equal(t, []int64{2}, ids(tombstones.update([]*Rule{{ID: 2}}, start.Add(70*time.Second))))
+	require.False(t, tombstones.isDeleted(deleted))
+}
+
+type failingRuleReader struct{}
+
+func (failingRuleReader) fetch() ([]*Rule, error) {
+	return nil, errors.New("database is locked")
+}
+
+func TestEngineDeletedRules(t *testing.T) {
+	setting.AlertingEvaluationTimeout = 30 * time.Second
+	setting.AlertingNotificationTimeout = 30 * time.Second
+	setting.AlertingMaxAttempts = 1
+
+	t.Run("drops the result of a rule deleted mid-evaluation", func(t *testing.T) {
+		engine := newRunnableEngine(t)
+		evalHandler := &blockingEvalHandler{started: make(chan struct{}, 1), release: make(chan struct{})}
+		engine.evalHandler = evalHandler
+		resultHandler := &slowResultHandler{handled: make(chan *EvalContext, 1)}
+		engine.resultHandler = resultHandler
+
+		rule := &Rule{ID: 1, Frequency: 10}
+		reader := &fakeRuleReader{rules: []*Rule{rule}}
+		engine.ruleReader = reader
+		engine.updateRules("localhost")
+
+		done := make(chan error, 1)
+		go func() { done <- engine.processJobWithRetry(context.Background(), &Job{running: true, Rule: rule}) }()
+		<-evalHandler.started
+
+		reader.rules = nil
+		engine.updateRules("localhost")
+		require.Empty(t, engine.ScheduleSnapshot())
+		close(evalHandler.release)
+
+		require.NoError(t, <-done)
+		select {
+		case <-resultHandler.handled:
+			t.Fatal("the result of a deleted rule was handled")
+		default:
+		}
+		_, ok := engine.LastEvaluation(rule.OrgID, rule.ID)
+		require.False(t, ok)
+
+		// results already waiting for the result workers are dropped too
+		engine.handleResult(NewEvalContext(context.Background(), rule, nil))
+		require.Empty(t, resultHandler.handled)
+	})
+
+	t.Run("keeps the schedule when the rules cannot be fetched", func(t *testing.T) {
+		engine := newRunnableEngine(t)
+		rule := &Rule{ID: 1, Frequency: 10}
+		engine.ruleReader = &fakeRuleReader{rules: []*Rule{rule}}
+		engine.updateRules("localhost")
+
+		engine.ruleReader = failingRuleReader{}
+		engine.updateRules("localhost")
+		require.Len(t, engine.ScheduleSnapshot(), 1)
+		require.False(t, engine.tombstones.isDeleted(rule))
+	})
+}
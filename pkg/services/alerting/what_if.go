@@ -0,0 +1,53 @@
+package alerting
+
+import (
+	"context"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+)
+
+// SyntheticSeries is the data a what-if evaluation of an alert rule is run
+// against, as the series returned to the queries of its conditions by refId.
+// The queries whose refId is missing return no series.
+type SyntheticSeries map[string]plugins.DataTimeSeriesSlice
+
+// syntheticRequestHandler answers the data requests with synthetic series
+// instead of querying the datasources.
+type syntheticRequestHandler struct {
+	data SyntheticSeries
+}
+
+//nolint: staticcheck // plugins.DataQuery deprecated
+func (h syntheticRequestHandler) HandleRequest(_ context.Context, _ *models.DataSource, query plugins.DataQuery) (plugins.DataResponse, error) {
+	resp := plugins.DataResponse{Results: make(map[string]plugins.DataQueryResult, len(query.Queries))}
+	for _, q := range query.Queries {
+		resp.Results[q.RefID] = plugins.DataQueryResult{RefID: q.RefID, Series: h.data[q.RefID]}
+	}
+	return resp, nil
+}
+
+// EvalWithData evaluates the alert rule against the synthetic data, e.g. to
+// tell whether it would fire if the error rate were some value, and returns
+// the evaluation with the state the rule would move to from its current
+// state. The datasources are not queried, and the state of the rule is
+// neither saved nor notified.
+func (e *AlertEngine) EvalWithData(ruleID int64, data SyntheticSeries) (*EvalContext, error) {
+	alertQuery := &models.GetAlertByIdQuery{Id: ruleID}
+	if err := bus.Dispatch(alertQuery); err != nil {
+		return nil, err
+	}
+	rule, err := NewRuleFromDBAlert(alertQuery.Result, false)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := NewEvalHandler(syntheticRequestHandler{data: data})
+
+	evalContext := NewEvalContext(context.Background(), rule, fakeRequestValidator{})
+	evalContext.IsTestRun = true
+	handler.Eval(evalContext)
+	evalContext.Rule.State = evalContext.GetNewState()
+	return evalContext, nil
+}
@@ -0,0 +1,106 @@
+package alerting
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/bus"
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/stretchr/testify/require"
+)
+
+// thresholdCondition fires when the last value of a series of its query
+// is above its threshold.
+type thresholdCondition struct {
+	refID     string
+	threshold float64
+}
+
+//nolint: staticcheck // plugins.DataQuery deprecated
+func (c *thresholdCondition) Eval(context *EvalContext, reqHandler plugins.DataRequestHandler) (*ConditionResult, error) {
+	resp, err := reqHandler.HandleRequest(context.Ctx, &models.DataSource{Id: 1}, plugins.DataQuery{
+		Queries: []plugins.DataSubQuery{{RefID: c.refID}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ConditionResult{}
+	series := resp.Results[c.refID].Series
+	result.NoDataFound = len(series) == 0
+	for _, s := range series {
+		last := s.Points[len(s.Points)-1][0]
+		if last.Valid && last.Float64 > c.threshold {
+			result.Firing = true
+			result.EvalMatches = append(result.EvalMatches, &EvalMatch{Metric: s.Name, Value: last})
+		}
+	}
+	return result, nil
+}
+
+var errAlertNotFound = errors.New("could not find alert")
+
+func TestEngineEvalWithData(t *testing.T) {
+	RegisterCondition("threshold", func(model *simplejson.Json, index int) (Condition, error) {
+		return &thresholdCondition{refID: model.Get("refId").MustString(), threshold: model.Get("threshold").MustFloat64()}, nil
+	})
+
+	var stored *models.Alert
+	bus.AddHandler("test", func(query *models.GetAlertByIdQuery) error {
+		if stored == nil || query.Id != stored.Id {
+			return errAlertNotFound
+		}
+		query.Result = stored
+		return nil
+	})
+	newAlert := func(state models.AlertStateType, forDuration time.Duration) *models.Alert {
+		settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "threshold", "refId": "A", "threshold": 5}], "noDataState": "no_data"}`))
+		require.NoError(t, err)
+		return &models.Alert{Id: 1, OrgId: 1, Frequency: 60, For: forDuration, State: state, Settings: settings}
+	}
+	errorRate := func(values ...float64) SyntheticSeries {
+		points := make(plugins.DataTimeSeriesPoints, 0, len(values))
+		for i, value := range values {
+			points = append(points, plugins.DataTimePoint{null.FloatFrom(value), null.FloatFrom(float64(i * 1000))})
+		}
+		return SyntheticSeries{"A": {{Name: "error_rate", Points: points}}}
+	}
+
+	engine := &AlertEngine{}
+	stored = newAlert(models.AlertStateOK, 0)
+
+	evalContext, err := engine.EvalWithData(1, errorRate(1, 2, 10))
+	require.NoError(t, err)
+	require.True(t, evalContext.Firing)
+	require.Equal(t, models.AlertStateAlerting, evalContext.Rule.State)
+	require.Len(t, evalContext.EvalMatches, 1)
+	require.Equal(t, "error_rate", evalContext.EvalMatches[0].Metric)
+	require.Equal(t, 10.0, evalContext.EvalMatches[0].Value.Float64)
+
+	evalContext, err = engine.EvalWithData(1, errorRate(10, 2, 1))
+	require.NoError(t, err)
+	require.False(t, evalContext.Firing)
+	require.Equal(t, models.AlertStateOK, evalContext.Rule.State)
+
+	evalContext, err = engine.EvalWithData(1, SyntheticSeries{})
+	require.NoError(t, err)
+	require.True(t, evalContext.NoDataFound)
+	require.Equal(t, models.AlertStateNoData, evalContext.Rule.State)
+
+	t.Run("the state decision of the rule applies", func(t *testing.T) {
+		stored = newAlert(models.AlertStateOK, time.Minute)
+		evalContext, err := engine.EvalWithData(1, errorRate(10))
+		require.NoError(t, err)
+		require.True(t, evalContext.Firing)
+		require.Equal(t, models.AlertStatePending, evalContext.Rule.State)
+	})
+
+	t.Run("rule not found", func(t *testing.T) {
+		_, err := engine.EvalWithData(2, errorRate(10))
+		require.Equal(t, errAlertNotFound, err)
+	})
+}
@@ -0,0 +1,314 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/plugins"
+)
+
+// EvalWindow is a named time window the conditions of a rule are evaluated
+// over, ending at the time of the evaluation.
+type EvalWindow struct {
+	Name     string
+	Duration time.Duration
+}
+
+// WindowResult is the result of the conditions of a rule evaluated over one
+// of the windows of the rule.
+type WindowResult struct {
+	Firing      bool
+	NoDataFound bool
+	EvalMatches []*EvalMatch
+
+	// Series are the reduced values of all the series of the window, matching
+	// or not, by series key.
+	Series map[string]*EvalMatch
+}
+
+var (
+	windowNamePattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	windowOperatorPattern  = regexp.MustCompile(`(?i)\s+(and|or)\s+`)
+	windowTermPattern      = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*(?:(>=|<=|>|<)\s*(.+))?$`)
+	errWindowConditionTerm = errors.New("a term must be a window, or a window compared to a threshold, e.g. `short > 14.4*0.001`")
+)
+
+// windowTerm is a term of a window condition, either a window, true for the
+// series matching the conditions of the rule over the window, or a window
+// compared to a threshold, true for the series whose value over the window
+// is past it.
+type windowTerm struct {
+	// operator joins the term to the previous ones, it is empty for the first term.
+	operator   string
+	window     string
+	comparator string
+	threshold  float64
+}
+
+// windowCondition combines the results of the windows of a rule, e.g.
+// `short > 14.4*0.001 AND long > 14.4*0.001` for a burn rate alert firing when
+// both the short and long windows burn the error budget 14.4 times too fast.
+// Its terms are combined left to right, like the conditions of a rule.
+type windowCondition struct {
+	expr  string
+	terms []windowTerm
+}
+
+func (c *windowCondition) String() string {
+	return c.expr
+}
+
+// parseWindows parses the windows of a rule and the condition combining their
+// results, which must be set together.
+func parseWindows(rawWindows []interface{}, rawCondition string) ([]*EvalWindow, *windowCondition, error) {
+	if len(rawWindows) == 0 && rawCondition == "" {
+		return nil, nil, nil
+	}
+	if len(rawWindows) == 0 {
+		return nil, nil, errors.New("the window condition has no windows")
+	}
+	if rawCondition == "" {
+		return nil, nil, errors.New("the windows have no window condition")
+	}
+
+	windows := make([]*EvalWindow, 0, len(rawWindows))
+	names := make(map[string]bool, len(rawWindows))
+	for _, v := range rawWindows {
+		jsonModel := simplejson.NewFromAny(v)
+		name := jsonModel.Get("name").MustString()
+		if !windowNamePattern.MatchString(name) {
+			return nil, nil, fmt.Errorf("invalid window name %q", name)
+		}
+		if names[name] {
+			return nil, nil, fmt.Errorf("duplicate window %q", name)
+		}
+		duration, err := time.ParseDuration(jsonModel.Get("duration").MustString())
+		if err != nil || duration <= 0 {
+			return nil, nil, fmt.Errorf("could not parse the duration of window %q", name)
+		}
+		names[name] = true
+		windows = append(windows, &EvalWindow{Name: name, Duration: duration})
+	}
+
+	condition, err := parseWindowCondition(rawCondition)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, term := range condition.terms {
+		if !names[term.window] {
+			return nil, nil, fmt.Errorf("the window condition references the unknown window %q", term.window)
+		}
+	}
+	return windows, condition, nil
+}
+
+func parseWindowCondition(expr string) (*windowCondition, error) {
+	expr = strings.TrimSpace(expr)
+	condition := &windowCondition{expr: expr}
+
+	operators := windowOperatorPattern.FindAllStringSubmatchIndex(expr, -1)
+	start, operator := 0, ""
+	for i := 0; i <= len(operators); i++ {
+		end := len(expr)
+		if i < len(operators) {
+			end = operators[i][0]
+		}
+		term, err := parseWindowTerm(expr[start:end])
+		if err != nil {
+			return nil, err
+		}
+		term.operator = operator
+		condition.terms = append(condition.terms, term)
+
+		if i < len(operators) {
+			operator = strings.ToLower(expr[operators[i][2]:operators[i][3]])
+			start = operators[i][1]
+		}
+	}
+	return condition, nil
+}
+
+// parseWindowTerm parses a term, whose threshold may be a product, e.g.
+// `14.4*0.001` for 14.4 times the error budget.
+func parseWindowTerm(raw string) (windowTerm, error) {
+	match := windowTermPattern.FindStringSubmatch(strings.TrimSpace(raw))
+	if match == nil {
+		return windowTerm{}, errWindowConditionTerm
+	}
+	term := windowTerm{window: match[1], comparator: match[2]}
+	if term.comparator == "" {
+		return term, nil
+	}
+
+	term.threshold = 1
+	for _, factor := range strings.Split(match[3], "*") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(factor), 64)
+		if err != nil {
+			return windowTerm{}, errWindowConditionTerm
+		}
+		term.threshold *= value
+	}
+	return term, nil
+}
+
+// evalSeries returns true if the term is true for the series of the window.
+func (t windowTerm) evalSeries(result *WindowResult, key string) bool {
+	if t.comparator == "" {
+		for _, match := range result.EvalMatches {
+			if seriesKey(match) == key {
+				return true
+			}
+		}
+		return false
+	}
+
+	series, ok := result.Series[key]
+	if !ok || !series.Value.Valid {
+		return false
+	}
+	value := series.Value.Float64
+	switch t.comparator {
+	case ">":
+		return value > t.threshold
+	case ">=":
+		return value >= t.threshold
+	case "<":
+		return value < t.threshold
+	default:
+		return value <= t.threshold
+	}
+}
+
+// eval combines the results of the windows for every series, and returns
+// the eval matches of the series for which the condition is true, whether
+// the windows have no data and the verdict of every term for the logs. The
+// value of a matching series is its value over the first window of the
+// condition.
+func (c *windowCondition) eval(results map[string]*WindowResult) ([]*EvalMatch, bool, string) {
+	var keys []string
+	seen := make(map[string]*EvalMatch)
+	for _, term := range c.terms {
+		result := results[term.window]
+		for _, match := range result.EvalMatches {
+			if key := seriesKey(match); seen[key] == nil {
+				keys = append(keys, key)
+				seen[key] = match
+			}
+		}
+		for key, series := range result.Series {
+			if seen[key] == nil {
+				keys = append(keys, key)
+				seen[key] = series
+			}
+		}
+	}
+
+	matches := make([]*EvalMatch, 0)
+	for _, key := range keys {
+		firing := false
+		for i, term := range c.terms {
+			termFiring := term.evalSeries(results[term.window], key)
+			switch {
+			case i == 0:
+				firing = termFiring
+			case term.operator == "or":
+				firing = firing || termFiring
+			default:
+				firing = firing && termFiring
+			}
+		}
+		if !firing {
+			continue
+		}
+
+		match := &EvalMatch{Metric: seen[key].Metric, Tags: seen[key].Tags, Value: null.FloatFromPtr(nil)}
+		if series, ok := results[c.terms[0].window].Series[key]; ok {
+			match.Value = series.Value
+		}
+		matches = append(matches, match)
+	}
+
+	noDataFound := true
+	var verdicts []string
+	for i, term := range c.terms {
+		result := results[term.window]
+		switch {
+		case i == 0:
+			noDataFound = result.NoDataFound
+		case term.operator == "or":
+			noDataFound = noDataFound || result.NoDataFound
+		default:
+			noDataFound = noDataFound && result.NoDataFound
+		}
+		verdicts = append(verdicts, fmt.Sprintf("%s=%t", term.window, result.Firing))
+	}
+	return matches, noDataFound, strings.Join(verdicts, ", ")
+}
+
+// evalWindows evaluates the conditions of the rule over each of its windows,
+// with the time range of their queries set to the window, and combines the
+// results of the windows with the window condition of the rule. The rule
+// fires when the window condition is true for at least one series. The
+// previous values of the series are not tracked over windows.
+func (e *DefaultEvalHandler) evalWindows(context *EvalContext, requestHandler plugins.DataRequestHandler) (bool, bool, time.Time) {
+	var latestDataPoint time.Time
+	context.WindowResults = make(map[string]*WindowResult, len(context.Rule.Windows))
+	for _, window := range context.Rule.Windows {
+		windowContext := *context
+		windowContext.Window = window
+		windowContext.Logs = nil
+		windowContext.QueryTraces = nil
+		windowContext.ConditionResults = nil
+		windowContext.EvalMatches = make([]*EvalMatch, 0)
+		windowContext.SeriesValues = nil
+
+		firing, noDataFound, windowDataPoint, outcomes := e.evalRuleConditions(&windowContext, requestHandler)
+		for _, result := range windowContext.ConditionResults {
+			result.Window = window.Name
+		}
+		context.Logs = append(context.Logs, windowContext.Logs...)
+		context.QueryTraces = append(context.QueryTraces, windowContext.QueryTraces...)
+		context.ConditionResults = append(context.ConditionResults, windowContext.ConditionResults...)
+		if windowContext.Error != nil && context.Error == nil {
+			context.Error = fmt.Errorf("window %s: %w", window.Name, windowContext.Error)
+		}
+		if windowDataPoint.After(latestDataPoint) {
+			latestDataPoint = windowDataPoint
+		}
+
+		result := &WindowResult{Firing: firing, NoDataFound: noDataFound, EvalMatches: windowContext.EvalMatches, Series: make(map[string]*EvalMatch)}
+		for _, outcome := range outcomes {
+			if outcome.result == nil {
+				continue
+			}
+			for _, series := range outcome.result.Series {
+				if key := seriesKey(series); result.Series[key] == nil {
+					result.Series[key] = series
+				}
+			}
+		}
+		context.WindowResults[window.Name] = result
+	}
+
+	if context.Error != nil {
+		context.ConditionEvals = context.Rule.WindowCondition.String() + " = error"
+		return false, false, latestDataPoint
+	}
+
+	matches, noDataFound, verdicts := context.Rule.WindowCondition.eval(context.WindowResults)
+	firing := len(matches) > 0
+	context.EvalMatches = append(context.EvalMatches, matches...)
+	context.ConditionEvals = fmt.Sprintf("%s [%s] = %t", context.Rule.WindowCondition, verdicts, firing)
+	if context.IsTestRun || context.IsDebug {
+		context.Logs = append(context.Logs, &ResultLogEntry{
+			Message: fmt.Sprintf("Window condition: Eval: %v, %s, Matching series: %d", firing, verdicts, len(matches)),
+		})
+	}
+	return firing, noDataFound, latestDataPoint
+}
@@ -0,0 +1,158 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana/pkg/components/null"
+	"github.com/grafana/grafana/pkg/components/simplejson"
+	"github.com/grafana/grafana/pkg/models"
+	"github.com/grafana/grafana/pkg/plugins"
+	"github.com/grafana/grafana/pkg/services/validations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorRateCondition reports the error rate of every host over the window
+// the rule is evaluated over, matching the hosts above the threshold.
+type errorRateCondition struct {
+	rates     map[time.Duration]map[string]float64
+	threshold float64
+	windows   []time.Duration
+}
+
+func (c *errorRateCondition) Eval(context *EvalContext, reqHandler plugins.DataRequestHandler) (*ConditionResult, error) {
+	c.windows = append(c.windows, context.Window.Duration)
+
+	result := &ConditionResult{NoDataFound: len(c.rates[context.Window.Duration]) == 0}
+	for host, rate := range c.rates[context.Window.Duration] {
+		series := &EvalMatch{Metric: "error_rate", Tags: map[string]string{"host": host}, Value: null.FloatFrom(rate)}
+		result.Series = append(result.Series, series)
+		if rate > c.threshold {
+			result.EvalMatches = append(result.EvalMatches, series)
+		}
+	}
+	result.Firing = len(result.EvalMatches) > 0
+	return result, nil
+}
+
+func TestBurnRateWindows(t *testing.T) {
+	// an error budget of 0.1% burnt 14.4 times too fast is used up in 2 days
+	windows, condition, err := parseWindows([]interface{}{
+		map[string]interface{}{"name": "short", "duration": "5m"},
+		map[string]interface{}{"name": "long", "duration": "1h"},
+	}, "short > 14.4*0.001 AND long > 14.4*0.001")
+	require.NoError(t, err)
+
+	errorRates := &errorRateCondition{
+		threshold: 0.0144,
+		rates: map[time.Duration]map[string]float64{
+			5 * time.Minute: {
+				"burning":    0.05,
+				"spike":      0.2,
+				"recovering": 0.001,
+			},
+			time.Hour: {
+				"burning":    0.02,
+				"spike":      0.002,
+				"recovering": 0.03,
+			},
+		},
+	}
+	rule := &Rule{Conditions: []Condition{errorRates}, Windows: windows, WindowCondition: condition}
+	evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+	NewEvalHandler(nil).Eval(evalContext)
+
+	require.NoError(t, evalContext.Error)
+	assert.Equal(t, []time.Duration{5 * time.Minute, time.Hour}, errorRates.windows)
+	require.True(t, evalContext.Firing)
+	require.False(t, evalContext.NoDataFound)
+
+	// only the host burning the budget over both windows fires, with its value over the short window
+	require.Len(t, evalContext.EvalMatches, 1)
+	assert.Equal(t, map[string]string{"host": "burning"}, evalContext.EvalMatches[0].Tags)
+	assert.Equal(t, null.FloatFrom(0.05), evalContext.EvalMatches[0].Value)
+
+	require.Len(t, evalContext.WindowResults, 2)
+	assert.Len(t, evalContext.WindowResults["short"].EvalMatches, 2)
+	assert.Len(t, evalContext.WindowResults["long"].EvalMatches, 2)
+	assert.Len(t, evalContext.WindowResults["long"].Series, 3)
+	require.Len(t, evalContext.ConditionResults, 2)
+	assert.Equal(t, "short", evalContext.ConditionResults[0].Window)
+	assert.Equal(t, "long", evalContext.ConditionResults[1].Window)
+	assert.Equal(t, "short > 14.4*0.001 AND long > 14.4*0.001 [short=true, long=true] = true", evalContext.ConditionEvals)
+
+	t.Run("does not fire when a single window burns the budget", func(t *testing.T) {
+		delete(errorRates.rates[time.Hour], "burning")
+		evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		NewEvalHandler(nil).Eval(evalContext)
+
+		require.NoError(t, evalContext.Error)
+		assert.False(t, evalContext.Firing)
+		assert.Empty(t, evalContext.EvalMatches)
+	})
+
+	t.Run("combines the windows left to right", func(t *testing.T) {
+		_, condition, err := parseWindows([]interface{}{
+			map[string]interface{}{"name": "short", "duration": "5m"},
+			map[string]interface{}{"name": "long", "duration": "1h"},
+		}, "long or short >= 0.2")
+		require.NoError(t, err)
+		rule := &Rule{Conditions: []Condition{errorRates}, Windows: windows, WindowCondition: condition}
+		evalContext := NewEvalContext(context.Background(), rule, &validations.OSSPluginRequestValidator{})
+		NewEvalHandler(nil).Eval(evalContext)
+
+		require.True(t, evalContext.Firing)
+		var hosts []string
+		for _, match := range evalContext.EvalMatches {
+			hosts = append(hosts, match.Tags["host"])
+		}
+		assert.ElementsMatch(t, []string{"spike", "recovering"}, hosts)
+	})
+}
+
+func TestAlertRuleWindowsParsing(t *testing.T) {
+	RegisterCondition("test", func(model *simplejson.Json, index int) (Condition, error) {
+		return &FakeCondition{}, nil
+	})
+
+	parse := func(windows string, condition string) (*Rule, error) {
+		settings, err := simplejson.NewJson([]byte(`{"conditions": [{"type": "test"}], "windows": ` + windows + `}`))
+		require.NoError(t, err)
+		settings.Set("windowCondition", condition)
+		return NewRuleFromDBAlert(&models.Alert{Id: 1, Frequency: 60, Settings: settings}, false)
+	}
+
+	rule, err := parse(`[]`, "")
+	require.NoError(t, err)
+	assert.Empty(t, rule.Windows)
+	assert.Nil(t, rule.WindowCondition)
+
+	rule, err = parse(`[{"name": "short", "duration": "5m"}, {"name": "long", "duration": "1h"}]`, "short > 14.4*0.001 AND long > 14.4*0.001")
+	require.NoError(t, err)
+	assert.Equal(t, []*EvalWindow{{Name: "short", Duration: 5 * time.Minute}, {Name: "long", Duration: time.Hour}}, rule.Windows)
+	require.Len(t, rule.WindowCondition.terms, 2)
+	for i, window := range []string{"short", "long"} {
+		term := rule.WindowCondition.terms[i]
+		assert.Equal(t, window, term.window)
+		assert.Equal(t, ">", term.comparator)
+		assert.InDelta(t, 0.0144, term.threshold, 1e-12)
+	}
+	assert.Equal(t, "and", rule.WindowCondition.terms[1].operator)
+
+	for _, tc := range []struct{ windows, condition string }{
+		{windows: `[{"name": "short", "duration": "5m"}]`, condition: ""},
+		{windows: `[]`, condition: "short"},
+		{windows: `[{"name": "short", "duration": "5m"}]`, condition: "long"},
+		{windows: `[{"name": "short", "duration": "5m"}]`, condition: "short > budget"},
+		{windows: `[{"name": "short", "duration": "5m"}]`, condition: "short = 1"},
+		{windows: `[{"name": "short", "duration": "5m"}, {"name": "short", "duration": "1h"}]`, condition: "short"},
+		{windows: `[{"name": "short", "duration": "0s"}]`, condition: "short"},
+		{windows: `[{"name": "short window", "duration": "5m"}]`, condition: "short"},
+	} {
+		_, err := parse(tc.windows, tc.condition)
+		var validationErr ValidationError
+		require.ErrorAs(t, err, &validationErr, tc.windows+" "+tc.condition)
+	}
+}
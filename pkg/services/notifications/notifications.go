@@ -101,6 +101,9 @@ func (ns *NotificationService) Run(ctx context.Context) error {
 }
 
 func (ns *NotificationService) SendWebhookSync(ctx context.Context, cmd *models.SendWebhookSync) error {
+	if models.RecordNotification(ctx, cmd) {
+		return nil
+	}
 	return ns.sendWebRequestSync(ctx, &Webhook{
 		Url:         cmd.Url,
 		User:        cmd.User,
@@ -118,6 +121,9 @@ func subjectTemplateFunc(obj map[string]interface{}, value string) string {
 }
 
 func (ns *NotificationService) sendEmailCommandHandlerSync(ctx context.Context, cmd *models.SendEmailCommandSync) error {
+	if models.RecordNotification(ctx, cmd) {
+		return nil
+	}
 	message, err := ns.buildEmailMessage(&models.SendEmailCommand{
 		Data:          cmd.Data,
 		Info:          cmd.Info,
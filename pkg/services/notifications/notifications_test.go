@@ -1,6 +1,7 @@
 package notifications
 
 import (
+	"context"
 	"testing"
 
 	"github.com/grafana/grafana/pkg/bus"
@@ -33,4 +34,15 @@ func TestNotificationService(t *testing.T) {
 		assert.Equal(t, "Reset your Grafana password - asd@asd.com", sentMsg.Subject)
 		assert.NotContains(t, sentMsg.Body, "Subject")
 	})
+
+	t.Run("When sending a webhook with a notification recorder", func(t *testing.T) {
+		var recorded []interface{}
+		ctx := models.WithNotificationRecorder(context.Background(), func(msg interface{}) {
+			recorded = append(recorded, msg)
+		})
+		cmd := &models.SendWebhookSync{Url: "http://127.0.0.1:1/unreachable", Body: "body"}
+
+		require.NoError(t, ns.SendWebhookSync(ctx, cmd), "the webhook is not sent")
+		require.Equal(t, []interface{}{cmd}, recorded)
+	})
 }
@@ -27,7 +27,11 @@ func init() {
 
 func GetAlertById(query *models.GetAlertByIdQuery) error {
 	alert := models.Alert{}
-	has, err := x.ID(query.Id).Get(&alert)
+	sess := x.ID(query.Id)
+	if query.OrgId != 0 {
+		sess = sess.Where("org_id=?", query.OrgId)
+	}
+	has, err := sess.Get(&alert)
 	if !has {
 		return fmt.Errorf("could not find alert")
 	}
@@ -11,6 +11,7 @@ import (
 func init() {
 	bus.AddHandler("sql", UnprovisionDashboard)
 	bus.AddHandler("sql", DeleteOrphanedProvisionedDashboards)
+	bus.AddHandler("sql", GetProvisionedDashboardData)
 }
 
 type DashboardExtras struct {
@@ -32,6 +33,18 @@ func (ss *SQLStore) GetProvisionedDataByDashboardID(dashboardID int64) (*models.
 	return nil, nil
 }
 
+func GetProvisionedDashboardData(query *models.GetProvisionedDashboardDataQuery) error {
+	var data models.DashboardProvisioning
+	exists, err := x.Where("dashboard_id = ?", query.DashboardId).Get(&data)
+	if err != nil {
+		return err
+	}
+	if exists {
+		query.Result = &data
+	}
+	return nil
+}
+
 func (ss *SQLStore) SaveProvisionedDashboard(cmd models.SaveDashboardCommand,
 	provisioning *models.DashboardProvisioning) (*models.Dashboard, error) {
 	err := ss.WithTransactionalDbSession(context.Background(), func(sess *DBSession) error {
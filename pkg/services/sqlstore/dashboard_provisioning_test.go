@@ -110,6 +110,17 @@ func TestDashboardProvisioningTest(t *testing.T) {
 				So(data, ShouldBeNil)
 			})
 
+			Convey("Can query for the provisioning of a dashboard on the bus", func() {
+				query := &models.GetProvisionedDashboardDataQuery{DashboardId: dash.Id}
+				So(GetProvisionedDashboardData(query), ShouldBeNil)
+				So(query.Result, ShouldNotBeNil)
+				So(query.Result.DashboardId, ShouldEqual, dash.Id)
+
+				query = &models.GetProvisionedDashboardDataQuery{DashboardId: 3000}
+				So(GetProvisionedDashboardData(query), ShouldBeNil)
+				So(query.Result, ShouldBeNil)
+			})
+
 			Convey("Deleting folder should delete provision meta data", func() {
 				deleteCmd := &models.DeleteDashboardCommand{
 					Id:    dash.Id,
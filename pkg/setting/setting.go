@@ -49,6 +49,26 @@ const (
 	authProxySyncTTL = 60
 )
 
+// Behaviors of cluster alerting when the remote cache is unavailable
+const (
+	ClusteringFailOpen   = "fail-open"
+	ClusteringFailClosed = "fail-closed"
+)
+
+// Orders in which the alert rules due on the same tick are evaluated
+const (
+	EvalOrderByID        = "id"
+	EvalOrderByLastError = "last-error"
+	EvalOrderRandom      = "random"
+)
+
+// Behaviors for the alert rules which send no notification
+const (
+	NotifierlessRulesAllow = "allow"
+	NotifierlessRulesWarn  = "warn"
+	NotifierlessRulesSkip  = "skip"
+)
+
 // zoneInfo names environment variable for setting the path to look for the timezone database in go
 const zoneInfo = "ZONEINFO"
 
@@ -163,6 +183,7 @@ var (
 	AlertingEnabled            bool
 	ExecuteAlerts              bool
 	AlertingRenderLimit        int
+	AlertingRenderTimeout      time.Duration
 	AlertingErrorOrTimeout     string
 	AlertingNoDataOrNullValues string
 
@@ -171,10 +192,77 @@ var (
 	AlertingMaxAttempts         int
 	AlertingMinInterval         int64
 
+	AlertingEvaluationSoftTimeout time.Duration
+
+	AlertingRetryBackoffBase time.Duration
+	AlertingRetryBackoffCap  time.Duration
+	AlertingRetryMaxElapsed  time.Duration
+
+	AlertingResultHandlerWorkers int
+	AlertingTraceSampleRate      float64
+	AlertingShutdownGracePeriod  time.Duration
+	AlertingRuleSelector         string
+
+	AlertingMaxInFlightCost int64
+
+	AlertingNotificationMaxAttempts int
+
+	AlertingNotificationDedupTTL time.Duration
+
+	AlertingNotificationsDisabled bool
+
+	AlertingMaxNotificationsPerMinute int
+
+	AlertingMaxMatchesInNotification int
+
+	AlertingMaxEvalDatapoints int64
+
+	AlertingStartupNotificationDelay time.Duration
+
+	AlertingWarmupPeriod time.Duration
+
+	AlertingEvalLagThreshold float64
+
+	AlertingStaleEvaluationThreshold float64
+
+	AlertingDatasourceHealthThreshold float64
+	AlertingDatasourceHealthLatency   time.Duration
+
+	AlertingEvalOrder string
+
+	AlertingNotifierlessRules string
+
+	AlertingDeletedRuleGracePeriod time.Duration
+
+	AlertingEvalWebhookURL         string
+	AlertingEvalWebhookTimeout     time.Duration
+	AlertingEvalWebhookMaxAttempts int
+
+	AlertingHeartbeatURL      string
+	AlertingHeartbeatInterval time.Duration
+
+	AlertingMetricsPerRule          bool
+	AlertingMetricsPerRuleTag       string
+	AlertingMetricsPerRuleMaxLabels int
+
 	AlertingClusteringEnabled  bool
 	AlertingClusteringInstance string
 	AlertingClusteringTimeout  int64
 
+	AlertingClusteringAssignments      map[string]string
+	AlertingClusteringWeights          map[string]float64
+	AlertingClusteringFallbackInstance string
+	AlertingClusteringFailMode         string
+	AlertingClusteringFailThreshold    int
+
+	AlertingClusteringStandbyBackoff time.Duration
+
+	AlertingFlapDetectionThreshold     int
+	AlertingFlapDetectionWindow        time.Duration
+	AlertingFlapDetectionStabilization time.Duration
+
+	AlertingInhibitRules map[string]string
+
 	// Explore UI
 	ExploreEnabled bool
 
@@ -1332,24 +1420,122 @@ func readRenderingSettings(iniFile *ini.File, cfg *Cfg) error {
 	return nil
 }
 
+// ReadAlertingSettings reads the alerting settings again from the configuration.
+func (cfg *Cfg) ReadAlertingSettings() error {
+	return readAlertingSettings(cfg.Raw)
+}
+
 func readAlertingSettings(iniFile *ini.File) error {
 	alerting := iniFile.Section("alerting")
 	AlertingEnabled = alerting.Key("enabled").MustBool(true)
 	AlertingClusteringEnabled = alerting.Key("clustering_enabled").MustBool(false)
 	AlertingClusteringInstance = alerting.Key("clustering_instance").MustString("localhost")
 	AlertingClusteringTimeout = alerting.Key("clustering_timeout_seconds").MustInt64(300)
+	AlertingClusteringFallbackInstance = alerting.Key("clustering_fallback_instance").MustString("")
+	AlertingClusteringFailMode = alerting.Key("clustering_fail_mode").In(ClusteringFailOpen, []string{ClusteringFailOpen, ClusteringFailClosed})
+	AlertingClusteringFailThreshold = alerting.Key("clustering_fail_threshold").MustInt(3)
+	standbyBackoffSeconds := alerting.Key("clustering_standby_backoff_seconds").MustInt64(10)
+	AlertingClusteringStandbyBackoff = time.Second * time.Duration(standbyBackoffSeconds)
+
+	assignments := iniFile.Section("alerting.clustering_assignments").Keys()
+	AlertingClusteringAssignments = make(map[string]string, len(assignments))
+	for _, key := range assignments {
+		AlertingClusteringAssignments[key.Name()] = key.Value()
+	}
+	weights := iniFile.Section("alerting.clustering_weights").Keys()
+	AlertingClusteringWeights = make(map[string]float64, len(weights))
+	for _, key := range weights {
+		// the engine rejects the weights which aren't positive
+		AlertingClusteringWeights[key.Name()] = key.MustFloat64(0)
+	}
 	ExecuteAlerts = alerting.Key("execute_alerts").MustBool(true)
 	AlertingRenderLimit = alerting.Key("concurrent_render_limit").MustInt(5)
+	renderTimeoutSeconds := alerting.Key("render_timeout_seconds").MustInt64(0)
+	AlertingRenderTimeout = time.Second * time.Duration(renderTimeoutSeconds)
 
 	AlertingErrorOrTimeout = valueAsString(alerting, "error_or_timeout", "alerting")
 	AlertingNoDataOrNullValues = valueAsString(alerting, "nodata_or_nullvalues", "no_data")
 
 	evaluationTimeoutSeconds := alerting.Key("evaluation_timeout_seconds").MustInt64(30)
 	AlertingEvaluationTimeout = time.Second * time.Duration(evaluationTimeoutSeconds)
+	evaluationSoftTimeoutSeconds := alerting.Key("evaluation_soft_timeout_seconds").MustInt64(0)
+	AlertingEvaluationSoftTimeout = time.Second * time.Duration(evaluationSoftTimeoutSeconds)
 	notificationTimeoutSeconds := alerting.Key("notification_timeout_seconds").MustInt64(30)
 	AlertingNotificationTimeout = time.Second * time.Duration(notificationTimeoutSeconds)
 	AlertingMaxAttempts = alerting.Key("max_attempts").MustInt(3)
+	retryBackoffBaseMs := alerting.Key("retry_backoff_base_ms").MustInt64(0)
+	AlertingRetryBackoffBase = time.Millisecond * time.Duration(retryBackoffBaseMs)
+	retryBackoffCapSeconds := alerting.Key("retry_backoff_cap_seconds").MustInt64(30)
+	AlertingRetryBackoffCap = time.Second * time.Duration(retryBackoffCapSeconds)
+	retryMaxElapsedSeconds := alerting.Key("retry_max_elapsed_seconds").MustInt64(0)
+	AlertingRetryMaxElapsed = time.Second * time.Duration(retryMaxElapsedSeconds)
 	AlertingMinInterval = alerting.Key("min_interval_seconds").MustInt64(1)
+	AlertingResultHandlerWorkers = alerting.Key("result_handler_workers").MustInt(0)
+	AlertingTraceSampleRate = alerting.Key("trace_sample_rate").MustFloat64(1)
+	shutdownGracePeriodSeconds := alerting.Key("shutdown_grace_period_seconds").MustInt64(5)
+	AlertingShutdownGracePeriod = time.Second * time.Duration(shutdownGracePeriodSeconds)
+	AlertingRuleSelector = valueAsString(alerting, "rule_selector", "")
+
+	AlertingMaxInFlightCost = alerting.Key("max_in_flight_cost").MustInt64(0)
+
+	AlertingNotificationMaxAttempts = alerting.Key("notification_max_attempts").MustInt(1)
+
+	notificationDedupTTLSeconds := alerting.Key("notification_dedup_ttl_seconds").MustInt64(600)
+	AlertingNotificationDedupTTL = time.Second * time.Duration(notificationDedupTTLSeconds)
+
+	AlertingNotificationsDisabled = alerting.Key("notifications_disabled").MustBool(false)
+
+	AlertingMaxNotificationsPerMinute = alerting.Key("max_notifications_per_minute").MustInt(0)
+
+	AlertingMaxMatchesInNotification = alerting.Key("max_matches_in_notification").MustInt(0)
+
+	AlertingMaxEvalDatapoints = alerting.Key("max_eval_datapoints").MustInt64(0)
+
+	startupNotificationDelaySeconds := alerting.Key("startup_notification_delay_seconds").MustInt64(0)
+	AlertingStartupNotificationDelay = time.Second * time.Duration(startupNotificationDelaySeconds)
+
+	warmupPeriodSeconds := alerting.Key("warmup_period_seconds").MustInt64(0)
+	AlertingWarmupPeriod = time.Second * time.Duration(warmupPeriodSeconds)
+
+	AlertingEvalLagThreshold = alerting.Key("eval_lag_threshold").MustFloat64(0.8)
+
+	AlertingStaleEvaluationThreshold = alerting.Key("stale_evaluation_threshold").MustFloat64(3)
+
+	AlertingDatasourceHealthThreshold = alerting.Key("datasource_health_threshold").MustFloat64(0.5)
+	datasourceHealthLatencySeconds := alerting.Key("datasource_health_latency_seconds").MustInt64(10)
+	AlertingDatasourceHealthLatency = time.Second * time.Duration(datasourceHealthLatencySeconds)
+
+	deletedRuleGracePeriodSeconds := alerting.Key("deleted_rule_grace_period_seconds").MustInt64(300)
+	AlertingDeletedRuleGracePeriod = time.Second * time.Duration(deletedRuleGracePeriodSeconds)
+
+	AlertingEvalOrder = alerting.Key("eval_order").In(EvalOrderByID, []string{EvalOrderByID, EvalOrderByLastError, EvalOrderRandom})
+
+	AlertingNotifierlessRules = alerting.Key("notifierless_rules").In(NotifierlessRulesWarn, []string{NotifierlessRulesAllow, NotifierlessRulesWarn, NotifierlessRulesSkip})
+
+	AlertingEvalWebhookURL = valueAsString(alerting, "eval_webhook_url", "")
+	evalWebhookTimeoutSeconds := alerting.Key("eval_webhook_timeout_seconds").MustInt64(5)
+	AlertingEvalWebhookTimeout = time.Second * time.Duration(evalWebhookTimeoutSeconds)
+	AlertingEvalWebhookMaxAttempts = alerting.Key("eval_webhook_max_attempts").MustInt(3)
+
+	AlertingHeartbeatURL = valueAsString(alerting, "heartbeat_url", "")
+	heartbeatIntervalSeconds := alerting.Key("heartbeat_interval_seconds").MustInt64(60)
+	AlertingHeartbeatInterval = time.Second * time.Duration(heartbeatIntervalSeconds)
+
+	AlertingMetricsPerRule = alerting.Key("metrics_per_rule").MustBool(false)
+	AlertingMetricsPerRuleTag = valueAsString(alerting, "metrics_per_rule_tag", "")
+	AlertingMetricsPerRuleMaxLabels = alerting.Key("metrics_per_rule_max_labels").MustInt(100)
+
+	AlertingFlapDetectionThreshold = alerting.Key("flap_detection_threshold").MustInt(0)
+	flapDetectionWindowSeconds := alerting.Key("flap_detection_window_seconds").MustInt64(3600)
+	AlertingFlapDetectionWindow = time.Second * time.Duration(flapDetectionWindowSeconds)
+	flapDetectionStabilizationSeconds := alerting.Key("flap_detection_stabilization_seconds").MustInt64(1800)
+	AlertingFlapDetectionStabilization = time.Second * time.Duration(flapDetectionStabilizationSeconds)
+
+	inhibitRules := iniFile.Section("alerting.inhibit_rules").Keys()
+	AlertingInhibitRules = make(map[string]string, len(inhibitRules))
+	for _, key := range inhibitRules {
+		AlertingInhibitRules[key.Name()] = key.Value()
+	}
 
 	return nil
 }
@@ -47,6 +47,7 @@ export class AlertRuleListUnconnected extends PureComponent<Props> {
     { label: 'No data', value: 'no_data' },
     { label: 'Paused', value: 'paused' },
     { label: 'Pending', value: 'pending' },
+    { label: 'Config error', value: 'config_error' },
   ];
 
   componentDidMount() {
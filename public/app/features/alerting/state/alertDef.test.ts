@@ -0,0 +1,15 @@
+import alertDef from './alertDef';
+
+describe('getStateDisplayModel', () => {
+  it('should display the rules with a configuration error', () => {
+    expect(alertDef.getStateDisplayModel('config_error')).toEqual({
+      text: 'CONFIG ERROR',
+      iconClass: 'exclamation-triangle',
+      stateClass: 'alert-state-warning',
+    });
+  });
+
+  it('should throw for an unknown state', () => {
+    expect(() => alertDef.getStateDisplayModel('invalid')).toThrow();
+  });
+});
@@ -21,6 +21,7 @@ const alertStateSortScore = {
   alerting: 1,
   firing: 1,
   no_data: 2,
+  config_error: 2,
   pending: 3,
   ok: 4,
   paused: 5,
@@ -61,6 +62,10 @@ const reducerTypes = [
   { text: 'percent_diff()', value: 'percent_diff' },
   { text: 'percent_diff_abs()', value: 'percent_diff_abs' },
   { text: 'count_non_null()', value: 'count_non_null' },
+  { text: 'p50()', value: 'p50' },
+  { text: 'p90()', value: 'p90' },
+  { text: 'p95()', value: 'p95' },
+  { text: 'p99()', value: 'p99' },
 ];
 
 const noDataModes = [
@@ -103,6 +108,13 @@ function getStateDisplayModel(state: string) {
         stateClass: 'alert-state-warning',
       };
     }
+    case 'config_error': {
+      return {
+        text: 'CONFIG ERROR',
+        iconClass: 'exclamation-triangle',
+        stateClass: 'alert-state-warning',
+      };
+    }
     case 'paused': {
       return {
         text: 'PAUSED',